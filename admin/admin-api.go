@@ -0,0 +1,425 @@
+// Package admin is an HTTP/JSON API to look at and control the tasks of a
+// scheduler, for mounting on an existing http.ServeMux.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	manager "github.com/amitiwary999/task-scheduler/manager"
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+)
+
+// Scheduler is what the API needs of a scheduler.TaskScheduler.
+type Scheduler interface {
+	AddNewTask(task model.Task) (string, error)
+	ListTasks(filter model.TaskFilter) ([]model.TaskDetail, error)
+	GetTaskHistory(id string) (*model.TaskHistory, error)
+	CancelTask(id string) (bool, error)
+	RetryTask(id string) error
+	RescheduleTask(id string, executionTime int64) error
+	DeleteTask(id string) error
+	QueueStats() []model.QueueStats
+	CountTasks() ([]model.TaskCount, error)
+	DelayedCount() int
+	Members() ([]model.Member, error)
+	Pauses() ([]model.Pause, error)
+	Pause(scope string, name string) error
+	Resume(scope string, name string) error
+}
+
+// Stats is the state of this server's queues and the task counts of the
+// whole cluster.
+type Stats struct {
+	Queues  []model.QueueStats `json:"queues"`
+	Tasks   []model.TaskCount  `json:"tasks"`
+	Delayed int                `json:"delayed"`
+	Pauses  []model.Pause      `json:"pauses"`
+}
+
+type addTaskResponse struct {
+	Id string `json:"id"`
+}
+
+type rescheduleRequest struct {
+	ExecutionTime int64 `json:"executionTime"`
+	Delay         int64 `json:"delay"`
+}
+
+// Handler serves the API:
+//
+//	GET    /tasks?status=&type=&queue=&from=&to=&limit=&offset=
+//	POST   /tasks                   {"type": "email", "payload": ...}, answers {"id": id}
+//	GET    /tasks/{id}
+//	DELETE /tasks/{id}
+//	POST   /tasks/{id}/cancel
+//	POST   /tasks/{id}/retry
+//	POST   /tasks/{id}/reschedule   {"executionTime": unix} or {"delay": seconds}
+//	GET    /stats
+//	GET    /members
+//	GET    /pauses
+//	POST   /pauses                  {"scope": "queue", "name": "reports"}
+//	DELETE /pauses?scope=&name=
+//
+// from and to take unix seconds or RFC 3339 times. Without WithAuth
+// anyone who can reach the handler may use it. Browsers may not send it
+// POST or DELETE requests from pages of another site either way.
+type Handler struct {
+	scheduler Scheduler
+	allowed   func(r *http.Request) bool
+}
+
+// Option configures a Handler.
+type Option func(h *Handler)
+
+// WithAuth makes the Handler answer 401 to the requests allowed rejects,
+// like ones without the right token or session cookie.
+func WithAuth(allowed func(r *http.Request) bool) Option {
+	return func(h *Handler) {
+		h.allowed = allowed
+	}
+}
+
+// WithBearerToken accepts only requests with "Authorization: Bearer token".
+func WithBearerToken(token string) Option {
+	return WithAuth(BearerToken(token))
+}
+
+// BearerToken is an auth check for WithAuth, and for the dashboard, that
+// accepts requests with "Authorization: Bearer token".
+func BearerToken(token string) func(r *http.Request) bool {
+	want := []byte("Bearer " + token)
+	return func(r *http.Request) bool {
+		return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) == 1
+	}
+}
+
+func NewHandler(scheduler Scheduler, opts ...Option) *Handler {
+	h := &Handler{scheduler: scheduler}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Mount serves the API under prefix, like "/admin", on mux.
+func (h *Handler) Mount(mux *http.ServeMux, prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	mux.Handle(prefix+"/", http.StripPrefix(prefix, h))
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if crossSite(r) {
+		writeError(w, http.StatusForbidden, errors.New("cross-site request"))
+		return
+	}
+	if h.allowed != nil && !h.allowed(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "tasks":
+		switch r.Method {
+		case http.MethodGet:
+			h.listTasks(w, r)
+		case http.MethodPost:
+			h.addTask(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+	case len(parts) == 2 && parts[0] == "tasks":
+		switch r.Method {
+		case http.MethodGet:
+			h.getTask(w, parts[1])
+		case http.MethodDelete:
+			h.deleteTask(w, parts[1])
+		default:
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+	case len(parts) == 3 && parts[0] == "tasks" && parts[2] == "cancel":
+		h.allow(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) { h.cancelTask(w, parts[1]) })
+	case len(parts) == 3 && parts[0] == "tasks" && parts[2] == "retry":
+		h.allow(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) { h.retryTask(w, parts[1]) })
+	case len(parts) == 3 && parts[0] == "tasks" && parts[2] == "reschedule":
+		h.allow(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) { h.rescheduleTask(w, r, parts[1]) })
+	case len(parts) == 1 && parts[0] == "stats":
+		h.allow(w, r, http.MethodGet, h.stats)
+	case len(parts) == 1 && parts[0] == "members":
+		h.allow(w, r, http.MethodGet, h.members)
+	case len(parts) == 1 && parts[0] == "pauses":
+		switch r.Method {
+		case http.MethodGet:
+			h.pauses(w, r)
+		case http.MethodPost:
+			h.pause(w, r)
+		case http.MethodDelete:
+			h.resume(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *Handler) allow(w http.ResponseWriter, r *http.Request, method string, handle http.HandlerFunc) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	handle(w, r)
+}
+
+func (h *Handler) listTasks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := model.TaskFilter{
+		Status: query.Get("status"),
+		Type:   query.Get("type"),
+		Queue:  query.Get("queue"),
+	}
+	var err error
+	if filter.From, err = parseTime(query.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if filter.To, err = parseTime(query.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if filter.Limit, err = parseInt(query.Get("limit")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if filter.Offset, err = parseInt(query.Get("offset")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	tasks, err := h.scheduler.ListTasks(filter)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	if tasks == nil {
+		tasks = []model.TaskDetail{}
+	}
+	writeJson(w, http.StatusOK, tasks)
+}
+
+func (h *Handler) addTask(w http.ResponseWriter, r *http.Request) {
+	var meta model.TaskMeta
+	if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// Only a handler registered for its type can run a task added here.
+	if meta.Type == "" {
+		writeError(w, http.StatusBadRequest, errors.New("task needs a type"))
+		return
+	}
+	id, err := h.scheduler.AddNewTask(model.Task{Meta: meta})
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJson(w, http.StatusCreated, addTaskResponse{Id: id})
+}
+
+func (h *Handler) getTask(w http.ResponseWriter, id string) {
+	history, err := h.scheduler.GetTaskHistory(id)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJson(w, http.StatusOK, history)
+}
+
+func (h *Handler) deleteTask(w http.ResponseWriter, id string) {
+	if err := h.scheduler.DeleteTask(id); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) cancelTask(w http.ResponseWriter, id string) {
+	cancelled, err := h.scheduler.CancelTask(id)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	if !cancelled {
+		if _, err := h.scheduler.GetTaskHistory(id); err != nil {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+		writeError(w, http.StatusConflict, manager.ErrTaskState)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) retryTask(w http.ResponseWriter, id string) {
+	if err := h.scheduler.RetryTask(id); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) rescheduleTask(w http.ResponseWriter, r *http.Request, id string) {
+	var req rescheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	executionTime := req.ExecutionTime
+	if executionTime == 0 {
+		executionTime = time.Now().Unix() + req.Delay
+	}
+	if err := h.scheduler.RescheduleTask(id, executionTime); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.scheduler.CountTasks()
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	pauses, err := h.scheduler.Pauses()
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJson(w, http.StatusOK, Stats{
+		Queues:  h.scheduler.QueueStats(),
+		Tasks:   counts,
+		Delayed: h.scheduler.DelayedCount(),
+		Pauses:  pauses,
+	})
+}
+
+func (h *Handler) members(w http.ResponseWriter, r *http.Request) {
+	members, err := h.scheduler.Members()
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	if members == nil {
+		members = []model.Member{}
+	}
+	writeJson(w, http.StatusOK, members)
+}
+
+func (h *Handler) pauses(w http.ResponseWriter, r *http.Request) {
+	pauses, err := h.scheduler.Pauses()
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	if pauses == nil {
+		pauses = []model.Pause{}
+	}
+	writeJson(w, http.StatusOK, pauses)
+}
+
+func (h *Handler) pause(w http.ResponseWriter, r *http.Request) {
+	var pause model.Pause
+	if err := json.NewDecoder(r.Body).Decode(&pause); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.scheduler.Pause(pause.Scope, pause.Name); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) resume(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if err := h.scheduler.Resume(query.Get("scope"), query.Get("name")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// crossSite reports whether a browser sent a request that changes
+// something from a page of another origin, which a form on any site can
+// do without CORS.
+func crossSite(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site != "same-origin" && site != "none"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != r.Host
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrTaskNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, manager.ErrTaskState):
+		return http.StatusConflict
+	case errors.Is(err, manager.ErrPayloadTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, manager.ErrQueueFull):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, map[string]string{"error": err.Error()})
+}
+
+func parseInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// parseTime reads unix seconds or an RFC 3339 time.
+func parseTime(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return seconds, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
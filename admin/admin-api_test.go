@@ -0,0 +1,343 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	manager "github.com/amitiwary999/task-scheduler/manager"
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// fakeScheduler keeps tasks in a map and records what the API asked of it.
+type fakeScheduler struct {
+	tasks       map[string]*model.TaskDetail
+	logs        map[string][]model.TaskLog
+	filter      model.TaskFilter
+	rescheduled int64
+}
+
+func newFakeScheduler(tasks ...model.TaskDetail) *fakeScheduler {
+	f := &fakeScheduler{tasks: make(map[string]*model.TaskDetail), logs: make(map[string][]model.TaskLog)}
+	for i := range tasks {
+		f.tasks[tasks[i].Id] = &tasks[i]
+	}
+	return f
+}
+
+func (f *fakeScheduler) task(id string, from ...string) (*model.TaskDetail, error) {
+	task, ok := f.tasks[id]
+	if !ok {
+		return nil, storage.ErrTaskNotFound
+	}
+	for _, status := range from {
+		if task.Status == status {
+			return task, nil
+		}
+	}
+	return task, fmt.Errorf("%w: task %v is %v", manager.ErrTaskState, id, task.Status)
+}
+
+func (f *fakeScheduler) AddNewTask(task model.Task) (string, error) {
+	id := fmt.Sprintf("task-%v", len(f.tasks)+1)
+	f.tasks[id] = &model.TaskDetail{Id: id, Meta: task.Meta, Status: util.TASK_STATUS_PENDING}
+	return id, nil
+}
+
+func (f *fakeScheduler) ListTasks(filter model.TaskFilter) ([]model.TaskDetail, error) {
+	f.filter = filter
+	var tasks []model.TaskDetail
+	for _, task := range f.tasks {
+		if filter.Status == "" || task.Status == filter.Status {
+			tasks = append(tasks, *task)
+		}
+	}
+	return tasks, nil
+}
+
+func (f *fakeScheduler) GetTaskHistory(id string) (*model.TaskHistory, error) {
+	task, ok := f.tasks[id]
+	if !ok {
+		return nil, storage.ErrTaskNotFound
+	}
+	return &model.TaskHistory{Task: *task, Logs: f.logs[id]}, nil
+}
+
+func (f *fakeScheduler) CancelTask(id string) (bool, error) {
+	// Like the storage, a cancel that did not happen is not an error.
+	task, err := f.task(id, util.TASK_STATUS_PENDING, util.TASK_STATUS_RUNNING)
+	if err != nil {
+		return false, nil
+	}
+	task.Status = util.TASK_STATUS_CANCELLED
+	return true, nil
+}
+
+func (f *fakeScheduler) RetryTask(id string) error {
+	task, err := f.task(id, util.TASK_STATUS_FAILED, util.TASK_STATUS_CANCELLED)
+	if err != nil {
+		return err
+	}
+	task.Status = util.TASK_STATUS_PENDING
+	task.Attempt++
+	return nil
+}
+
+func (f *fakeScheduler) RescheduleTask(id string, executionTime int64) error {
+	task, err := f.task(id, util.TASK_STATUS_PENDING)
+	if err != nil {
+		return err
+	}
+	task.Meta.ExecutionTime = executionTime
+	f.rescheduled = executionTime
+	return nil
+}
+
+func (f *fakeScheduler) DeleteTask(id string) error {
+	if _, err := f.task(id, util.TASK_STATUS_COMPLETED, util.TASK_STATUS_FAILED, util.TASK_STATUS_CANCELLED); err != nil {
+		return err
+	}
+	delete(f.tasks, id)
+	return nil
+}
+
+func (f *fakeScheduler) QueueStats() []model.QueueStats         { return nil }
+func (f *fakeScheduler) CountTasks() ([]model.TaskCount, error) { return nil, nil }
+func (f *fakeScheduler) DelayedCount() int                      { return 0 }
+func (f *fakeScheduler) Members() ([]model.Member, error)       { return nil, nil }
+func (f *fakeScheduler) Pauses() ([]model.Pause, error)         { return nil, nil }
+func (f *fakeScheduler) Pause(scope string, name string) error  { return nil }
+func (f *fakeScheduler) Resume(scope string, name string) error { return nil }
+
+func serveAdmin(t *testing.T, scheduler Scheduler, opts ...Option) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	NewHandler(scheduler, opts...).Mount(mux, "/admin")
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func call(t *testing.T, server *httptest.Server, method string, path string, body string, header ...string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+"/admin"+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestListTasksParsesTheFilter(t *testing.T) {
+	scheduler := newFakeScheduler(
+		model.TaskDetail{Id: "a", Status: util.TASK_STATUS_FAILED},
+		model.TaskDetail{Id: "b", Status: util.TASK_STATUS_COMPLETED},
+	)
+	server := serveAdmin(t, scheduler)
+
+	resp := call(t, server, http.MethodGet, "/tasks?status=failed&type=report&queue=slow&from=100&to=2024-01-01T00:00:00Z&limit=10&offset=20", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %v, want 200", resp.StatusCode)
+	}
+	var tasks []model.TaskDetail
+	if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Id != "a" {
+		t.Errorf("tasks = %+v, want only a", tasks)
+	}
+	to, _ := time.Parse(time.RFC3339, "2024-01-01T00:00:00Z")
+	want := model.TaskFilter{Status: "failed", Type: "report", Queue: "slow", From: 100, To: to.Unix(), Limit: 10, Offset: 20}
+	if scheduler.filter != want {
+		t.Errorf("filter = %+v, want %+v", scheduler.filter, want)
+	}
+
+	for _, query := range []string{"from=yesterday", "to=soon", "limit=ten", "offset=-x"} {
+		if resp := call(t, server, http.MethodGet, "/tasks?"+query, ""); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%v: status = %v, want 400", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestListTasksReturnsAnEmptyList(t *testing.T) {
+	server := serveAdmin(t, newFakeScheduler())
+	resp := call(t, server, http.MethodGet, "/tasks?status=running", "")
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "[]" {
+		t.Errorf("body = %s, want []", body)
+	}
+}
+
+func TestGetTaskReturnsItsHistory(t *testing.T) {
+	scheduler := newFakeScheduler(model.TaskDetail{Id: "a", Status: util.TASK_STATUS_FAILED, Error: "second"})
+	scheduler.logs["a"] = []model.TaskLog{
+		{TaskId: "a", Attempt: 0, Error: "first"},
+		{TaskId: "a", Attempt: 1, Logs: "retrying\n", Error: "second"},
+	}
+	server := serveAdmin(t, scheduler)
+
+	resp := call(t, server, http.MethodGet, "/tasks/a", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %v, want 200", resp.StatusCode)
+	}
+	var history model.TaskHistory
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+	if history.Task.Id != "a" || len(history.Logs) != 2 || history.Logs[0].Error != "first" || history.Logs[1].Error != "second" {
+		t.Errorf("history = %+v, want a with the error of each attempt", history)
+	}
+}
+
+func TestTaskActions(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status string
+		method string
+		path   string
+		body   string
+		want   int
+		after  string
+	}{
+		{name: "cancel", status: util.TASK_STATUS_PENDING, method: http.MethodPost, path: "/tasks/a/cancel", want: http.StatusNoContent, after: util.TASK_STATUS_CANCELLED},
+		{name: "cancel finished", status: util.TASK_STATUS_COMPLETED, method: http.MethodPost, path: "/tasks/a/cancel", want: http.StatusConflict, after: util.TASK_STATUS_COMPLETED},
+		{name: "cancel missing", status: util.TASK_STATUS_PENDING, method: http.MethodPost, path: "/tasks/b/cancel", want: http.StatusNotFound, after: util.TASK_STATUS_PENDING},
+		{name: "retry", status: util.TASK_STATUS_FAILED, method: http.MethodPost, path: "/tasks/a/retry", want: http.StatusNoContent, after: util.TASK_STATUS_PENDING},
+		{name: "retry running", status: util.TASK_STATUS_RUNNING, method: http.MethodPost, path: "/tasks/a/retry", want: http.StatusConflict, after: util.TASK_STATUS_RUNNING},
+		{name: "retry missing", status: util.TASK_STATUS_FAILED, method: http.MethodPost, path: "/tasks/b/retry", want: http.StatusNotFound, after: util.TASK_STATUS_FAILED},
+		{name: "reschedule", status: util.TASK_STATUS_PENDING, method: http.MethodPost, path: "/tasks/a/reschedule", body: `{"executionTime": 2000000000}`, want: http.StatusNoContent, after: util.TASK_STATUS_PENDING},
+		{name: "reschedule failed", status: util.TASK_STATUS_FAILED, method: http.MethodPost, path: "/tasks/a/reschedule", body: `{"delay": 60}`, want: http.StatusConflict, after: util.TASK_STATUS_FAILED},
+		{name: "reschedule bad body", status: util.TASK_STATUS_PENDING, method: http.MethodPost, path: "/tasks/a/reschedule", body: `soon`, want: http.StatusBadRequest, after: util.TASK_STATUS_PENDING},
+		{name: "delete", status: util.TASK_STATUS_COMPLETED, method: http.MethodDelete, path: "/tasks/a", want: http.StatusNoContent},
+		{name: "delete running", status: util.TASK_STATUS_RUNNING, method: http.MethodDelete, path: "/tasks/a", want: http.StatusConflict, after: util.TASK_STATUS_RUNNING},
+		{name: "get missing", status: util.TASK_STATUS_PENDING, method: http.MethodGet, path: "/tasks/b", want: http.StatusNotFound, after: util.TASK_STATUS_PENDING},
+		{name: "wrong method", status: util.TASK_STATUS_PENDING, method: http.MethodGet, path: "/tasks/a/cancel", want: http.StatusMethodNotAllowed, after: util.TASK_STATUS_PENDING},
+		{name: "unknown path", status: util.TASK_STATUS_PENDING, method: http.MethodGet, path: "/tasks/a/logs", want: http.StatusNotFound, after: util.TASK_STATUS_PENDING},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			scheduler := newFakeScheduler(model.TaskDetail{Id: "a", Status: tc.status})
+			server := serveAdmin(t, scheduler)
+
+			resp := call(t, server, tc.method, tc.path, tc.body)
+			if resp.StatusCode != tc.want {
+				t.Fatalf("status = %v, want %v", resp.StatusCode, tc.want)
+			}
+			if tc.want >= http.StatusBadRequest {
+				var body map[string]string
+				if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body["error"] == "" {
+					t.Errorf("body = %v, %v, want an error", body, err)
+				}
+			}
+			task, ok := scheduler.tasks["a"]
+			switch {
+			case tc.after == "" && ok:
+				t.Errorf("task is %v, want it deleted", task.Status)
+			case tc.after != "" && (!ok || task.Status != tc.after):
+				t.Errorf("task = %+v, want it %v", task, tc.after)
+			}
+		})
+	}
+}
+
+func TestRescheduleTakesADelay(t *testing.T) {
+	scheduler := newFakeScheduler(model.TaskDetail{Id: "a", Status: util.TASK_STATUS_PENDING})
+	server := serveAdmin(t, scheduler)
+
+	before := time.Now().Unix()
+	if resp := call(t, server, http.MethodPost, "/tasks/a/reschedule", `{"delay": 60}`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %v, want 204", resp.StatusCode)
+	}
+	if scheduler.rescheduled < before+60 || scheduler.rescheduled > time.Now().Unix()+60 {
+		t.Errorf("rescheduled to %v, want 60 seconds from %v", scheduler.rescheduled, before)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	server := serveAdmin(t, newFakeScheduler(model.TaskDetail{Id: "a", Status: util.TASK_STATUS_FAILED}), WithBearerToken("secret"))
+	for _, tc := range []struct {
+		name   string
+		header []string
+		want   int
+	}{
+		{"no token", nil, http.StatusUnauthorized},
+		{"wrong token", []string{"Authorization", "Bearer guess"}, http.StatusUnauthorized},
+		{"not bearer", []string{"Authorization", "Basic secret"}, http.StatusUnauthorized},
+		{"token", []string{"Authorization", "Bearer secret"}, http.StatusNoContent},
+	} {
+		resp := call(t, server, http.MethodPost, "/tasks/a/retry", "", tc.header...)
+		if resp.StatusCode != tc.want {
+			t.Errorf("%v: status = %v, want %v", tc.name, resp.StatusCode, tc.want)
+		}
+		if tc.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("%v: WWW-Authenticate = %q, want Bearer", tc.name, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestCrossSiteRequestsAreRefused(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		method string
+		header []string
+		want   int
+	}{
+		{"cross-site post", http.MethodPost, []string{"Sec-Fetch-Site", "cross-site"}, http.StatusForbidden},
+		{"same-site post", http.MethodPost, []string{"Sec-Fetch-Site", "same-site"}, http.StatusForbidden},
+		{"post from another origin", http.MethodPost, []string{"Origin", "http://evil.example"}, http.StatusForbidden},
+		{"same-origin post", http.MethodPost, []string{"Sec-Fetch-Site", "same-origin"}, http.StatusNoContent},
+		{"post without a browser", http.MethodPost, nil, http.StatusNoContent},
+		{"cross-site get", http.MethodGet, []string{"Sec-Fetch-Site", "cross-site"}, http.StatusOK},
+	} {
+		server := serveAdmin(t, newFakeScheduler(model.TaskDetail{Id: "a", Status: util.TASK_STATUS_FAILED}))
+		path := "/tasks/a/retry"
+		if tc.method == http.MethodGet {
+			path = "/tasks/a"
+		}
+		if resp := call(t, server, tc.method, path, "", tc.header...); resp.StatusCode != tc.want {
+			t.Errorf("%v: status = %v, want %v", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+	// The dashboard calls the API from the same origin.
+	server := serveAdmin(t, newFakeScheduler(model.TaskDetail{Id: "a", Status: util.TASK_STATUS_FAILED}))
+	if resp := call(t, server, http.MethodPost, "/tasks/a/retry", "", "Origin", server.URL); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("same-origin post = %v, want 204", resp.StatusCode)
+	}
+}
+
+func TestClientAddsTasksWithItsToken(t *testing.T) {
+	scheduler := newFakeScheduler()
+	server := serveAdmin(t, scheduler, WithBearerToken("secret"))
+	client := NewClient(server.URL+"/admin", server.Client())
+
+	if _, err := client.AddTask(model.TaskMeta{Type: "email"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("AddTask without the token = %v, want a 401", err)
+	}
+	client.SetToken("secret")
+	id, err := client.AddTask(model.TaskMeta{Type: "email", Queue: "mail"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task := scheduler.tasks[id]; task == nil || task.Meta.Type != "email" || task.Meta.Queue != "mail" {
+		t.Errorf("task %v = %+v, want the email task", id, task)
+	}
+	if _, err := client.AddTask(model.TaskMeta{}); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("AddTask without a type = %v, want a 400", err)
+	}
+}
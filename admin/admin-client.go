@@ -0,0 +1,184 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	manager "github.com/amitiwary999/task-scheduler/manager"
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+)
+
+// Client calls the API of a Handler mounted at baseUrl, like
+// "http://localhost:8081/admin". Errors the API answers with 404 and 409
+// wrap storage.ErrTaskNotFound and manager.ErrTaskState.
+type Client struct {
+	httpClient *http.Client
+	baseUrl    string
+	token      string
+}
+
+func NewClient(baseUrl string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{httpClient: httpClient, baseUrl: strings.TrimSuffix(baseUrl, "/")}
+}
+
+// SetToken sends token as a bearer token with every call, for a Handler
+// configured WithBearerToken.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// AddTask adds a task with meta and returns its id.
+func (c *Client) AddTask(meta model.TaskMeta) (string, error) {
+	var resp addTaskResponse
+	err := c.request(http.MethodPost, "/tasks", meta, &resp)
+	return resp.Id, err
+}
+
+func (c *Client) ListTasks(filter model.TaskFilter) ([]model.TaskDetail, error) {
+	query := url.Values{}
+	setQuery(query, "status", filter.Status)
+	setQuery(query, "type", filter.Type)
+	setQuery(query, "queue", filter.Queue)
+	if filter.From != 0 {
+		query.Set("from", strconv.FormatInt(filter.From, 10))
+	}
+	if filter.To != 0 {
+		query.Set("to", strconv.FormatInt(filter.To, 10))
+	}
+	if filter.Limit != 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	if filter.Offset != 0 {
+		query.Set("offset", strconv.Itoa(filter.Offset))
+	}
+	var tasks []model.TaskDetail
+	err := c.request(http.MethodGet, "/tasks?"+query.Encode(), nil, &tasks)
+	return tasks, err
+}
+
+func (c *Client) GetTaskHistory(id string) (*model.TaskHistory, error) {
+	var history model.TaskHistory
+	if err := c.request(http.MethodGet, "/tasks/"+url.PathEscape(id), nil, &history); err != nil {
+		return nil, err
+	}
+	return &history, nil
+}
+
+// CancelTask returns false when the task had already finished.
+func (c *Client) CancelTask(id string) (bool, error) {
+	err := c.request(http.MethodPost, "/tasks/"+url.PathEscape(id)+"/cancel", nil, nil)
+	if errors.Is(err, manager.ErrTaskState) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *Client) RetryTask(id string) error {
+	return c.request(http.MethodPost, "/tasks/"+url.PathEscape(id)+"/retry", nil, nil)
+}
+
+func (c *Client) RescheduleTask(id string, executionTime int64) error {
+	return c.request(http.MethodPost, "/tasks/"+url.PathEscape(id)+"/reschedule", rescheduleRequest{ExecutionTime: executionTime}, nil)
+}
+
+func (c *Client) DeleteTask(id string) error {
+	return c.request(http.MethodDelete, "/tasks/"+url.PathEscape(id), nil, nil)
+}
+
+func (c *Client) Stats() (*Stats, error) {
+	var stats Stats
+	if err := c.request(http.MethodGet, "/stats", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (c *Client) Members() ([]model.Member, error) {
+	var members []model.Member
+	err := c.request(http.MethodGet, "/members", nil, &members)
+	return members, err
+}
+
+func (c *Client) Pauses() ([]model.Pause, error) {
+	var pauses []model.Pause
+	err := c.request(http.MethodGet, "/pauses", nil, &pauses)
+	return pauses, err
+}
+
+func (c *Client) Pause(scope string, name string) error {
+	return c.request(http.MethodPost, "/pauses", model.Pause{Scope: scope, Name: name}, nil)
+}
+
+func (c *Client) Resume(scope string, name string) error {
+	query := url.Values{"scope": {scope}, "name": {name}}
+	return c.request(http.MethodDelete, "/pauses?"+query.Encode(), nil, nil)
+}
+
+func (c *Client) request(method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), method, c.baseUrl+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			message = apiErr.Error
+		}
+		switch {
+		case resp.StatusCode == http.StatusNotFound && strings.Contains(message, storage.ErrTaskNotFound.Error()):
+			return fmt.Errorf("%w: %v %v", storage.ErrTaskNotFound, method, path)
+		case resp.StatusCode == http.StatusConflict:
+			return fmt.Errorf("%w: %v", manager.ErrTaskState, message)
+		}
+		return fmt.Errorf("admin %v %v failed with status %v: %v", method, path, resp.StatusCode, message)
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func setQuery(query url.Values, key string, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
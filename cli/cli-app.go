@@ -0,0 +1,190 @@
+// Package cli is the taskscheduler command. It works on the tasks of a
+// cluster straight through storage, or through the admin API of a running
+// server, and serve runs a server. Build your own command around App to
+// give serve the handlers of your task types.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	admin "github.com/amitiwary999/task-scheduler/admin"
+	scheduler "github.com/amitiwary999/task-scheduler/scheduler"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+var errUsage = errors.New("usage")
+
+// App runs the command. Setup, when set, is called by serve before the
+// scheduler starts, to register handlers, queues and hooks. Storage, when
+// set, is used instead of connecting to Postgres or Supabase.
+type App struct {
+	Setup   func(tsk *scheduler.TaskScheduler) error
+	Storage util.StorageClient
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(env *env, args []string) error
+}
+
+var commands = []command{
+	{"migrate", "migrate", "create or update the scheduler's tables", runMigrate},
+	{"serve", "serve [flags]", "run a server with the admin API and dashboard", runServe},
+	{"enqueue", "enqueue -type TYPE [flags]", "add a task", runEnqueue},
+	{"list", "list [flags]", "list tasks", runList},
+	{"inspect", "inspect ID", "show a task with its logs and children", runInspect},
+	{"cancel", "cancel ID...", "cancel tasks and their children", runCancel},
+	{"retry", "retry ID...", "run failed or cancelled tasks again", runRetry},
+	{"dlq", "dlq list|replay [flags]", "list or replay tasks that failed for good", runDlq},
+	{"pause", "pause scheduler | pause queue NAME | pause type NAME", "stop starting tasks", runPause},
+	{"resume", "resume scheduler | resume queue NAME | resume type NAME", "start tasks again", runResume},
+	{"stats", "stats", "show task counts, queues and pauses", runStats},
+	{"purge", "purge -older-than DURATION [flags]", "delete finished tasks", runPurge},
+}
+
+// env is what a command runs with: the global flags and the output.
+type env struct {
+	app          *App
+	out          *printer
+	postgresUrl  string
+	poolLimit    int
+	supabaseUrl  string
+	supabaseKey  string
+	supabaseAuth string
+	adminUrl     string
+	adminToken   string
+	// given are the global flags set on the command line.
+	given map[string]bool
+}
+
+// Run runs the command line args, without the program name, and returns
+// the exit code: 0 on success, 1 on errors and 2 on bad usage.
+func (a *App) Run(args []string) int {
+	if a.Stdout == nil {
+		a.Stdout = os.Stdout
+	}
+	if a.Stderr == nil {
+		a.Stderr = os.Stderr
+	}
+	env := &env{app: a}
+	var output string
+	flags := flag.NewFlagSet("taskscheduler", flag.ContinueOnError)
+	flags.SetOutput(a.Stderr)
+	flags.StringVar(&env.postgresUrl, "postgres", os.Getenv("POSTGRES_URL"), "postgres connection url ($POSTGRES_URL)")
+	flags.IntVar(&env.poolLimit, "pool", envInt("POSTGRES_POOL_LIMIT", 5), "postgres connection pool size ($POSTGRES_POOL_LIMIT)")
+	flags.StringVar(&env.supabaseUrl, "supabase-url", os.Getenv("SUPABASE_URL"), "supabase rest url, instead of postgres ($SUPABASE_URL)")
+	flags.StringVar(&env.supabaseAuth, "supabase-auth", os.Getenv("SUPABASE_AUTH"), "supabase auth token ($SUPABASE_AUTH)")
+	flags.StringVar(&env.supabaseKey, "supabase-key", os.Getenv("SUPABASE_KEY"), "supabase api key ($SUPABASE_KEY)")
+	flags.StringVar(&env.adminUrl, "admin", os.Getenv("TASKSCHEDULER_ADMIN_URL"), "admin api url of a running server, instead of storage ($TASKSCHEDULER_ADMIN_URL)")
+	flags.StringVar(&env.adminToken, "token", os.Getenv("TASKSCHEDULER_ADMIN_TOKEN"), "bearer token of the admin api, which serve requires when set ($TASKSCHEDULER_ADMIN_TOKEN)")
+	flags.StringVar(&output, "o", "table", "output format: table or json")
+	flags.Usage = func() { a.usage(flags) }
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	env.given = make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { env.given[f.Name] = true })
+	if output != "table" && output != "json" {
+		fmt.Fprintf(a.Stderr, "unknown output format %q\n", output)
+		return 2
+	}
+	env.out = &printer{w: a.Stdout, json: output == "json"}
+	if flags.NArg() == 0 {
+		a.usage(flags)
+		return 2
+	}
+	name, args := flags.Arg(0), flags.Args()[1:]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(env, args)
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, errUsage):
+			fmt.Fprintf(a.Stderr, "usage: taskscheduler %v\n", cmd.usage)
+			return 2
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		default:
+			fmt.Fprintf(a.Stderr, "taskscheduler %v: %v\n", name, err)
+			return 1
+		}
+	}
+	fmt.Fprintf(a.Stderr, "unknown command %q\n", name)
+	a.usage(flags)
+	return 2
+}
+
+func (a *App) usage(flags *flag.FlagSet) {
+	fmt.Fprintf(a.Stderr, "usage: taskscheduler [flags] command [args]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(a.Stderr, "  %-8v %v\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(a.Stderr, "\nflags:\n")
+	flags.PrintDefaults()
+}
+
+// storage connects to Supabase when its url is set and to Postgres
+// otherwise.
+func (e *env) storage() (util.StorageClient, error) {
+	if e.app.Storage != nil {
+		return e.app.Storage, nil
+	}
+	if e.supabaseUrl != "" {
+		return storage.NewSupabaseClient(e.supabaseUrl, e.supabaseAuth, e.supabaseKey)
+	}
+	if e.postgresUrl == "" {
+		return nil, errors.New("set -postgres or -supabase-url, or POSTGRES_URL or SUPABASE_URL")
+	}
+	return storage.NewPostgresClient(e.postgresUrl, int16(e.poolLimit))
+}
+
+// backend goes through the admin API when its url is set and straight to
+// storage otherwise.
+func (e *env) backend() (backend, error) {
+	if e.adminUrl != "" {
+		client := admin.NewClient(e.adminUrl, nil)
+		client.SetToken(e.adminToken)
+		return client, nil
+	}
+	client, err := e.storage()
+	if err != nil {
+		return nil, err
+	}
+	return &storageBackend{storage: client}, nil
+}
+
+func (e *env) flags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(e.app.Stderr)
+	return flags
+}
+
+func envInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
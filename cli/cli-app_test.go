@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	storage "github.com/amitiwary999/task-scheduler/storage"
+)
+
+// run runs args with a fresh environment and returns the exit code and
+// what the command wrote.
+func run(t *testing.T, app *App, args ...string) (int, string, string) {
+	t.Helper()
+	for _, key := range []string{"POSTGRES_URL", "SUPABASE_URL", "TASKSCHEDULER_ADMIN_URL", "TASKSCHEDULER_ADMIN_TOKEN"} {
+		t.Setenv(key, "")
+	}
+	var stdout, stderr bytes.Buffer
+	app.Stdout = &stdout
+	app.Stderr = &stderr
+	code := app.Run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunRejectsBadUsage(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		code   int
+		stderr string
+	}{
+		{name: "no command", args: nil, code: 2, stderr: "usage: taskscheduler [flags] command"},
+		{name: "unknown command", args: []string{"frobnicate"}, code: 2, stderr: `unknown command "frobnicate"`},
+		{name: "unknown flag", args: []string{"-verbose", "list"}, code: 2, stderr: "flag provided but not defined"},
+		{name: "unknown output", args: []string{"-o", "yaml", "list"}, code: 2, stderr: `unknown output format "yaml"`},
+		{name: "enqueue without a type", args: []string{"enqueue"}, code: 2, stderr: "usage: taskscheduler enqueue"},
+		{name: "enqueue with delay and at", args: []string{"enqueue", "-type", "email", "-delay", "1m", "-at", "1700000000"}, code: 2, stderr: "usage: taskscheduler enqueue"},
+		{name: "enqueue a bad payload", args: []string{"enqueue", "-type", "email", "-payload", "{to"}, code: 1, stderr: "payload is not valid JSON"},
+		{name: "enqueue a bad time", args: []string{"enqueue", "-type", "email", "-at", "tomorrow"}, code: 1, stderr: "taskscheduler enqueue:"},
+		{name: "inspect without an id", args: []string{"inspect"}, code: 2, stderr: "usage: taskscheduler inspect ID"},
+		{name: "cancel without ids", args: []string{"cancel"}, code: 2, stderr: "usage: taskscheduler cancel"},
+		{name: "dlq without a verb", args: []string{"dlq"}, code: 2, stderr: "usage: taskscheduler dlq"},
+		{name: "pause an unknown scope", args: []string{"pause", "server", "a"}, code: 2, stderr: "usage: taskscheduler pause"},
+		{name: "purge without an age", args: []string{"purge"}, code: 2, stderr: "usage: taskscheduler purge"},
+		{name: "help", args: []string{"list", "-h"}, code: 0, stderr: "-status"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, stderr := run(t, &App{Storage: storage.NewMemoryStorage()}, tc.args...)
+			if code != tc.code || !strings.Contains(stderr, tc.stderr) {
+				t.Errorf("exit %v with %q, want %v with %q", code, stderr, tc.code, tc.stderr)
+			}
+		})
+	}
+}
+
+func TestRunNeedsStorage(t *testing.T) {
+	code, _, stderr := run(t, &App{}, "list")
+	if code != 1 || !strings.Contains(stderr, "set -postgres or -supabase-url") {
+		t.Errorf("exit %v with %q, want 1 asking for storage", code, stderr)
+	}
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	admin "github.com/amitiwary999/task-scheduler/admin"
+	manager "github.com/amitiwary999/task-scheduler/manager"
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// backend is what the commands need, from either the admin API or storage.
+type backend interface {
+	AddTask(meta model.TaskMeta) (string, error)
+	ListTasks(filter model.TaskFilter) ([]model.TaskDetail, error)
+	GetTaskHistory(id string) (*model.TaskHistory, error)
+	CancelTask(id string) (bool, error)
+	RetryTask(id string) error
+	DeleteTask(id string) error
+	Stats() (*admin.Stats, error)
+	Pause(scope string, name string) error
+	Resume(scope string, name string) error
+}
+
+var _ backend = (*admin.Client)(nil)
+
+// storageBackend does what a server would, straight in storage. Servers of
+// the cluster pick up retried tasks when they next claim pending tasks.
+type storageBackend struct {
+	storage util.StorageClient
+}
+
+// AddTask saves the task for a server of the cluster to claim.
+func (b *storageBackend) AddTask(meta model.TaskMeta) (string, error) {
+	return b.storage.SaveTask(&meta)
+}
+
+func (b *storageBackend) ListTasks(filter model.TaskFilter) ([]model.TaskDetail, error) {
+	return b.storage.ListTasks(filter)
+}
+
+func (b *storageBackend) GetTaskHistory(id string) (*model.TaskHistory, error) {
+	task, err := b.storage.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := b.storage.GetTaskLogs(id)
+	if err != nil {
+		return nil, err
+	}
+	children, err := b.storage.GetChildTasks(id)
+	if err != nil {
+		return nil, err
+	}
+	return &model.TaskHistory{Task: *task, Logs: logs, Children: children}, nil
+}
+
+func (b *storageBackend) CancelTask(id string) (bool, error) {
+	if _, err := b.storage.GetTask(id); err != nil {
+		return false, err
+	}
+	cancelled, err := b.storage.CancelTask(id)
+	if err != nil {
+		return false, err
+	}
+	children, err := b.storage.GetChildTasks(id)
+	if err != nil {
+		return cancelled, err
+	}
+	for _, child := range children {
+		if child.Status != util.TASK_STATUS_PENDING && child.Status != util.TASK_STATUS_RUNNING {
+			continue
+		}
+		if _, err := b.CancelTask(child.Id); err != nil {
+			return cancelled, err
+		}
+	}
+	return cancelled, nil
+}
+
+func (b *storageBackend) RetryTask(id string) error {
+	task, err := b.storage.GetTask(id)
+	if err != nil {
+		return err
+	}
+	if task.Meta.Type == "" {
+		return fmt.Errorf("%w: task %v has no type", manager.ErrTaskState, id)
+	}
+	replayed, err := b.storage.ReplayTask(id, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if !replayed {
+		return fmt.Errorf("%w: task %v is %v", manager.ErrTaskState, id, task.Status)
+	}
+	return nil
+}
+
+func (b *storageBackend) DeleteTask(id string) error {
+	task, err := b.storage.GetTask(id)
+	if err != nil {
+		return err
+	}
+	deleted, err := b.storage.DeleteTask(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w: task %v is %v", manager.ErrTaskState, id, task.Status)
+	}
+	return nil
+}
+
+// Stats has no queues: those live in the memory of each server.
+func (b *storageBackend) Stats() (*admin.Stats, error) {
+	counts, err := b.storage.CountTasks()
+	if err != nil {
+		return nil, err
+	}
+	pauses, err := b.storage.GetPauses()
+	if err != nil {
+		return nil, err
+	}
+	return &admin.Stats{Tasks: counts, Pauses: pauses}, nil
+}
+
+func (b *storageBackend) Pause(scope string, name string) error {
+	return b.storage.SetPause(model.Pause{Scope: scope, Name: name}, true)
+}
+
+func (b *storageBackend) Resume(scope string, name string) error {
+	return b.storage.SetPause(model.Pause{Scope: scope, Name: name}, false)
+}
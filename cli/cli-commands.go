@@ -0,0 +1,517 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// result is what happened to one task of a command working on several.
+type result struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func runMigrate(env *env, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	client, err := env.storage()
+	if err != nil {
+		return err
+	}
+	migrator, ok := client.(interface{ Migrate() error })
+	if !ok {
+		return errors.New("only postgres can be migrated, create the supabase tables yourself")
+	}
+	if err := migrator.Migrate(); err != nil {
+		return err
+	}
+	return env.out.print(result{Status: "migrated"}, func(t *tabwriter.Writer) {
+		row(t, "migrated")
+	})
+}
+
+func runEnqueue(env *env, args []string) error {
+	var meta model.TaskMeta
+	var payload, payloadFile, at string
+	var delay time.Duration
+	flags := env.flags("enqueue")
+	flags.StringVar(&meta.Type, "type", "", "task type")
+	flags.StringVar(&meta.MetaId, "meta-id", "", "meta id")
+	flags.StringVar(&meta.Queue, "queue", "", "queue")
+	flags.StringVar(&payload, "payload", "", "JSON payload")
+	flags.StringVar(&payloadFile, "payload-file", "", "file with the JSON payload, - for stdin")
+	flags.DurationVar(&delay, "delay", 0, "run after this long, like 10m")
+	flags.StringVar(&at, "at", "", "run at this time, RFC 3339 or unix seconds")
+	flags.IntVar(&meta.MaxRetry, "max-retry", 0, "retries after a failure")
+	flags.IntVar(&meta.RetryDelay, "retry-delay", 0, "seconds before the first retry")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if meta.Type == "" || flags.NArg() != 0 || (payload != "" && payloadFile != "") || (delay != 0 && at != "") {
+		flags.PrintDefaults()
+		return errUsage
+	}
+	if payloadFile != "" {
+		var data []byte
+		var err error
+		if payloadFile == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(payloadFile)
+		}
+		if err != nil {
+			return err
+		}
+		payload = string(data)
+	}
+	if payload != "" {
+		if !json.Valid([]byte(payload)) {
+			return errors.New("payload is not valid JSON")
+		}
+		meta.Codec = util.CODEC_JSON
+		meta.Payload = []byte(payload)
+	}
+	switch {
+	case delay > 0:
+		meta.ExecutionTime = time.Now().Add(delay).Unix()
+	case at != "":
+		executionTime, err := parseTime(at)
+		if err != nil {
+			return err
+		}
+		meta.ExecutionTime = executionTime
+	}
+	b, err := env.backend()
+	if err != nil {
+		return err
+	}
+	id, err := b.AddTask(meta)
+	if err != nil {
+		return err
+	}
+	return env.out.print(result{Id: id, Status: util.TASK_STATUS_PENDING}, func(t *tabwriter.Writer) {
+		row(t, id)
+	})
+}
+
+func runList(env *env, args []string) error {
+	var filter model.TaskFilter
+	var from, to string
+	flags := env.flags("list")
+	flags.StringVar(&filter.Status, "status", "", "pending, running, completed, failed or cancelled")
+	flags.StringVar(&filter.Type, "type", "", "task type")
+	flags.StringVar(&filter.Queue, "queue", "", "queue")
+	flags.StringVar(&from, "from", "", "created at or after, RFC 3339, unix seconds or a duration ago like 24h")
+	flags.StringVar(&to, "to", "", "created before, like -from")
+	flags.IntVar(&filter.Limit, "limit", util.DEFAULT_LIST_LIMIT, "tasks to list")
+	flags.IntVar(&filter.Offset, "offset", 0, "tasks to skip")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errUsage
+	}
+	var err error
+	if filter.From, err = parseTime(from); err != nil {
+		return err
+	}
+	if filter.To, err = parseTime(to); err != nil {
+		return err
+	}
+	b, err := env.backend()
+	if err != nil {
+		return err
+	}
+	tasks, err := b.ListTasks(filter)
+	if err != nil {
+		return err
+	}
+	if tasks == nil {
+		tasks = []model.TaskDetail{}
+	}
+	return env.out.print(tasks, func(t *tabwriter.Writer) {
+		taskTable(t, tasks)
+	})
+}
+
+func runInspect(env *env, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	b, err := env.backend()
+	if err != nil {
+		return err
+	}
+	history, err := b.GetTaskHistory(args[0])
+	if err != nil {
+		return err
+	}
+	return env.out.print(history, func(t *tabwriter.Writer) {
+		task := history.Task
+		row(t, "id", task.Id)
+		row(t, "type", task.Meta.Type)
+		row(t, "queue", queueName(task.Meta.Queue))
+		row(t, "status", task.Status)
+		row(t, "attempt", task.Attempt)
+		row(t, "max retry", task.Meta.MaxRetry)
+		row(t, "created", formatTime(task.CreatedAt))
+		row(t, "runs at", formatTime(task.Meta.ExecutionTime))
+		row(t, "parent", task.Meta.ParentId)
+		row(t, "workflow", task.Meta.WorkflowId)
+		row(t, "batch", task.Meta.BatchId)
+		row(t, "payload", string(task.Meta.Payload))
+		row(t, "error", task.Error)
+		for _, log := range history.Logs {
+			fmt.Fprintf(t, "\nattempt %v, %v\n%v", log.Attempt, formatTime(log.CreatedAt), log.Logs)
+		}
+		if len(history.Children) > 0 {
+			fmt.Fprintln(t, "\nchildren")
+			taskTable(t, history.Children)
+		}
+	})
+}
+
+func runCancel(env *env, args []string) error {
+	return eachId(env, args, func(b backend, id string) (string, error) {
+		cancelled, err := b.CancelTask(id)
+		if err != nil {
+			return "", err
+		}
+		if !cancelled {
+			return "already finished", nil
+		}
+		return util.TASK_STATUS_CANCELLED, nil
+	})
+}
+
+func runRetry(env *env, args []string) error {
+	return eachId(env, args, func(b backend, id string) (string, error) {
+		if err := b.RetryTask(id); err != nil {
+			return "", err
+		}
+		return "retried", nil
+	})
+}
+
+// eachId runs do on every id and reports how each went. It fails if any
+// of them failed.
+func eachId(env *env, ids []string, do func(b backend, id string) (string, error)) error {
+	if len(ids) == 0 {
+		return errUsage
+	}
+	b, err := env.backend()
+	if err != nil {
+		return err
+	}
+	results := make([]result, len(ids))
+	failed := 0
+	for i, id := range ids {
+		results[i].Id = id
+		status, err := do(b, id)
+		if err != nil {
+			results[i].Status = "error"
+			results[i].Error = err.Error()
+			failed++
+			continue
+		}
+		results[i].Status = status
+	}
+	if err := env.out.print(results, func(t *tabwriter.Writer) {
+		resultTable(t, results)
+	}); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v of %v tasks failed", failed, len(ids))
+	}
+	return nil
+}
+
+// runDlq works on failed tasks: a task is only failed once it used all its
+// retries, so those are the dead letters.
+func runDlq(env *env, args []string) error {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "replay") {
+		return errUsage
+	}
+	replay := args[0] == "replay"
+	filter := model.TaskFilter{Status: util.TASK_STATUS_FAILED}
+	var limit int
+	var dryRun bool
+	flags := env.flags("dlq " + args[0])
+	flags.StringVar(&filter.Type, "type", "", "task type")
+	flags.StringVar(&filter.Queue, "queue", "", "queue")
+	flags.IntVar(&limit, "limit", 0, "most tasks to list or replay, 0 for all")
+	if replay {
+		flags.BoolVar(&dryRun, "dry-run", false, "list what would be replayed")
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errUsage
+	}
+	b, err := env.backend()
+	if err != nil {
+		return err
+	}
+	if !replay {
+		var tasks []model.TaskDetail
+		if _, err := eachTask(b, filter, limit, func(task model.TaskDetail) (bool, error) {
+			tasks = append(tasks, task)
+			return false, nil
+		}); err != nil {
+			return err
+		}
+		if tasks == nil {
+			tasks = []model.TaskDetail{}
+		}
+		return env.out.print(tasks, func(t *tabwriter.Writer) {
+			taskTable(t, tasks)
+		})
+	}
+	results := []result{}
+	failed := 0
+	_, err = eachTask(b, filter, limit, func(task model.TaskDetail) (bool, error) {
+		if dryRun {
+			results = append(results, result{Id: task.Id, Status: "would replay"})
+			return false, nil
+		}
+		if err := b.RetryTask(task.Id); err != nil {
+			results = append(results, result{Id: task.Id, Status: "error", Error: err.Error()})
+			failed++
+			return false, nil
+		}
+		results = append(results, result{Id: task.Id, Status: "replayed"})
+		return true, nil
+	})
+	if printErr := env.out.print(results, func(t *tabwriter.Writer) {
+		resultTable(t, results)
+	}); printErr != nil {
+		return printErr
+	}
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("%v of %v tasks could not be replayed", failed, len(results))
+	}
+	return err
+}
+
+func runPause(env *env, args []string) error {
+	return setPause(env, args, true)
+}
+
+func runResume(env *env, args []string) error {
+	return setPause(env, args, false)
+}
+
+func setPause(env *env, args []string, paused bool) error {
+	var pause model.Pause
+	switch {
+	case len(args) == 1 && args[0] == util.PAUSE_SCOPE_SCHEDULER:
+		pause.Scope = util.PAUSE_SCOPE_SCHEDULER
+	case len(args) == 2 && (args[0] == util.PAUSE_SCOPE_QUEUE || args[0] == util.PAUSE_SCOPE_TYPE) && args[1] != "":
+		pause.Scope, pause.Name = args[0], args[1]
+	default:
+		return errUsage
+	}
+	b, err := env.backend()
+	if err != nil {
+		return err
+	}
+	status := "resumed"
+	if paused {
+		err = b.Pause(pause.Scope, pause.Name)
+		status = "paused"
+	} else {
+		err = b.Resume(pause.Scope, pause.Name)
+	}
+	if err != nil {
+		return err
+	}
+	return env.out.print(pause, func(t *tabwriter.Writer) {
+		row(t, status, pause.Scope, pause.Name)
+	})
+}
+
+func runStats(env *env, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	b, err := env.backend()
+	if err != nil {
+		return err
+	}
+	stats, err := b.Stats()
+	if err != nil {
+		return err
+	}
+	return env.out.print(stats, func(t *tabwriter.Writer) {
+		statuses := []string{util.TASK_STATUS_PENDING, util.TASK_STATUS_RUNNING, util.TASK_STATUS_COMPLETED, util.TASK_STATUS_FAILED, util.TASK_STATUS_CANCELLED}
+		counts := make(map[string]map[string]int)
+		for _, count := range stats.Tasks {
+			if counts[count.Type] == nil {
+				counts[count.Type] = make(map[string]int)
+			}
+			counts[count.Type][count.Status] += count.Count
+		}
+		row(t, "TYPE", "PENDING", "RUNNING", "COMPLETED", "FAILED", "CANCELLED")
+		for _, taskType := range sortedKeys(counts) {
+			cells := []interface{}{taskType}
+			for _, status := range statuses {
+				cells = append(cells, counts[taskType][status])
+			}
+			row(t, cells...)
+		}
+		if len(stats.Queues) > 0 {
+			fmt.Fprintln(t)
+			row(t, "QUEUE", "WORKERS", "BUSY", "QUEUED", "IN FLIGHT", "REJECTED", "SPILLED", "WAIT")
+			for _, q := range stats.Queues {
+				row(t, q.Name, fmt.Sprintf("%v/%v", q.Workers, q.MaxWorkers), q.Busy, q.Queued, q.InFlight, q.Rejected, q.Spilled, q.Wait.Round(time.Millisecond))
+			}
+			fmt.Fprintf(t, "\n%v delayed tasks\n", stats.Delayed)
+		}
+		if len(stats.Pauses) > 0 {
+			fmt.Fprintln(t)
+			row(t, "PAUSED", "NAME", "SINCE")
+			for _, pause := range stats.Pauses {
+				row(t, pause.Scope, pause.Name, formatTime(pause.PausedAt))
+			}
+		}
+	})
+}
+
+func runPurge(env *env, args []string) error {
+	var olderThan time.Duration
+	var statuses, taskType, queue string
+	var dryRun bool
+	flags := env.flags("purge")
+	flags.DurationVar(&olderThan, "older-than", 0, "delete tasks created longer ago than this, like 720h")
+	flags.StringVar(&statuses, "status", util.TASK_STATUS_COMPLETED, "comma separated statuses among completed, failed and cancelled")
+	flags.StringVar(&taskType, "type", "", "task type")
+	flags.StringVar(&queue, "queue", "", "queue")
+	flags.BoolVar(&dryRun, "dry-run", false, "count what would be deleted")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if olderThan <= 0 || flags.NArg() != 0 {
+		flags.PrintDefaults()
+		return errUsage
+	}
+	b, err := env.backend()
+	if err != nil {
+		return err
+	}
+	counts := make(map[string]int)
+	for _, status := range strings.Split(statuses, ",") {
+		status = strings.TrimSpace(status)
+		if status != util.TASK_STATUS_COMPLETED && status != util.TASK_STATUS_FAILED && status != util.TASK_STATUS_CANCELLED {
+			return fmt.Errorf("cannot purge %q tasks", status)
+		}
+		filter := model.TaskFilter{
+			Status: status,
+			Type:   taskType,
+			Queue:  queue,
+			To:     time.Now().Add(-olderThan).Unix(),
+		}
+		deleted, err := eachTask(b, filter, 0, func(task model.TaskDetail) (bool, error) {
+			if dryRun {
+				return false, nil
+			}
+			return true, b.DeleteTask(task.Id)
+		})
+		counts[status] = deleted
+		if err != nil {
+			return err
+		}
+	}
+	verb := "deleted"
+	if dryRun {
+		verb = "would delete"
+	}
+	return env.out.print(counts, func(t *tabwriter.Writer) {
+		for _, status := range sortedKeys(counts) {
+			row(t, verb, counts[status], status)
+		}
+	})
+}
+
+// eachTask calls fn on every task filter matches, up to limit when it is
+// not 0, a page at a time. fn tells whether the task left the filter's
+// results, so the next page does not skip any. It returns how many tasks
+// fn was called on.
+func eachTask(b backend, filter model.TaskFilter, limit int, fn func(task model.TaskDetail) (bool, error)) (int, error) {
+	seen := 0
+	filter.Limit = util.DEFAULT_LIST_LIMIT
+	for {
+		tasks, err := b.ListTasks(filter)
+		if err != nil {
+			return seen, err
+		}
+		for _, task := range tasks {
+			if limit > 0 && seen == limit {
+				return seen, nil
+			}
+			removed, err := fn(task)
+			if err != nil {
+				return seen, err
+			}
+			seen++
+			if !removed {
+				filter.Offset++
+			}
+		}
+		if len(tasks) < filter.Limit {
+			return seen, nil
+		}
+	}
+}
+
+func taskTable(t *tabwriter.Writer, tasks []model.TaskDetail) {
+	row(t, "ID", "TYPE", "QUEUE", "STATUS", "ATTEMPT", "CREATED", "ERROR")
+	for _, task := range tasks {
+		row(t, task.Id, task.Meta.Type, queueName(task.Meta.Queue), task.Status, task.Attempt, formatTime(task.CreatedAt), task.Error)
+	}
+}
+
+func resultTable(t *tabwriter.Writer, results []result) {
+	for _, r := range results {
+		row(t, r.Id, r.Status, r.Error)
+	}
+}
+
+func queueName(queue string) string {
+	if queue == "" {
+		return util.DEFAULT_QUEUE
+	}
+	return queue
+}
+
+// parseTime reads an RFC 3339 time, unix seconds, or a duration before now
+// like 24h.
+func parseTime(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return seconds, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-ago).Unix(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an RFC 3339 time, unix seconds or a duration", value)
+	}
+	return t.Unix(), nil
+}
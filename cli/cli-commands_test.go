@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	admin "github.com/amitiwary999/task-scheduler/admin"
+	model "github.com/amitiwary999/task-scheduler/model"
+	scheduler "github.com/amitiwary999/task-scheduler/scheduler"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// runJson runs args with -o json, fails the test unless they succeed and
+// decodes what they printed into out.
+func runJson(t *testing.T, app *App, out interface{}, args ...string) {
+	t.Helper()
+	code, stdout, stderr := run(t, app, append([]string{"-o", "json"}, args...)...)
+	if code != 0 {
+		t.Fatalf("%v: exit %v with %q", args, code, stderr)
+	}
+	if err := json.Unmarshal([]byte(stdout), out); err != nil {
+		t.Fatalf("%v printed %q: %v", args, stdout, err)
+	}
+}
+
+func TestEnqueueSavesTheTask(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	app := &App{Storage: store}
+	var added result
+	runJson(t, app, &added, "enqueue", "-type", "email", "-queue", "mail", "-meta-id", "m1", "-payload", `{"to":"a@example.com"}`, "-max-retry", "2", "-at", "2030-01-01T00:00:00Z")
+	if added.Id == "" || added.Status != util.TASK_STATUS_PENDING {
+		t.Fatalf("enqueue printed %+v, want a pending task", added)
+	}
+	task, err := store.GetTask(added.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	meta := task.Meta
+	if meta.Type != "email" || meta.Queue != "mail" || meta.MetaId != "m1" || meta.MaxRetry != 2 || meta.ExecutionTime != want ||
+		meta.Codec != util.CODEC_JSON || string(meta.Payload) != `{"to":"a@example.com"}` {
+		t.Errorf("saved %+v", meta)
+	}
+}
+
+func TestCommandsWorkOnStorage(t *testing.T) {
+	app := &App{Storage: storage.NewMemoryStorage()}
+	var added result
+	runJson(t, app, &added, "enqueue", "-type", "email")
+
+	var tasks []model.TaskDetail
+	runJson(t, app, &tasks, "list", "-status", "pending", "-type", "email")
+	if len(tasks) != 1 || tasks[0].Id != added.Id {
+		t.Fatalf("list = %+v, want the enqueued task", tasks)
+	}
+	var results []result
+	runJson(t, app, &results, "cancel", added.Id)
+	if len(results) != 1 || results[0].Status != util.TASK_STATUS_CANCELLED {
+		t.Errorf("cancel = %+v, want it cancelled", results)
+	}
+	runJson(t, app, &results, "retry", added.Id)
+	if len(results) != 1 || results[0].Status != "retried" {
+		t.Errorf("retry = %+v, want it retried", results)
+	}
+	var history model.TaskHistory
+	runJson(t, app, &history, "inspect", added.Id)
+	if history.Task.Status != util.TASK_STATUS_PENDING || history.Task.Attempt != 1 {
+		t.Errorf("inspect = %+v, want it pending again on its second attempt", history.Task)
+	}
+	if code, _, stderr := run(t, app, "retry", added.Id, "missing"); code != 1 || !strings.Contains(stderr, "2 of 2 tasks failed") {
+		t.Errorf("retry of a pending and a missing task = exit %v with %q, want both to fail", code, stderr)
+	}
+
+	var pause model.Pause
+	runJson(t, app, &pause, "pause", "queue", "mail")
+	var stats admin.Stats
+	runJson(t, app, &stats, "stats")
+	if len(stats.Pauses) != 1 || stats.Pauses[0].Name != "mail" || len(stats.Tasks) != 1 || stats.Tasks[0].Count != 1 {
+		t.Errorf("stats = %+v, want the mail pause and one task", stats)
+	}
+	runJson(t, app, &pause, "resume", "queue", "mail")
+	runJson(t, app, &stats, "stats")
+	if len(stats.Pauses) != 0 {
+		t.Errorf("pauses after resume = %+v, want none", stats.Pauses)
+	}
+}
+
+func TestEnqueueGoesThroughTheAdminApi(t *testing.T) {
+	tsk, err := scheduler.New(
+		scheduler.WithStorage(storage.NewMemoryStorage()),
+		scheduler.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := make(chan string, 1)
+	tsk.RegisterHandler("email", func(metaId string) { ran <- metaId })
+	if err := tsk.StartScheduler(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tsk.Stop)
+	mux := http.NewServeMux()
+	admin.NewHandler(tsk, admin.WithBearerToken("secret")).Mount(mux, "/admin")
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	// Without -admin the command would need storage, which the app has none of.
+	app := &App{}
+	if code, _, stderr := run(t, app, "-admin", server.URL+"/admin", "enqueue", "-type", "email"); code != 1 || !strings.Contains(stderr, "401") {
+		t.Errorf("enqueue without the token = exit %v with %q, want a 401", code, stderr)
+	}
+	var added result
+	runJson(t, app, &added, "-admin", server.URL+"/admin", "-token", "secret", "enqueue", "-type", "email", "-meta-id", "m1")
+	select {
+	case metaId := <-ran:
+		if metaId != "m1" {
+			t.Errorf("handler ran %q, want m1", metaId)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not run the enqueued task")
+	}
+	if _, err := tsk.GetTask(added.Id); err != nil {
+		t.Errorf("GetTask(%v) = %v", added.Id, err)
+	}
+}
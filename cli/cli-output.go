@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const maxCellWidth = 60
+
+// printer writes what a command found as JSON or as aligned tables.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// print writes v as JSON, or calls table to write it for people.
+func (p *printer) print(v interface{}, table func(t *tabwriter.Writer)) error {
+	if p.json {
+		encoder := json.NewEncoder(p.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	t := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	table(t)
+	return t.Flush()
+}
+
+func row(t *tabwriter.Writer, cells ...interface{}) {
+	values := make([]string, len(cells))
+	for i, value := range cells {
+		values[i] = cell(fmt.Sprint(value))
+	}
+	fmt.Fprintln(t, strings.Join(values, "\t"))
+}
+
+// cell keeps a value on one line and short enough for a table.
+func cell(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if runes := []rune(value); len(runes) > maxCellWidth {
+		value = string(runes[:maxCellWidth-3]) + "..."
+	}
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func formatTime(seconds int64) string {
+	if seconds == 0 {
+		return ""
+	}
+	return time.Unix(seconds, 0).Format(time.RFC3339)
+}
@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	admin "github.com/amitiwary999/task-scheduler/admin"
+	dashboard "github.com/amitiwary999/task-scheduler/dashboard"
+	metrics "github.com/amitiwary999/task-scheduler/metrics"
+	scheduler "github.com/amitiwary999/task-scheduler/scheduler"
+	submission "github.com/amitiwary999/task-scheduler/submission"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// runServe runs a server of the cluster until SIGINT or SIGTERM, with the
+// admin API, the dashboard, metrics and the submission service. It runs
+// the task types App.Setup registers; without any it still serves the API.
+// Flags given on the command line win over the config file, which is
+// reloaded when it changes or on SIGHUP.
+func runServe(env *env, args []string) error {
+	var configPath, listen, rabbitmqUrl, serverId string
+	var workers, queueSize uint
+	flags := env.flags("serve")
+	flags.StringVar(&configPath, "config", os.Getenv("TASKSCHEDULER_CONFIG"), "JSON config file ($TASKSCHEDULER_CONFIG)")
+	flags.StringVar(&listen, "listen", util.DEFAULT_ADMIN_LISTEN, "address of the admin api, dashboard, metrics and submission service")
+	flags.StringVar(&rabbitmqUrl, "rabbitmq", "", "rabbitmq url to join a cluster")
+	flags.StringVar(&serverId, "server-id", "", "id of this server, random when empty")
+	flags.UintVar(&workers, "workers", util.DEFAULT_WORKERS, "workers of the default queue")
+	flags.UintVar(&queueSize, "queue-size", util.DEFAULT_QUEUE_SIZE, "tasks the default queue buffers")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errUsage
+	}
+	// The flags are applied again whenever the config file is reloaded.
+	load := func(path string) (*scheduler.Config, error) {
+		config, err := scheduler.ReadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		// The environment is in the config already; only flags override it.
+		if env.given["supabase-url"] {
+			config.Storage = scheduler.StorageConfig{
+				Backend:      util.STORAGE_SUPABASE,
+				SupabaseUrl:  env.supabaseUrl,
+				SupabaseAuth: env.supabaseAuth,
+				SupabaseKey:  env.supabaseKey,
+			}
+		} else if env.given["postgres"] {
+			config.Storage.Backend = util.STORAGE_POSTGRES
+			config.Storage.PostgresUrl = env.postgresUrl
+		}
+		if env.given["pool"] {
+			config.Storage.PoolLimit = int16(env.poolLimit)
+		}
+		if env.given["token"] {
+			config.Admin.Token = env.adminToken
+		}
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "listen":
+				config.Admin.Listen = listen
+			case "rabbitmq":
+				config.Amqp.Url = rabbitmqUrl
+			case "server-id":
+				config.ServerId = serverId
+			case "workers":
+				config.Workers = uint16(workers)
+			case "queue-size":
+				config.QueueSize = uint16(queueSize)
+			}
+		})
+		return config, nil
+	}
+	config, err := load(configPath)
+	if err != nil {
+		return err
+	}
+	if config.Admin.Listen == "" {
+		return errors.New("admin.listen: serve needs an address")
+	}
+
+	registry := metrics.NewRegistry()
+	logger := slog.New(slog.NewTextHandler(env.app.Stderr, nil))
+	opts := []scheduler.Option{scheduler.WithConfig(*config), scheduler.WithLogger(logger), scheduler.WithMetrics(registry)}
+	if env.app.Storage != nil {
+		opts = append(opts, scheduler.WithStorage(env.app.Storage))
+	}
+	tsk, err := scheduler.New(opts...)
+	if err != nil {
+		return err
+	}
+	if env.app.Setup != nil {
+		if err := env.app.Setup(tsk); err != nil {
+			return err
+		}
+	}
+	if err := tsk.StartScheduler(); err != nil {
+		return err
+	}
+	defer tsk.Stop()
+	if configPath != "" {
+		tsk.WatchConfig(configPath, load)
+	}
+
+	mux := http.NewServeMux()
+	var adminOpts []admin.Option
+	if config.Admin.Token != "" {
+		adminOpts = append(adminOpts, admin.WithBearerToken(config.Admin.Token))
+	}
+	admin.NewHandler(tsk, adminOpts...).Mount(mux, config.Admin.Path)
+	ui, err := dashboard.NewHandler(config.Admin.Path)
+	if err != nil {
+		return err
+	}
+	ui.Mount(mux, "/dashboard")
+	var submissionOpts []submission.Option
+	if config.Admin.Token != "" {
+		submissionOpts = append(submissionOpts, submission.WithAuth(admin.BearerToken(config.Admin.Token)))
+	}
+	submission.NewHandler(tsk, submissionOpts...).Mount(mux, "")
+	servers := []*http.Server{{Addr: config.Admin.Listen, Handler: mux}}
+	if config.Metrics.Listen == "" || config.Metrics.Listen == config.Admin.Listen {
+		mux.Handle(config.Metrics.Path, withToken(registry, config.Metrics.Token))
+	} else {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle(config.Metrics.Path, withToken(registry, config.Metrics.Token))
+		servers = append(servers, &http.Server{Addr: config.Metrics.Listen, Handler: metricsMux})
+	}
+	serveErr := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			serveErr <- server.ListenAndServe()
+		}(server)
+	}
+	logger.Info("serving", "serverId", tsk.ServerId, "admin", config.Admin.Listen, "metrics", config.Metrics.Listen)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	select {
+	case err = <-serveErr:
+	case <-stop:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, server := range servers {
+		server.Shutdown(ctx)
+	}
+	return err
+}
+
+// withToken answers 401 to requests without the bearer token, if there is
+// one.
+func withToken(handler http.Handler, token string) http.Handler {
+	if token == "" {
+		return handler
+	}
+	allowed := admin.BearerToken(token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowed(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
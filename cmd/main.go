@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
 	"time"
 
@@ -26,29 +25,39 @@ func main() {
 	if err != nil {
 		fmt.Printf("error load env %v\n", err)
 	}
-	poolLimit, err := strconv.Atoi(os.Getenv("POSTGRES_POOL_LIMIT"))
+	config, err := scheduler.LoadConfig(os.Getenv("TASKSCHEDULER_CONFIG"))
 	if err != nil {
-		fmt.Printf("error in the string conversion pool limit %v", err)
-	} else {
-		done := make(chan int)
-		gracefulShutdown := make(chan os.Signal, 1)
-		signal.Notify(gracefulShutdown, syscall.SIGINT, syscall.SIGTERM)
-		tsk := scheduler.NewTaskScheduler(done, os.Getenv("POSTGRES_URL"), int16(poolLimit), 10, 10000)
-		go tsk.StartScheduler()
-		time.Sleep(time.Duration(time.Second * 3))
-		for i := 0; i < 1000; i++ {
-			fn := generateFunc()
-			id := fmt.Sprintf("task_%v", i)
-			meta := model.TaskMeta{
-				MetaId: id,
-			}
-			mdlTsk := model.Task{
-				Meta:   meta,
-				TaskFn: fn,
-			}
-			tsk.AddNewTask(mdlTsk)
-		}
-		<-gracefulShutdown
-		close(done)
+		fmt.Printf("invalid config:\n%v\n", err)
+		return
 	}
+	gracefulShutdown := make(chan os.Signal, 1)
+	signal.Notify(gracefulShutdown, syscall.SIGINT, syscall.SIGTERM)
+	tsk, err := scheduler.New(scheduler.WithConfig(*config))
+	if err != nil {
+		fmt.Printf("error in create scheduler %v\n", err)
+		return
+	}
+	tsk.RegisterHandler("sleep", generateFunc())
+	tsk.RegisterHandler("sleep-done", func(metaId string) {
+		fmt.Printf("all tasks of %v completed \n", metaId)
+	})
+	if err := tsk.StartScheduler(); err != nil {
+		fmt.Printf("error in start scheduler %v\n", err)
+		return
+	}
+	batch := model.Batch{
+		OnComplete: &model.TaskMeta{MetaId: "sleep-batch", Type: "sleep-done"},
+	}
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("task_%v", i)
+		batch.Tasks = append(batch.Tasks, model.TaskMeta{
+			MetaId: id,
+			Type:   "sleep",
+		})
+	}
+	if _, _, err := tsk.AddBatch(batch); err != nil {
+		fmt.Printf("error in add batch %v\n", err)
+	}
+	<-gracefulShutdown
+	tsk.Stop()
 }
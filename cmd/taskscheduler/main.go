@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+
+	cli "github.com/amitiwary999/task-scheduler/cli"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	godotenv.Load(".env")
+	app := &cli.App{}
+	os.Exit(app.Run(os.Args[1:]))
+}
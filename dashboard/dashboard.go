@@ -0,0 +1,80 @@
+// Package dashboard is a small web UI over the admin API. Its pages,
+// scripts and styles are embedded in the binary and load nothing from
+// other hosts.
+package dashboard
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+//go:embed static
+var static embed.FS
+
+var index = template.Must(template.ParseFS(static, "static/index.html"))
+
+type page struct {
+	API string
+}
+
+// Handler serves the dashboard for the admin API mounted at api, like
+// "/admin". Its pages hold no data: when the API answers 401 the dashboard
+// asks for the bearer token and sends it with every call, keeping it for
+// the browser session.
+type Handler struct {
+	index   []byte
+	files   http.Handler
+	allowed func(r *http.Request) bool
+}
+
+// Option configures a Handler.
+type Option func(h *Handler)
+
+// WithAuth makes the Handler answer 401 to the requests allowed rejects.
+// Browsers send no bearer token when they open a page, so it is for checks
+// like a session cookie or basic auth.
+func WithAuth(allowed func(r *http.Request) bool) Option {
+	return func(h *Handler) {
+		h.allowed = allowed
+	}
+}
+
+func NewHandler(api string, opts ...Option) (*Handler, error) {
+	var buf bytes.Buffer
+	if err := index.Execute(&buf, page{API: strings.TrimSuffix(api, "/")}); err != nil {
+		return nil, err
+	}
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		return nil, err
+	}
+	h := &Handler{index: buf.Bytes(), files: http.FileServer(http.FS(files))}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
+}
+
+// Mount serves the dashboard under prefix, like "/dashboard", on mux.
+func (h *Handler) Mount(mux *http.ServeMux, prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	mux.Handle(prefix+"/", http.StripPrefix(prefix, h))
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.allowed != nil && !h.allowed(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path == "/" || r.URL.Path == "" || r.URL.Path == "/index.html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(h.index)
+		return
+	}
+	h.files.ServeHTTP(w, r)
+}
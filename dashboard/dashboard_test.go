@@ -0,0 +1,69 @@
+package dashboard
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, server *httptest.Server, path string, header ...string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func serveDashboard(t *testing.T, opts ...Option) *httptest.Server {
+	t.Helper()
+	ui, err := NewHandler("/admin/", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	ui.Mount(mux, "/dashboard")
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDashboardServesItsPages(t *testing.T) {
+	server := serveDashboard(t)
+	status, body := get(t, server, "/dashboard/")
+	if status != http.StatusOK || !strings.Contains(body, `data-api="/admin"`) {
+		t.Errorf("index = %v %q, want the page with the api path", status, body)
+	}
+	if status, body := get(t, server, "/dashboard/app.js"); status != http.StatusOK || !strings.Contains(body, "Authorization") {
+		t.Errorf("app.js = %v, want the script that sends the token", status)
+	}
+}
+
+func TestDashboardWithAuth(t *testing.T) {
+	server := serveDashboard(t, WithAuth(func(r *http.Request) bool {
+		cookie, err := r.Cookie("session")
+		return err == nil && cookie.Value == "ok"
+	}))
+	for _, path := range []string{"/dashboard/", "/dashboard/app.js"} {
+		if status, _ := get(t, server, path); status != http.StatusUnauthorized {
+			t.Errorf("%v without a session = %v, want 401", path, status)
+		}
+		if status, _ := get(t, server, path, "Cookie", "session=ok"); status != http.StatusOK {
+			t.Errorf("%v with a session = %v, want 200", path, status)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+"use strict";
+
+const api = document.body.dataset.api;
+const refreshInterval = 5000;
+const pageSize = 50;
+const samples = [];
+const maxSamples = 60;
+const tokenKey = "taskscheduler-token";
+
+let pauses = [];
+let offset = 0;
+let asking = null;
+let declined = false;
+
+function el(tag, attrs, ...children) {
+	const node = document.createElement(tag);
+	for (const [key, value] of Object.entries(attrs || {})) {
+		if (key === "onclick") {
+			node.addEventListener("click", value);
+		} else {
+			node.setAttribute(key, value);
+		}
+	}
+	for (const child of children) {
+		node.append(child === undefined || child === null ? "" : child);
+	}
+	return node;
+}
+
+// askToken asks for the token of the admin API once, however many calls
+// it refused at the same time, and not again after the user declined.
+function askToken() {
+	if (declined) {
+		return Promise.resolve(false);
+	}
+	if (!asking) {
+		asking = Promise.resolve().then(() => {
+			const token = window.prompt("Token of the admin API");
+			asking = null;
+			if (!token) {
+				declined = true;
+				return false;
+			}
+			sessionStorage.setItem(tokenKey, token);
+			return true;
+		});
+	}
+	return asking;
+}
+
+async function call(method, path, body, retried) {
+	const options = { method, headers: {} };
+	if (body !== undefined) {
+		options.headers["Content-Type"] = "application/json";
+		options.body = JSON.stringify(body);
+	}
+	const token = sessionStorage.getItem(tokenKey);
+	if (token) {
+		options.headers["Authorization"] = "Bearer " + token;
+	}
+	const response = await fetch(api + path, options);
+	if (response.status === 401 && !retried && await askToken()) {
+		return call(method, path, body, true);
+	}
+	if (!response.ok) {
+		let message = response.statusText;
+		try {
+			message = (await response.json()).error || message;
+		} catch (e) {}
+		throw new Error(message);
+	}
+	if (response.status === 204) {
+		return null;
+	}
+	return response.json();
+}
+
+function showError(err) {
+	const box = document.getElementById("error");
+	box.textContent = err ? err.message : "";
+	box.hidden = !err;
+}
+
+async function act(method, path, body) {
+	try {
+		await call(method, path, body);
+		showError(null);
+	} catch (err) {
+		showError(err);
+	}
+	refresh();
+}
+
+function isPaused(scope, name) {
+	return pauses.some((p) => p.scope === scope && p.name === name);
+}
+
+function pauseButton(scope, name) {
+	const paused = isPaused(scope, name);
+	const query = "?scope=" + encodeURIComponent(scope) + "&name=" + encodeURIComponent(name);
+	return el("button", {
+		class: paused ? "paused" : "",
+		onclick: () => paused ? act("DELETE", "/pauses" + query) : act("POST", "/pauses", { scope, name }),
+	}, paused ? "Resume" : "Pause");
+}
+
+function formatTime(seconds) {
+	return seconds ? new Date(seconds * 1000).toLocaleString() : "";
+}
+
+function formatWait(nanoseconds) {
+	return (nanoseconds / 1e6).toFixed(0) + " ms";
+}
+
+function fill(id, rows) {
+	document.querySelector("#" + id + " tbody").replaceChildren(...rows);
+}
+
+function renderStats(stats) {
+	pauses = stats.pauses || [];
+	document.getElementById("scheduler").replaceChildren(
+		isPaused("scheduler", "") ? "Scheduler paused " : "",
+		pauseButton("scheduler", ""),
+	);
+
+	fill("queues", (stats.queues || []).map((q) => el("tr", {},
+		el("td", {}, q.name),
+		el("td", {}, q.workers + " / " + q.maxWorkers),
+		el("td", {}, q.busy),
+		el("td", {}, q.queued),
+		el("td", {}, q.inFlight),
+		el("td", {}, q.rejected),
+		el("td", {}, q.spilled),
+		el("td", {}, formatWait(q.wait)),
+		el("td", {}, pauseButton("queue", q.name)),
+	)));
+	document.getElementById("delayed").textContent = stats.delayed;
+
+	const types = {};
+	let completed = 0;
+	let failed = 0;
+	for (const count of stats.tasks || []) {
+		const type = types[count.type] || (types[count.type] = { completed: 0, failed: 0 });
+		if (count.status === "completed") {
+			type.completed += count.count;
+			completed += count.count;
+		} else if (count.status === "failed") {
+			type.failed += count.count;
+			failed += count.count;
+		}
+	}
+	const failing = Object.entries(types)
+		.filter(([, t]) => t.failed > 0)
+		.sort((a, b) => b[1].failed - a[1].failed);
+	fill("failing", failing.map(([name, t]) => el("tr", {},
+		el("td", {}, name || "(untyped)"),
+		el("td", { class: "status-failed" }, t.failed),
+		el("td", {}, t.completed),
+		el("td", {}, (100 * t.failed / (t.failed + t.completed)).toFixed(1) + " %"),
+		el("td", {}, name ? pauseButton("type", name) : ""),
+	)));
+
+	samples.push({ time: Date.now(), completed, failed });
+	if (samples.length > maxSamples) {
+		samples.shift();
+	}
+	drawThroughput();
+}
+
+function drawThroughput() {
+	const canvas = document.getElementById("throughput");
+	const ctx = canvas.getContext("2d");
+	ctx.clearRect(0, 0, canvas.width, canvas.height);
+	const rates = [];
+	for (let i = 1; i < samples.length; i++) {
+		const minutes = (samples[i].time - samples[i - 1].time) / 60000;
+		rates.push({
+			completed: Math.max(0, samples[i].completed - samples[i - 1].completed) / minutes,
+			failed: Math.max(0, samples[i].failed - samples[i - 1].failed) / minutes,
+		});
+	}
+	const top = Math.max(1, ...rates.map((r) => Math.max(r.completed, r.failed)));
+	const pad = 24;
+	const width = canvas.width - 2 * pad;
+	const height = canvas.height - 2 * pad;
+	ctx.strokeStyle = "#e4e6eb";
+	ctx.fillStyle = "#5d6678";
+	ctx.font = "11px system-ui, sans-serif";
+	ctx.beginPath();
+	ctx.moveTo(pad, pad);
+	ctx.lineTo(pad, pad + height);
+	ctx.lineTo(pad + width, pad + height);
+	ctx.stroke();
+	ctx.fillText(top.toFixed(0), 2, pad);
+	ctx.fillText("0", 2, pad + height);
+	for (const [key, color] of [["completed", "#12b76a"], ["failed", "#f04438"]]) {
+		ctx.strokeStyle = color;
+		ctx.lineWidth = 2;
+		ctx.beginPath();
+		rates.forEach((r, i) => {
+			const x = pad + width * (i + maxSamples - 1 - rates.length) / (maxSamples - 2);
+			const y = pad + height - height * r[key] / top;
+			i === 0 ? ctx.moveTo(x, y) : ctx.lineTo(x, y);
+		});
+		ctx.stroke();
+	}
+	ctx.lineWidth = 1;
+}
+
+function renderMembers(members) {
+	fill("members", members.map((m) => el("tr", {},
+		el("td", {}, m.serverId + (m.self ? " (this server)" : "")),
+		el("td", {}, formatTime(m.heartbeat)),
+		el("td", {}, m.load),
+	)));
+}
+
+function taskRow(task) {
+	return el("tr", { onclick: () => showTask(task.id) },
+		el("td", {}, task.id),
+		el("td", {}, task.meta.type || ""),
+		el("td", {}, task.meta.queue || "default"),
+		el("td", { class: "status-" + task.status }, task.status),
+		el("td", {}, task.attempt || 0),
+		el("td", {}, formatTime(task.createdAt)),
+		el("td", { class: "error", title: task.error || "" }, task.error || ""),
+	);
+}
+
+async function loadTasks(more) {
+	const form = new FormData(document.getElementById("filter"));
+	const query = new URLSearchParams();
+	for (const [key, value] of form) {
+		if (value) {
+			query.set(key, value);
+		}
+	}
+	offset = more ? offset + pageSize : 0;
+	query.set("limit", pageSize);
+	query.set("offset", offset);
+	try {
+		const tasks = await call("GET", "/tasks?" + query);
+		const body = document.querySelector("#tasks tbody");
+		const rows = tasks.map(taskRow);
+		more ? body.append(...rows) : body.replaceChildren(...rows);
+		document.getElementById("more").hidden = tasks.length < pageSize;
+		showError(null);
+	} catch (err) {
+		showError(err);
+	}
+}
+
+async function showTask(id) {
+	let history;
+	try {
+		history = await call("GET", "/tasks/" + encodeURIComponent(id));
+	} catch (err) {
+		showError(err);
+		return;
+	}
+	const task = history.task;
+	document.getElementById("detail-id").textContent = task.id;
+	const fields = [
+		["Type", task.meta.type],
+		["Queue", task.meta.queue || "default"],
+		["Status", task.status],
+		["Attempt", task.attempt || 0],
+		["Max retry", task.meta.maxRetry || 0],
+		["Created", formatTime(task.createdAt)],
+		["Runs at", formatTime(task.meta.executionTime)],
+		["Parent", task.meta.parentId],
+		["Workflow", task.meta.workflowId ? task.meta.workflowId + " / " + task.meta.workflowNode : ""],
+		["Batch", task.meta.batchId],
+		["Error", task.error],
+	].filter(([, value]) => value !== undefined && value !== "");
+	document.getElementById("detail-fields").replaceChildren(...fields.flatMap(([name, value]) => [el("dt", {}, name), el("dd", {}, value)]));
+
+	const finished = task.status === "failed" || task.status === "cancelled";
+	const retry = document.getElementById("detail-retry");
+	retry.hidden = !finished || !task.meta.type;
+	retry.onclick = () => act("POST", "/tasks/" + encodeURIComponent(id) + "/retry").then(() => showTask(id));
+	const cancel = document.getElementById("detail-cancel");
+	cancel.hidden = task.status !== "pending" && task.status !== "running";
+	cancel.onclick = () => act("POST", "/tasks/" + encodeURIComponent(id) + "/cancel").then(() => showTask(id));
+
+	const logs = history.logs || [];
+	document.getElementById("detail-logs").replaceChildren(...(logs.length ? logs.map((log) => el("div", {},
+		el("p", {}, "Attempt " + log.attempt + " · " + formatTime(log.createdAt)),
+		...(log.error ? [el("p", { class: "error" }, log.error)] : []),
+		...(log.logs ? [el("pre", {}, log.logs)] : []),
+	)) : [el("p", { class: "note" }, "Nothing logged.")]));
+	const children = history.children || [];
+	document.getElementById("detail-children").replaceChildren(...(children.length ? children.map((child) => el("li", {},
+		el("a", { href: "#", onclick: (e) => { e.preventDefault(); showTask(child.id); } }, child.id),
+		" " + (child.meta.type || "") + " · " + child.status,
+	)) : [el("li", { class: "note" }, "None.")]));
+
+	const dialog = document.getElementById("detail");
+	if (!dialog.open) {
+		dialog.showModal();
+	}
+}
+
+async function refresh() {
+	try {
+		const [stats, members] = await Promise.all([call("GET", "/stats"), call("GET", "/members")]);
+		renderStats(stats);
+		renderMembers(members);
+		document.getElementById("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+	} catch (err) {
+		showError(err);
+	}
+}
+
+document.getElementById("filter").addEventListener("submit", (e) => {
+	e.preventDefault();
+	loadTasks(false);
+});
+document.getElementById("more").addEventListener("click", () => loadTasks(true));
+document.getElementById("detail-close").addEventListener("click", () => {
+	document.getElementById("detail").close();
+	loadTasks(false);
+});
+
+refresh();
+loadTasks(false);
+setInterval(refresh, refreshInterval);
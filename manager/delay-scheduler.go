@@ -1,10 +1,22 @@
 package manager
 
+import (
+	"container/heap"
+	"sync"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
 type DelayTask struct {
-	IdTask string
-	MetaId string
-	TaskFn func(string)
-	Time   int64
+	IdTask  string
+	Meta    model.TaskMeta
+	Handler model.TaskHandler
+	Time    int64
+	Attempt int
+	// Span covers the time the task waits here; it ends when the task is
+	// popped.
+	Span util.Span
 }
 
 type PriorityQueue []*DelayTask
@@ -32,3 +44,33 @@ func (pq *PriorityQueue) Pop() interface{} {
 	*pq = prev[0 : len(prev)-1]
 	return task
 }
+
+// DelayQueue is a PriorityQueue safe for use from many goroutines, ordered
+// by the time each task is due.
+type DelayQueue struct {
+	mu    sync.Mutex
+	tasks PriorityQueue
+}
+
+func (dq *DelayQueue) Add(task *DelayTask) {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+	heap.Push(&dq.tasks, task)
+}
+
+// PopDue removes and returns every task due at or before now.
+func (dq *DelayQueue) PopDue(now int64) []*DelayTask {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+	var due []*DelayTask
+	for len(dq.tasks) > 0 && dq.tasks[0].Time <= now {
+		due = append(due, heap.Pop(&dq.tasks).(*DelayTask))
+	}
+	return due
+}
+
+func (dq *DelayQueue) Len() int {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+	return len(dq.tasks)
+}
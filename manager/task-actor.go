@@ -1,61 +1,196 @@
 package manager
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	model "github.com/amitiwary999/task-scheduler/model"
 )
 
+var errActorDone = errors.New("task actor stopped")
+
+type queuedTask struct {
+	task     model.ActorTask
+	queuedAt time.Time
+}
+
+// TaskActor runs tasks on up to maxWorker goroutines, started as tasks
+// arrive. The limit can change while it runs; workers over the limit stop
+// once they are idle. With an idle timeout, workers idle for that long stop
+// too, but one worker is always kept.
 type TaskActor struct {
-	maxWorker uint16
-	done      chan int
-	taskChan  chan model.ActorTask
-	taskQueue chan model.ActorTask
+	mu          sync.Mutex
+	maxWorker   uint16
+	workers     uint16
+	idleTimeout time.Duration
+	resized     chan struct{}
+	busy        atomic.Int64
+	wait        atomic.Int64
+	done        chan int
+	taskQueue   chan queuedTask
 }
 
 func NewTaskActor(maxWorker uint16, done chan int, tasksSize uint16) *TaskActor {
 	ta := &TaskActor{
 		maxWorker: maxWorker,
 		done:      done,
-		taskQueue: make(chan model.ActorTask, tasksSize),
-		taskChan:  make(chan model.ActorTask),
+		resized:   make(chan struct{}),
+		taskQueue: make(chan queuedTask, tasksSize),
 	}
-	go ta.Dispatch()
 	return ta
 }
 
+func (ta *TaskActor) Capacity() int {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	return int(ta.maxWorker) + cap(ta.taskQueue)
+}
+
+func (ta *TaskActor) MaxWorker() uint16 {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	return ta.maxWorker
+}
+
+func (ta *TaskActor) BufferSize() uint16 {
+	return uint16(cap(ta.taskQueue))
+}
+
+// SetMaxWorker changes the worker limit. Growing starts workers for tasks
+// already waiting; shrinking lets the extra workers finish their task.
+func (ta *TaskActor) SetMaxWorker(maxWorker uint16) {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	ta.maxWorker = maxWorker
+	close(ta.resized)
+	ta.resized = make(chan struct{})
+	for waiting := len(ta.taskQueue); waiting > 0 && ta.workers < ta.maxWorker; waiting-- {
+		ta.workers++
+		go ta.DoAction(nil)
+	}
+}
+
+// SetIdleTimeout makes workers idle for timeout stop. Zero keeps them.
+func (ta *TaskActor) SetIdleTimeout(timeout time.Duration) {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	ta.idleTimeout = timeout
+	close(ta.resized)
+	ta.resized = make(chan struct{})
+}
+
+// Stats is a snapshot of the pool; Wait is the recent average time tasks
+// spent queued before a worker picked them up.
+func (ta *TaskActor) Stats() model.QueueStats {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	return model.QueueStats{
+		MaxWorkers: int(ta.maxWorker),
+		Workers:    int(ta.workers),
+		Busy:       int(ta.busy.Load()),
+		Queued:     len(ta.taskQueue),
+		BufferSize: cap(ta.taskQueue),
+		Wait:       time.Duration(ta.wait.Load()),
+	}
+}
+
+// SubmitTask hands tsk to an idle or new worker, or queues it, waiting for
+// room in the buffer as long as it takes.
 func (ta *TaskActor) SubmitTask(tsk model.ActorTask) {
-	ta.taskChan <- tsk
+	ta.SubmitContext(context.Background(), tsk)
 }
 
-func (ta *TaskActor) Dispatch() {
-	var workerCount uint16 = 0
-ExitLoop:
+// SubmitContext is SubmitTask giving up when ctx is done.
+func (ta *TaskActor) SubmitContext(ctx context.Context, tsk model.ActorTask) error {
+	task := queuedTask{task: tsk, queuedAt: time.Now()}
+	if ta.startWorker(task) {
+		return nil
+	}
+	select {
+	case ta.taskQueue <- task:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ta.done:
+		return errActorDone
+	}
+}
+
+// TrySubmit is SubmitTask returning false instead of waiting when the
+// buffer is full.
+func (ta *TaskActor) TrySubmit(tsk model.ActorTask) bool {
+	task := queuedTask{task: tsk, queuedAt: time.Now()}
+	if ta.startWorker(task) {
+		return true
+	}
+	select {
+	case ta.taskQueue <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+func (ta *TaskActor) startWorker(task queuedTask) bool {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	if ta.workers >= ta.maxWorker {
+		return false
+	}
+	ta.workers++
+	go ta.DoAction(&task)
+	return true
+}
+
+// DoAction runs tsk, when given, and then queued tasks until the worker is
+// over the limit, idle for too long or the actor is done.
+func (ta *TaskActor) DoAction(tsk *queuedTask) {
+	if tsk != nil {
+		ta.run(*tsk)
+	}
 	for {
+		ta.mu.Lock()
+		if ta.workers > ta.maxWorker {
+			ta.workers--
+			ta.mu.Unlock()
+			return
+		}
+		resized := ta.resized
+		var idle <-chan time.Time
+		if ta.idleTimeout > 0 {
+			idle = time.After(ta.idleTimeout)
+		}
+		ta.mu.Unlock()
 		select {
-		case taskF, ok := <-ta.taskChan:
-			if !ok {
-				break ExitLoop
-			}
-			if workerCount < ta.maxWorker {
-				go ta.DoAction(taskF)
-				workerCount++
-			} else {
-				ta.taskQueue <- taskF
+		case task := <-ta.taskQueue:
+			ta.run(task)
+		case <-resized:
+		case <-idle:
+			ta.mu.Lock()
+			if ta.workers > 1 && len(ta.taskQueue) == 0 {
+				ta.workers--
+				ta.mu.Unlock()
+				return
 			}
+			ta.mu.Unlock()
 		case <-ta.done:
-			break ExitLoop
+			return
 		}
 	}
 }
 
-func (ta *TaskActor) DoAction(tsk model.ActorTask) {
-	task := tsk
-ExitLoop:
+func (ta *TaskActor) run(task queuedTask) {
+	waited := int64(time.Since(task.queuedAt))
 	for {
-		task.TaskFn(task.MetaId)
-		select {
-		case task = <-ta.taskQueue:
-		case <-ta.done:
-			break ExitLoop
+		old := ta.wait.Load()
+		if ta.wait.CompareAndSwap(old, old-old/8+waited/8) {
+			break
 		}
 	}
+	ta.busy.Add(1)
+	defer ta.busy.Add(-1)
+	task.task.TaskFn(task.task.MetaId)
 }
@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+)
+
+// blockingTasks submits count tasks to ta that run until release is closed.
+func blockingTasks(ta *TaskActor, count int, release chan struct{}, ran *atomic.Int64) {
+	for i := 0; i < count; i++ {
+		ta.SubmitTask(model.ActorTask{TaskFn: func(metaId string) {
+			<-release
+			ran.Add(1)
+		}})
+	}
+}
+
+func TestResizeWhileTasksRun(t *testing.T) {
+	done := make(chan int)
+	t.Cleanup(func() { close(done) })
+	ta := NewTaskActor(1, done, 10)
+	release := make(chan struct{})
+	var ran atomic.Int64
+	blockingTasks(ta, 6, release, &ran)
+	eventually(t, "one worker busy", func() bool {
+		stats := ta.Stats()
+		return stats.Busy == 1 && stats.Queued == 5
+	})
+
+	ta.SetMaxWorker(4)
+	eventually(t, "the new workers to take queued tasks", func() bool {
+		stats := ta.Stats()
+		return stats.Busy == 4 && stats.Queued == 2
+	})
+	ta.SetMaxWorker(2)
+	if stats := ta.Stats(); stats.Busy != 4 {
+		t.Errorf("busy = %v after shrinking, want running tasks left alone", stats.Busy)
+	}
+	close(release)
+	eventually(t, "every task to run", func() bool { return ran.Load() == 6 })
+	eventually(t, "the extra workers to stop", func() bool { return ta.Stats().Workers == 2 })
+
+	// The pool still runs tasks at its new size.
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for i := 0; i < 3; i++ {
+		ta.SubmitTask(model.ActorTask{TaskFn: func(metaId string) { wg.Done() }})
+	}
+	wg.Wait()
+	if stats := ta.Stats(); stats.Workers > 2 {
+		t.Errorf("workers = %v, want at most 2", stats.Workers)
+	}
+}
+
+func TestIdleWorkersStop(t *testing.T) {
+	done := make(chan int)
+	t.Cleanup(func() { close(done) })
+	ta := NewTaskActor(3, done, 10)
+	ta.SetIdleTimeout(50 * time.Millisecond)
+	release := make(chan struct{})
+	var ran atomic.Int64
+	blockingTasks(ta, 3, release, &ran)
+	eventually(t, "three workers busy", func() bool { return ta.Stats().Busy == 3 })
+	if workers := ta.Stats().Workers; workers != 3 {
+		t.Fatalf("workers = %v, want 3", workers)
+	}
+	close(release)
+	eventually(t, "idle workers to stop", func() bool { return ta.Stats().Workers == 1 })
+	// One worker is always kept.
+	time.Sleep(200 * time.Millisecond)
+	if workers := ta.Stats().Workers; workers != 1 {
+		t.Errorf("workers = %v, want the last worker kept", workers)
+	}
+	blockingTasks(ta, 1, release, &ran)
+	eventually(t, "the kept worker to run a new task", func() bool { return ran.Load() == 4 })
+}
@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+)
+
+// ErrTaskState is returned when a task is not in a status the operation
+// applies to, like retrying a task that has not failed.
+var ErrTaskState = errors.New("task is not in a state for this operation")
+
+func (tm *TaskManager) GetTask(id string) (*model.TaskDetail, error) {
+	return tm.storageClient.GetTask(id)
+}
+
+func (tm *TaskManager) ListTasks(filter model.TaskFilter) ([]model.TaskDetail, error) {
+	return tm.storageClient.ListTasks(filter)
+}
+
+func (tm *TaskManager) CountTasks() ([]model.TaskCount, error) {
+	return tm.storageClient.CountTasks()
+}
+
+func (tm *TaskManager) GetTaskHistory(id string) (*model.TaskHistory, error) {
+	task, err := tm.storageClient.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := tm.storageClient.GetTaskLogs(id)
+	if err != nil {
+		return nil, err
+	}
+	children, err := tm.storageClient.GetChildTasks(id)
+	if err != nil {
+		return nil, err
+	}
+	return &model.TaskHistory{Task: *task, Logs: logs, Children: children}, nil
+}
+
+// RetryTask runs a failed or cancelled task again as a new attempt. Only
+// typed tasks can run again; a TaskFn is gone once its task finished.
+func (tm *TaskManager) RetryTask(id string) error {
+	task, err := tm.storageClient.GetTask(id)
+	if err != nil {
+		return err
+	}
+	if task.Meta.Type == "" {
+		return fmt.Errorf("%w: task %v has no type", ErrTaskState, id)
+	}
+	executionTime := time.Now().Unix()
+	replayed, err := tm.storageClient.ReplayTask(id, executionTime)
+	if err != nil {
+		return err
+	}
+	if !replayed {
+		return fmt.Errorf("%w: task %v is %v", ErrTaskState, id, task.Status)
+	}
+	detail := pendingDetail(id, task.Meta)
+	detail.Attempt = task.Attempt + 1
+	detail.Meta.ExecutionTime = executionTime
+	tm.schedule(detail, nil)
+	return nil
+}
+
+// RescheduleTask moves a pending typed task to run at executionTime, in
+// unix seconds.
+func (tm *TaskManager) RescheduleTask(id string, executionTime int64) error {
+	task, err := tm.storageClient.GetTask(id)
+	if err != nil {
+		return err
+	}
+	if task.Meta.Type == "" {
+		return fmt.Errorf("%w: task %v has no type", ErrTaskState, id)
+	}
+	rescheduled, err := tm.storageClient.RescheduleTask(id, executionTime)
+	if err != nil {
+		return err
+	}
+	if !rescheduled {
+		return fmt.Errorf("%w: task %v is %v", ErrTaskState, id, task.Status)
+	}
+	detail := pendingDetail(id, task.Meta)
+	detail.Attempt = task.Attempt
+	detail.Meta.ExecutionTime = executionTime
+	tm.schedule(detail, nil)
+	return nil
+}
+
+// DeleteTask removes a finished task and its logs.
+func (tm *TaskManager) DeleteTask(id string) error {
+	task, err := tm.storageClient.GetTask(id)
+	if err != nil {
+		return err
+	}
+	deleted, err := tm.storageClient.DeleteTask(id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w: task %v is %v", ErrTaskState, id, task.Status)
+	}
+	return nil
+}
+
+// Members lists the live servers of the cluster with the load this server
+// put on each.
+func (tm *TaskManager) Members() ([]model.Member, error) {
+	servers, err := tm.storageClient.GetAllUsedServer()
+	if err != nil {
+		return nil, err
+	}
+	tm.serversMu.Lock()
+	defer tm.serversMu.Unlock()
+	members := make([]model.Member, len(servers))
+	for i, server := range servers {
+		members[i] = model.Member{
+			ServerId:  server.ServerId,
+			Status:    server.Status,
+			Heartbeat: server.Heartbeat,
+			Self:      server.ServerId == tm.serverId,
+		}
+		if known, ok := tm.servers[server.ServerId]; ok {
+			members[i].Load = known.Load
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ServerId < members[j].ServerId })
+	return members, nil
+}
+
+func (tm *TaskManager) DelayedCount() int {
+	return tm.delayQueue.Len()
+}
@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+)
+
+func TestTaskHistoryKeepsTheErrorOfEachAttempt(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	tm := startTestManager(t, store)
+	tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		return nil, fmt.Errorf("attempt %v failed", task.Attempt)
+	})
+	tm.StartManager()
+
+	id, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work", MaxRetry: 1, RetryDelay: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tm.Wait(ctx, id); err == nil {
+		t.Fatal("Wait = nil, want the task failed")
+	}
+
+	history, err := tm.GetTaskHistory(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Task.Error != "attempt 1 failed" {
+		t.Errorf("task error = %q, want that of the last attempt", history.Task.Error)
+	}
+	if len(history.Logs) != 2 {
+		t.Fatalf("history has %v attempts, want 2: %+v", len(history.Logs), history.Logs)
+	}
+	for i, taskLog := range history.Logs {
+		if want := fmt.Sprintf("attempt %v failed", i); taskLog.Attempt != i || taskLog.Error != want {
+			t.Errorf("attempt %v = %v %q, want %v %q", i, taskLog.Attempt, taskLog.Error, i, want)
+		}
+	}
+}
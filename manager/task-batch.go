@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+var ErrInvalidBatch = errors.New("invalid batch")
+
+// AddBatch saves every task of the batch at once and schedules them. Batch
+// tasks run on registered handlers, so each one needs a type.
+func (tm *TaskManager) AddBatch(batch model.Batch) (string, []string, error) {
+	if len(batch.Tasks) == 0 {
+		return "", nil, fmt.Errorf("%w: no tasks", ErrInvalidBatch)
+	}
+	now := time.Now().Unix()
+	for i := range batch.Tasks {
+		if batch.Tasks[i].Type == "" {
+			return "", nil, fmt.Errorf("%w: task %v has no type", ErrInvalidBatch, i)
+		}
+		if err := tm.checkPayloadSize(batch.Tasks[i]); err != nil {
+			return "", nil, fmt.Errorf("task %v: %w", i, err)
+		}
+		if batch.Tasks[i].Delay > 0 {
+			batch.Tasks[i].ExecutionTime = now + int64(batch.Tasks[i].Delay)*60
+		}
+	}
+	if batch.OnComplete != nil && batch.OnComplete.Type == "" {
+		return "", nil, fmt.Errorf("%w: callback has no type", ErrInvalidBatch)
+	}
+	ids, err := tm.storageClient.SaveBatch(&batch)
+	if err != nil {
+		return "", nil, err
+	}
+	for i, id := range ids {
+		tm.submitted(id, batch.Tasks[i])
+		tm.schedule(pendingDetail(id, batch.Tasks[i]), nil)
+	}
+	return batch.Id, ids, nil
+}
+
+func (tm *TaskManager) GetBatch(id string) (*model.Batch, error) {
+	return tm.storageClient.GetBatch(id)
+}
+
+// checkBatch adds the callback of the batch once its last task finished.
+// Every server finishing a task of the batch calls it; FinishBatch lets
+// only one of them add the callback.
+func (tm *TaskManager) checkBatch(batchId string) {
+	batch, err := tm.storageClient.GetBatch(batchId)
+	if err != nil {
+		tm.logger.Error("failed to load batch", "batchId", batchId, "error", err)
+		return
+	}
+	if batch.Status != util.TASK_STATUS_RUNNING || !batch.Done() {
+		return
+	}
+	var callback *model.TaskMeta
+	if batch.OnComplete != nil {
+		meta := *batch.OnComplete
+		if meta.PassResult {
+			summary := *batch
+			summary.Status = util.TASK_STATUS_COMPLETED
+			summary.OnComplete = nil
+			if meta.Payload, err = json.Marshal(summary); err != nil {
+				tm.logger.Error("failed to encode batch", "batchId", batchId, "error", err)
+				return
+			}
+			meta.Codec = util.CODEC_JSON
+		}
+		if meta.Delay > 0 {
+			meta.ExecutionTime = time.Now().Unix() + int64(meta.Delay)*60
+		}
+		callback = &meta
+	}
+	callbackId, finished, err := tm.storageClient.FinishBatch(batchId, callback)
+	if err != nil {
+		tm.logger.Error("failed to finish batch", "batchId", batchId, "error", err)
+		return
+	}
+	if finished && callback != nil {
+		tm.submitted(callbackId, *callback)
+		tm.schedule(pendingDetail(callbackId, *callback), nil)
+	}
+}
+
+// reconcileBatches adds the callback of running batches whose tasks all
+// finished, in case the server that finished the last one stopped first.
+func (tm *TaskManager) reconcileBatches() {
+	ids, err := tm.storageClient.GetRunningBatches()
+	if err != nil {
+		tm.logger.Error("failed to list running batches", "error", err)
+		return
+	}
+	for _, id := range ids {
+		tm.checkBatch(id)
+	}
+}
@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"context"
+	"testing"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+func TestReconcileFinishesBatchAfterCrash(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	// A server finished every task of the batch and stopped before adding
+	// the callback.
+	batch := &model.Batch{
+		Tasks:      []model.TaskMeta{{Type: "work"}, {Type: "work"}},
+		OnComplete: &model.TaskMeta{Type: "done"},
+	}
+	ids, err := store.SaveBatch(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if _, completed, err := store.UpdateTaskComplete(id, nil, nil); err != nil || !completed {
+			t.Fatalf("UpdateTaskComplete = %v, %v", completed, err)
+		}
+	}
+
+	tm := startTestManager(t, store)
+	callbacks := make(chan string, 2)
+	tm.RegisterHandler("done", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		callbacks <- task.Id
+		return nil, nil
+	})
+	tm.StartManager()
+
+	eventually(t, "the batch callback to run", func() bool { return len(callbacks) > 0 })
+	batch, err = store.GetBatch(batch.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Status != util.TASK_STATUS_COMPLETED || batch.CallbackId != <-callbacks {
+		t.Fatalf("batch = %+v, want it completed by the callback that ran", batch)
+	}
+}
@@ -0,0 +1,143 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+var (
+	ErrNoTaskContext = errors.New("context does not belong to a running task")
+	errTaskCancelled = errors.New("task cancelled")
+)
+
+type taskContextKey struct{}
+
+// taskScope is what a running handler's context knows about its task.
+type taskScope struct {
+	tm     *TaskManager
+	task   model.TaskDetail
+	logger *capturedLogger
+}
+
+func withTaskScope(ctx context.Context, tm *TaskManager, task model.TaskDetail, logger *capturedLogger) context.Context {
+	return context.WithValue(ctx, taskContextKey{}, &taskScope{tm: tm, task: task, logger: logger})
+}
+
+// TaskFromContext returns the task whose handler got ctx.
+func TaskFromContext(ctx context.Context) (model.TaskDetail, bool) {
+	scope, ok := ctx.Value(taskContextKey{}).(*taskScope)
+	if !ok {
+		return model.TaskDetail{}, false
+	}
+	return scope.task, true
+}
+
+// inHandler reports whether ctx belongs to a running handler.
+func inHandler(ctx context.Context) bool {
+	_, ok := ctx.Value(taskContextKey{}).(*taskScope)
+	return ok
+}
+
+// Spawn adds a child of the task whose handler got ctx. The child is a
+// normal task with its ParentId set, so it runs on any server with a
+// handler for its type, and cancelling the parent cancels it too. Spawn
+// never waits for room in a full queue; the child runs once a worker is
+// free.
+func Spawn(ctx context.Context, meta model.TaskMeta) (string, error) {
+	scope, ok := ctx.Value(taskContextKey{}).(*taskScope)
+	if !ok {
+		return "", ErrNoTaskContext
+	}
+	if meta.Type == "" {
+		return "", fmt.Errorf("child task of %v needs a type", scope.task.Id)
+	}
+	meta.ParentId = scope.task.Id
+	return scope.tm.AddNewTaskContext(ctx, model.Task{Meta: meta})
+}
+
+// WaitChildren blocks until every child of the task whose handler got ctx
+// finished, and returns the errors of those that did not succeed. The
+// parent holds a worker while it waits, so the pool must be able to run
+// the children next to every waiting parent.
+func WaitChildren(ctx context.Context) error {
+	scope, ok := ctx.Value(taskContextKey{}).(*taskScope)
+	if !ok {
+		return ErrNoTaskContext
+	}
+	children, err := scope.tm.storageClient.GetChildTasks(scope.task.Id)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, child := range children {
+		if err := scope.tm.Wait(ctx, child.Id); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CancelTask cancels a task that has not finished and, in turn, all its
+// children. A handler running the task on this server sees its context
+// cancelled right away; on other servers once the notification arrives.
+func (tm *TaskManager) CancelTask(id string) (bool, error) {
+	cancelled, err := tm.storageClient.CancelTask(id)
+	if err != nil {
+		return false, err
+	}
+	if cancelled {
+		tm.cancelRunning(id)
+		tm.resolveWaiters(id, util.TASK_STATUS_CANCELLED)
+		task, err := tm.storageClient.GetTask(id)
+		if err != nil {
+			return true, err
+		}
+		tm.emit(util.TASK_EVENT_CANCELLED, *task, nil)
+		if task.Meta.WorkflowId != "" {
+			tm.onWorkflowTaskFinished(*task, util.TASK_STATUS_CANCELLED)
+		}
+		if task.Meta.BatchId != "" {
+			tm.checkBatch(task.Meta.BatchId)
+		}
+	}
+	children, err := tm.storageClient.GetChildTasks(id)
+	if err != nil {
+		return cancelled, err
+	}
+	for _, child := range children {
+		if isTerminalStatus(child.Status) {
+			continue
+		}
+		if _, err := tm.CancelTask(child.Id); err != nil {
+			return cancelled, err
+		}
+	}
+	return cancelled, nil
+}
+
+func (tm *TaskManager) trackRunning(id string, cancel context.CancelCauseFunc) {
+	tm.runningMu.Lock()
+	defer tm.runningMu.Unlock()
+	tm.running[id] = cancel
+}
+
+func (tm *TaskManager) untrackRunning(id string) {
+	tm.runningMu.Lock()
+	defer tm.runningMu.Unlock()
+	delete(tm.running, id)
+}
+
+func (tm *TaskManager) cancelRunning(id string) {
+	tm.runningMu.Lock()
+	defer tm.runningMu.Unlock()
+	if cancel, ok := tm.running[id]; ok {
+		cancel(errTaskCancelled)
+	}
+}
@@ -0,0 +1,92 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+func TestSpawnChecksPayloadSize(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	tm := startTestManager(t, store)
+	tm.SetMaxPayloadSize(4)
+	spawned := make(chan error, 2)
+	tm.RegisterHandler("parent", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		_, err := Spawn(ctx, model.TaskMeta{Type: "child", Payload: []byte("too large")})
+		spawned <- err
+		_, err = Spawn(ctx, model.TaskMeta{Type: "child", Payload: []byte("ok")})
+		spawned <- err
+		return nil, nil
+	})
+	tm.RegisterHandler("child", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		return nil, nil
+	})
+	tm.StartManager()
+
+	id, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "parent"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tm.Wait(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-spawned; !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("Spawn of a large payload = %v, want ErrPayloadTooLarge", err)
+	}
+	if err := <-spawned; err != nil {
+		t.Errorf("Spawn of a small payload = %v", err)
+	}
+	children, err := store.GetChildTasks(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 1 || string(children[0].Meta.Payload) != "ok" {
+		t.Errorf("children = %+v, want only the small one", children)
+	}
+}
+
+func TestSpawnDoesNotBlockOnAFullQueue(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	tm := startTestManager(t, store)
+	// One worker and no buffer: the parent alone fills the queue.
+	if err := tm.AddQueue(model.QueueConfig{Name: util.DEFAULT_QUEUE, Workers: 1}); err != nil {
+		t.Fatal(err)
+	}
+	spawned := make(chan string, 3)
+	tm.RegisterHandler("parent", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		for i := 0; i < 3; i++ {
+			id, err := Spawn(ctx, model.TaskMeta{Type: "child"})
+			if err != nil {
+				return nil, err
+			}
+			spawned <- id
+		}
+		return nil, nil
+	})
+	tm.RegisterHandler("child", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		return nil, nil
+	})
+	tm.StartManager()
+
+	id, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "parent"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tm.Wait(ctx, id); err != nil {
+		t.Fatalf("Wait for the parent = %v, want Spawn not to wait for its own worker", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := tm.Wait(ctx, <-spawned); err != nil {
+			t.Errorf("Wait for a child = %v", err)
+		}
+	}
+}
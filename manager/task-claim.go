@@ -0,0 +1,182 @@
+package manager
+
+import (
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+func (tm *TaskManager) claimLoop() {
+	events := make(chan model.TaskEvent)
+	if tm.listener != nil {
+		go tm.consume("task notification", func() error { return tm.listener.Listen(events) })
+	}
+	ticker := time.NewTicker(util.CLAIM_POLL_INTERVAL * time.Second)
+	defer ticker.Stop()
+	lastClaim := time.Now()
+	lastRequeue := time.Now()
+	lastPauseRefresh := time.Now()
+	lastConfigReload := time.Now()
+	lastReconcile := time.Now()
+	tm.refreshPauses()
+	tm.requeueStale()
+	tm.reconcile()
+	tm.claimPending()
+	for {
+		select {
+		case <-tm.done:
+			return
+		case event := <-events:
+			if event.Id == "" || event.Status == util.TASK_STATUS_PENDING {
+				tm.signalClaim()
+			} else if isTerminalStatus(event.Status) {
+				if event.Status == util.TASK_STATUS_CANCELLED {
+					tm.cancelRunning(event.Id)
+				}
+				tm.resolveWaiters(event.Id, event.Status)
+			}
+		case <-tm.wake:
+			tm.claimPending()
+			lastClaim = time.Now()
+		case <-ticker.C:
+			listening := tm.listener != nil && tm.listener.Connected()
+			if time.Since(lastPauseRefresh) >= util.PAUSE_REFRESH_INTERVAL*time.Second {
+				tm.refreshPauses()
+				lastPauseRefresh = time.Now()
+			}
+			if time.Since(lastConfigReload) >= util.TASK_CONFIG_RELOAD_INTERVAL*time.Second {
+				tm.reloadTaskConfig()
+				lastConfigReload = time.Now()
+			}
+			if time.Since(lastReconcile) >= util.RECONCILE_INTERVAL*time.Second {
+				tm.reconcile()
+				lastReconcile = time.Now()
+			}
+			if time.Since(lastRequeue) >= util.CLAIM_SAFETY_INTERVAL*time.Second {
+				tm.requeueStale()
+				lastRequeue = time.Now()
+			}
+			if !listening || time.Since(lastClaim) >= util.CLAIM_SAFETY_INTERVAL*time.Second {
+				tm.claimPending()
+				lastClaim = time.Now()
+			}
+		}
+	}
+}
+
+func (tm *TaskManager) requeueStale() {
+	count, err := tm.storageClient.RequeueStaleTasks()
+	if err != nil {
+		tm.logger.Error("failed to requeue tasks of stopped servers", "error", err)
+	} else if count > 0 {
+		tm.logger.Info("requeued tasks of stopped servers", "count", count)
+	}
+}
+
+// reconcile finishes the workflow and batch steps that servers which
+// stopped between committing a task and updating its workflow or batch
+// left undone.
+func (tm *TaskManager) reconcile() {
+	tm.reconcileWorkflows()
+	tm.reconcileBatches()
+}
+
+func (tm *TaskManager) signalClaim() {
+	select {
+	case tm.wake <- struct{}{}:
+	default:
+	}
+}
+
+// claimPending claims due tasks for every queue with room, highest
+// priority first. Tasks of a queue this server does not have are claimed
+// for the default queue.
+func (tm *TaskManager) claimPending() {
+	if tm.isPaused(util.PAUSE_SCOPE_SCHEDULER, "") {
+		return
+	}
+	tm.handlersMu.RLock()
+	types := make([]string, 0, len(tm.handlers))
+	for taskType := range tm.handlers {
+		if !tm.isPaused(util.PAUSE_SCOPE_TYPE, taskType) {
+			types = append(types, taskType)
+		}
+	}
+	tm.handlersMu.RUnlock()
+	types = tm.rateOpen(types)
+	if len(types) == 0 {
+		return
+	}
+	queues := tm.queuesByPriority()
+	known := make([]string, len(queues))
+	for i, queue := range queues {
+		known[i] = queue.config.Name
+	}
+	full := false
+	for _, queue := range queues {
+		if tm.isPaused(util.PAUSE_SCOPE_QUEUE, queue.config.Name) {
+			continue
+		}
+		limit := queue.actor.Capacity() - int(queue.inFlight.Load())
+		if limit <= 0 {
+			full = true
+			continue
+		}
+		tasks, err := tm.storageClient.ClaimPendingTasks(tm.serverId, queue.config.Name, known, types, limit)
+		if err != nil {
+			tm.logger.Error("failed to claim pending tasks", "queue", queue.config.Name, "error", err)
+			continue
+		}
+		full = full || len(tasks) == limit
+		for _, task := range tasks {
+			if wait := tm.reserve(task.Meta.Type); wait > 0 {
+				executionTime := time.Now().Add(wait).Unix() + 1
+				_, err := tm.storageClient.DeferTask(task.Id, executionTime)
+				if err == nil {
+					continue
+				}
+				tm.taskLogger(task).Warn("failed to defer task, running it now", "error", err)
+			}
+			handler := tm.handler(task.Meta.Type)
+			go tm.assignTask(task, handler, nil)
+		}
+	}
+	tm.claimFull.Store(full)
+}
+
+func (tm *TaskManager) addWaiter(idTask string) chan string {
+	statusCh := make(chan string, 1)
+	tm.waitersMu.Lock()
+	defer tm.waitersMu.Unlock()
+	tm.waiters[idTask] = append(tm.waiters[idTask], statusCh)
+	return statusCh
+}
+
+func (tm *TaskManager) removeWaiter(idTask string, statusCh chan string) {
+	tm.waitersMu.Lock()
+	defer tm.waitersMu.Unlock()
+	waiters := tm.waiters[idTask]
+	for i, waiter := range waiters {
+		if waiter == statusCh {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(tm.waiters, idTask)
+	} else {
+		tm.waiters[idTask] = waiters
+	}
+}
+
+func (tm *TaskManager) resolveWaiters(idTask string, status string) {
+	tm.waitersMu.Lock()
+	defer tm.waitersMu.Unlock()
+	for _, statusCh := range tm.waiters[idTask] {
+		select {
+		case statusCh <- status:
+		default:
+		}
+	}
+}
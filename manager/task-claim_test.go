@@ -0,0 +1,157 @@
+package manager
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// fakeListener stands in for the Postgres listener: Listen hands the test
+// the channel of the claim loop, so the test sends the notifications.
+type fakeListener struct {
+	connected atomic.Bool
+	events    chan chan model.TaskEvent
+	done      chan int
+}
+
+func newFakeListener(connected bool) *fakeListener {
+	listener := &fakeListener{events: make(chan chan model.TaskEvent, 1)}
+	listener.connected.Store(connected)
+	return listener
+}
+
+func (l *fakeListener) Listen(events chan model.TaskEvent) error {
+	l.events <- events
+	<-l.done
+	return nil
+}
+
+func (l *fakeListener) Connected() bool {
+	return l.connected.Load()
+}
+
+// startListening starts a manager with listener that runs "work" tasks
+// and reports their ids on the returned channel.
+func startListening(t *testing.T, store *storage.MemoryStorage, listener *fakeListener) (*TaskManager, chan string) {
+	t.Helper()
+	tm := startTestManager(t, store)
+	listener.done = tm.done
+	tm.UseListener(listener)
+	ran := make(chan string, 10)
+	tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		ran <- task.Id
+		return nil, nil
+	})
+	tm.StartManager()
+	return tm, ran
+}
+
+// waitForWaiter blocks until Wait registered for id and had time to look
+// at the task once.
+func waitForWaiter(t *testing.T, tm *TaskManager, id string) {
+	t.Helper()
+	eventually(t, "Wait to start", func() bool {
+		tm.waitersMu.Lock()
+		defer tm.waitersMu.Unlock()
+		return len(tm.waiters[id]) > 0
+	})
+	time.Sleep(100 * time.Millisecond)
+}
+
+func TestNotificationsWakeTheClaimLoopAndWait(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	listener := newFakeListener(true)
+	tm, ran := startListening(t, store, listener)
+	events := <-listener.events
+	// The claim loop reads events only after its first claim, so once this
+	// one is taken the task below can only be found through a notification.
+	events <- model.TaskEvent{Id: "unknown", Status: util.TASK_STATUS_COMPLETED}
+
+	id, err := store.SaveTask(&model.TaskMeta{Type: "work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ran:
+		t.Fatal("a connected listener polled for the task")
+	case <-time.After(2 * util.CLAIM_POLL_INTERVAL * time.Second):
+	}
+	events <- model.TaskEvent{Id: id, Status: util.TASK_STATUS_PENDING}
+	select {
+	case got := <-ran:
+		if got != id {
+			t.Errorf("ran %v, want %v", got, id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the notification did not wake the claim loop")
+	}
+
+	// Nothing on this server runs "other" tasks: another server cancels it.
+	otherId, err := store.SaveTask(&model.TaskMeta{Type: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waited := make(chan error, 1)
+	go func() { waited <- tm.Wait(context.Background(), otherId) }()
+	waitForWaiter(t, tm, otherId)
+	if _, err := store.CancelTask(otherId); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-waited:
+		t.Fatalf("Wait = %v before the notification, want it not to poll", err)
+	case <-time.After(2 * util.CLAIM_POLL_INTERVAL * time.Second):
+	}
+	events <- model.TaskEvent{Id: otherId, Status: util.TASK_STATUS_CANCELLED}
+	select {
+	case err := <-waited:
+		if err == nil || !strings.Contains(err.Error(), util.TASK_STATUS_CANCELLED) {
+			t.Errorf("Wait = %v, want the task cancelled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the notification did not wake Wait")
+	}
+}
+
+func TestPollingWhileTheListenerIsDisconnected(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	tm, ran := startListening(t, store, newFakeListener(false))
+
+	id, err := store.SaveTask(&model.TaskMeta{Type: "work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-ran:
+		if got != id {
+			t.Errorf("ran %v, want %v", got, id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the claim loop did not poll for the task")
+	}
+
+	otherId, err := store.SaveTask(&model.TaskMeta{Type: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waited := make(chan error, 1)
+	go func() { waited <- tm.Wait(context.Background(), otherId) }()
+	waitForWaiter(t, tm, otherId)
+	if _, err := store.CancelTask(otherId); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-waited:
+		if err == nil || !strings.Contains(err.Error(), util.TASK_STATUS_CANCELLED) {
+			t.Errorf("Wait = %v, want the task cancelled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not poll for the task")
+	}
+}
@@ -0,0 +1,234 @@
+package manager
+
+import (
+	"encoding/json"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+func (tm *TaskManager) joinCluster() {
+	tm.serversMu.Lock()
+	tm.servers[tm.serverId] = &model.Servers{Id: tm.serverId}
+	tm.serversMu.Unlock()
+
+	taskDeliveries := make(chan model.Delivery)
+	completeDeliveries := make(chan model.Delivery)
+	membershipDeliveries := make(chan model.Delivery)
+	go tm.consume("task", func() error { return tm.broker.ConsumeTasks(tm.serverId, taskDeliveries) })
+	go tm.consume("complete task", func() error { return tm.broker.ConsumeTaskComplete(tm.serverId, completeDeliveries) })
+	go tm.consume("membership", func() error { return tm.broker.ConsumeMembership(tm.serverId, membershipDeliveries) })
+	go tm.clusterLoop(taskDeliveries, completeDeliveries, membershipDeliveries)
+	go tm.announceJoin()
+}
+
+func (tm *TaskManager) consume(name string, consumeFn func() error) {
+	if err := consumeFn(); err != nil {
+		tm.logger.Error("consumer stopped", "consumer", name, "error", err)
+	}
+}
+
+// heartbeat keeps this server in jobservers; tasks claimed by a server
+// whose heartbeat is older than SERVER_STALE_AFTER are requeued.
+func (tm *TaskManager) heartbeat() {
+	ticker := time.NewTicker(util.SERVER_HEARTBEAT_INTERVAL * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tm.done:
+			tm.updateServerStatus(util.SERVER_STATUS_LEFT)
+			return
+		case <-ticker.C:
+			tm.updateServerStatus(util.SERVER_STATUS_ACTIVE)
+		}
+	}
+}
+
+func (tm *TaskManager) updateServerStatus(status int) {
+	if err := tm.storageClient.UpdateServerStatus(tm.serverId, status); err != nil {
+		tm.logger.Error("failed to update server status", "serverId", tm.serverId, "error", err)
+	}
+}
+
+func (tm *TaskManager) announce(status int) {
+	joinData := model.JoinData{
+		ServerId: tm.serverId,
+		Status:   status,
+	}
+	if err := tm.broker.PublishMembership(joinData); err != nil {
+		tm.logger.Error("failed to publish membership", "serverId", tm.serverId, "error", err)
+	}
+}
+
+func (tm *TaskManager) clusterLoop(taskDeliveries, completeDeliveries, membershipDeliveries chan model.Delivery) {
+	for {
+		select {
+		case <-tm.done:
+			tm.announce(util.SERVER_STATUS_LEFT)
+			tm.broker.Shutdown()
+			return
+		case d := <-taskDeliveries:
+			tm.onTaskMessage(d)
+		case d := <-completeDeliveries:
+			tm.onCompleteMessage(d)
+		case d := <-membershipDeliveries:
+			tm.onMembershipMessage(d)
+		}
+	}
+}
+
+func (tm *TaskManager) onTaskMessage(d model.Delivery) {
+	var msg model.TaskMessage
+	if err := json.Unmarshal(d.Body, &msg); err != nil {
+		tm.logger.Error("invalid task message", "error", err)
+		d.Reject()
+		return
+	}
+	task, err := tm.storageClient.GetTask(msg.TaskId)
+	if err != nil {
+		tm.logger.Error("failed to load task", "taskId", msg.TaskId, "error", err)
+		d.Reject()
+		return
+	}
+	if traceParent := d.Headers[util.TRACE_PARENT_HEADER]; traceParent != "" {
+		task.Meta.TraceParent = traceParent
+	}
+	handler := tm.handler(task.Meta.Type)
+	if handler == nil {
+		tm.taskLogger(*task).Error("no handler registered for task type")
+		d.Reject()
+		return
+	}
+	if tm.taskPaused(task.Meta) {
+		// Left pending for whichever server claims it after the pause.
+		tm.publishComplete(task.Id, task.Status)
+		d.Ack()
+		return
+	}
+	claimed, err := tm.storageClient.ClaimTask(task.Id, tm.serverId)
+	if err != nil {
+		tm.taskLogger(*task).Error("failed to claim task", "error", err)
+		d.Reject()
+		return
+	}
+	if !claimed {
+		tm.publishComplete(task.Id, "")
+		d.Ack()
+		return
+	}
+	go tm.assignTask(*task, handler, func(status string) {
+		tm.publishComplete(task.Id, status)
+		d.Ack()
+	})
+}
+
+// publishComplete tells the server that sent a task that this server is
+// done with it, so it stops counting the task against this server's load.
+func (tm *TaskManager) publishComplete(taskId string, status string) {
+	err := tm.broker.PublishTaskComplete(model.TaskMessage{
+		ServerId: tm.serverId,
+		TaskId:   taskId,
+		Status:   status,
+	})
+	if err != nil {
+		tm.logger.Error("failed to publish task complete", "taskId", taskId, "error", err)
+	}
+}
+
+func (tm *TaskManager) onCompleteMessage(d model.Delivery) {
+	var msg model.TaskMessage
+	if err := json.Unmarshal(d.Body, &msg); err != nil {
+		tm.logger.Error("invalid complete task message", "error", err)
+	} else {
+		tm.releaseServer(msg.TaskId)
+		tm.resolveWaiters(msg.TaskId, msg.Status)
+	}
+	d.Ack()
+}
+
+func (tm *TaskManager) onMembershipMessage(d model.Delivery) {
+	var joinData model.JoinData
+	if err := json.Unmarshal(d.Body, &joinData); err != nil {
+		tm.logger.Error("invalid membership message", "error", err)
+		d.Ack()
+		return
+	}
+	d.Ack()
+	if joinData.ServerId == tm.serverId {
+		if joinData.Status == util.SERVER_STATUS_JOINING {
+			tm.joined.Store(true)
+		}
+		return
+	}
+	tm.serversMu.Lock()
+	if joinData.Status == util.SERVER_STATUS_LEFT {
+		delete(tm.servers, joinData.ServerId)
+	} else if _, ok := tm.servers[joinData.ServerId]; !ok {
+		tm.servers[joinData.ServerId] = &model.Servers{Id: joinData.ServerId}
+	}
+	tm.serversMu.Unlock()
+	// A joining server missed the announcements sent before it listened.
+	if joinData.Status == util.SERVER_STATUS_JOINING {
+		tm.announce(util.SERVER_STATUS_ACTIVE)
+	}
+}
+
+// announceJoin tells the cluster this server joined until its own
+// announcement comes back, which shows it listens for the answers. The
+// broker only delivers to servers listening at the time, so one
+// announcement sent before the consumer is up would be lost.
+func (tm *TaskManager) announceJoin() {
+	ticker := time.NewTicker(util.JOIN_ANNOUNCE_INTERVAL * time.Millisecond)
+	defer ticker.Stop()
+	for i := 0; i < util.JOIN_ANNOUNCE_ATTEMPTS; i++ {
+		tm.announce(util.SERVER_STATUS_JOINING)
+		select {
+		case <-tm.done:
+			return
+		case <-ticker.C:
+		}
+		if tm.joined.Load() {
+			return
+		}
+	}
+	tm.logger.Warn("no answer to join announcement", "serverId", tm.serverId)
+}
+
+func (tm *TaskManager) taskWeight(taskType string) int {
+	if taskWeight, ok := tm.tasksWeight[taskType]; ok && taskWeight.Weight > 0 {
+		return taskWeight.Weight
+	}
+	return 1
+}
+
+func (tm *TaskManager) pickServer(idTask string, taskType string) string {
+	tm.serversMu.Lock()
+	defer tm.serversMu.Unlock()
+	var picked *model.Servers
+	for _, server := range tm.servers {
+		if picked == nil || server.Load < picked.Load {
+			picked = server
+		}
+	}
+	if picked == nil {
+		return tm.serverId
+	}
+	weight := tm.taskWeight(taskType)
+	picked.Load += weight
+	tm.assigned[idTask] = assignment{serverId: picked.Id, weight: weight}
+	return picked.Id
+}
+
+func (tm *TaskManager) releaseServer(idTask string) {
+	tm.serversMu.Lock()
+	defer tm.serversMu.Unlock()
+	assigned, ok := tm.assigned[idTask]
+	if !ok {
+		return
+	}
+	delete(tm.assigned, idTask)
+	if server, ok := tm.servers[assigned.serverId]; ok {
+		server.Load -= assigned.weight
+	}
+}
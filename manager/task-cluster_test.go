@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+type testNode struct {
+	tm   *TaskManager
+	done chan int
+}
+
+// startTestNode starts a server on store and hub, applying setup before
+// it starts.
+func startTestNode(t *testing.T, store util.StorageClient, hub *storage.MemoryHub, serverId string, handler model.TaskHandler, setup ...func(tm *TaskManager)) *testNode {
+	t.Helper()
+	done := make(chan int)
+	tm := InitManager(store, NewTaskActor(2, done, 10), done, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	tm.SetServerId(serverId)
+	tm.UseBroker(storage.NewMemoryBroker(done, hub))
+	tm.RegisterHandler("work", handler)
+	for _, apply := range setup {
+		apply(tm)
+	}
+	tm.StartManager()
+	node := &testNode{tm: tm, done: done}
+	t.Cleanup(node.stop)
+	return node
+}
+
+func (n *testNode) stop() {
+	select {
+	case <-n.done:
+	default:
+		close(n.done)
+	}
+}
+
+func (n *testNode) knows(serverIds ...string) bool {
+	n.tm.serversMu.Lock()
+	defer n.tm.serversMu.Unlock()
+	if len(n.tm.servers) != len(serverIds) {
+		return false
+	}
+	for _, serverId := range serverIds {
+		if _, ok := n.tm.servers[serverId]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClusterRunsEveryTaskOnce(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	hub := storage.NewMemoryHub()
+
+	var mu sync.Mutex
+	runs := make(map[string]int)
+	ranOn := make(map[string]int)
+	handlerOf := func(serverId string) model.TaskHandler {
+		return func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			runs[task.Id]++
+			ranOn[serverId]++
+			mu.Unlock()
+			return nil, nil
+		}
+	}
+
+	var nodes []*testNode
+	var serverIds []string
+	for i := 0; i < 3; i++ {
+		serverId := fmt.Sprintf("node-%v", i)
+		serverIds = append(serverIds, serverId)
+		nodes = append(nodes, startTestNode(t, store, hub, serverId, handlerOf(serverId)))
+		// A node learns the ones before it from their announcements or
+		// jobservers, and they learn it from its announcement.
+		for _, node := range nodes {
+			eventually(t, "membership", func() bool { return node.knows(serverIds...) })
+		}
+	}
+
+	var ids []string
+	for i := 0; i < 12; i++ {
+		id, err := nodes[0].tm.AddNewTask(model.Task{Meta: model.TaskMeta{MetaId: fmt.Sprint(i), Type: "work"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, id := range ids {
+		if err := nodes[0].tm.Wait(ctx, id); err != nil {
+			t.Fatalf("task %v: %v", id, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range ids {
+		if runs[id] != 1 {
+			t.Errorf("task %v ran %v times, want once", id, runs[id])
+		}
+	}
+	if len(ranOn) < 2 {
+		t.Errorf("tasks ran on %v, want them spread over the cluster", ranOn)
+	}
+}
+
+func TestClusterBroadcastsMembership(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	hub := storage.NewMemoryHub()
+	noop := func(ctx context.Context, task model.TaskDetail) ([]byte, error) { return nil, nil }
+
+	a := startTestNode(t, store, hub, "a", noop)
+	b := startTestNode(t, store, hub, "b", noop)
+	eventually(t, "a and b to see each other", func() bool { return a.knows("a", "b") && b.knows("a", "b") })
+
+	c := startTestNode(t, store, hub, "c", noop)
+	eventually(t, "every node to see c join", func() bool {
+		return a.knows("a", "b", "c") && b.knows("a", "b", "c") && c.knows("a", "b", "c")
+	})
+
+	c.stop()
+	eventually(t, "a and b to see c leave", func() bool { return a.knows("a", "b") && b.knows("a", "b") })
+}
@@ -0,0 +1,84 @@
+package manager
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+)
+
+// ReloadTaskConfig reads jobconfig again, so weights and rate limits
+// changed in the table apply without a restart; limits set with
+// SetRateLimit stay. It returns what changed, which it also reports to the
+// config_changed hooks.
+func (tm *TaskManager) ReloadTaskConfig() ([]string, error) {
+	taskWeights, err := tm.storageClient.GetTaskConfig()
+	if err != nil {
+		return nil, err
+	}
+	tasksWeight := make(map[string]model.TaskWeight, len(taskWeights))
+	for _, taskWeight := range taskWeights {
+		tasksWeight[taskWeight.Type] = taskWeight
+	}
+	tm.serversMu.Lock()
+	changes, limitChanged := tm.taskConfigChanges(tasksWeight)
+	tm.tasksWeight = tasksWeight
+	tm.serversMu.Unlock()
+	for _, taskType := range limitChanged {
+		tm.unblockRate(taskType)
+	}
+	if len(changes) > 0 {
+		tm.logger.Info("task config changed", "changes", changes)
+		tm.ConfigChanged(changes, nil)
+	}
+	return changes, nil
+}
+
+func (tm *TaskManager) reloadTaskConfig() {
+	if _, err := tm.ReloadTaskConfig(); err != nil {
+		tm.logger.Error("failed to reload task config", "error", err)
+	}
+}
+
+// taskConfigChanges returns what replacing jobconfig with tasksWeight
+// changes for each type, and the types whose limit changed. A limit of
+// SetRateLimit hides the one of jobconfig. The caller holds serversMu.
+func (tm *TaskManager) taskConfigChanges(tasksWeight map[string]model.TaskWeight) ([]string, []string) {
+	var changes, limitChanged []string
+	for _, taskType := range unionKeys(tm.tasksWeight, tasksWeight) {
+		before, after := tm.tasksWeight[taskType], tasksWeight[taskType]
+		if before.Weight != after.Weight {
+			changes = append(changes, fmt.Sprintf("jobconfig.%v.weight: %v -> %v", taskType, before.Weight, after.Weight))
+		}
+		if _, overridden := tm.rateOverrides[taskType]; overridden {
+			continue
+		}
+		if !reflect.DeepEqual(before.RateLimit, after.RateLimit) {
+			changes = append(changes, fmt.Sprintf("jobconfig.%v.rateLimit: %v -> %v", taskType, formatRateLimit(before.RateLimit), formatRateLimit(after.RateLimit)))
+			limitChanged = append(limitChanged, taskType)
+		}
+	}
+	return changes, limitChanged
+}
+
+func formatRateLimit(limit *model.RateLimit) string {
+	if limit == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%+v", *limit)
+}
+
+func unionKeys(a map[string]model.TaskWeight, b map[string]model.TaskWeight) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+)
+
+func TestReloadTaskConfig(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	store.SetTaskConfig([]model.TaskWeight{
+		{Type: "email", Weight: 2, RateLimit: &model.RateLimit{Limit: 10, Window: 60}},
+		{Type: "report", Weight: 1},
+	})
+	tm := startTestManager(t, store)
+	tm.SetRateLimit("report", model.RateLimit{Limit: 1, Window: 1})
+
+	store.SetTaskConfig([]model.TaskWeight{
+		{Type: "email", Weight: 3, RateLimit: &model.RateLimit{Limit: 20, Window: 60}},
+		{Type: "report", Weight: 1, RateLimit: &model.RateLimit{Limit: 5, Window: 60}},
+	})
+	changes, err := tm.ReloadTaskConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"jobconfig.email.weight: 2 -> 3",
+		"jobconfig.email.rateLimit: {Algorithm: Limit:10 Window:60 Burst:0 Shared:false} -> {Algorithm: Limit:20 Window:60 Burst:0 Shared:false}",
+	}
+	if strings.Join(changes, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes = %q, want %q", changes, want)
+	}
+	if got := tm.taskWeight("email"); got != 3 {
+		t.Errorf("weight of email = %v, want 3", got)
+	}
+	if limit, _ := tm.rateLimit("email"); limit.Limit != 20 {
+		t.Errorf("limit of email = %+v, want the reloaded one", limit)
+	}
+	if limit, _ := tm.rateLimit("report"); limit.Limit != 1 {
+		t.Errorf("limit of report = %+v, want the one of SetRateLimit over jobconfig", limit)
+	}
+
+	tm.ClearRateLimit("report")
+	if limit, _ := tm.rateLimit("report"); limit.Limit != 5 {
+		t.Errorf("limit of report after ClearRateLimit = %+v, want the one of jobconfig", limit)
+	}
+	if changes, err := tm.ReloadTaskConfig(); err != nil || len(changes) != 0 {
+		t.Errorf("ReloadTaskConfig of the same rows = %q, %v, want no changes", changes, err)
+	}
+}
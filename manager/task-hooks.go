@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+type registeredHook struct {
+	event string
+	hook  model.LifecycleHook
+}
+
+// OnEvent calls hook on every event of the kind given, or on every event
+// with TASK_EVENT_ANY. Hooks run in the order they were added, on the
+// goroutine where the event happens, so a slow hook holds up the task; a
+// hook that panics is logged and skipped. The events of a task reach the
+// hooks of a server in the order they happened there: submitted, then
+// started, then failed followed by retried or dead_lettered, or succeeded.
+// Cancelled may come at any point.
+func (tm *TaskManager) OnEvent(event string, hook model.LifecycleHook) {
+	tm.hooksMu.Lock()
+	defer tm.hooksMu.Unlock()
+	tm.hooks = append(tm.hooks, registeredHook{event: event, hook: hook})
+}
+
+// Use adds middleware around every handler this server runs. The first
+// middleware added is the outermost, so it sees the task first and the
+// result last; the handler is innermost. A middleware that panics fails
+// the attempt like a handler that panics.
+func (tm *TaskManager) Use(middleware model.Middleware) {
+	tm.hooksMu.Lock()
+	defer tm.hooksMu.Unlock()
+	tm.middleware = append(tm.middleware, middleware)
+}
+
+func (tm *TaskManager) withMiddleware(handler model.TaskHandler) model.TaskHandler {
+	tm.hooksMu.RLock()
+	defer tm.hooksMu.RUnlock()
+	for i := len(tm.middleware) - 1; i >= 0; i-- {
+		handler = tm.middleware[i](handler)
+	}
+	return handler
+}
+
+func (tm *TaskManager) emit(event string, task model.TaskDetail, err error) {
+	tm.emitEvent(model.LifecycleEvent{
+		Event:    event,
+		Task:     task,
+		Err:      err,
+		ServerId: tm.serverId,
+		Time:     time.Now(),
+	})
+}
+
+// ConfigChanged tells the hooks this server's config changed, and why
+// some changes were rejected when rejected is not nil.
+func (tm *TaskManager) ConfigChanged(changes []string, rejected error) {
+	tm.emitEvent(model.LifecycleEvent{
+		Event:    util.TASK_EVENT_CONFIG_CHANGED,
+		Err:      rejected,
+		ServerId: tm.serverId,
+		Time:     time.Now(),
+		Changes:  changes,
+	})
+}
+
+func (tm *TaskManager) emitEvent(lifecycleEvent model.LifecycleEvent) {
+	tm.hooksMu.RLock()
+	hooks := tm.hooks
+	tm.hooksMu.RUnlock()
+	for _, registered := range hooks {
+		if registered.event == lifecycleEvent.Event || registered.event == util.TASK_EVENT_ANY {
+			tm.runHook(registered.hook, lifecycleEvent)
+		}
+	}
+}
+
+func (tm *TaskManager) runHook(hook model.LifecycleHook, event model.LifecycleEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			tm.taskLogger(event.Task).Error("task hook panic", "event", event.Event, "error", fmt.Sprint(r))
+		}
+	}()
+	hook(event)
+}
+
+// submitted reports a task just saved to storage.
+func (tm *TaskManager) submitted(id string, meta model.TaskMeta) {
+	tm.countSubmitted(meta)
+	tm.emit(util.TASK_EVENT_SUBMITTED, pendingDetail(id, meta), nil)
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// trace records the steps of a test from any goroutine.
+type trace struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (t *trace) add(step string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steps = append(t.steps, step)
+}
+
+func (t *trace) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strings.Join(t.steps, ",")
+}
+
+func runTask(t *testing.T, tm *TaskManager, meta model.TaskMeta) error {
+	t.Helper()
+	id, err := tm.AddNewTask(model.Task{Meta: meta})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return tm.Wait(ctx, id)
+}
+
+func recording(steps *trace, name string) model.Middleware {
+	return func(next model.TaskHandler) model.TaskHandler {
+		return func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+			steps.add(name + " before")
+			result, err := next(ctx, task)
+			steps.add(name + " after")
+			return result, err
+		}
+	}
+}
+
+func TestFirstMiddlewareIsOutermost(t *testing.T) {
+	tm := startTestManager(t, storage.NewMemoryStorage())
+	steps := &trace{}
+	tm.Use(recording(steps, "first"))
+	tm.Use(recording(steps, "second"))
+	tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		steps.add("handler")
+		return nil, nil
+	})
+	tm.StartManager()
+	if err := runTask(t, tm, model.TaskMeta{Type: "work"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "first before,second before,handler,second after,first after"
+	if got := steps.String(); got != want {
+		t.Errorf("steps = %v, want %v", got, want)
+	}
+}
+
+func TestHooksRunInTheOrderAdded(t *testing.T) {
+	tm := startTestManager(t, storage.NewMemoryStorage())
+	steps := &trace{}
+	hook := func(name string) model.LifecycleHook {
+		return func(event model.LifecycleEvent) { steps.add(name + " " + event.Event) }
+	}
+	tm.OnEvent(util.TASK_EVENT_ANY, hook("a"))
+	tm.OnEvent(util.TASK_EVENT_SUCCEEDED, hook("b"))
+	tm.OnEvent(util.TASK_EVENT_ANY, hook("c"))
+	tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		return nil, nil
+	})
+	tm.StartManager()
+	if err := runTask(t, tm, model.TaskMeta{Type: "work"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "a submitted,c submitted,a started,c started,a succeeded,b succeeded,c succeeded"
+	eventually(t, "every hook to run", func() bool { return steps.String() == want })
+}
+
+func TestPanicsInHooksAndMiddleware(t *testing.T) {
+	tm := startTestManager(t, storage.NewMemoryStorage())
+	steps := &trace{}
+	var wrapPanics atomic.Bool
+	tm.OnEvent(util.TASK_EVENT_STARTED, func(event model.LifecycleEvent) { panic("hook") })
+	tm.OnEvent(util.TASK_EVENT_STARTED, func(event model.LifecycleEvent) { steps.add("hook after the panic") })
+	tm.Use(func(next model.TaskHandler) model.TaskHandler {
+		return func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+			if task.Meta.MetaId == "panic in middleware" {
+				panic("middleware")
+			}
+			return next(ctx, task)
+		}
+	})
+	tm.Use(func(next model.TaskHandler) model.TaskHandler {
+		if wrapPanics.Load() {
+			panic("wrapping")
+		}
+		return next
+	})
+	tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		steps.add("handler " + task.Meta.MetaId)
+		return nil, nil
+	})
+	tm.StartManager()
+
+	if err := runTask(t, tm, model.TaskMeta{Type: "work", MetaId: "ok"}); err != nil {
+		t.Errorf("task with a panicking hook = %v, want it to succeed", err)
+	}
+	if got := steps.String(); got != "hook after the panic,handler ok" {
+		t.Errorf("steps = %v, want the next hook and the handler to run", got)
+	}
+	err := runTask(t, tm, model.TaskMeta{Type: "work", MetaId: "panic in middleware"})
+	if err == nil || !strings.Contains(err.Error(), "panic: middleware") {
+		t.Errorf("task with a panicking middleware = %v, want it failed with the panic", err)
+	}
+	wrapPanics.Store(true)
+	err = runTask(t, tm, model.TaskMeta{Type: "work", MetaId: "wrapped"})
+	if err == nil || !strings.Contains(err.Error(), "panic: wrapping") {
+		t.Errorf("task whose middleware panics when wrapping = %v, want it failed with the panic", err)
+	}
+	// The workers survived every panic.
+	wrapPanics.Store(false)
+	if err := runTask(t, tm, model.TaskMeta{Type: "work", MetaId: "after"}); err != nil {
+		t.Errorf("task after the panics = %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// taskLogger returns the manager's logger with the fields of task.
+func (tm *TaskManager) taskLogger(task model.TaskDetail) util.Logger {
+	args := []any{"taskId", task.Id, "type", task.Meta.Type, "attempt", task.Attempt, "serverId", tm.serverId}
+	if task.Meta.WorkflowNode != "" {
+		args = append(args, "workflowId", task.Meta.WorkflowId, "workflowNode", task.Meta.WorkflowNode)
+	}
+	return util.LoggerWith(tm.logger, args...)
+}
+
+// LoggerFromContext returns the logger for the handler that got ctx. Its
+// records carry the task's fields and are saved with the attempt, so
+// GetTaskLogs shows them later. Outside a handler it is slog.Default().
+func LoggerFromContext(ctx context.Context) util.Logger {
+	scope, ok := ctx.Value(taskContextKey{}).(*taskScope)
+	if !ok || scope.logger == nil {
+		return slog.Default()
+	}
+	return scope.logger
+}
+
+// capturedLogger passes records on to logger and keeps them as text, up
+// to MAX_TASK_LOG_SIZE bytes.
+type capturedLogger struct {
+	logger    util.Logger
+	mu        sync.Mutex
+	text      strings.Builder
+	truncated bool
+}
+
+func newCapturedLogger(logger util.Logger) *capturedLogger {
+	return &capturedLogger{logger: logger}
+}
+
+func (l *capturedLogger) Debug(msg string, args ...any) {
+	l.logger.Debug(msg, args...)
+	l.capture(slog.LevelDebug, msg, args)
+}
+
+func (l *capturedLogger) Info(msg string, args ...any) {
+	l.logger.Info(msg, args...)
+	l.capture(slog.LevelInfo, msg, args)
+}
+
+func (l *capturedLogger) Warn(msg string, args ...any) {
+	l.logger.Warn(msg, args...)
+	l.capture(slog.LevelWarn, msg, args)
+}
+
+func (l *capturedLogger) Error(msg string, args ...any) {
+	l.logger.Error(msg, args...)
+	l.capture(slog.LevelError, msg, args)
+}
+
+func (l *capturedLogger) capture(level slog.Level, msg string, args []any) {
+	var line strings.Builder
+	fmt.Fprintf(&line, "%v %v %v", time.Now().Format(time.RFC3339), level, msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&line, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&line, " %v", args[i])
+		}
+	}
+	line.WriteByte('\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.truncated {
+		return
+	}
+	if l.text.Len()+line.Len() > util.MAX_TASK_LOG_SIZE {
+		l.truncated = true
+		l.text.WriteString("...truncated\n")
+		return
+	}
+	l.text.WriteString(line.String())
+}
+
+func (l *capturedLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.text.String()
+}
+
+// saveTaskLog keeps what the handler of task logged during this attempt
+// and the error it returned, since a retry replaces the error of the task.
+func (tm *TaskManager) saveTaskLog(task model.TaskDetail, captured *capturedLogger, taskErr error) {
+	taskLog := model.TaskLog{
+		TaskId:    task.Id,
+		Attempt:   task.Attempt,
+		Logs:      captured.String(),
+		CreatedAt: time.Now().Unix(),
+	}
+	if taskErr != nil {
+		taskLog.Error = taskErr.Error()
+	}
+	if taskLog.Logs == "" && taskLog.Error == "" {
+		return
+	}
+	err := tm.storageClient.SaveTaskLog(taskLog)
+	if err != nil {
+		tm.taskLogger(task).Error("failed to save task logs", "error", err)
+	}
+}
+
+func (tm *TaskManager) GetTaskLogs(taskId string) ([]model.TaskLog, error) {
+	return tm.storageClient.GetTaskLogs(taskId)
+}
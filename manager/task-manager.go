@@ -1,35 +1,81 @@
 package manager
 
 import (
-	"container/heap"
+	"context"
 	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	model "github.com/amitiwary999/task-scheduler/model"
 	util "github.com/amitiwary999/task-scheduler/util"
 )
 
+type assignment struct {
+	serverId string
+	weight   int
+}
+
 type TaskManager struct {
-	postgClient   util.PostgClient
-	taskActor     *TaskActor
+	storageClient util.StorageClient
+	queues        map[string]*taskQueue
 	done          chan int
-	priorityQueue PriorityQueue
+	ctx           context.Context
+	delayQueue    DelayQueue
+	broker        util.Broker
+	serverId      string
+	joined        atomic.Bool
+	serversMu     sync.Mutex
+	servers       map[string]*model.Servers
+	assigned      map[string]assignment
+	tasksWeight   map[string]model.TaskWeight
+	rateOverrides map[string]model.RateLimit
+	handlersMu    sync.RWMutex
+	handlers      map[string]model.TaskHandler
+	listener      util.TaskListener
+	wake          chan struct{}
+	claimFull     atomic.Bool
+	waitersMu     sync.Mutex
+	waiters       map[string][]chan string
+	runningMu     sync.Mutex
+	running       map[string]context.CancelCauseFunc
+	rateMu        sync.Mutex
+	rateStates    map[string]*util.RateState
+	rateBlocked   map[string]time.Time
+	pauseMu       sync.RWMutex
+	paused        map[pauseKey]bool
+	metrics       util.MetricsSink
+	tracer        util.Tracer
+	logger        util.Logger
+	hooksMu       sync.RWMutex
+	hooks         []registeredHook
+	middleware    []model.Middleware
+	retryDefaults atomic.Pointer[model.RetryPolicy]
+	payloadLimit  int
 }
 
-func InitManager(postgClient util.PostgClient, taskActor *TaskActor, done chan int) *TaskManager {
+// InitManager loads the task config and known servers from storageClient.
+// It logs through logger, or slog.Default() when logger is nil.
+func InitManager(storageClient util.StorageClient, taskActor *TaskActor, done chan int, logger util.Logger) *TaskManager {
+	if logger == nil {
+		logger = slog.Default()
+	}
 	servers := make(map[string]*model.Servers)
 	tasksWeight := make(map[string]model.TaskWeight)
 
-	var taskWeightConfig []model.TaskWeight
-	taskWeightConfig, _ = postgClient.GetTaskConfig()
+	taskWeightConfig, configErr := storageClient.GetTaskConfig()
+	if configErr != nil {
+		logger.Error("failed to load task config", "error", configErr)
+	}
 	for _, taskWeight := range taskWeightConfig {
 		tasksWeight[taskWeight.Type] = taskWeight
 	}
 
-	serversJoinData, serversErr := postgClient.GetAllUsedServer()
+	serversJoinData, serversErr := storageClient.GetAllUsedServer()
 
 	if serversErr != nil {
-		fmt.Printf("error in get all used servers %v\n", serversErr)
+		logger.Error("failed to load servers", "error", serversErr)
 	} else {
 		for _, serverJonData := range serversJoinData {
 			server := model.Servers{
@@ -40,67 +86,514 @@ func InitManager(postgClient util.PostgClient, taskActor *TaskActor, done chan i
 		}
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-done
+		cancel()
+	}()
+
+	defaultQueue := newTaskQueue(model.QueueConfig{
+		Name:         util.DEFAULT_QUEUE,
+		Workers:      taskActor.MaxWorker(),
+		BufferSize:   taskActor.BufferSize(),
+		Backpressure: util.BACKPRESSURE_BLOCK,
+	}, taskActor)
+
 	return &TaskManager{
-		postgClient:   postgClient,
-		taskActor:     taskActor,
+		storageClient: storageClient,
+		queues:        map[string]*taskQueue{util.DEFAULT_QUEUE: defaultQueue},
 		done:          done,
-		priorityQueue: make(PriorityQueue, 0),
+		ctx:           ctx,
+		servers:       servers,
+		assigned:      make(map[string]assignment),
+		tasksWeight:   tasksWeight,
+		rateOverrides: make(map[string]model.RateLimit),
+		handlers:      make(map[string]model.TaskHandler),
+		wake:          make(chan struct{}, 1),
+		waiters:       make(map[string][]chan string),
+		running:       make(map[string]context.CancelCauseFunc),
+		rateStates:    make(map[string]*util.RateState),
+		rateBlocked:   make(map[string]time.Time),
+		paused:        make(map[pauseKey]bool),
+		metrics:       nopMetrics{},
+		tracer:        nopTracer{},
+		logger:        logger,
 	}
 }
 
+func (tm *TaskManager) SetServerId(serverId string) {
+	tm.serverId = serverId
+}
+
+// UseBroker switches the manager to distributed mode: typed tasks are spread
+// over every live server by load, and this node runs tasks other nodes send
+// to it.
+func (tm *TaskManager) UseBroker(broker util.Broker) {
+	tm.broker = broker
+}
+
+// UseListener lets the claim loop react to task notifications instead of
+// polling the table every CLAIM_POLL_INTERVAL seconds. Polling resumes while
+// the listener is disconnected.
+func (tm *TaskManager) UseListener(listener util.TaskListener) {
+	tm.listener = listener
+}
+
+func (tm *TaskManager) RegisterHandler(taskType string, handler model.TaskHandler) {
+	tm.handlersMu.Lock()
+	defer tm.handlersMu.Unlock()
+	tm.handlers[taskType] = handler
+}
+
 func (tm *TaskManager) StartManager() {
-	heap.Init(&tm.priorityQueue)
+	// Register before the claim loop's first sweep, which would requeue
+	// tasks this server claims if it were not in jobservers yet.
+	tm.updateServerStatus(util.SERVER_STATUS_ACTIVE)
 	go tm.delayTaskTicker()
+	go tm.heartbeat()
+	go tm.claimLoop()
+	go tm.reportMetrics()
+	for _, queue := range tm.queues {
+		if queue.config.Autoscale != nil {
+			go tm.autoscale(queue)
+		}
+	}
+	if tm.broker != nil {
+		tm.joinCluster()
+	}
+}
+
+func (tm *TaskManager) AddNewTask(task model.Task) (string, error) {
+	return tm.AddNewTaskContext(context.Background(), task)
 }
 
-func (tm *TaskManager) AddNewTask(task model.Task) {
+// AddNewTaskContext adds a task, applying the backpressure policy of its
+// queue when the queue on this server is full: block until there is room
+// or ctx is done, fail with ErrQueueFull, or spill the task to storage for
+// the claim loop. Only typed tasks without a TaskFn can spill; others
+// block. With a broker, the cluster picks the server of a task without a
+// TaskFn, so the queue on this server is not checked. A typed task added
+// from a running handler, like the children of Spawn, is saved for the
+// claim loop instead of blocking: the handler holds a worker, and waiting
+// for room could wait for itself.
+func (tm *TaskManager) AddNewTaskContext(ctx context.Context, task model.Task) (string, error) {
+	ctx, span := tm.tracer.Start(tm.tracer.Extract(ctx, task.Meta.TraceParent), "task.submit")
+	defer span.End()
+	span.SetAttribute("task.type", task.Meta.Type)
+	if err := tm.checkPayloadSize(task.Meta); err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+	if traceParent := span.TraceParent(); traceParent != "" {
+		task.Meta.TraceParent = traceParent
+	}
 	if task.Meta.Delay > 0 {
 		task.Meta.ExecutionTime = time.Now().Unix() + int64(task.Meta.Delay)*60
 	}
-	id, err := tm.postgClient.SaveTask(&task.Meta)
+	spill := false
+	local := task.TaskFn != nil || tm.broker == nil
+	if queue := tm.queue(task.Meta.Queue); local && task.Meta.ExecutionTime == 0 && !queue.hasRoom() {
+		switch {
+		case queue.config.Backpressure == util.BACKPRESSURE_REJECT:
+			tm.reject(queue)
+			span.RecordError(ErrQueueFull)
+			return "", ErrQueueFull
+		case queue.config.Backpressure == util.BACKPRESSURE_SPILL && task.Meta.Type != "" && task.TaskFn == nil:
+			queue.spilled.Add(1)
+			tm.metrics.AddCounter(util.METRIC_TASKS_SPILLED, queueLabels(queue.config.Name), 1)
+			spill = true
+		case inHandler(ctx) && task.Meta.Type != "" && task.TaskFn == nil:
+			spill = true
+		default:
+			if err := queue.waitRoom(ctx); err != nil {
+				tm.reject(queue)
+				span.RecordError(err)
+				return "", err
+			}
+		}
+	}
+	_, saveSpan := tm.tracer.Start(ctx, "storage.SaveTask")
+	id, err := tm.storageClient.SaveTask(&task.Meta)
+	saveSpan.RecordError(err)
+	saveSpan.End()
 	if err != nil {
-		fmt.Printf("failed to save the task %v\n", err)
+		tm.logger.Error("failed to save task", "type", task.Meta.Type, "error", err)
+		span.RecordError(err)
+		return "", err
+	}
+	span.SetAttribute("task.id", id)
+	tm.submitted(id, task.Meta)
+	if spill {
+		tm.claimFull.Store(true)
+		return id, nil
+	}
+	var handler model.TaskHandler
+	if task.TaskFn != nil {
+		handler = MetaIdHandler(task.TaskFn)
+	}
+	tm.schedule(pendingDetail(id, task.Meta), handler)
+	return id, nil
+}
+
+func (tm *TaskManager) schedule(task model.TaskDetail, handler model.TaskHandler) {
+	if task.Meta.ExecutionTime > 0 {
+		_, span := tm.startTaskSpan(tm.ctx, "task.delay", task)
+		tm.delayQueue.Add(&DelayTask{
+			IdTask:  task.Id,
+			Meta:    task.Meta,
+			Handler: handler,
+			Time:    task.Meta.ExecutionTime,
+			Attempt: task.Attempt,
+			Span:    span,
+		})
 	} else {
-		if task.Meta.ExecutionTime > 0 {
-			tm.priorityQueue.Push(&DelayTask{
-				IdTask: id,
-				MetaId: task.Meta.MetaId,
-				Time:   task.Meta.ExecutionTime,
+		tm.dispatch(task, handler)
+	}
+}
+
+// Wait blocks until the task reaches a terminal status. Completions on this
+// node, broker complete messages and task notifications all wake it; the
+// table is polled only while none of those can be relied on.
+func (tm *TaskManager) Wait(ctx context.Context, idTask string) error {
+	statusCh := tm.addWaiter(idTask)
+	defer tm.removeWaiter(idTask, statusCh)
+	ticker := time.NewTicker(util.CLAIM_POLL_INTERVAL * time.Second)
+	defer ticker.Stop()
+	poll := true
+	for {
+		if poll {
+			task, err := tm.storageClient.GetTask(idTask)
+			if err != nil {
+				return err
+			}
+			if isTerminalStatus(task.Status) {
+				return taskResult(task)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-statusCh:
+			poll = true
+		case <-ticker.C:
+			poll = tm.listener == nil || !tm.listener.Connected()
+		}
+	}
+}
+
+// dispatch runs a task that came with its own handler here, and otherwise
+// lets the cluster pick the server for it. Paused tasks are held back and
+// tasks over the rate limit of their type wait in the delay queue.
+func (tm *TaskManager) dispatch(task model.TaskDetail, handler model.TaskHandler) {
+	if tm.taskPaused(task.Meta) {
+		tm.holdPaused(task, handler)
+		return
+	}
+	if wait := tm.reserve(task.Meta.Type); wait > 0 {
+		tm.deferTask(task, handler, wait)
+		return
+	}
+	if handler != nil {
+		go tm.runLocal(task, handler, nil)
+		return
+	}
+	if tm.broker != nil {
+		serverId := tm.pickServer(task.Id, task.Meta.Type)
+		if serverId != tm.serverId {
+			err := tm.broker.PublishTask(model.TaskMessage{
+				ServerId:    serverId,
+				TaskId:      task.Id,
+				TraceParent: task.Meta.TraceParent,
 			})
-		} else {
-			go tm.assignTask(id, task.Meta.MetaId, task.TaskFn)
+			if err == nil {
+				return
+			}
+			tm.taskLogger(task).Error("failed to send task to server", "toServerId", serverId, "error", err)
+			tm.releaseServer(task.Id)
+		}
+	}
+	handler = tm.handler(task.Meta.Type)
+	if handler == nil {
+		tm.taskLogger(task).Error("no handler registered for task type")
+		tm.releaseServer(task.Id)
+		return
+	}
+	if !tm.queue(task.Meta.Queue).hasRoom() {
+		// The task stays pending; the claim loop takes it once a worker is free.
+		tm.claimFull.Store(true)
+		tm.releaseServer(task.Id)
+		return
+	}
+	go tm.runLocal(task, handler, func(status string) {
+		tm.releaseServer(task.Id)
+	})
+}
+
+// runLocal claims a typed task before running it, since the claim loop of
+// any node with a handler for the type may have taken it already.
+func (tm *TaskManager) runLocal(task model.TaskDetail, handler model.TaskHandler, onComplete func(status string)) {
+	if task.Meta.Type != "" {
+		claimed, err := tm.storageClient.ClaimTask(task.Id, tm.serverId)
+		if err != nil {
+			tm.taskLogger(task).Error("failed to claim task", "error", err)
+		}
+		if !claimed {
+			if onComplete != nil {
+				onComplete("")
+			}
+			return
 		}
 	}
+	tm.assignTask(task, handler, onComplete)
 }
 
-func (tm *TaskManager) assignTask(idTask string, metaId string, taskFn func(metaId string)) {
+func (tm *TaskManager) assignTask(task model.TaskDetail, handler model.TaskHandler, onComplete func(status string)) {
+	queue := tm.queue(task.Meta.Queue)
+	queue.inFlight.Add(1)
+	queuedAt := time.Now()
+	_, queueSpan := tm.startTaskSpan(tm.ctx, "task.queue", task)
+	queueSpan.SetAttribute("queue", queue.config.Name)
 	fn := func(metaId string) {
-		taskFn(metaId)
-		tm.postgClient.UpdateTaskComplete(idTask)
+		startedAt := time.Now()
+		queueSpan.End()
+		tm.metrics.Observe(util.METRIC_QUEUE_WAIT, typeLabels(task.Meta), startedAt.Sub(queuedAt).Seconds())
+		spanCtx, span := tm.startTaskSpan(tm.ctx, "task.execute", task)
+		span.SetAttribute("server.id", tm.serverId)
+		captured := newCapturedLogger(tm.taskLogger(task))
+		ctx, cancel := context.WithCancelCause(withTaskScope(spanCtx, tm, task, captured))
+		tm.trackRunning(task.Id, cancel)
+		tm.emit(util.TASK_EVENT_STARTED, task, nil)
+		result, err := tm.runHandler(ctx, handler, task)
+		tm.untrackRunning(task.Id)
+		tm.saveTaskLog(task, captured, err)
+		tm.metrics.Observe(util.METRIC_EXECUTION_TIME, typeLabels(task.Meta), time.Since(startedAt).Seconds())
+		span.RecordError(err)
+		var status string
+		if context.Cause(ctx) == errTaskCancelled {
+			status = util.TASK_STATUS_CANCELLED
+		} else {
+			status = tm.finishTask(task, handler, result, err)
+		}
+		cancel(nil)
+		span.SetAttribute("task.status", status)
+		span.End()
+		tm.countFinished(task, status)
+		// CancelTask already moved workflows and batches past a cancelled task.
+		if isTerminalStatus(status) && status != util.TASK_STATUS_CANCELLED {
+			if task.Meta.WorkflowId != "" {
+				tm.onWorkflowTaskFinished(task, status)
+			}
+			if task.Meta.BatchId != "" {
+				tm.checkBatch(task.Meta.BatchId)
+			}
+		}
+		queue.inFlight.Add(-1)
+		queue.signalRoom()
+		tm.resolveWaiters(task.Id, status)
+		if tm.claimFull.Load() {
+			tm.signalClaim()
+		}
+		if onComplete != nil {
+			onComplete(status)
+		}
 	}
 	tsk := model.ActorTask{
-		MetaId: metaId,
+		MetaId: task.Meta.MetaId,
 		TaskFn: fn,
 	}
-	tm.taskActor.SubmitTask(tsk)
+	queue.actor.SubmitTask(tsk)
+}
+
+func (tm *TaskManager) finishTask(task model.TaskDetail, handler model.TaskHandler, result []byte, taskErr error) string {
+	if taskErr != nil {
+		tm.taskLogger(task).Warn("task failed", "error", taskErr)
+		tm.emit(util.TASK_EVENT_FAILED, task, taskErr)
+		if task.Attempt < tm.retryPolicy(task.Meta).MaxRetry {
+			status, err := tm.retryTask(task, handler, taskErr)
+			if err == nil {
+				if status == util.TASK_STATUS_PENDING {
+					tm.emit(util.TASK_EVENT_RETRIED, task, taskErr)
+				}
+				return status
+			}
+			tm.taskLogger(task).Error("failed to retry task", "error", err)
+		}
+		failed, err := tm.storageClient.UpdateTaskFailed(task.Id, taskErr.Error())
+		if err != nil {
+			tm.taskLogger(task).Error("failed to mark task failed", "error", err)
+			return ""
+		}
+		if !failed {
+			tm.taskLogger(task).Info("task was cancelled or finished elsewhere, dropping its failure")
+			return ""
+		}
+		tm.emit(util.TASK_EVENT_DEAD_LETTERED, task, taskErr)
+		return util.TASK_STATUS_FAILED
+	}
+	next := successors(task, result)
+	nextIds, completed, err := tm.storageClient.UpdateTaskComplete(task.Id, result, next)
+	if err != nil {
+		tm.taskLogger(task).Error("failed to mark task complete", "error", err)
+		return ""
+	}
+	if !completed {
+		tm.taskLogger(task).Info("task was cancelled or finished elsewhere, dropping its result")
+		return ""
+	}
+	task.Result = result
+	tm.emit(util.TASK_EVENT_SUCCEEDED, task, nil)
+	for i, nextId := range nextIds {
+		tm.submitted(nextId, next[i])
+		tm.schedule(pendingDetail(nextId, next[i]), nil)
+	}
+	return util.TASK_STATUS_COMPLETED
+}
+
+// retryTask puts a failed task back to pending and schedules its next
+// attempt after an exponential backoff. Typed tasks go through dispatch
+// again, so the retry may run on another server.
+func (tm *TaskManager) retryTask(task model.TaskDetail, handler model.TaskHandler, taskErr error) (string, error) {
+	executionTime := time.Now().Unix() + retryDelay(tm.retryPolicy(task.Meta).RetryDelay, task.Attempt)
+	retried, err := tm.storageClient.RetryTask(task.Id, taskErr.Error(), executionTime)
+	if err != nil {
+		return "", err
+	}
+	if !retried {
+		// Cancelled or finished elsewhere; this server has no say any more.
+		return "", nil
+	}
+	task.Status = util.TASK_STATUS_PENDING
+	task.Attempt++
+	task.Meta.ExecutionTime = executionTime
+	if task.Meta.Type != "" {
+		handler = nil
+	}
+	tm.schedule(task, handler)
+	return util.TASK_STATUS_PENDING, nil
+}
+
+// SetRetryDefaults sets how tasks that do not set MaxRetry or RetryDelay
+// retry when they fail on this server.
+func (tm *TaskManager) SetRetryDefaults(policy model.RetryPolicy) {
+	tm.retryDefaults.Store(&policy)
+}
+
+// retryPolicy is the retry policy of meta, with the defaults of this
+// server for what it does not set.
+func (tm *TaskManager) retryPolicy(meta model.TaskMeta) model.RetryPolicy {
+	policy := model.RetryPolicy{MaxRetry: meta.MaxRetry, RetryDelay: meta.RetryDelay}
+	if defaults := tm.retryDefaults.Load(); defaults != nil {
+		if policy.MaxRetry == 0 {
+			policy.MaxRetry = defaults.MaxRetry
+		}
+		if policy.RetryDelay == 0 {
+			policy.RetryDelay = defaults.RetryDelay
+		}
+	}
+	return policy
+}
+
+// retryDelay is the wait in seconds before attempt+1 of a task, doubling
+// from delay (DEFAULT_RETRY_DELAY when zero) up to MAX_RETRY_DELAY.
+func retryDelay(delay int, attempt int) int64 {
+	if delay <= 0 {
+		delay = util.DEFAULT_RETRY_DELAY
+	}
+	backoff := int64(delay)
+	for i := 0; i < attempt && backoff < util.MAX_RETRY_DELAY; i++ {
+		backoff *= 2
+	}
+	if backoff > util.MAX_RETRY_DELAY {
+		backoff = util.MAX_RETRY_DELAY
+	}
+	return backoff
+}
+
+// successors returns the tasks to add after task succeeded with result.
+func successors(task model.TaskDetail, result []byte) []model.TaskMeta {
+	if len(task.Meta.Next) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	next := make([]model.TaskMeta, len(task.Meta.Next))
+	for i, meta := range task.Meta.Next {
+		if meta.PassResult {
+			meta.Payload = result
+			if meta.Codec == "" {
+				meta.Codec = task.Meta.Codec
+			}
+		}
+		if meta.Delay > 0 {
+			meta.ExecutionTime = now + int64(meta.Delay)*60
+		}
+		if meta.TraceParent == "" {
+			meta.TraceParent = task.Meta.TraceParent
+		}
+		next[i] = meta
+	}
+	return next
+}
+
+func (tm *TaskManager) handler(taskType string) model.TaskHandler {
+	tm.handlersMu.RLock()
+	defer tm.handlersMu.RUnlock()
+	return tm.handlers[taskType]
 }
 
 func (tm *TaskManager) delayTaskTicker() {
 	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-tm.done:
 			return
 		case <-ticker.C:
-			taskI := tm.priorityQueue.Pop()
-			if taskI != nil {
-				task := taskI.(*DelayTask)
-				if task.Time-time.Now().Unix() <= 0 {
-					go tm.assignTask(task.IdTask, task.MetaId, task.TaskFn)
-				} else {
-					tm.priorityQueue.Push(task)
+			for _, task := range tm.delayQueue.PopDue(time.Now().Unix()) {
+				if task.Span != nil {
+					task.Span.End()
 				}
+				detail := pendingDetail(task.IdTask, task.Meta)
+				detail.Attempt = task.Attempt
+				tm.dispatch(detail, task.Handler)
 			}
 		}
 	}
 }
+
+// MetaIdHandler adapts a func(metaId) task function to a TaskHandler.
+func MetaIdHandler(taskFn func(metaId string)) model.TaskHandler {
+	return func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		taskFn(task.Meta.MetaId)
+		return nil, nil
+	}
+}
+
+// runHandler runs handler inside the middleware, turning a panic of either
+// into the error of the attempt.
+func (tm *TaskManager) runHandler(ctx context.Context, handler model.TaskHandler, task model.TaskDetail) (result []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task handler panic: %v", r)
+		}
+	}()
+	return tm.withMiddleware(handler)(ctx, task)
+}
+
+func pendingDetail(id string, meta model.TaskMeta) model.TaskDetail {
+	return model.TaskDetail{
+		Id:     id,
+		Meta:   meta,
+		Status: util.TASK_STATUS_PENDING,
+	}
+}
+
+func isTerminalStatus(status string) bool {
+	return status == util.TASK_STATUS_COMPLETED || status == util.TASK_STATUS_FAILED || status == util.TASK_STATUS_CANCELLED
+}
+
+func taskResult(task *model.TaskDetail) error {
+	if task.Status == util.TASK_STATUS_COMPLETED {
+		return nil
+	}
+	return fmt.Errorf("task %v %v: %v", task.Id, task.Status, task.Error)
+}
@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// countingMetrics records the counters the manager adds.
+type countingMetrics struct {
+	nopMetrics
+	mu       sync.Mutex
+	counters map[string]float64
+}
+
+func (c *countingMetrics) AddCounter(name string, labels map[string]string, delta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counters[name] += delta
+}
+
+func (c *countingMetrics) counter(name string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counters[name]
+}
+
+// startTestManager starts a single server without a broker on store.
+func startTestManager(t *testing.T, store util.StorageClient) *TaskManager {
+	t.Helper()
+	done := make(chan int)
+	tm := InitManager(store, NewTaskActor(2, done, 10), done, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	tm.SetServerId("server-1")
+	t.Cleanup(func() { close(done) })
+	return tm
+}
+
+// recordEvents collects the names of the lifecycle events of tm.
+func recordEvents(tm *TaskManager) func() []string {
+	var mu sync.Mutex
+	var events []string
+	tm.OnEvent(util.TASK_EVENT_ANY, func(event model.LifecycleEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event.Event)
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), events...)
+	}
+}
+
+func TestFinishDropsTransitionsThatDidNotHappen(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		taskErr error
+		dropped string
+		counted string
+	}{
+		{name: "complete", dropped: util.TASK_EVENT_SUCCEEDED, counted: util.METRIC_TASKS_SUCCEEDED},
+		{name: "dead letter", taskErr: errors.New("boom"), dropped: util.TASK_EVENT_DEAD_LETTERED, counted: util.METRIC_TASKS_FAILED},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			store := storage.NewMemoryStorage()
+			tm := startTestManager(t, store)
+			metrics := &countingMetrics{counters: make(map[string]float64)}
+			tm.UseMetrics(metrics)
+			events := recordEvents(tm)
+			// Another server cancels the task while this one runs it.
+			tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+				if _, err := store.CancelTask(task.Id); err != nil {
+					t.Error(err)
+				}
+				return []byte("result"), tc.taskErr
+			})
+			tm.StartManager()
+
+			id, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tm.Wait(ctx, id); err == nil || !strings.Contains(err.Error(), util.TASK_STATUS_CANCELLED) {
+				t.Fatalf("Wait = %v, want the task cancelled", err)
+			}
+			eventually(t, "the run to finish", func() bool {
+				for _, event := range events() {
+					if event == util.TASK_EVENT_STARTED {
+						return tm.queue(util.DEFAULT_QUEUE).inFlight.Load() == 0
+					}
+				}
+				return false
+			})
+			for _, event := range events() {
+				if event == tc.dropped {
+					t.Errorf("emitted %v for a cancelled task: %v", tc.dropped, events())
+				}
+			}
+			if got := metrics.counter(tc.counted); got != 0 {
+				t.Errorf("%v = %v, want 0", tc.counted, got)
+			}
+			task, err := store.GetTask(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if task.Status != util.TASK_STATUS_CANCELLED || task.Result != nil {
+				t.Errorf("task = %v %q, want it cancelled without a result", task.Status, task.Result)
+			}
+		})
+	}
+}
+
+// brokenConfigStorage fails to load what InitManager reads.
+type brokenConfigStorage struct {
+	*storage.MemoryStorage
+}
+
+func (brokenConfigStorage) GetTaskConfig() ([]model.TaskWeight, error) {
+	return nil, errors.New("no jobconfig")
+}
+
+func (brokenConfigStorage) GetAllUsedServer() ([]model.JoinData, error) {
+	return nil, errors.New("no servers")
+}
+
+func TestInitManagerLogsThroughItsLogger(t *testing.T) {
+	var logs strings.Builder
+	done := make(chan int)
+	defer close(done)
+	InitManager(brokenConfigStorage{storage.NewMemoryStorage()}, NewTaskActor(1, done, 1), done, slog.New(slog.NewTextHandler(&logs, nil)))
+	for _, want := range []string{"failed to load task config", "no jobconfig", "failed to load servers", "no servers"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs do not mention %q:\n%v", want, logs.String())
+		}
+	}
+}
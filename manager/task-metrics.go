@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+type nopMetrics struct{}
+
+func (nopMetrics) AddCounter(name string, labels map[string]string, delta float64) {}
+func (nopMetrics) SetGauge(name string, labels map[string]string, value float64)   {}
+func (nopMetrics) Observe(name string, labels map[string]string, value float64)    {}
+
+// UseMetrics sends the manager's counters, gauges and histograms to sink.
+func (tm *TaskManager) UseMetrics(sink util.MetricsSink) {
+	tm.metrics = sink
+}
+
+func typeLabels(meta model.TaskMeta) map[string]string {
+	return map[string]string{"type": meta.Type}
+}
+
+func queueLabels(name string) map[string]string {
+	return map[string]string{"queue": name}
+}
+
+func (tm *TaskManager) countSubmitted(meta model.TaskMeta) {
+	tm.metrics.AddCounter(util.METRIC_TASKS_SUBMITTED, typeLabels(meta), 1)
+}
+
+// countFinished counts a run of task by the status it left the task in.
+func (tm *TaskManager) countFinished(task model.TaskDetail, status string) {
+	switch status {
+	case util.TASK_STATUS_COMPLETED:
+		tm.metrics.AddCounter(util.METRIC_TASKS_SUCCEEDED, typeLabels(task.Meta), 1)
+	case util.TASK_STATUS_FAILED:
+		tm.metrics.AddCounter(util.METRIC_TASKS_FAILED, typeLabels(task.Meta), 1)
+	case util.TASK_STATUS_PENDING:
+		tm.metrics.AddCounter(util.METRIC_TASKS_RETRIED, typeLabels(task.Meta), 1)
+	}
+}
+
+// reportMetrics sets the gauges every METRICS_INTERVAL seconds.
+func (tm *TaskManager) reportMetrics() {
+	ticker := time.NewTicker(util.METRICS_INTERVAL * time.Second)
+	defer ticker.Stop()
+	for {
+		tm.reportGauges()
+		select {
+		case <-tm.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (tm *TaskManager) reportGauges() {
+	for _, stats := range tm.QueueStats() {
+		labels := queueLabels(stats.Name)
+		tm.metrics.SetGauge(util.METRIC_QUEUE_DEPTH, labels, float64(stats.Queued))
+		tm.metrics.SetGauge(util.METRIC_QUEUE_WORKERS, labels, float64(stats.Workers))
+		tm.metrics.SetGauge(util.METRIC_QUEUE_BUSY_WORKERS, labels, float64(stats.Busy))
+	}
+	tm.metrics.SetGauge(util.METRIC_DELAYED_TASKS, nil, float64(tm.delayQueue.Len()))
+}
@@ -0,0 +1,78 @@
+package manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+func TestPausedTasksWaitForRefreshPauses(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		pause model.Pause
+		meta  model.TaskMeta
+	}{
+		{"scheduler", model.Pause{Scope: util.PAUSE_SCOPE_SCHEDULER}, model.TaskMeta{Type: "work"}},
+		{"queue", model.Pause{Scope: util.PAUSE_SCOPE_QUEUE, Name: "slow"}, model.TaskMeta{Type: "work", Queue: "slow"}},
+		{"default queue for an unknown one", model.Pause{Scope: util.PAUSE_SCOPE_QUEUE, Name: util.DEFAULT_QUEUE}, model.TaskMeta{Type: "work", Queue: "missing"}},
+		{"type", model.Pause{Scope: util.PAUSE_SCOPE_TYPE, Name: "work"}, model.TaskMeta{Type: "work"}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			store := storage.NewMemoryStorage()
+			tm := startTestManager(t, store)
+			if err := tm.AddQueue(model.QueueConfig{Name: "slow", Workers: 1}); err != nil {
+				t.Fatal(err)
+			}
+			ran := make(chan string, 2)
+			tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+				ran <- task.Id
+				return nil, nil
+			})
+			tm.StartManager()
+
+			// Another server pauses; this one learns of it on refresh.
+			if err := store.SetPause(tc.pause, true); err != nil {
+				t.Fatal(err)
+			}
+			tm.refreshPauses()
+			// One task is waiting when the pause lifts, the other comes
+			// from a claim.
+			held, err := tm.AddNewTask(model.Task{Meta: tc.meta})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pending, err := store.SaveTask(&tc.meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tm.signalClaim()
+			select {
+			case id := <-ran:
+				t.Fatalf("task %v ran while paused", id)
+			case <-time.After(200 * time.Millisecond):
+			}
+
+			if err := store.SetPause(tc.pause, false); err != nil {
+				t.Fatal(err)
+			}
+			tm.refreshPauses()
+			got := map[string]bool{}
+			for i := 0; i < 2; i++ {
+				select {
+				case id := <-ran:
+					got[id] = true
+				case <-time.After(5 * time.Second):
+					t.Fatal("the tasks did not run once the pause lifted")
+				}
+			}
+			if !got[held] || !got[pending] {
+				t.Errorf("ran %v, want %v and %v", got, held, pending)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+)
+
+var ErrPayloadTooLarge = errors.New("task payload too large")
+
+// SetMaxPayloadSize limits the payload of every task this server adds,
+// children spawned by handlers and successors included. Zero means no
+// limit.
+func (tm *TaskManager) SetMaxPayloadSize(size int) {
+	tm.payloadLimit = size
+}
+
+func (tm *TaskManager) checkPayloadSize(meta model.TaskMeta) error {
+	if tm.payloadLimit > 0 && len(meta.Payload) > tm.payloadLimit {
+		return fmt.Errorf("%w: %v bytes, limit %v", ErrPayloadTooLarge, len(meta.Payload), tm.payloadLimit)
+	}
+	for _, next := range meta.Next {
+		if err := tm.checkPayloadSize(next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tm *TaskManager) checkWorkflowPayloadSize(workflow model.Workflow) error {
+	for _, node := range workflow.Nodes {
+		if err := tm.checkPayloadSize(node.Meta); err != nil {
+			return fmt.Errorf("node %v: %w", node.Name, err)
+		}
+		if node.Compensate != nil {
+			if err := tm.checkPayloadSize(*node.Compensate); err != nil {
+				return fmt.Errorf("compensation of node %v: %w", node.Name, err)
+			}
+		}
+	}
+	return nil
+}
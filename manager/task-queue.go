@@ -0,0 +1,228 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+var ErrQueueFull = errors.New("task queue full")
+
+// taskQueue is a named queue with the TaskActor that runs its tasks.
+type taskQueue struct {
+	config   model.QueueConfig
+	actor    *TaskActor
+	inFlight atomic.Int64
+	roomMu   sync.Mutex
+	room     chan struct{}
+	rejected atomic.Int64
+	spilled  atomic.Int64
+}
+
+func newTaskQueue(config model.QueueConfig, actor *TaskActor) *taskQueue {
+	return &taskQueue{
+		config: config,
+		actor:  actor,
+		room:   make(chan struct{}),
+	}
+}
+
+func (q *taskQueue) hasRoom() bool {
+	return int(q.inFlight.Load()) < q.actor.Capacity()
+}
+
+// waitRoom blocks until the queue can take another task or ctx is done.
+func (q *taskQueue) waitRoom(ctx context.Context) error {
+	for {
+		q.roomMu.Lock()
+		room := q.room
+		q.roomMu.Unlock()
+		if q.hasRoom() {
+			return nil
+		}
+		select {
+		case <-room:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// signalRoom wakes every waitRoom after a task of the queue finished.
+func (q *taskQueue) signalRoom() {
+	q.roomMu.Lock()
+	defer q.roomMu.Unlock()
+	close(q.room)
+	q.room = make(chan struct{})
+}
+
+func (tm *TaskManager) reject(q *taskQueue) {
+	q.rejected.Add(1)
+	tm.metrics.AddCounter(util.METRIC_TASKS_REJECTED, queueLabels(q.config.Name), 1)
+}
+
+// ValidateQueue checks config describes a queue AddQueue can add.
+func ValidateQueue(config model.QueueConfig) error {
+	if config.Name == "" {
+		return fmt.Errorf("queue needs a name")
+	}
+	if config.Workers == 0 {
+		return fmt.Errorf("queue %v needs at least one worker", config.Name)
+	}
+	switch config.Backpressure {
+	case "", util.BACKPRESSURE_BLOCK, util.BACKPRESSURE_REJECT, util.BACKPRESSURE_SPILL:
+	default:
+		return fmt.Errorf("queue %v has unknown backpressure %q", config.Name, config.Backpressure)
+	}
+	if autoscale := config.Autoscale; autoscale != nil {
+		if autoscale.MinWorkers == 0 || autoscale.MaxWorkers < autoscale.MinWorkers {
+			return fmt.Errorf("queue %v autoscales between %v and %v workers", config.Name, autoscale.MinWorkers, autoscale.MaxWorkers)
+		}
+	}
+	return nil
+}
+
+// AddQueue adds a named queue with its own worker pool. Tasks pick it with
+// TaskMeta.Queue; a task naming a queue this server does not have runs on
+// the default queue, which AddQueue can also replace. Add every queue
+// before StartManager.
+func (tm *TaskManager) AddQueue(config model.QueueConfig) error {
+	if err := ValidateQueue(config); err != nil {
+		return err
+	}
+	if _, ok := tm.queues[config.Name]; ok && config.Name != util.DEFAULT_QUEUE {
+		return fmt.Errorf("queue %v already exists", config.Name)
+	}
+	if config.Backpressure == "" {
+		config.Backpressure = util.BACKPRESSURE_BLOCK
+	}
+	if autoscale := config.Autoscale; autoscale != nil {
+		if config.Workers < autoscale.MinWorkers {
+			config.Workers = autoscale.MinWorkers
+		}
+		if config.Workers > autoscale.MaxWorkers {
+			config.Workers = autoscale.MaxWorkers
+		}
+	}
+	actor := NewTaskActor(config.Workers, tm.done, config.BufferSize)
+	actor.SetIdleTimeout(time.Duration(config.IdleTimeout) * time.Second)
+	tm.queues[config.Name] = newTaskQueue(config, actor)
+	return nil
+}
+
+// ResizeQueue changes the number of workers of queue name while it runs.
+func (tm *TaskManager) ResizeQueue(name string, workers uint16) error {
+	queue, ok := tm.queues[name]
+	if !ok {
+		return fmt.Errorf("queue %v not found", name)
+	}
+	if workers == 0 {
+		return fmt.Errorf("queue %v needs at least one worker", name)
+	}
+	queue.actor.SetMaxWorker(workers)
+	return nil
+}
+
+// QueueStats returns the state of every queue, highest priority first.
+func (tm *TaskManager) QueueStats() []model.QueueStats {
+	queues := tm.queuesByPriority()
+	stats := make([]model.QueueStats, 0, len(queues))
+	for _, queue := range queues {
+		stat := queue.actor.Stats()
+		stat.Name = queue.config.Name
+		stat.InFlight = int(queue.inFlight.Load())
+		stat.Rejected = queue.rejected.Load()
+		stat.Spilled = queue.spilled.Load()
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// autoscale adjusts the workers of queue: it adds workers while tasks queue
+// up or wait longer than the target, and removes one at a time while fewer
+// than half the workers are busy and nothing waits.
+func (tm *TaskManager) autoscale(queue *taskQueue) {
+	config := *queue.config.Autoscale
+	interval := time.Duration(config.Interval) * time.Second
+	if interval <= 0 {
+		interval = util.AUTOSCALE_INTERVAL * time.Second
+	}
+	targetWait := time.Duration(config.TargetWait) * time.Millisecond
+	if targetWait <= 0 {
+		targetWait = util.AUTOSCALE_TARGET_WAIT * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tm.done:
+			return
+		case <-ticker.C:
+			stats := queue.actor.Stats()
+			workers := autoscaleWorkers(stats, config, targetWait)
+			if workers != stats.MaxWorkers {
+				queue.actor.SetMaxWorker(uint16(workers))
+			}
+		}
+	}
+}
+
+// autoscaleWorkers is the number of workers autoscale gives a queue in the
+// state of stats, kept between the bounds of config.
+func autoscaleWorkers(stats model.QueueStats, config model.AutoscaleConfig, targetWait time.Duration) int {
+	workers := stats.MaxWorkers
+	if stats.Queued > 0 && (stats.Wait > targetWait || stats.Queued > stats.MaxWorkers) {
+		step := stats.Queued / 2
+		if step < 1 {
+			step = 1
+		}
+		workers += step
+	} else if stats.Queued == 0 && stats.Busy < stats.MaxWorkers/2 {
+		workers--
+	}
+	if workers > int(config.MaxWorkers) {
+		workers = int(config.MaxWorkers)
+	}
+	if workers < int(config.MinWorkers) {
+		workers = int(config.MinWorkers)
+	}
+	return workers
+}
+
+// Capacity is how many tasks all queues of this server can run or buffer.
+func (tm *TaskManager) Capacity() int {
+	capacity := 0
+	for _, queue := range tm.queues {
+		capacity += queue.actor.Capacity()
+	}
+	return capacity
+}
+
+func (tm *TaskManager) queue(name string) *taskQueue {
+	if queue, ok := tm.queues[name]; ok {
+		return queue
+	}
+	return tm.queues[util.DEFAULT_QUEUE]
+}
+
+// queuesByPriority returns the queues, highest priority first.
+func (tm *TaskManager) queuesByPriority() []*taskQueue {
+	queues := make([]*taskQueue, 0, len(tm.queues))
+	for _, queue := range tm.queues {
+		queues = append(queues, queue)
+	}
+	sort.Slice(queues, func(i, j int) bool {
+		if queues[i].config.Priority != queues[j].config.Priority {
+			return queues[i].config.Priority > queues[j].config.Priority
+		}
+		return queues[i].config.Name < queues[j].config.Name
+	})
+	return queues
+}
@@ -0,0 +1,270 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// claimRecorder records the queues the claim loop asks storage for.
+type claimRecorder struct {
+	*storage.MemoryStorage
+	mu     sync.Mutex
+	queues []string
+}
+
+func (c *claimRecorder) ClaimPendingTasks(serverId string, queue string, known []string, types []string, limit int) ([]model.TaskDetail, error) {
+	c.mu.Lock()
+	c.queues = append(c.queues, queue)
+	c.mu.Unlock()
+	return c.MemoryStorage.ClaimPendingTasks(serverId, queue, known, types, limit)
+}
+
+func TestClaimTakesHigherPriorityQueuesFirst(t *testing.T) {
+	store := &claimRecorder{MemoryStorage: storage.NewMemoryStorage()}
+	tm := startTestManager(t, store)
+	for _, queue := range []model.QueueConfig{
+		{Name: "low", Workers: 1, Priority: 1},
+		{Name: "high", Workers: 1, Priority: 10},
+		{Name: "mid", Workers: 1, Priority: 5},
+	} {
+		if err := tm.AddQueue(queue); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		return nil, nil
+	})
+	tm.claimPending()
+	want := []string{"high", "mid", "low", util.DEFAULT_QUEUE}
+	if got := strings.Join(store.queues, ","); got != strings.Join(want, ",") {
+		t.Errorf("claimed queues in order %v, want %v", got, want)
+	}
+}
+
+func TestTaskOfAnUnknownQueueRunsOnTheDefaultQueue(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	tm := startTestManager(t, store)
+	if err := tm.AddQueue(model.QueueConfig{Name: "slow", Workers: 1}); err != nil {
+		t.Fatal(err)
+	}
+	tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		return nil, nil
+	})
+	// Saved before the server started, so only the claim loop can find it.
+	claimed, err := store.SaveTask(&model.TaskMeta{Type: "work", Queue: "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm.StartManager()
+	dispatched, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work", Queue: "missing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{claimed, dispatched} {
+		eventually(t, "the task of an unknown queue to run", func() bool {
+			task, err := store.GetTask(id)
+			return err == nil && task.Status == util.TASK_STATUS_COMPLETED
+		})
+	}
+	if stats := tm.QueueStats(); len(stats) != 2 {
+		t.Errorf("queues = %+v, want no queue made for the unknown name", stats)
+	}
+}
+
+func TestAutoscaleWorkersStaysWithinBounds(t *testing.T) {
+	config := model.AutoscaleConfig{MinWorkers: 2, MaxWorkers: 6}
+	for _, tc := range []struct {
+		name  string
+		stats model.QueueStats
+		want  int
+	}{
+		{"grows by half the queue", model.QueueStats{MaxWorkers: 2, Busy: 2, Queued: 6}, 5},
+		{"grows by one for a slow task", model.QueueStats{MaxWorkers: 3, Busy: 3, Queued: 1, Wait: 2 * time.Second}, 4},
+		{"grows no further than max", model.QueueStats{MaxWorkers: 5, Busy: 5, Queued: 20}, 6},
+		{"stays at max", model.QueueStats{MaxWorkers: 6, Busy: 6, Queued: 20}, 6},
+		{"stays while busy", model.QueueStats{MaxWorkers: 4, Busy: 3}, 4},
+		{"stays for a short wait", model.QueueStats{MaxWorkers: 4, Busy: 4, Queued: 1, Wait: time.Millisecond}, 4},
+		{"shrinks by one when idle", model.QueueStats{MaxWorkers: 5, Busy: 1}, 4},
+		{"shrinks no further than min", model.QueueStats{MaxWorkers: 2}, 2},
+		{"comes back within bounds", model.QueueStats{MaxWorkers: 1, Busy: 1}, 2},
+	} {
+		if got := autoscaleWorkers(tc.stats, config, time.Second); got != tc.want {
+			t.Errorf("%v: workers = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAutoscaleResizesTheQueue(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	tm := startTestManager(t, store)
+	autoscale := &model.AutoscaleConfig{MinWorkers: 1, MaxWorkers: 3, Interval: 1}
+	if err := tm.AddQueue(model.QueueConfig{Name: "scaled", Workers: 1, BufferSize: 20, Autoscale: autoscale}); err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		<-release
+		return nil, nil
+	})
+	tm.StartManager()
+	for i := 0; i < 10; i++ {
+		if _, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work", Queue: "scaled"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	queue := tm.queues["scaled"]
+	eventually(t, "the queue to grow to its max", func() bool { return queue.actor.MaxWorker() == 3 })
+	close(release)
+	eventually(t, "the queue to shrink to its min", func() bool { return queue.actor.MaxWorker() == 1 })
+}
+
+// fillQueue gives tm a default queue of one worker and no buffer with
+// policy, and starts a task that holds the worker until release closes.
+func fillQueue(t *testing.T, tm *TaskManager, policy string, release chan struct{}) {
+	t.Helper()
+	if err := tm.AddQueue(model.QueueConfig{Name: util.DEFAULT_QUEUE, Workers: 1, Backpressure: policy}); err != nil {
+		t.Fatal(err)
+	}
+	tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		<-release
+		return nil, nil
+	})
+	tm.StartManager()
+	if _, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work"}}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the queue to fill", func() bool { return !tm.queue(util.DEFAULT_QUEUE).hasRoom() })
+}
+
+func TestBackpressure(t *testing.T) {
+	for _, tc := range []struct {
+		policy   string
+		rejected float64
+		spilled  float64
+		check    func(t *testing.T, tm *TaskManager, release chan struct{})
+	}{
+		{
+			policy:   util.BACKPRESSURE_BLOCK,
+			rejected: 1,
+			check: func(t *testing.T, tm *TaskManager, release chan struct{}) {
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				if _, err := tm.AddNewTaskContext(ctx, model.Task{Meta: model.TaskMeta{Type: "work"}}); !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("AddNewTaskContext on a full queue = %v, want it to wait out ctx", err)
+				}
+				added := make(chan error, 1)
+				go func() {
+					_, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work"}})
+					added <- err
+				}()
+				select {
+				case err := <-added:
+					t.Fatalf("AddNewTask = %v before there was room", err)
+				case <-time.After(100 * time.Millisecond):
+				}
+				close(release)
+				if err := <-added; err != nil {
+					t.Errorf("AddNewTask once there was room = %v", err)
+				}
+			},
+		},
+		{
+			policy:   util.BACKPRESSURE_REJECT,
+			rejected: 1,
+			check: func(t *testing.T, tm *TaskManager, release chan struct{}) {
+				if _, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work"}}); !errors.Is(err, ErrQueueFull) {
+					t.Errorf("AddNewTask on a full queue = %v, want ErrQueueFull", err)
+				}
+				close(release)
+			},
+		},
+		{
+			policy:  util.BACKPRESSURE_SPILL,
+			spilled: 1,
+			check: func(t *testing.T, tm *TaskManager, release chan struct{}) {
+				id, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work"}})
+				if err != nil {
+					t.Fatalf("AddNewTask on a full queue = %v, want the task spilled", err)
+				}
+				if task, err := tm.storageClient.GetTask(id); err != nil || task.Status != util.TASK_STATUS_PENDING {
+					t.Errorf("spilled task = %+v, %v, want it pending", task, err)
+				}
+				close(release)
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				if err := tm.Wait(ctx, id); err != nil {
+					t.Errorf("Wait for the spilled task = %v", err)
+				}
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.policy, func(t *testing.T) {
+			tm := startTestManager(t, storage.NewMemoryStorage())
+			metrics := &countingMetrics{counters: make(map[string]float64)}
+			tm.UseMetrics(metrics)
+			release := make(chan struct{})
+			fillQueue(t, tm, tc.policy, release)
+			tc.check(t, tm, release)
+			if got := metrics.counter(util.METRIC_TASKS_REJECTED); got != tc.rejected {
+				t.Errorf("%v = %v, want %v", util.METRIC_TASKS_REJECTED, got, tc.rejected)
+			}
+			if got := metrics.counter(util.METRIC_TASKS_SPILLED); got != tc.spilled {
+				t.Errorf("%v = %v, want %v", util.METRIC_TASKS_SPILLED, got, tc.spilled)
+			}
+		})
+	}
+}
+
+func TestBackpressureSkipsTasksTheClusterPlaces(t *testing.T) {
+	release := make(chan struct{})
+	metrics := &countingMetrics{counters: make(map[string]float64)}
+	node := startTestNode(t, storage.NewMemoryStorage(), storage.NewMemoryHub(), "server-1",
+		func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+			<-release
+			return nil, nil
+		},
+		func(tm *TaskManager) {
+			tm.UseMetrics(metrics)
+			if err := tm.AddQueue(model.QueueConfig{Name: util.DEFAULT_QUEUE, Workers: 1, Backpressure: util.BACKPRESSURE_REJECT}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	tm := node.tm
+	if _, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work"}}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the queue to fill", func() bool { return !tm.queue(util.DEFAULT_QUEUE).hasRoom() })
+
+	id, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work"}})
+	if err != nil {
+		t.Fatalf("AddNewTask with a broker = %v, want the cluster to place the task", err)
+	}
+	if got := metrics.counter(util.METRIC_TASKS_REJECTED); got != 0 {
+		t.Errorf("%v = %v, want 0", util.METRIC_TASKS_REJECTED, got)
+	}
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tm.Wait(ctx, id); err != nil {
+		t.Errorf("Wait = %v", err)
+	}
+	// A task with its own TaskFn runs here, so the queue still applies.
+	release = make(chan struct{})
+	defer close(release)
+	if _, err := tm.AddNewTask(model.Task{TaskFn: func(metaId string) { <-release }}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the queue to fill", func() bool { return !tm.queue(util.DEFAULT_QUEUE).hasRoom() })
+	if _, err := tm.AddNewTask(model.Task{TaskFn: func(metaId string) {}}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("AddNewTask of a TaskFn on a full queue = %v, want ErrQueueFull", err)
+	}
+}
@@ -0,0 +1,115 @@
+package manager
+
+import (
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// SetRateLimit limits how fast tasks of taskType start, replacing the
+// limit read from jobconfig.
+func (tm *TaskManager) SetRateLimit(taskType string, limit model.RateLimit) {
+	tm.serversMu.Lock()
+	tm.rateOverrides[taskType] = limit
+	tm.serversMu.Unlock()
+	tm.unblockRate(taskType)
+}
+
+// ClearRateLimit drops the limit SetRateLimit gave taskType, which falls
+// back to the one in jobconfig, if any.
+func (tm *TaskManager) ClearRateLimit(taskType string) {
+	tm.serversMu.Lock()
+	delete(tm.rateOverrides, taskType)
+	tm.serversMu.Unlock()
+	tm.unblockRate(taskType)
+}
+
+// rateLimit is the limit of SetRateLimit for taskType, or else the one of
+// jobconfig.
+func (tm *TaskManager) rateLimit(taskType string) (model.RateLimit, bool) {
+	tm.serversMu.Lock()
+	defer tm.serversMu.Unlock()
+	if limit, ok := tm.rateOverrides[taskType]; ok {
+		return limit, true
+	}
+	taskWeight, ok := tm.tasksWeight[taskType]
+	if !ok || taskWeight.RateLimit == nil {
+		return model.RateLimit{}, false
+	}
+	return *taskWeight.RateLimit, true
+}
+
+// unblockRate lets tasks of taskType held back by its old limit start
+// again right away.
+func (tm *TaskManager) unblockRate(taskType string) {
+	tm.rateMu.Lock()
+	delete(tm.rateBlocked, taskType)
+	tm.rateMu.Unlock()
+}
+
+// reserve takes one start from the rate limit of taskType. It returns zero
+// when the task may start now, and otherwise how long to hold it back.
+// When storage cannot be asked about a shared limit the task is held back
+// too, since the limit usually protects a quota of someone else.
+func (tm *TaskManager) reserve(taskType string) time.Duration {
+	if taskType == "" {
+		return 0
+	}
+	limit, ok := tm.rateLimit(taskType)
+	if !ok {
+		return 0
+	}
+	var wait time.Duration
+	if limit.Shared {
+		var err error
+		wait, err = tm.storageClient.TakeRateToken(taskType, limit)
+		if err != nil {
+			tm.logger.Error("failed to take rate token", "type", taskType, "error", err)
+			wait = util.CLAIM_POLL_INTERVAL * time.Second
+		}
+	}
+	tm.rateMu.Lock()
+	defer tm.rateMu.Unlock()
+	if !limit.Shared {
+		state, ok := tm.rateStates[taskType]
+		if !ok {
+			state = &util.RateState{}
+			tm.rateStates[taskType] = state
+		}
+		wait = state.Take(limit, time.Now())
+	}
+	if wait > 0 {
+		tm.rateBlocked[taskType] = time.Now().Add(wait)
+	}
+	return wait
+}
+
+// rateOpen drops the types whose rate limit was hit recently, so the claim
+// loop does not claim tasks only to hand them back.
+func (tm *TaskManager) rateOpen(types []string) []string {
+	tm.rateMu.Lock()
+	defer tm.rateMu.Unlock()
+	now := time.Now()
+	open := types[:0]
+	for _, taskType := range types {
+		if until, ok := tm.rateBlocked[taskType]; ok && now.Before(until) {
+			continue
+		}
+		open = append(open, taskType)
+	}
+	return open
+}
+
+// deferTask puts a task held back by its rate limit in the delay queue.
+func (tm *TaskManager) deferTask(task model.TaskDetail, handler model.TaskHandler, wait time.Duration) {
+	_, span := tm.startTaskSpan(tm.ctx, "task.delay", task)
+	tm.delayQueue.Add(&DelayTask{
+		IdTask:  task.Id,
+		Meta:    task.Meta,
+		Handler: handler,
+		Time:    time.Now().Add(wait).Unix() + 1,
+		Attempt: task.Attempt,
+		Span:    span,
+	})
+}
@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+)
+
+func TestSharedRateLimitIsKeptInStorage(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	first, second := startTestManager(t, store), startTestManager(t, store)
+	for _, tm := range []*TaskManager{first, second} {
+		tm.SetRateLimit("shared", model.RateLimit{Limit: 1, Window: 60, Shared: true})
+		tm.SetRateLimit("local", model.RateLimit{Limit: 1, Window: 60})
+	}
+	if wait := first.reserve("shared"); wait != 0 {
+		t.Fatalf("first reserve of a shared limit waits %v, want 0", wait)
+	}
+	if wait := second.reserve("shared"); wait <= 0 {
+		t.Error("another server took a shared limit twice")
+	}
+	if wait := first.reserve("local"); wait != 0 {
+		t.Fatalf("first reserve of a local limit waits %v, want 0", wait)
+	}
+	if wait := second.reserve("local"); wait != 0 {
+		t.Errorf("another server waits %v on a local limit, want its own", wait)
+	}
+	if open := second.rateOpen([]string{"shared", "local", "other"}); len(open) != 2 || open[0] != "local" {
+		t.Errorf("rateOpen = %v, want the shared type held back", open)
+	}
+}
+
+func TestTaskOverTheRateLimitIsDeferred(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	tm := startTestManager(t, store)
+	tm.SetRateLimit("work", model.RateLimit{Limit: 1, Window: 1})
+	started := make(chan time.Time, 2)
+	tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		started <- time.Now()
+		return nil, nil
+	})
+	tm.StartManager()
+
+	first, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := tm.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delayed := tm.DelayedCount(); delayed != 1 {
+		t.Errorf("DelayedCount = %v, want the second task deferred", delayed)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, id := range []string{first, second} {
+		if err := tm.Wait(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	firstStart, secondStart := <-started, <-started
+	if gap := secondStart.Sub(firstStart); gap < 950*time.Millisecond {
+		t.Errorf("tasks started %v apart, want the second a window later", gap)
+	}
+}
@@ -0,0 +1,43 @@
+package manager
+
+import (
+	"context"
+	"strconv"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, name string) (context.Context, util.Span) {
+	return ctx, nopSpan{}
+}
+
+func (nopTracer) Extract(ctx context.Context, traceParent string) context.Context {
+	return ctx
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(key string, value string) {}
+func (nopSpan) RecordError(err error)                 {}
+func (nopSpan) TraceParent() string                   { return "" }
+func (nopSpan) End()                                  {}
+
+// UseTracer traces every task from submit to the end of its handler. The
+// traceparent of the submit span is saved in TaskMeta.TraceParent and sent
+// with tasks handed to other servers, so one trace covers the whole run.
+func (tm *TaskManager) UseTracer(tracer util.Tracer) {
+	tm.tracer = tracer
+}
+
+// startTaskSpan starts a span of task under the trace the task was
+// submitted in.
+func (tm *TaskManager) startTaskSpan(ctx context.Context, name string, task model.TaskDetail) (context.Context, util.Span) {
+	ctx, span := tm.tracer.Start(tm.tracer.Extract(ctx, task.Meta.TraceParent), name)
+	span.SetAttribute("task.id", task.Id)
+	span.SetAttribute("task.type", task.Meta.Type)
+	span.SetAttribute("task.attempt", strconv.Itoa(task.Attempt))
+	return ctx, span
+}
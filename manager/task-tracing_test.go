@@ -0,0 +1,85 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	"github.com/amitiwary999/task-scheduler/tracing/oteltracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceFollowsTaskAcrossServers(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := oteltracing.NewTracer(provider.Tracer("test"))
+	store := storage.NewMemoryStorage()
+	hub := storage.NewMemoryHub()
+	noop := func(ctx context.Context, task model.TaskDetail) ([]byte, error) { return nil, nil }
+	useTracer := func(tm *TaskManager) { tm.UseTracer(tracer) }
+
+	a := startTestNode(t, store, hub, "a", noop, useTracer)
+	b := startTestNode(t, store, hub, "b", noop, useTracer)
+	eventually(t, "a and b to see each other", func() bool { return a.knows("a", "b") && b.knows("a", "b") })
+
+	ctx, request := provider.Tracer("test").Start(context.Background(), "request")
+	var ids []string
+	for i := 0; i < 8; i++ {
+		id, err := a.tm.AddNewTaskContext(ctx, model.Task{Meta: model.TaskMeta{MetaId: fmt.Sprint(i), Type: "work"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	request.End()
+	waitCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, id := range ids {
+		if err := a.tm.Wait(waitCtx, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	traceId := request.SpanContext().TraceID()
+	submits := make(map[string]sdktrace.ReadOnlySpan)
+	eventually(t, "every execute span to end", func() bool {
+		executes := 0
+		for _, span := range recorder.Ended() {
+			switch span.Name() {
+			case "task.submit":
+				submits[span.SpanContext().SpanID().String()] = span
+			case "task.execute":
+				executes++
+			}
+		}
+		return executes == len(ids)
+	})
+	servers := make(map[string]bool)
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() != traceId {
+			t.Errorf("%v span is in another trace", span.Name())
+		}
+		switch span.Name() {
+		case "task.submit":
+			if span.Parent().SpanID() != request.SpanContext().SpanID() {
+				t.Errorf("submit span parent = %v, want the request", span.Parent().SpanID())
+			}
+		case "task.execute":
+			if _, ok := submits[span.Parent().SpanID().String()]; !ok {
+				t.Errorf("execute span parent %v is not a submit span", span.Parent().SpanID())
+			}
+			for _, attr := range span.Attributes() {
+				if attr.Key == "server.id" {
+					servers[attr.Value.AsString()] = true
+				}
+			}
+		}
+	}
+	if len(servers) < 2 {
+		t.Errorf("tasks ran on %v, want the trace to cross servers", servers)
+	}
+}
@@ -0,0 +1,427 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+var ErrInvalidWorkflow = errors.New("invalid workflow")
+
+// ValidateWorkflow checks that every node has a unique name and a type,
+// that dependencies name other nodes of the workflow and that the graph has
+// no cycle.
+func ValidateWorkflow(workflow model.Workflow) error {
+	if len(workflow.Nodes) == 0 {
+		return fmt.Errorf("%w: no nodes", ErrInvalidWorkflow)
+	}
+	nodes := make(map[string]model.WorkflowNode, len(workflow.Nodes))
+	for _, node := range workflow.Nodes {
+		if node.Name == "" {
+			return fmt.Errorf("%w: node without name", ErrInvalidWorkflow)
+		}
+		if _, ok := nodes[node.Name]; ok {
+			return fmt.Errorf("%w: duplicate node %q", ErrInvalidWorkflow, node.Name)
+		}
+		if node.Meta.Type == "" {
+			return fmt.Errorf("%w: node %q has no task type", ErrInvalidWorkflow, node.Name)
+		}
+		if node.Compensate != nil && node.Compensate.Type == "" {
+			return fmt.Errorf("%w: compensation of node %q has no task type", ErrInvalidWorkflow, node.Name)
+		}
+		if node.MinParents < 0 || node.MinParents > len(node.DependsOn) {
+			return fmt.Errorf("%w: node %q needs %v of %v parents", ErrInvalidWorkflow, node.Name, node.MinParents, len(node.DependsOn))
+		}
+		nodes[node.Name] = node
+	}
+	indegree := make(map[string]int, len(nodes))
+	children := make(map[string][]string, len(nodes))
+	for _, node := range workflow.Nodes {
+		for _, parent := range node.DependsOn {
+			if _, ok := nodes[parent]; !ok {
+				return fmt.Errorf("%w: node %q depends on unknown node %q", ErrInvalidWorkflow, node.Name, parent)
+			}
+			if parent == node.Name {
+				return fmt.Errorf("%w: node %q depends on itself", ErrInvalidWorkflow, node.Name)
+			}
+			indegree[node.Name]++
+			children[parent] = append(children[parent], node.Name)
+		}
+	}
+	var ready []string
+	for name := range nodes {
+		if indegree[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+	visited := 0
+	for len(ready) > 0 {
+		name := ready[len(ready)-1]
+		ready = ready[:len(ready)-1]
+		visited++
+		for _, child := range children[name] {
+			indegree[child]--
+			if indegree[child] == 0 {
+				ready = append(ready, child)
+			}
+		}
+	}
+	if visited < len(nodes) {
+		var cycle []string
+		for name, degree := range indegree {
+			if degree > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return fmt.Errorf("%w: cycle through %v", ErrInvalidWorkflow, cycle)
+	}
+	return nil
+}
+
+func (tm *TaskManager) AddWorkflow(workflow model.Workflow) (string, error) {
+	if err := ValidateWorkflow(workflow); err != nil {
+		return "", err
+	}
+	if err := tm.checkWorkflowPayloadSize(workflow); err != nil {
+		return "", err
+	}
+	id, err := tm.storageClient.SaveWorkflow(&workflow)
+	if err != nil {
+		return "", err
+	}
+	workflow.Id = id
+	workflow.Status = util.TASK_STATUS_RUNNING
+	for i := range workflow.Nodes {
+		workflow.Nodes[i].Status = util.WORKFLOW_NODE_WAITING
+	}
+	tm.advanceWorkflow(&workflow)
+	return id, nil
+}
+
+func (tm *TaskManager) GetWorkflow(id string) (*model.Workflow, error) {
+	return tm.storageClient.GetWorkflow(id)
+}
+
+// CancelWorkflow stops a running workflow: nodes that have not run are
+// cancelled, and nodes already running finish without scheduling anything.
+func (tm *TaskManager) CancelWorkflow(id string) error {
+	cancelled, err := tm.storageClient.UpdateWorkflowStatus(id, util.TASK_STATUS_RUNNING, util.TASK_STATUS_CANCELLED)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return fmt.Errorf("workflow %v is not running", id)
+	}
+	workflow, err := tm.storageClient.GetWorkflow(id)
+	if err != nil {
+		return err
+	}
+	fromStatus := []string{util.WORKFLOW_NODE_WAITING, util.WORKFLOW_NODE_SCHEDULED}
+	for _, node := range workflow.Nodes {
+		if isTerminalNodeStatus(node.Status) {
+			continue
+		}
+		if _, err := tm.storageClient.UpdateWorkflowNodeStatus(id, node.Name, fromStatus, util.TASK_STATUS_CANCELLED); err != nil {
+			return err
+		}
+		if node.TaskId != "" {
+			if _, err := tm.CancelTask(node.TaskId); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (tm *TaskManager) onWorkflowTaskFinished(task model.TaskDetail, status string) {
+	if !tm.finishWorkflowNode(task, status) {
+		return
+	}
+	workflowId := task.Meta.WorkflowId
+	workflow, err := tm.storageClient.GetWorkflow(workflowId)
+	if err != nil {
+		tm.logger.Error("failed to load workflow", "workflowId", workflowId, "error", err)
+		return
+	}
+	tm.advanceWorkflow(workflow)
+}
+
+// finishWorkflowNode moves the node of task to the status the task ended
+// in. It returns false when storage failed.
+func (tm *TaskManager) finishWorkflowNode(task model.TaskDetail, status string) bool {
+	workflowId := task.Meta.WorkflowId
+	fromStatus := []string{util.WORKFLOW_NODE_SCHEDULED}
+	if task.Meta.Compensation {
+		fromStatus = []string{util.WORKFLOW_COMPENSATING}
+		if status == util.TASK_STATUS_COMPLETED {
+			status = util.WORKFLOW_COMPENSATED
+		} else {
+			status = util.WORKFLOW_COMPENSATION_FAILED
+		}
+	}
+	_, err := tm.storageClient.UpdateWorkflowNodeStatus(workflowId, task.Meta.WorkflowNode, fromStatus, status)
+	if err != nil {
+		tm.taskLogger(task).Error("failed to update workflow node", "error", err)
+		return false
+	}
+	return true
+}
+
+// reconcileWorkflows catches up on workflows a server stopped in the
+// middle of: a node whose task ended before its status was updated, or a
+// workflow saved but never advanced. Every server runs it; the conditional
+// updates in storage make a second run a no-op.
+func (tm *TaskManager) reconcileWorkflows() {
+	ids, err := tm.storageClient.GetActiveWorkflows()
+	if err != nil {
+		tm.logger.Error("failed to list active workflows", "error", err)
+		return
+	}
+	for _, id := range ids {
+		workflow, err := tm.storageClient.GetWorkflow(id)
+		if err != nil {
+			tm.logger.Error("failed to load workflow", "workflowId", id, "error", err)
+			continue
+		}
+		changed := false
+		for _, node := range workflow.Nodes {
+			var taskId string
+			switch node.Status {
+			case util.WORKFLOW_NODE_SCHEDULED:
+				taskId = node.TaskId
+			case util.WORKFLOW_COMPENSATING:
+				taskId = storage.WorkflowCompensationId(id, node.Name)
+			}
+			if taskId == "" {
+				continue
+			}
+			task, err := tm.storageClient.GetTask(taskId)
+			if err != nil {
+				tm.logger.Error("failed to load task of workflow node", "workflowId", id, "workflowNode", node.Name, "error", err)
+				continue
+			}
+			if isTerminalStatus(task.Status) && tm.finishWorkflowNode(*task, task.Status) {
+				changed = true
+			}
+		}
+		if changed {
+			if workflow, err = tm.storageClient.GetWorkflow(id); err != nil {
+				tm.logger.Error("failed to load workflow", "workflowId", id, "error", err)
+				continue
+			}
+		}
+		tm.advanceWorkflow(workflow)
+	}
+}
+
+// advanceWorkflow schedules every waiting node whose parents are done,
+// skips nodes that can no longer get enough completed parents and closes
+// the workflow once every node is finished. Servers may run it for the
+// same workflow at once; the conditional updates in storage keep each
+// transition to a single winner.
+func (tm *TaskManager) advanceWorkflow(workflow *model.Workflow) {
+	if workflow.Status == util.TASK_STATUS_RUNNING && needsCompensation(workflow) {
+		compensating, err := tm.storageClient.UpdateWorkflowStatus(workflow.Id, util.TASK_STATUS_RUNNING, util.WORKFLOW_COMPENSATING)
+		if err != nil {
+			tm.logger.Error("failed to start compensation of workflow", "workflowId", workflow.Id, "error", err)
+			return
+		}
+		if compensating {
+			workflow.Status = util.WORKFLOW_COMPENSATING
+		}
+	}
+	if workflow.Status == util.WORKFLOW_COMPENSATING {
+		tm.compensateWorkflow(workflow)
+		return
+	}
+	if workflow.Status != util.TASK_STATUS_RUNNING {
+		return
+	}
+	nodes := make(map[string]*model.WorkflowNode, len(workflow.Nodes))
+	for i := range workflow.Nodes {
+		nodes[workflow.Nodes[i].Name] = &workflow.Nodes[i]
+	}
+	for changed := true; changed; {
+		changed = false
+		for i := range workflow.Nodes {
+			node := &workflow.Nodes[i]
+			if node.Status != util.WORKFLOW_NODE_WAITING {
+				continue
+			}
+			required := len(node.DependsOn)
+			if node.MinParents > 0 {
+				required = node.MinParents
+			}
+			completed, dead := 0, 0
+			var firstCompleted *model.WorkflowNode
+			for _, parent := range node.DependsOn {
+				switch status := nodes[parent].Status; {
+				case status == util.TASK_STATUS_COMPLETED:
+					completed++
+					if firstCompleted == nil {
+						firstCompleted = nodes[parent]
+					}
+				case isTerminalNodeStatus(status):
+					dead++
+				}
+			}
+			if completed >= required {
+				if tm.scheduleWorkflowNode(workflow.Id, node, firstCompleted) {
+					node.Status = util.WORKFLOW_NODE_SCHEDULED
+				}
+			} else if len(node.DependsOn)-dead < required {
+				fromStatus := []string{util.WORKFLOW_NODE_WAITING}
+				if _, err := tm.storageClient.UpdateWorkflowNodeStatus(workflow.Id, node.Name, fromStatus, util.WORKFLOW_NODE_SKIPPED); err != nil {
+					tm.logger.Error("failed to skip workflow node", "workflowId", workflow.Id, "workflowNode", node.Name, "error", err)
+					return
+				}
+				node.Status = util.WORKFLOW_NODE_SKIPPED
+				changed = true
+			}
+		}
+	}
+	status := util.TASK_STATUS_COMPLETED
+	for _, node := range workflow.Nodes {
+		if !isTerminalNodeStatus(node.Status) {
+			return
+		}
+		if node.Status != util.TASK_STATUS_COMPLETED {
+			status = util.TASK_STATUS_FAILED
+		}
+	}
+	if _, err := tm.storageClient.UpdateWorkflowStatus(workflow.Id, util.TASK_STATUS_RUNNING, status); err != nil {
+		tm.logger.Error("failed to finish workflow", "workflowId", workflow.Id, "error", err)
+	}
+}
+
+func (tm *TaskManager) scheduleWorkflowNode(workflowId string, node *model.WorkflowNode, parent *model.WorkflowNode) bool {
+	meta := node.Meta
+	meta.WorkflowId = workflowId
+	meta.WorkflowNode = node.Name
+	if meta.PassResult && parent != nil && parent.TaskId != "" {
+		parentTask, err := tm.storageClient.GetTask(parent.TaskId)
+		if err != nil {
+			tm.logger.Error("failed to load result of workflow node", "workflowId", workflowId, "workflowNode", parent.Name, "error", err)
+			return false
+		}
+		meta.Payload = parentTask.Result
+		if meta.Codec == "" {
+			meta.Codec = parentTask.Meta.Codec
+		}
+	}
+	taskId, scheduled, err := tm.storageClient.ScheduleWorkflowNode(workflowId, node.Name, meta)
+	if err != nil {
+		tm.logger.Error("failed to schedule workflow node", "workflowId", workflowId, "workflowNode", node.Name, "error", err)
+		return false
+	}
+	if scheduled {
+		node.TaskId = taskId
+		tm.submitted(taskId, meta)
+		tm.schedule(pendingDetail(taskId, meta), nil)
+	}
+	return scheduled
+}
+
+// needsCompensation reports whether a node failed for good while some
+// node has a compensating task to undo it.
+func needsCompensation(workflow *model.Workflow) bool {
+	failed, compensable := false, false
+	for _, node := range workflow.Nodes {
+		failed = failed || node.Status == util.TASK_STATUS_FAILED
+		compensable = compensable || node.Compensate != nil
+	}
+	return failed && compensable
+}
+
+// compensateWorkflow undoes the completed nodes of a failed workflow, last
+// step first: a node is compensated once none of its dependents still runs
+// or waits for its own compensation. The workflow ends compensated, or
+// failed when some compensation failed for good.
+func (tm *TaskManager) compensateWorkflow(workflow *model.Workflow) {
+	children := make(map[string][]*model.WorkflowNode, len(workflow.Nodes))
+	for i := range workflow.Nodes {
+		for _, parent := range workflow.Nodes[i].DependsOn {
+			children[parent] = append(children[parent], &workflow.Nodes[i])
+		}
+	}
+	pending := false
+	status := util.WORKFLOW_COMPENSATED
+	for i := range workflow.Nodes {
+		node := &workflow.Nodes[i]
+		switch node.Status {
+		case util.WORKFLOW_NODE_WAITING:
+			fromStatus := []string{util.WORKFLOW_NODE_WAITING}
+			if _, err := tm.storageClient.UpdateWorkflowNodeStatus(workflow.Id, node.Name, fromStatus, util.WORKFLOW_NODE_SKIPPED); err != nil {
+				tm.logger.Error("failed to skip workflow node", "workflowId", workflow.Id, "workflowNode", node.Name, "error", err)
+				return
+			}
+			node.Status = util.WORKFLOW_NODE_SKIPPED
+		case util.WORKFLOW_NODE_SCHEDULED, util.WORKFLOW_COMPENSATING:
+			pending = true
+		case util.WORKFLOW_COMPENSATION_FAILED:
+			status = util.TASK_STATUS_FAILED
+		}
+	}
+	for i := range workflow.Nodes {
+		node := &workflow.Nodes[i]
+		if node.Status != util.TASK_STATUS_COMPLETED || node.Compensate == nil {
+			continue
+		}
+		pending = true
+		ready := true
+		for _, child := range children[node.Name] {
+			switch child.Status {
+			case util.WORKFLOW_NODE_SCHEDULED, util.WORKFLOW_COMPENSATING:
+				ready = false
+			case util.TASK_STATUS_COMPLETED:
+				ready = ready && child.Compensate == nil
+			}
+		}
+		if ready {
+			tm.scheduleCompensation(workflow.Id, node)
+		}
+	}
+	if pending {
+		return
+	}
+	if _, err := tm.storageClient.UpdateWorkflowStatus(workflow.Id, util.WORKFLOW_COMPENSATING, status); err != nil {
+		tm.logger.Error("failed to finish compensation of workflow", "workflowId", workflow.Id, "error", err)
+	}
+}
+
+func (tm *TaskManager) scheduleCompensation(workflowId string, node *model.WorkflowNode) {
+	meta := *node.Compensate
+	meta.WorkflowId = workflowId
+	meta.WorkflowNode = node.Name
+	meta.Compensation = true
+	if meta.PassResult && node.TaskId != "" {
+		task, err := tm.storageClient.GetTask(node.TaskId)
+		if err != nil {
+			tm.logger.Error("failed to load result of workflow node", "workflowId", workflowId, "workflowNode", node.Name, "error", err)
+			return
+		}
+		meta.Payload = task.Result
+		if meta.Codec == "" {
+			meta.Codec = task.Meta.Codec
+		}
+	}
+	taskId, scheduled, err := tm.storageClient.ScheduleWorkflowCompensation(workflowId, node.Name, meta)
+	if err != nil {
+		tm.logger.Error("failed to compensate workflow node", "workflowId", workflowId, "workflowNode", node.Name, "error", err)
+		return
+	}
+	if scheduled {
+		node.Status = util.WORKFLOW_COMPENSATING
+		tm.submitted(taskId, meta)
+		tm.schedule(pendingDetail(taskId, meta), nil)
+	}
+}
+
+func isTerminalNodeStatus(status string) bool {
+	return status == util.WORKFLOW_NODE_SKIPPED || isTerminalStatus(status)
+}
@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+func TestReconcileFinishesWorkflowAfterCrash(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	workflowId, err := store.SaveWorkflow(&model.Workflow{
+		Name: "chain",
+		Nodes: []model.WorkflowNode{
+			{Name: "a", Meta: model.TaskMeta{Type: "work"}},
+			{Name: "b", Meta: model.TaskMeta{Type: "work"}, DependsOn: []string{"a"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A server ran node a and stopped before updating the node.
+	meta := model.TaskMeta{Type: "work", WorkflowId: workflowId, WorkflowNode: "a"}
+	taskId, scheduled, err := store.ScheduleWorkflowNode(workflowId, "a", meta)
+	if err != nil || !scheduled {
+		t.Fatalf("ScheduleWorkflowNode = %v, %v", scheduled, err)
+	}
+	if _, completed, err := store.UpdateTaskComplete(taskId, nil, nil); err != nil || !completed {
+		t.Fatalf("UpdateTaskComplete = %v, %v", completed, err)
+	}
+
+	tm := startTestManager(t, store)
+	tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		return nil, nil
+	})
+	tm.StartManager()
+
+	eventually(t, "the workflow to complete", func() bool {
+		workflow, err := store.GetWorkflow(workflowId)
+		return err == nil && workflow.Status == util.TASK_STATUS_COMPLETED
+	})
+	workflow, _ := store.GetWorkflow(workflowId)
+	for _, node := range workflow.Nodes {
+		if node.Status != util.TASK_STATUS_COMPLETED {
+			t.Errorf("node %v is %v, want completed", node.Name, node.Status)
+		}
+	}
+}
+
+// compensationOrder runs a workflow where a feeds b and side, and c fails
+// after b. It returns the nodes compensated, in order, and the workflow.
+func compensationOrder(t *testing.T, failUndo string) ([]string, *model.Workflow) {
+	t.Helper()
+	store := storage.NewMemoryStorage()
+	tm := startTestManager(t, store)
+	undone := make(chan string, 10)
+	tm.RegisterHandler("work", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		if task.Meta.WorkflowNode == "c" {
+			return nil, errors.New("c failed")
+		}
+		return nil, nil
+	})
+	tm.RegisterHandler("undo", func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		undone <- task.Meta.WorkflowNode
+		if task.Meta.WorkflowNode == failUndo {
+			return nil, errors.New("undo failed")
+		}
+		return nil, nil
+	})
+	tm.StartManager()
+
+	undo := &model.TaskMeta{Type: "undo"}
+	workflowId, err := tm.AddWorkflow(model.Workflow{
+		Name: "saga",
+		Nodes: []model.WorkflowNode{
+			{Name: "a", Meta: model.TaskMeta{Type: "work"}, Compensate: undo},
+			{Name: "b", Meta: model.TaskMeta{Type: "work"}, Compensate: undo, DependsOn: []string{"a"}},
+			{Name: "side", Meta: model.TaskMeta{Type: "work"}, Compensate: undo, DependsOn: []string{"a"}},
+			{Name: "c", Meta: model.TaskMeta{Type: "work"}, DependsOn: []string{"b"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the compensation to finish", func() bool {
+		workflow, err := store.GetWorkflow(workflowId)
+		return err == nil && workflow.Status != util.TASK_STATUS_RUNNING && workflow.Status != util.WORKFLOW_COMPENSATING
+	})
+	close(undone)
+	var order []string
+	for node := range undone {
+		order = append(order, node)
+	}
+	workflow, _ := store.GetWorkflow(workflowId)
+	return order, workflow
+}
+
+func TestCompensationRunsInReverseDependencyOrder(t *testing.T) {
+	order, workflow := compensationOrder(t, "")
+	if len(order) != 3 || order[2] != "a" {
+		t.Errorf("compensated %v, want b and side before a", order)
+	}
+	if workflow.Status != util.WORKFLOW_COMPENSATED {
+		t.Errorf("workflow is %v, want %v", workflow.Status, util.WORKFLOW_COMPENSATED)
+	}
+	for _, node := range workflow.Nodes {
+		want := util.WORKFLOW_COMPENSATED
+		if node.Name == "c" {
+			want = util.TASK_STATUS_FAILED
+		}
+		if node.Status != want {
+			t.Errorf("node %v is %v, want %v", node.Name, node.Status, want)
+		}
+	}
+}
+
+func TestFailedCompensationFailsTheWorkflow(t *testing.T) {
+	order, workflow := compensationOrder(t, "b")
+	if len(order) != 3 || order[2] != "a" {
+		t.Errorf("compensated %v, want a compensated after b failed to", order)
+	}
+	if workflow.Status != util.TASK_STATUS_FAILED {
+		t.Errorf("workflow is %v, want %v", workflow.Status, util.TASK_STATUS_FAILED)
+	}
+	for _, node := range workflow.Nodes {
+		if node.Name == "b" && node.Status != util.WORKFLOW_COMPENSATION_FAILED {
+			t.Errorf("node b is %v, want %v", node.Status, util.WORKFLOW_COMPENSATION_FAILED)
+		}
+	}
+}
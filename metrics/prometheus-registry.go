@@ -0,0 +1,210 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// DefaultBuckets are the histogram bounds in seconds, from a quick storage
+// call up to a long task.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+var defaultHelp = map[string]string{
+	util.METRIC_TASKS_SUBMITTED:    "Tasks added, by type.",
+	util.METRIC_TASKS_SUCCEEDED:    "Task runs that succeeded, by type.",
+	util.METRIC_TASKS_FAILED:       "Task runs that failed for good, by type.",
+	util.METRIC_TASKS_RETRIED:      "Task runs that failed and were retried, by type.",
+	util.METRIC_TASKS_REJECTED:     "Tasks refused because their queue was full, by queue.",
+	util.METRIC_TASKS_SPILLED:      "Tasks saved without queueing because their queue was full, by queue.",
+	util.METRIC_QUEUE_DEPTH:        "Tasks waiting for a worker, by queue.",
+	util.METRIC_QUEUE_WORKERS:      "Running workers, by queue.",
+	util.METRIC_QUEUE_BUSY_WORKERS: "Workers running a task, by queue.",
+	util.METRIC_DELAYED_TASKS:      "Tasks waiting in the delay queue.",
+	util.METRIC_QUEUE_WAIT:         "Seconds tasks waited for a worker, by type.",
+	util.METRIC_EXECUTION_TIME:     "Seconds handlers ran, by type.",
+	util.METRIC_STORAGE_LATENCY:    "Seconds storage calls took, by operation.",
+}
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+type series struct {
+	labels string
+	value  float64
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type family struct {
+	kind   string
+	help   string
+	series map[string]*series
+}
+
+// Registry keeps metrics in memory and serves them in the Prometheus text
+// exposition format. It is a util.MetricsSink and an http.Handler.
+type Registry struct {
+	mu       sync.Mutex
+	buckets  []float64
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		buckets:  DefaultBuckets,
+		families: make(map[string]*family),
+	}
+}
+
+// SetBuckets changes the histogram bounds of histograms not observed yet.
+func (r *Registry) SetBuckets(buckets []float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buckets = append([]float64(nil), buckets...)
+	sort.Float64s(r.buckets)
+}
+
+func (r *Registry) AddCounter(name string, labels map[string]string, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, kindCounter, labels).value += delta
+}
+
+func (r *Registry) SetGauge(name string, labels map[string]string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, kindGauge, labels).value = value
+}
+
+func (r *Registry) Observe(name string, labels map[string]string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.series(name, kindHistogram, labels)
+	if s.bounds == nil {
+		s.bounds = r.buckets
+		s.counts = make([]uint64, len(s.bounds))
+	}
+	for i, bound := range s.bounds {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (r *Registry) series(name string, kind string, labels map[string]string) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{kind: kind, help: defaultHelp[name], series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	key := formatLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: key}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		if f.help != "" {
+			fmt.Fprintf(&b, "# HELP %v %v\n", name, f.help)
+		}
+		fmt.Fprintf(&b, "# TYPE %v %v\n", name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != kindHistogram {
+				fmt.Fprintf(&b, "%v%v %v\n", name, braces(s.labels), formatValue(s.value))
+				continue
+			}
+			for i, bound := range s.bounds {
+				le := withLabel(s.labels, "le", formatValue(bound))
+				fmt.Fprintf(&b, "%v_bucket%v %v\n", name, le, s.counts[i])
+			}
+			fmt.Fprintf(&b, "%v_bucket%v %v\n", name, withLabel(s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(&b, "%v_sum%v %v\n", name, braces(s.labels), formatValue(s.sum))
+			fmt.Fprintf(&b, "%v_count%v %v\n", name, braces(s.labels), s.count)
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// formatLabels renders labels sorted by name, so equal label sets share a
+// series.
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + quoteLabel(labels[name])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func withLabel(labels string, name string, value string) string {
+	pair := name + "=" + quoteLabel(value)
+	if labels == "" {
+		return braces(pair)
+	}
+	return braces(labels + "," + pair)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
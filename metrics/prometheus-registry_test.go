@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+	r.SetBuckets([]float64{1, 0.5})
+	r.AddCounter(util.METRIC_TASKS_SUBMITTED, map[string]string{"type": "email"}, 1)
+	r.AddCounter(util.METRIC_TASKS_SUBMITTED, map[string]string{"type": "email"}, 2)
+	r.AddCounter(util.METRIC_TASKS_SUBMITTED, map[string]string{"type": "a\\b \"c\"\nd"}, 1)
+	r.SetGauge(util.METRIC_DELAYED_TASKS, nil, 4)
+	r.SetGauge("custom_gauge", map[string]string{"z": "1", "a": "2"}, 1.5)
+	for _, value := range []float64{0.25, 0.75, 3} {
+		r.Observe(util.METRIC_QUEUE_WAIT, map[string]string{"type": "email"}, value)
+	}
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE custom_gauge gauge
+custom_gauge{a="2",z="1"} 1.5
+# HELP taskscheduler_delayed_tasks Tasks waiting in the delay queue.
+# TYPE taskscheduler_delayed_tasks gauge
+taskscheduler_delayed_tasks 4
+# HELP taskscheduler_queue_wait_seconds Seconds tasks waited for a worker, by type.
+# TYPE taskscheduler_queue_wait_seconds histogram
+taskscheduler_queue_wait_seconds_bucket{type="email",le="0.5"} 1
+taskscheduler_queue_wait_seconds_bucket{type="email",le="1"} 2
+taskscheduler_queue_wait_seconds_bucket{type="email",le="+Inf"} 3
+taskscheduler_queue_wait_seconds_sum{type="email"} 4
+taskscheduler_queue_wait_seconds_count{type="email"} 3
+# HELP taskscheduler_tasks_submitted_total Tasks added, by type.
+# TYPE taskscheduler_tasks_submitted_total counter
+taskscheduler_tasks_submitted_total{type="a\\b \"c\"\nd"} 1
+taskscheduler_tasks_submitted_total{type="email"} 3
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteTo =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestCounterNamesEndInTotal(t *testing.T) {
+	for _, name := range []string{
+		util.METRIC_TASKS_SUBMITTED,
+		util.METRIC_TASKS_SUCCEEDED,
+		util.METRIC_TASKS_FAILED,
+		util.METRIC_TASKS_RETRIED,
+		util.METRIC_TASKS_REJECTED,
+		util.METRIC_TASKS_SPILLED,
+	} {
+		if !strings.HasSuffix(name, "_total") {
+			t.Errorf("counter %v does not end in _total", name)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// StorageClient times every call of a util.StorageClient into
+// METRIC_STORAGE_LATENCY, labelled with the method name.
+type StorageClient struct {
+	client util.StorageClient
+	sink   util.MetricsSink
+}
+
+func InstrumentStorage(client util.StorageClient, sink util.MetricsSink) *StorageClient {
+	return &StorageClient{client: client, sink: sink}
+}
+
+func (s *StorageClient) observe(op string, start time.Time) {
+	s.sink.Observe(util.METRIC_STORAGE_LATENCY, map[string]string{"op": op}, time.Since(start).Seconds())
+}
+
+func (s *StorageClient) SaveTask(meta *model.TaskMeta) (string, error) {
+	defer s.observe("SaveTask", time.Now())
+	return s.client.SaveTask(meta)
+}
+
+func (s *StorageClient) GetTask(id string) (*model.TaskDetail, error) {
+	defer s.observe("GetTask", time.Now())
+	return s.client.GetTask(id)
+}
+
+func (s *StorageClient) ClaimTask(id string, serverId string) (bool, error) {
+	defer s.observe("ClaimTask", time.Now())
+	return s.client.ClaimTask(id, serverId)
+}
+
+func (s *StorageClient) ClaimPendingTasks(serverId string, queue string, known []string, types []string, limit int) ([]model.TaskDetail, error) {
+	defer s.observe("ClaimPendingTasks", time.Now())
+	return s.client.ClaimPendingTasks(serverId, queue, known, types, limit)
+}
+
+func (s *StorageClient) UpdateTaskComplete(id string, result []byte, next []model.TaskMeta) ([]string, bool, error) {
+	defer s.observe("UpdateTaskComplete", time.Now())
+	return s.client.UpdateTaskComplete(id, result, next)
+}
+
+func (s *StorageClient) UpdateTaskFailed(id string, reason string) (bool, error) {
+	defer s.observe("UpdateTaskFailed", time.Now())
+	return s.client.UpdateTaskFailed(id, reason)
+}
+
+func (s *StorageClient) RetryTask(id string, reason string, executionTime int64) (bool, error) {
+	defer s.observe("RetryTask", time.Now())
+	return s.client.RetryTask(id, reason, executionTime)
+}
+
+func (s *StorageClient) CancelTask(id string) (bool, error) {
+	defer s.observe("CancelTask", time.Now())
+	return s.client.CancelTask(id)
+}
+
+func (s *StorageClient) GetChildTasks(parentId string) ([]model.TaskDetail, error) {
+	defer s.observe("GetChildTasks", time.Now())
+	return s.client.GetChildTasks(parentId)
+}
+
+func (s *StorageClient) UpdateServerStatus(serverId string, status int) error {
+	defer s.observe("UpdateServerStatus", time.Now())
+	return s.client.UpdateServerStatus(serverId, status)
+}
+
+func (s *StorageClient) RequeueStaleTasks() (int, error) {
+	defer s.observe("RequeueStaleTasks", time.Now())
+	return s.client.RequeueStaleTasks()
+}
+
+func (s *StorageClient) GetAllUsedServer() ([]model.JoinData, error) {
+	defer s.observe("GetAllUsedServer", time.Now())
+	return s.client.GetAllUsedServer()
+}
+
+func (s *StorageClient) GetTaskConfig() ([]model.TaskWeight, error) {
+	defer s.observe("GetTaskConfig", time.Now())
+	return s.client.GetTaskConfig()
+}
+
+func (s *StorageClient) TakeRateToken(taskType string, limit model.RateLimit) (time.Duration, error) {
+	defer s.observe("TakeRateToken", time.Now())
+	return s.client.TakeRateToken(taskType, limit)
+}
+
+func (s *StorageClient) DeferTask(id string, executionTime int64) (bool, error) {
+	defer s.observe("DeferTask", time.Now())
+	return s.client.DeferTask(id, executionTime)
+}
+
+func (s *StorageClient) GetPendingTask() ([]model.PendingTask, error) {
+	defer s.observe("GetPendingTask", time.Now())
+	return s.client.GetPendingTask()
+}
+
+func (s *StorageClient) SaveWorkflow(workflow *model.Workflow) (string, error) {
+	defer s.observe("SaveWorkflow", time.Now())
+	return s.client.SaveWorkflow(workflow)
+}
+
+func (s *StorageClient) GetWorkflow(id string) (*model.Workflow, error) {
+	defer s.observe("GetWorkflow", time.Now())
+	return s.client.GetWorkflow(id)
+}
+
+func (s *StorageClient) ScheduleWorkflowNode(workflowId string, name string, meta model.TaskMeta) (string, bool, error) {
+	defer s.observe("ScheduleWorkflowNode", time.Now())
+	return s.client.ScheduleWorkflowNode(workflowId, name, meta)
+}
+
+func (s *StorageClient) ScheduleWorkflowCompensation(workflowId string, name string, meta model.TaskMeta) (string, bool, error) {
+	defer s.observe("ScheduleWorkflowCompensation", time.Now())
+	return s.client.ScheduleWorkflowCompensation(workflowId, name, meta)
+}
+
+func (s *StorageClient) UpdateWorkflowNodeStatus(workflowId string, name string, fromStatus []string, status string) (bool, error) {
+	defer s.observe("UpdateWorkflowNodeStatus", time.Now())
+	return s.client.UpdateWorkflowNodeStatus(workflowId, name, fromStatus, status)
+}
+
+func (s *StorageClient) UpdateWorkflowStatus(id string, fromStatus string, status string) (bool, error) {
+	defer s.observe("UpdateWorkflowStatus", time.Now())
+	return s.client.UpdateWorkflowStatus(id, fromStatus, status)
+}
+
+func (s *StorageClient) GetActiveWorkflows() ([]string, error) {
+	defer s.observe("GetActiveWorkflows", time.Now())
+	return s.client.GetActiveWorkflows()
+}
+
+func (s *StorageClient) SetPause(pause model.Pause, paused bool) error {
+	defer s.observe("SetPause", time.Now())
+	return s.client.SetPause(pause, paused)
+}
+
+func (s *StorageClient) GetPauses() ([]model.Pause, error) {
+	defer s.observe("GetPauses", time.Now())
+	return s.client.GetPauses()
+}
+
+func (s *StorageClient) SaveTaskLog(taskLog model.TaskLog) error {
+	defer s.observe("SaveTaskLog", time.Now())
+	return s.client.SaveTaskLog(taskLog)
+}
+
+func (s *StorageClient) GetTaskLogs(taskId string) ([]model.TaskLog, error) {
+	defer s.observe("GetTaskLogs", time.Now())
+	return s.client.GetTaskLogs(taskId)
+}
+
+func (s *StorageClient) ListTasks(filter model.TaskFilter) ([]model.TaskDetail, error) {
+	defer s.observe("ListTasks", time.Now())
+	return s.client.ListTasks(filter)
+}
+
+func (s *StorageClient) CountTasks() ([]model.TaskCount, error) {
+	defer s.observe("CountTasks", time.Now())
+	return s.client.CountTasks()
+}
+
+func (s *StorageClient) ReplayTask(id string, executionTime int64) (bool, error) {
+	defer s.observe("ReplayTask", time.Now())
+	return s.client.ReplayTask(id, executionTime)
+}
+
+func (s *StorageClient) RescheduleTask(id string, executionTime int64) (bool, error) {
+	defer s.observe("RescheduleTask", time.Now())
+	return s.client.RescheduleTask(id, executionTime)
+}
+
+func (s *StorageClient) DeleteTask(id string) (bool, error) {
+	defer s.observe("DeleteTask", time.Now())
+	return s.client.DeleteTask(id)
+}
+
+func (s *StorageClient) SaveBatch(batch *model.Batch) ([]string, error) {
+	defer s.observe("SaveBatch", time.Now())
+	return s.client.SaveBatch(batch)
+}
+
+func (s *StorageClient) GetBatch(id string) (*model.Batch, error) {
+	defer s.observe("GetBatch", time.Now())
+	return s.client.GetBatch(id)
+}
+
+func (s *StorageClient) FinishBatch(id string, callback *model.TaskMeta) (string, bool, error) {
+	defer s.observe("FinishBatch", time.Now())
+	return s.client.FinishBatch(id, callback)
+}
+
+func (s *StorageClient) GetRunningBatches() ([]string, error) {
+	defer s.observe("GetRunningBatches", time.Now())
+	return s.client.GetRunningBatches()
+}
@@ -0,0 +1,23 @@
+package model
+
+// Batch is a group of tasks submitted together. Once every task reached a
+// terminal status the OnComplete task is added; with OnComplete.PassResult
+// its payload is the JSON encoded Batch with the final counts.
+type Batch struct {
+	Id         string     `json:"id,omitempty"`
+	Tasks      []TaskMeta `json:"tasks,omitempty"`
+	OnComplete *TaskMeta  `json:"onComplete,omitempty"`
+	Status     string     `json:"status,omitempty"`
+	CallbackId string     `json:"callbackId,omitempty"`
+	Total      int        `json:"total"`
+	Pending    int        `json:"pending"`
+	Running    int        `json:"running"`
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+	Cancelled  int        `json:"cancelled"`
+}
+
+// Done reports whether every task of the batch reached a terminal status.
+func (b *Batch) Done() bool {
+	return b.Succeeded+b.Failed+b.Cancelled >= b.Total
+}
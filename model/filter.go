@@ -0,0 +1,20 @@
+package model
+
+// TaskFilter selects tasks to list. Empty fields match every task; From
+// and To bound the creation time in unix seconds.
+type TaskFilter struct {
+	Status string `json:"status,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Queue  string `json:"queue,omitempty"`
+	From   int64  `json:"from,omitempty"`
+	To     int64  `json:"to,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+}
+
+// TaskCount is how many tasks of a type are in a status.
+type TaskCount struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// LifecycleEvent is passed to hooks when a task changes state. Err is the
+// handler's error for failed and dead-lettered events. A config_changed
+// event has no task: Changes lists what changed and Err why changes were
+// rejected.
+type LifecycleEvent struct {
+	Event    string
+	Task     TaskDetail
+	Err      error
+	ServerId string
+	Time     time.Time
+	Changes  []string
+}
+
+type LifecycleHook func(event LifecycleEvent)
+
+// Middleware wraps a handler, like HTTP middleware: it can act before and
+// after calling next, change the task or result, or not call next at all.
+type Middleware func(next TaskHandler) TaskHandler
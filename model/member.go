@@ -0,0 +1,11 @@
+package model
+
+// Member is a server of the cluster as this server sees it. Load is the
+// weight of tasks this server sent it that have not finished.
+type Member struct {
+	ServerId  string `json:"serverId"`
+	Status    int    `json:"status"`
+	Heartbeat int64  `json:"heartbeat,omitempty"`
+	Load      int    `json:"load"`
+	Self      bool   `json:"self,omitempty"`
+}
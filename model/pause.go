@@ -0,0 +1,10 @@
+package model
+
+// Pause stops servers from starting tasks of a scope: the whole scheduler
+// (Name empty), a queue or a task type. Tasks keep being saved and run once
+// the pause is lifted.
+type Pause struct {
+	Scope    string `json:"scope"`
+	Name     string `json:"name"`
+	PausedAt int64  `json:"pausedAt,omitempty"`
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// QueueConfig describes a named queue. Every queue runs its tasks on its own
+// Workers, so a busy queue never delays the tasks of another; Priority
+// orders the queues when a server claims pending tasks. Workers idle for
+// IdleTimeout seconds stop until there is work again. Backpressure says what
+// AddNewTask does when the queue is full: "block" (the default) waits for
+// room, "reject" fails with an error and "spill" only saves the task, to be
+// claimed once there is room.
+type QueueConfig struct {
+	Name         string           `json:"name"`
+	Workers      uint16           `json:"workers"`
+	BufferSize   uint16           `json:"bufferSize"`
+	Priority     int              `json:"priority,omitempty"`
+	IdleTimeout  int              `json:"idleTimeout,omitempty"`
+	Autoscale    *AutoscaleConfig `json:"autoscale,omitempty"`
+	Backpressure string           `json:"backpressure,omitempty"`
+}
+
+// AutoscaleConfig lets a queue change its worker count between MinWorkers
+// and MaxWorkers every Interval seconds: it grows while tasks wait longer
+// than TargetWait milliseconds or pile up, and shrinks while workers idle.
+type AutoscaleConfig struct {
+	MinWorkers uint16 `json:"minWorkers"`
+	MaxWorkers uint16 `json:"maxWorkers"`
+	Interval   int    `json:"interval,omitempty"`
+	TargetWait int    `json:"targetWait,omitempty"`
+}
+
+type QueueStats struct {
+	Name       string        `json:"name"`
+	MaxWorkers int           `json:"maxWorkers"`
+	Workers    int           `json:"workers"`
+	Busy       int           `json:"busy"`
+	Queued     int           `json:"queued"`
+	BufferSize int           `json:"bufferSize"`
+	InFlight   int           `json:"inFlight"`
+	Rejected   int64         `json:"rejected"`
+	Spilled    int64         `json:"spilled"`
+	Wait       time.Duration `json:"wait"`
+}
@@ -0,0 +1,14 @@
+package model
+
+// RateLimit caps how many tasks of a type start per Window seconds. With
+// the token bucket algorithm up to Burst tasks (Limit when unset) may start
+// at once and the bucket refills at Limit per Window; the sliding window
+// algorithm allows at most Limit starts in any Window. Shared limits hold
+// for the whole cluster and are kept in storage; others hold per server.
+type RateLimit struct {
+	Algorithm string `json:"algorithm,omitempty"`
+	Limit     int    `json:"limit"`
+	Window    int    `json:"window"`
+	Burst     int    `json:"burst,omitempty"`
+	Shared    bool   `json:"shared,omitempty"`
+}
@@ -0,0 +1,8 @@
+package model
+
+// RetryPolicy is how often a failed task runs again and how long the
+// first retry waits, in seconds, before the delay doubles.
+type RetryPolicy struct {
+	MaxRetry   int `json:"maxRetry,omitempty"`
+	RetryDelay int `json:"retryDelay,omitempty"`
+}
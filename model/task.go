@@ -1,11 +1,28 @@
 package model
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+)
 
 type TaskMeta struct {
-	MetaId        string `json:"metaId"`
-	Delay         int    `json:"delay,omitempty"`
-	ExecutionTime int64  `json:"executionTime,omitempty"`
+	MetaId        string     `json:"metaId"`
+	Type          string     `json:"type,omitempty"`
+	Codec         string     `json:"codec,omitempty"`
+	Payload       []byte     `json:"payload,omitempty"`
+	Delay         int        `json:"delay,omitempty"`
+	ExecutionTime int64      `json:"executionTime,omitempty"`
+	Next          []TaskMeta `json:"next,omitempty"`
+	PassResult    bool       `json:"passResult,omitempty"`
+	WorkflowId    string     `json:"workflowId,omitempty"`
+	WorkflowNode  string     `json:"workflowNode,omitempty"`
+	Compensation  bool       `json:"compensation,omitempty"`
+	BatchId       string     `json:"batchId,omitempty"`
+	ParentId      string     `json:"parentId,omitempty"`
+	Queue         string     `json:"queue,omitempty"`
+	MaxRetry      int        `json:"maxRetry,omitempty"`
+	RetryDelay    int        `json:"retryDelay,omitempty"`
+	TraceParent   string     `json:"traceParent,omitempty"`
 }
 
 type Task struct {
@@ -24,19 +41,41 @@ type PendingTask struct {
 	Meta TaskMeta `json:"meta"`
 }
 
+type TaskDetail struct {
+	Id        string   `json:"id"`
+	Meta      TaskMeta `json:"meta"`
+	Status    string   `json:"status"`
+	Error     string   `json:"error,omitempty"`
+	Result    []byte   `json:"result,omitempty"`
+	Attempt   int      `json:"attempt,omitempty"`
+	CreatedAt int64    `json:"createdAt,omitempty"`
+}
+
+type TaskHandler func(ctx context.Context, task TaskDetail) ([]byte, error)
+
+type TaskEvent struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+	Type   string `json:"type,omitempty"`
+}
+
 type Servers struct {
 	Id   string `json:"id"`
 	Load int    `json:"load"`
 }
 
 type TaskWeight struct {
-	Type   string `json:"type"`
-	Weight int    `json:"weight"`
+	Type      string     `json:"type"`
+	Weight    int        `json:"weight"`
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
 }
 
 type TaskMessage struct {
 	ServerId string `json:"server"`
 	TaskId   string `json:"task"`
+	Status   string `json:"status,omitempty"`
+	// TraceParent travels in the traceparent header, not the body.
+	TraceParent string `json:"-"`
 }
 
 type TaskStatus struct {
@@ -48,9 +87,18 @@ type ActorTask struct {
 	TaskFn func(metaId string)
 }
 
+type Delivery struct {
+	Body        []byte
+	Headers     map[string]string
+	Redelivered bool
+	Ack         func() error
+	Reject      func() error
+}
+
 type JoinData struct {
-	ServerId string `json:"serverId"`
-	Status   int    `json:"status"`
+	ServerId  string `json:"serverId"`
+	Status    int    `json:"status"`
+	Heartbeat int64  `json:"heartbeat,omitempty"`
 }
 
 func (m *TaskMeta) Scan(value interface{}) error {
@@ -0,0 +1,19 @@
+package model
+
+// TaskLog is one attempt of a task: what its handler logged and the error
+// it failed with, if it did.
+type TaskLog struct {
+	TaskId    string `json:"taskId"`
+	Attempt   int    `json:"attempt"`
+	Logs      string `json:"logs"`
+	Error     string `json:"error,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// TaskHistory is a task with its attempts and its children. The error of
+// the task itself is that of the last attempt; Logs keeps each one's.
+type TaskHistory struct {
+	Task     TaskDetail   `json:"task"`
+	Logs     []TaskLog    `json:"logs"`
+	Children []TaskDetail `json:"children"`
+}
@@ -0,0 +1,27 @@
+package model
+
+// WorkflowNode is one task of a workflow. It runs once every node in
+// DependsOn completed, or once MinParents of them did when MinParents is
+// set. With Meta.PassResult it gets the result of its first completed
+// parent, in DependsOn order, as its payload.
+//
+// Compensate is the task that undoes a completed node. When a node of the
+// workflow fails for good, the compensating tasks of the completed nodes
+// run in reverse order: a node is undone only after every node that
+// depends on it. With Compensate.PassResult it gets the node's result.
+type WorkflowNode struct {
+	Name       string    `json:"name"`
+	Meta       TaskMeta  `json:"meta"`
+	DependsOn  []string  `json:"dependsOn,omitempty"`
+	MinParents int       `json:"minParents,omitempty"`
+	Compensate *TaskMeta `json:"compensate,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	TaskId     string    `json:"taskId,omitempty"`
+}
+
+type Workflow struct {
+	Id     string         `json:"id,omitempty"`
+	Name   string         `json:"name"`
+	Status string         `json:"status,omitempty"`
+	Nodes  []WorkflowNode `json:"nodes"`
+}
@@ -0,0 +1,282 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	manager "github.com/amitiwary999/task-scheduler/manager"
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// Config is how a server of the scheduler is set up. LoadConfig reads it
+// from a JSON file and the environment, and New takes it with WithConfig.
+// Metrics and Admin are for whoever serves them over HTTP, like the
+// taskscheduler command; an empty Metrics.Listen shares the admin listener.
+type Config struct {
+	ServerId       string                     `json:"serverId,omitempty"`
+	Storage        StorageConfig              `json:"storage"`
+	Workers        uint16                     `json:"workers"`
+	QueueSize      uint16                     `json:"queueSize"`
+	MaxPayloadSize int                        `json:"maxPayloadSize"`
+	Queues         []model.QueueConfig        `json:"queues,omitempty"`
+	Retry          model.RetryPolicy          `json:"retry"`
+	RateLimits     map[string]model.RateLimit `json:"rateLimits,omitempty"`
+	Amqp           AmqpConfig                 `json:"amqp"`
+	Metrics        HttpConfig                 `json:"metrics"`
+	Admin          HttpConfig                 `json:"admin"`
+}
+
+// StorageConfig picks the store of tasks: "postgres" or "supabase".
+type StorageConfig struct {
+	Backend      string `json:"backend"`
+	PostgresUrl  string `json:"postgresUrl,omitempty"`
+	PoolLimit    int16  `json:"poolLimit"`
+	SupabaseUrl  string `json:"supabaseUrl,omitempty"`
+	SupabaseAuth string `json:"supabaseAuth,omitempty"`
+	SupabaseKey  string `json:"supabaseKey,omitempty"`
+}
+
+// AmqpConfig is the RabbitMQ server the cluster talks through, if any.
+type AmqpConfig struct {
+	Url string `json:"url,omitempty"`
+}
+
+// HttpConfig is an address to listen on and the path to serve at. Token,
+// when set, is the bearer token callers must send.
+type HttpConfig struct {
+	Listen string `json:"listen,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Token  string `json:"token,omitempty"`
+}
+
+// configEnv are the environment variables LoadConfig reads over the file.
+var configEnv = []struct {
+	key string
+	set func(c *Config, value string) error
+}{
+	{"TASKSCHEDULER_SERVER_ID", func(c *Config, value string) error { c.ServerId = value; return nil }},
+	{"TASKSCHEDULER_STORAGE", func(c *Config, value string) error { c.Storage.Backend = value; return nil }},
+	{"POSTGRES_URL", func(c *Config, value string) error { c.Storage.PostgresUrl = value; return nil }},
+	{"POSTGRES_POOL_LIMIT", func(c *Config, value string) error { return parseEnvInt(value, 16, &c.Storage.PoolLimit) }},
+	{"SUPABASE_URL", func(c *Config, value string) error { c.Storage.SupabaseUrl = value; return nil }},
+	{"SUPABASE_AUTH", func(c *Config, value string) error { c.Storage.SupabaseAuth = value; return nil }},
+	{"SUPABASE_KEY", func(c *Config, value string) error { c.Storage.SupabaseKey = value; return nil }},
+	{"RABBITMQ_URL", func(c *Config, value string) error { c.Amqp.Url = value; return nil }},
+	{"TASKSCHEDULER_WORKERS", func(c *Config, value string) error { return parseEnvUint(value, &c.Workers) }},
+	{"TASKSCHEDULER_QUEUE_SIZE", func(c *Config, value string) error { return parseEnvUint(value, &c.QueueSize) }},
+	{"TASKSCHEDULER_MAX_PAYLOAD_SIZE", func(c *Config, value string) error { return parseEnvInt(value, 0, &c.MaxPayloadSize) }},
+	{"TASKSCHEDULER_MAX_RETRY", func(c *Config, value string) error { return parseEnvInt(value, 0, &c.Retry.MaxRetry) }},
+	{"TASKSCHEDULER_RETRY_DELAY", func(c *Config, value string) error { return parseEnvInt(value, 0, &c.Retry.RetryDelay) }},
+	{"TASKSCHEDULER_ADMIN_LISTEN", func(c *Config, value string) error { c.Admin.Listen = value; return nil }},
+	{"TASKSCHEDULER_ADMIN_TOKEN", func(c *Config, value string) error { c.Admin.Token = value; return nil }},
+	{"TASKSCHEDULER_METRICS_LISTEN", func(c *Config, value string) error { c.Metrics.Listen = value; return nil }},
+	{"TASKSCHEDULER_METRICS_TOKEN", func(c *Config, value string) error { c.Metrics.Token = value; return nil }},
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Storage: StorageConfig{
+			Backend:   util.STORAGE_POSTGRES,
+			PoolLimit: util.DEFAULT_POOL_LIMIT,
+		},
+		Workers:        util.DEFAULT_WORKERS,
+		QueueSize:      util.DEFAULT_QUEUE_SIZE,
+		MaxPayloadSize: util.DEFAULT_MAX_PAYLOAD_SIZE,
+		Metrics:        HttpConfig{Path: "/metrics"},
+		Admin:          HttpConfig{Listen: util.DEFAULT_ADMIN_LISTEN, Path: "/admin"},
+	}
+}
+
+// LoadConfig starts from DefaultConfig, reads the JSON file at path over
+// it when path is not empty, then the environment over that, and
+// validates the result. The error lists every problem it found.
+func LoadConfig(path string) (*Config, error) {
+	config, envErr, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := errors.Join(envErr, config.Validate()); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ReadConfig is LoadConfig without the validation, for a config to change
+// further before New validates it.
+func ReadConfig(path string) (*Config, error) {
+	config, envErr, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if envErr != nil {
+		return nil, envErr
+	}
+	return config, nil
+}
+
+// readConfig returns the problems of the environment apart, so LoadConfig
+// can list them with those of the config.
+func readConfig(path string) (*Config, error, error) {
+	config := DefaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := config.decode(data); err != nil {
+			return nil, nil, fmt.Errorf("%v: %w", path, err)
+		}
+	}
+	return &config, config.applyEnv(os.LookupEnv), nil
+}
+
+func (c *Config) decode(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(c)
+}
+
+func (c *Config) applyEnv(lookup func(key string) (string, bool)) error {
+	var errs []error
+	for _, env := range configEnv {
+		value, ok := lookup(env.key)
+		if !ok || value == "" {
+			continue
+		}
+		if err := env.set(c, value); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", env.key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate returns every problem of the config, joined.
+func (c *Config) Validate() error {
+	return c.validate(true)
+}
+
+// validate skips the storage settings when the caller brings its own
+// StorageClient.
+func (c *Config) validate(checkStorage bool) error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	if checkStorage {
+		switch c.Storage.Backend {
+		case util.STORAGE_POSTGRES:
+			if c.Storage.PostgresUrl == "" {
+				add("storage.postgresUrl: needed for postgres")
+			}
+			if c.Storage.PoolLimit < 1 {
+				add("storage.poolLimit: must be at least 1, got %v", c.Storage.PoolLimit)
+			}
+		case util.STORAGE_SUPABASE:
+			if c.Storage.SupabaseUrl == "" {
+				add("storage.supabaseUrl: needed for supabase")
+			}
+			if c.Storage.SupabaseKey == "" {
+				add("storage.supabaseKey: needed for supabase")
+			}
+		default:
+			add("storage.backend: must be %v or %v, got %q", util.STORAGE_POSTGRES, util.STORAGE_SUPABASE, c.Storage.Backend)
+		}
+	}
+	if c.Workers == 0 {
+		add("workers: must be at least 1")
+	}
+	if c.MaxPayloadSize < 0 {
+		add("maxPayloadSize: must not be negative, got %v", c.MaxPayloadSize)
+	}
+	names := make(map[string]bool)
+	for i, queue := range c.Queues {
+		if err := manager.ValidateQueue(queue); err != nil {
+			add("queues[%v]: %v", i, err)
+		}
+		if queue.Name != "" && names[queue.Name] {
+			add("queues[%v]: queue %v is defined twice", i, queue.Name)
+		}
+		names[queue.Name] = true
+	}
+	if c.Retry.MaxRetry < 0 {
+		add("retry.maxRetry: must not be negative, got %v", c.Retry.MaxRetry)
+	}
+	if c.Retry.RetryDelay < 0 || c.Retry.RetryDelay > util.MAX_RETRY_DELAY {
+		add("retry.retryDelay: must be between 0 and %v seconds, got %v", util.MAX_RETRY_DELAY, c.Retry.RetryDelay)
+	}
+	taskTypes := make([]string, 0, len(c.RateLimits))
+	for taskType := range c.RateLimits {
+		taskTypes = append(taskTypes, taskType)
+	}
+	sort.Strings(taskTypes)
+	for _, taskType := range taskTypes {
+		for _, problem := range rateLimitProblems(c.RateLimits[taskType]) {
+			add("rateLimits.%v: %v", taskType, problem)
+		}
+	}
+	if c.Amqp.Url != "" {
+		if u, err := url.Parse(c.Amqp.Url); err != nil || (u.Scheme != "amqp" && u.Scheme != "amqps") {
+			add("amqp.url: must be an amqp:// or amqps:// url")
+		}
+	}
+	for _, server := range []struct {
+		name   string
+		config HttpConfig
+	}{{"metrics", c.Metrics}, {"admin", c.Admin}} {
+		if server.config.Listen != "" {
+			if _, _, err := net.SplitHostPort(server.config.Listen); err != nil {
+				add("%v.listen: %v", server.name, err)
+			}
+		}
+		if server.config.Path != "" && !strings.HasPrefix(server.config.Path, "/") {
+			add("%v.path: must start with /, got %q", server.name, server.config.Path)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func rateLimitProblems(limit model.RateLimit) []string {
+	var problems []string
+	switch limit.Algorithm {
+	case "", util.RATE_LIMIT_TOKEN_BUCKET, util.RATE_LIMIT_SLIDING_WINDOW:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown algorithm %q", limit.Algorithm))
+	}
+	if limit.Limit < 1 {
+		problems = append(problems, fmt.Sprintf("limit must be at least 1, got %v", limit.Limit))
+	}
+	if limit.Window < 1 {
+		problems = append(problems, fmt.Sprintf("window must be at least 1 second, got %v", limit.Window))
+	}
+	if limit.Burst < 0 {
+		problems = append(problems, fmt.Sprintf("burst must not be negative, got %v", limit.Burst))
+	}
+	return problems
+}
+
+func parseEnvInt[T int | int16](value string, bits int, out *T) error {
+	n, err := strconv.ParseInt(value, 10, bits)
+	if err != nil {
+		return err
+	}
+	*out = T(n)
+	return nil
+}
+
+func parseEnvUint(value string, out *uint16) error {
+	n, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return err
+	}
+	*out = uint16(n)
+	return nil
+}
@@ -0,0 +1,197 @@
+package scheduler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// clearConfigEnv hides the variables LoadConfig reads, so the machine the
+// tests run on does not leak into them.
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, env := range configEnv {
+		t.Setenv(env.key, "")
+	}
+}
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaultConfig(t *testing.T) {
+	clearConfigEnv(t)
+	config, err := ReadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"storage.backend", config.Storage.Backend, util.STORAGE_POSTGRES},
+		{"storage.poolLimit", config.Storage.PoolLimit, int16(util.DEFAULT_POOL_LIMIT)},
+		{"workers", config.Workers, uint16(util.DEFAULT_WORKERS)},
+		{"queueSize", config.QueueSize, uint16(util.DEFAULT_QUEUE_SIZE)},
+		{"maxPayloadSize", config.MaxPayloadSize, util.DEFAULT_MAX_PAYLOAD_SIZE},
+		{"admin.listen", config.Admin.Listen, "127.0.0.1:8081"},
+		{"admin.path", config.Admin.Path, "/admin"},
+		{"metrics.listen", config.Metrics.Listen, ""},
+		{"metrics.path", config.Metrics.Path, "/metrics"},
+		{"amqp.url", config.Amqp.Url, ""},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%v = %v, want %v", tc.name, tc.got, tc.want)
+		}
+	}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "storage.postgresUrl") {
+		t.Errorf("Validate of the defaults = %v, want postgresUrl needed", err)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfig(t, `{
+		"storage": {"postgresUrl": "postgres://file"},
+		"workers": 4,
+		"queueSize": 50,
+		"retry": {"maxRetry": 2}
+	}`)
+	for _, tc := range []struct {
+		name string
+		path string
+		env  map[string]string
+		want func(c *Config) bool
+	}{
+		{
+			name: "default without file or env",
+			env:  map[string]string{"POSTGRES_URL": "postgres://env"},
+			want: func(c *Config) bool {
+				return c.Workers == util.DEFAULT_WORKERS && c.QueueSize == util.DEFAULT_QUEUE_SIZE
+			},
+		},
+		{
+			name: "file over default",
+			path: path,
+			want: func(c *Config) bool {
+				return c.Storage.PostgresUrl == "postgres://file" && c.Workers == 4 && c.QueueSize == 50 && c.Retry.MaxRetry == 2
+			},
+		},
+		{
+			name: "default where the file is silent",
+			path: path,
+			want: func(c *Config) bool {
+				return c.Storage.PoolLimit == util.DEFAULT_POOL_LIMIT && c.MaxPayloadSize == util.DEFAULT_MAX_PAYLOAD_SIZE
+			},
+		},
+		{
+			name: "env over file",
+			path: path,
+			env:  map[string]string{"POSTGRES_URL": "postgres://env", "TASKSCHEDULER_WORKERS": "8", "TASKSCHEDULER_MAX_RETRY": "5"},
+			want: func(c *Config) bool {
+				return c.Storage.PostgresUrl == "postgres://env" && c.Workers == 8 && c.Retry.MaxRetry == 5 && c.QueueSize == 50
+			},
+		},
+		{
+			name: "empty env is unset",
+			path: path,
+			env:  map[string]string{"TASKSCHEDULER_WORKERS": ""},
+			want: func(c *Config) bool { return c.Workers == 4 },
+		},
+		{
+			name: "env over default",
+			env:  map[string]string{"POSTGRES_URL": "postgres://env", "TASKSCHEDULER_ADMIN_LISTEN": ":9000", "TASKSCHEDULER_ADMIN_TOKEN": "secret", "POSTGRES_POOL_LIMIT": "20"},
+			want: func(c *Config) bool {
+				return c.Admin.Listen == ":9000" && c.Admin.Token == "secret" && c.Storage.PoolLimit == 20
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			config, err := LoadConfig(tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.want(config) {
+				t.Errorf("config = %+v", *config)
+			}
+		})
+	}
+}
+
+func TestLoadConfigJoinsEveryProblem(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("TASKSCHEDULER_QUEUE_SIZE", "many")
+	path := writeConfig(t, `{
+		"storage": {"backend": "supabase"},
+		"workers": 0,
+		"maxPayloadSize": -1,
+		"queues": [{"name": "slow", "workers": 1}, {"name": "slow", "workers": 1}, {"name": "fast"}],
+		"retry": {"maxRetry": -1, "retryDelay": 99999},
+		"rateLimits": {"email": {"algorithm": "leaky", "limit": 0, "window": 0, "burst": -1}},
+		"amqp": {"url": "http://rabbit"},
+		"metrics": {"listen": "9090", "path": "metrics"}
+	}`)
+	_, err := LoadConfig(path)
+	if err == nil {
+		t.Fatal("LoadConfig = nil, want every problem")
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); !ok || len(joined.Unwrap()) < 2 {
+		t.Errorf("err = %T, want the problems joined", err)
+	}
+	for _, want := range []string{
+		"TASKSCHEDULER_QUEUE_SIZE:",
+		"storage.supabaseUrl: needed for supabase",
+		"storage.supabaseKey: needed for supabase",
+		"workers: must be at least 1",
+		"maxPayloadSize: must not be negative, got -1",
+		"queues[1]: queue slow is defined twice",
+		"queues[2]: queue fast needs at least one worker",
+		"retry.maxRetry: must not be negative, got -1",
+		"retry.retryDelay: must be between 0 and",
+		`rateLimits.email: unknown algorithm "leaky"`,
+		"rateLimits.email: limit must be at least 1, got 0",
+		"rateLimits.email: window must be at least 1 second, got 0",
+		"rateLimits.email: burst must not be negative, got -1",
+		"amqp.url: must be an amqp:// or amqps:// url",
+		"metrics.listen:",
+		`metrics.path: must start with /, got "metrics"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigRejectsUnknownFields(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfig(t, `{"storage": {"postgresUrl": "postgres://file"}, "worker": 4}`)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), `unknown field "worker"`) {
+		t.Errorf("LoadConfig = %v, want the unknown field named", err)
+	}
+}
+
+func TestValidateSkipsStorageForAClient(t *testing.T) {
+	config := DefaultConfig()
+	config.Storage.Backend = "sqlite"
+	config.RateLimits = map[string]model.RateLimit{"email": {Limit: 10, Window: 60}}
+	if err := config.validate(false); err != nil {
+		t.Errorf("validate(false) = %v, want nil", err)
+	}
+	if err := config.validate(true); err == nil {
+		t.Error("validate(true) = nil, want the backend rejected")
+	}
+}
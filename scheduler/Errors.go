@@ -0,0 +1,24 @@
+package scheduler
+
+import (
+	"errors"
+
+	manager "github.com/amitiwary999/task-scheduler/manager"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+)
+
+var (
+	ErrPayloadTooLarge = manager.ErrPayloadTooLarge
+	ErrPayloadType     = errors.New("task payload type does not match the registered handler")
+	ErrMissingType     = errors.New("typed task needs a type")
+	ErrUnknownCodec    = errors.New("unknown payload codec")
+	ErrNeedsRestart    = errors.New("change needs a restart")
+	ErrNoConfig        = errors.New("scheduler was not made by New")
+	ErrNotStarted      = errors.New("scheduler not started")
+	ErrInvalidWorkflow = manager.ErrInvalidWorkflow
+	ErrInvalidBatch    = manager.ErrInvalidBatch
+	ErrNoTaskContext   = manager.ErrNoTaskContext
+	ErrQueueFull       = manager.ErrQueueFull
+	ErrTaskState       = manager.ErrTaskState
+	ErrTaskNotFound    = storage.ErrTaskNotFound
+)
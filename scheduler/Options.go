@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// Option sets up the TaskScheduler New makes.
+type Option func(o *schedulerOptions)
+
+type schedulerOptions struct {
+	config  Config
+	done    chan int
+	storage util.StorageClient
+	broker  util.Broker
+	logger  util.Logger
+	metrics util.MetricsSink
+	tracer  util.Tracer
+}
+
+// New makes a TaskScheduler from DefaultConfig and opts, applied in order,
+// and fails with every problem of the resulting config. Unless WithDone
+// gives one, the scheduler has its own done channel, which Stop closes.
+func New(opts ...Option) (*TaskScheduler, error) {
+	o := schedulerOptions{config: DefaultConfig()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	config := o.config
+	if err := config.validate(o.storage == nil); err != nil {
+		return nil, err
+	}
+	done := o.done
+	if done == nil {
+		done = make(chan int)
+	}
+	t := NewTaskScheduler(done, config.Storage.PostgresUrl, config.Storage.PoolLimit, config.Workers, config.QueueSize)
+	t.ServerId = config.ServerId
+	t.MaxPayloadSize = config.MaxPayloadSize
+	t.RabbitmqUrl = config.Amqp.Url
+	t.Storage = o.storage
+	if t.Storage == nil && config.Storage.Backend == util.STORAGE_SUPABASE {
+		client, err := storage.NewSupabaseClient(config.Storage.SupabaseUrl, config.Storage.SupabaseAuth, config.Storage.SupabaseKey, storage.WithLogger(o.logger))
+		if err != nil {
+			return nil, err
+		}
+		t.Storage = client
+	}
+	t.Broker = o.broker
+	t.Logger = o.logger
+	t.Metrics = o.metrics
+	t.Tracer = o.tracer
+	for _, queue := range config.Queues {
+		t.AddQueue(queue)
+	}
+	for taskType, limit := range config.RateLimits {
+		t.SetRateLimit(taskType, limit)
+	}
+	t.SetRetryDefaults(config.Retry)
+	t.config = &config
+	return t, nil
+}
+
+// WithConfig replaces the whole config, like one from LoadConfig. Later
+// options change it further.
+func WithConfig(config Config) Option {
+	return func(o *schedulerOptions) {
+		o.config = config
+	}
+}
+
+func WithDone(done chan int) Option {
+	return func(o *schedulerOptions) {
+		o.done = done
+	}
+}
+
+func WithPostgres(url string, poolLimit int16) Option {
+	return func(o *schedulerOptions) {
+		o.config.Storage.Backend = util.STORAGE_POSTGRES
+		o.config.Storage.PostgresUrl = url
+		o.config.Storage.PoolLimit = poolLimit
+	}
+}
+
+func WithSupabase(url string, auth string, key string) Option {
+	return func(o *schedulerOptions) {
+		o.config.Storage.Backend = util.STORAGE_SUPABASE
+		o.config.Storage.SupabaseUrl = url
+		o.config.Storage.SupabaseAuth = auth
+		o.config.Storage.SupabaseKey = key
+	}
+}
+
+// WithStorage keeps tasks in client instead of the configured backend.
+func WithStorage(client util.StorageClient) Option {
+	return func(o *schedulerOptions) {
+		o.storage = client
+	}
+}
+
+func WithRabbitMQ(url string) Option {
+	return func(o *schedulerOptions) {
+		o.config.Amqp.Url = url
+	}
+}
+
+func WithBroker(broker util.Broker) Option {
+	return func(o *schedulerOptions) {
+		o.broker = broker
+	}
+}
+
+// WithWorkers sizes the default queue.
+func WithWorkers(workers uint16, queueSize uint16) Option {
+	return func(o *schedulerOptions) {
+		o.config.Workers = workers
+		o.config.QueueSize = queueSize
+	}
+}
+
+func WithQueue(queue model.QueueConfig) Option {
+	return func(o *schedulerOptions) {
+		o.config.Queues = append(o.config.Queues, queue)
+	}
+}
+
+func WithRateLimit(taskType string, limit model.RateLimit) Option {
+	return func(o *schedulerOptions) {
+		if o.config.RateLimits == nil {
+			o.config.RateLimits = make(map[string]model.RateLimit)
+		}
+		o.config.RateLimits[taskType] = limit
+	}
+}
+
+func WithRetry(policy model.RetryPolicy) Option {
+	return func(o *schedulerOptions) {
+		o.config.Retry = policy
+	}
+}
+
+func WithMaxPayloadSize(size int) Option {
+	return func(o *schedulerOptions) {
+		o.config.MaxPayloadSize = size
+	}
+}
+
+func WithServerId(serverId string) Option {
+	return func(o *schedulerOptions) {
+		o.config.ServerId = serverId
+	}
+}
+
+func WithLogger(logger util.Logger) Option {
+	return func(o *schedulerOptions) {
+		o.logger = logger
+	}
+}
+
+func WithMetrics(sink util.MetricsSink) Option {
+	return func(o *schedulerOptions) {
+		o.metrics = sink
+	}
+}
+
+func WithTracer(tracer util.Tracer) Option {
+	return func(o *schedulerOptions) {
+		o.tracer = tracer
+	}
+}
@@ -0,0 +1,213 @@
+package scheduler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"syscall"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// Reload applies the changes of config a running scheduler can take
+// without a restart: the workers of the default queue and of queues that
+// do not autoscale, rate limits and retry defaults. Every other change is
+// rejected and logged, and the scheduler keeps what it runs with. The
+// config_changed hooks get what changed and, in Err, what was rejected.
+// Reload returns the rejected changes, each wrapping ErrNeedsRestart, or
+// the problems of config, in which case it changes nothing.
+func (t *TaskScheduler) Reload(config Config) error {
+	if err := config.validate(false); err != nil {
+		return err
+	}
+	t.configMu.Lock()
+	defer t.configMu.Unlock()
+	if t.config == nil {
+		return ErrNoConfig
+	}
+	if t.taskM == nil {
+		return ErrNotStarted
+	}
+	current := t.config
+	next := *current
+	var changes []string
+	var rejected []error
+	reject := func(field string) {
+		rejected = append(rejected, fmt.Errorf("%v: %w", field, ErrNeedsRestart))
+	}
+	for _, field := range []struct {
+		name          string
+		before, after interface{}
+	}{
+		{"serverId", current.ServerId, config.ServerId},
+		{"storage", current.Storage, config.Storage},
+		{"queueSize", current.QueueSize, config.QueueSize},
+		{"maxPayloadSize", current.MaxPayloadSize, config.MaxPayloadSize},
+		{"amqp", current.Amqp, config.Amqp},
+		{"metrics", current.Metrics, config.Metrics},
+		{"admin", current.Admin, config.Admin},
+	} {
+		if !reflect.DeepEqual(field.before, field.after) {
+			reject(field.name)
+		}
+	}
+
+	// A queue named default in Queues replaces the default queue, which
+	// then autoscales like any other.
+	defaultAutoscaled := false
+	for _, queue := range current.Queues {
+		if queue.Name == util.DEFAULT_QUEUE && queue.Autoscale != nil {
+			defaultAutoscaled = true
+		}
+	}
+	if config.Workers != current.Workers && defaultAutoscaled {
+		reject("workers (autoscaled)")
+	} else if config.Workers != current.Workers {
+		if err := t.taskM.ResizeQueue(util.DEFAULT_QUEUE, config.Workers); err != nil {
+			rejected = append(rejected, fmt.Errorf("workers: %w", err))
+		} else {
+			changes = append(changes, fmt.Sprintf("workers: %v -> %v", current.Workers, config.Workers))
+			next.Workers = config.Workers
+		}
+	}
+
+	queues := make(map[string]model.QueueConfig, len(config.Queues))
+	for _, queue := range config.Queues {
+		queues[queue.Name] = queue
+	}
+	next.Queues = make([]model.QueueConfig, 0, len(current.Queues))
+	for _, before := range current.Queues {
+		after, ok := queues[before.Name]
+		delete(queues, before.Name)
+		if !ok {
+			reject(fmt.Sprintf("queues.%v (removed)", before.Name))
+			next.Queues = append(next.Queues, before)
+			continue
+		}
+		resized := after
+		resized.Workers = before.Workers
+		if !reflect.DeepEqual(before, resized) {
+			reject(fmt.Sprintf("queues.%v", before.Name))
+			next.Queues = append(next.Queues, before)
+			continue
+		}
+		if after.Workers != before.Workers {
+			if before.Autoscale != nil {
+				reject(fmt.Sprintf("queues.%v.workers (autoscaled)", before.Name))
+				next.Queues = append(next.Queues, before)
+				continue
+			}
+			if err := t.taskM.ResizeQueue(before.Name, after.Workers); err != nil {
+				rejected = append(rejected, fmt.Errorf("queues.%v.workers: %w", before.Name, err))
+				next.Queues = append(next.Queues, before)
+				continue
+			}
+			changes = append(changes, fmt.Sprintf("queues.%v.workers: %v -> %v", before.Name, before.Workers, after.Workers))
+		}
+		next.Queues = append(next.Queues, after)
+	}
+	for _, name := range sortedNames(queues) {
+		reject(fmt.Sprintf("queues.%v (added)", name))
+	}
+
+	next.RateLimits = config.RateLimits
+	for _, taskType := range sortedNames(current.RateLimits, config.RateLimits) {
+		before, hadLimit := current.RateLimits[taskType]
+		after, hasLimit := config.RateLimits[taskType]
+		switch {
+		case !hasLimit:
+			t.taskM.ClearRateLimit(taskType)
+			changes = append(changes, fmt.Sprintf("rateLimits.%v: removed", taskType))
+		case !hadLimit:
+			t.taskM.SetRateLimit(taskType, after)
+			changes = append(changes, fmt.Sprintf("rateLimits.%v: added", taskType))
+		case before != after:
+			t.taskM.SetRateLimit(taskType, after)
+			changes = append(changes, fmt.Sprintf("rateLimits.%v: %+v -> %+v", taskType, before, after))
+		}
+	}
+
+	if config.Retry != current.Retry {
+		t.taskM.SetRetryDefaults(config.Retry)
+		changes = append(changes, fmt.Sprintf("retry: %+v -> %+v", current.Retry, config.Retry))
+		next.Retry = config.Retry
+	}
+
+	t.config = &next
+	for _, err := range rejected {
+		t.Logger.Warn("config change rejected", "reason", err)
+	}
+	if len(changes) > 0 {
+		t.Logger.Info("config changed", "changes", changes)
+	}
+	rejectedErr := errors.Join(rejected...)
+	if len(changes) > 0 || rejectedErr != nil {
+		t.taskM.ConfigChanged(changes, rejectedErr)
+	}
+	return rejectedErr
+}
+
+// WatchConfig reloads the config from the file at path when the file
+// changes and when the process gets SIGHUP, until the scheduler stops.
+// load reads the file; nil uses ReadConfig. A config that cannot be read
+// or is invalid is logged and the scheduler keeps the one it runs with.
+func (t *TaskScheduler) WatchConfig(path string, load func(path string) (*Config, error)) {
+	if load == nil {
+		load = ReadConfig
+	}
+	last, _ := os.ReadFile(path)
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hangup)
+		ticker := time.NewTicker(util.CONFIG_WATCH_INTERVAL * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.done:
+				return
+			case <-hangup:
+				last, _ = os.ReadFile(path)
+			case <-ticker.C:
+				data, err := os.ReadFile(path)
+				if err != nil || bytes.Equal(data, last) {
+					continue
+				}
+				last = data
+			}
+			t.reloadFrom(path, load)
+		}
+	}()
+}
+
+func (t *TaskScheduler) reloadFrom(path string, load func(path string) (*Config, error)) {
+	config, err := load(path)
+	if err != nil {
+		t.Logger.Error("failed to reload config", "path", path, "error", err)
+		return
+	}
+	if err := t.Reload(*config); err != nil && !errors.Is(err, ErrNeedsRestart) {
+		t.Logger.Error("failed to reload config", "path", path, "error", err)
+	}
+}
+
+func sortedNames[V any](maps ...map[string]V) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range maps {
+		for name := range m {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,222 @@
+package scheduler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// startReloadable starts a scheduler made by New on memory storage with an
+// "emails" queue and an autoscaled "reports" queue, and records the
+// changes of its config_changed events.
+func startReloadable(t *testing.T) (*TaskScheduler, func() []string) {
+	t.Helper()
+	ts, err := New(
+		WithStorage(storage.NewMemoryStorage()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithServerId("server-1"),
+		WithWorkers(4, 100),
+		WithQueue(model.QueueConfig{Name: "emails", Workers: 2}),
+		WithQueue(model.QueueConfig{Name: "reports", Workers: 1, Autoscale: &model.AutoscaleConfig{MinWorkers: 1, MaxWorkers: 3}}),
+		WithRateLimit("email", model.RateLimit{Limit: 10, Window: 60}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var changes []string
+	ts.OnEvent(util.TASK_EVENT_CONFIG_CHANGED, func(event model.LifecycleEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, event.Changes...)
+	})
+	if err := ts.StartScheduler(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ts.Stop)
+	return ts, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), changes...)
+	}
+}
+
+func maxWorkers(ts *TaskScheduler, queue string) int {
+	for _, stats := range ts.QueueStats() {
+		if stats.Name == queue {
+			return stats.MaxWorkers
+		}
+	}
+	return -1
+}
+
+func TestReload(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		change   func(c *Config)
+		restart  []string
+		changes  []string
+		check    func(ts *TaskScheduler) bool
+		rejected bool
+	}{
+		{
+			name:    "default queue workers",
+			change:  func(c *Config) { c.Workers = 6 },
+			changes: []string{"workers: 4 -> 6"},
+			check:   func(ts *TaskScheduler) bool { return maxWorkers(ts, util.DEFAULT_QUEUE) == 6 },
+		},
+		{
+			name:    "queue workers",
+			change:  func(c *Config) { c.Queues[0].Workers = 5 },
+			changes: []string{"queues.emails.workers: 2 -> 5"},
+			check:   func(ts *TaskScheduler) bool { return maxWorkers(ts, "emails") == 5 },
+		},
+		{
+			name: "rate limits",
+			change: func(c *Config) {
+				c.RateLimits = map[string]model.RateLimit{"sms": {Limit: 1, Window: 1}}
+			},
+			changes: []string{"rateLimits.email: removed", "rateLimits.sms: added"},
+		},
+		{
+			name:    "retry defaults",
+			change:  func(c *Config) { c.Retry = model.RetryPolicy{MaxRetry: 3, RetryDelay: 10} },
+			changes: []string{"retry: {MaxRetry:0 RetryDelay:0} -> {MaxRetry:3 RetryDelay:10}"},
+		},
+		{
+			name:    "storage",
+			change:  func(c *Config) { c.Storage.Backend = util.STORAGE_SUPABASE },
+			restart: []string{"storage"},
+		},
+		{
+			name:    "queue size",
+			change:  func(c *Config) { c.QueueSize = 200 },
+			restart: []string{"queueSize"},
+		},
+		{
+			name: "added queue",
+			change: func(c *Config) {
+				c.Queues = append(c.Queues, model.QueueConfig{Name: "sms", Workers: 1})
+			},
+			restart: []string{"queues.sms (added)"},
+		},
+		{
+			name:    "removed queue",
+			change:  func(c *Config) { c.Queues = c.Queues[1:] },
+			restart: []string{"queues.emails (removed)"},
+			check:   func(ts *TaskScheduler) bool { return maxWorkers(ts, "emails") == 2 },
+		},
+		{
+			name:    "autoscaled queue workers",
+			change:  func(c *Config) { c.Queues[1].Workers = 2 },
+			restart: []string{"queues.reports.workers (autoscaled)"},
+		},
+		{
+			name: "applied and rejected together",
+			change: func(c *Config) {
+				c.Workers = 8
+				c.Amqp.Url = "amqp://rabbit"
+			},
+			changes: []string{"workers: 4 -> 8"},
+			restart: []string{"amqp"},
+			check:   func(ts *TaskScheduler) bool { return maxWorkers(ts, util.DEFAULT_QUEUE) == 8 },
+		},
+		{
+			name:     "invalid config",
+			change:   func(c *Config) { c.Workers = 0; c.Retry.MaxRetry = -1 },
+			rejected: true,
+			check:    func(ts *TaskScheduler) bool { return maxWorkers(ts, util.DEFAULT_QUEUE) == 4 },
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ts, changes := startReloadable(t)
+			config := *ts.config
+			config.Queues = append([]model.QueueConfig(nil), config.Queues...)
+			tc.change(&config)
+
+			err := ts.Reload(config)
+			switch {
+			case tc.rejected:
+				if err == nil || errors.Is(err, ErrNeedsRestart) {
+					t.Fatalf("Reload = %v, want the config rejected", err)
+				}
+			case len(tc.restart) > 0:
+				if !errors.Is(err, ErrNeedsRestart) {
+					t.Fatalf("Reload = %v, want ErrNeedsRestart", err)
+				}
+				for _, field := range tc.restart {
+					if !strings.Contains(err.Error(), field+": "+ErrNeedsRestart.Error()) {
+						t.Errorf("Reload = %v, want %v to need a restart", err, field)
+					}
+				}
+			case err != nil:
+				t.Fatalf("Reload = %v, want nil", err)
+			}
+			if got := changes(); strings.Join(got, "\n") != strings.Join(tc.changes, "\n") {
+				t.Errorf("changes = %q, want %q", got, tc.changes)
+			}
+			if tc.check != nil && !tc.check(ts) {
+				t.Errorf("queues = %+v", ts.QueueStats())
+			}
+			// What was rejected is still to apply, and what was applied is
+			// not applied again.
+			if err := ts.Reload(config); tc.rejected || len(tc.restart) > 0 {
+				if err == nil {
+					t.Error("second Reload = nil, want the same rejection")
+				}
+			} else if err != nil {
+				t.Errorf("second Reload = %v, want nil", err)
+			}
+			if got := changes(); len(got) != len(tc.changes) {
+				t.Errorf("changes after a second Reload = %q, want %q", got, tc.changes)
+			}
+		})
+	}
+}
+
+func TestReloadLeavesAnAutoscaledDefaultQueue(t *testing.T) {
+	ts, err := New(
+		WithStorage(storage.NewMemoryStorage()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithServerId("server-1"),
+		WithQueue(model.QueueConfig{Name: util.DEFAULT_QUEUE, Workers: 2, Autoscale: &model.AutoscaleConfig{MinWorkers: 1, MaxWorkers: 4}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.StartScheduler(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ts.Stop)
+	config := *ts.config
+	config.Workers = 8
+
+	err = ts.Reload(config)
+	if !errors.Is(err, ErrNeedsRestart) || !strings.Contains(err.Error(), "workers (autoscaled)") {
+		t.Errorf("Reload = %v, want the workers of the autoscaled default queue rejected", err)
+	}
+	if workers := maxWorkers(ts, util.DEFAULT_QUEUE); workers != 2 {
+		t.Errorf("default queue has %v workers, want the 2 it started with", workers)
+	}
+}
+
+func TestReloadNeedsAStartedSchedulerFromNew(t *testing.T) {
+	if err := NewTaskScheduler(make(chan int), "", 1, 1, 1).Reload(DefaultConfig()); !errors.Is(err, ErrNoConfig) {
+		t.Errorf("Reload without New = %v, want ErrNoConfig", err)
+	}
+	ts, err := New(WithStorage(storage.NewMemoryStorage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.Reload(*ts.config); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("Reload before start = %v, want ErrNotStarted", err)
+	}
+}
@@ -1,44 +1,497 @@
 package scheduler
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
+	"reflect"
+	"sync"
 
 	manager "github.com/amitiwary999/task-scheduler/manager"
+	metrics "github.com/amitiwary999/task-scheduler/metrics"
 	model "github.com/amitiwary999/task-scheduler/model"
 	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+	"github.com/google/uuid"
 )
 
 type TaskScheduler struct {
-	PostgUrl      string
-	PoolLimit     int16
-	maxTaskWorker uint16
-	taskQueueSize uint16
-	done          chan int
-	taskM         *manager.TaskManager
+	PostgUrl       string
+	PoolLimit      int16
+	RabbitmqUrl    string
+	Storage        util.StorageClient
+	Broker         util.Broker
+	Metrics        util.MetricsSink
+	Tracer         util.Tracer
+	Logger         util.Logger
+	ServerId       string
+	MaxPayloadSize int
+	maxTaskWorker  uint16
+	taskQueueSize  uint16
+	done           chan int
+	taskM          *manager.TaskManager
+	handlers       map[string]model.TaskHandler
+	payloadTypes   map[string]reflect.Type
+	codecs         map[string]util.Codec
+	rateLimits     map[string]model.RateLimit
+	retry          model.RetryPolicy
+	stopOnce       sync.Once
+	configMu       sync.Mutex
+	config         *Config
+	queues         []model.QueueConfig
+	hooks          []eventHook
+	middleware     []model.Middleware
+}
+
+type eventHook struct {
+	event string
+	hook  model.LifecycleHook
 }
 
 func NewTaskScheduler(done chan int, postgUrl string, poolLimit int16, maxTaskWorker uint16, taskQueueSize uint16) *TaskScheduler {
 	return &TaskScheduler{
-		done:          done,
-		PostgUrl:      postgUrl,
-		PoolLimit:     poolLimit,
-		maxTaskWorker: maxTaskWorker,
-		taskQueueSize: taskQueueSize,
+		done:           done,
+		PostgUrl:       postgUrl,
+		PoolLimit:      poolLimit,
+		maxTaskWorker:  maxTaskWorker,
+		taskQueueSize:  taskQueueSize,
+		MaxPayloadSize: util.DEFAULT_MAX_PAYLOAD_SIZE,
+		handlers:       make(map[string]model.TaskHandler),
+		payloadTypes:   make(map[string]reflect.Type),
+		rateLimits:     make(map[string]model.RateLimit),
+		codecs: map[string]util.Codec{
+			util.CODEC_JSON: util.JSONCodec{},
+		},
 	}
 }
 
-func (t *TaskScheduler) StartScheduler() {
-	postgClient, error := storage.NewPostgresClient(t.PostgUrl, t.PoolLimit)
+// RegisterHandler makes tasks of taskType runnable on this node without a
+// TaskFn, which is what lets another node of the cluster hand them over.
+// Register every handler before StartScheduler.
+func (t *TaskScheduler) RegisterHandler(taskType string, taskFn func(metaId string)) {
+	t.handlers[taskType] = manager.MetaIdHandler(taskFn)
+}
+
+// SetRateLimit limits how fast tasks of taskType start, overriding the
+// rate_limit column of jobconfig. Set every limit before StartScheduler.
+func (t *TaskScheduler) SetRateLimit(taskType string, limit model.RateLimit) {
+	t.rateLimits[taskType] = limit
+}
+
+// SetRetryDefaults sets how tasks that do not set TaskMeta.MaxRetry or
+// RetryDelay retry when they fail on this server. Set it before
+// StartScheduler.
+func (t *TaskScheduler) SetRetryDefaults(policy model.RetryPolicy) {
+	t.retry = policy
+}
+
+// AddQueue adds a named queue with its own workers next to the default
+// queue. Tasks choose it with TaskMeta.Queue. Add every queue before
+// StartScheduler.
+func (t *TaskScheduler) AddQueue(config model.QueueConfig) {
+	t.queues = append(t.queues, config)
+}
+
+// ResizeQueue changes the number of workers of a queue while the scheduler
+// runs. The default queue is named "default".
+func (t *TaskScheduler) ResizeQueue(name string, workers uint16) error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.ResizeQueue(name, workers)
+}
+
+func (t *TaskScheduler) QueueStats() []model.QueueStats {
+	if t.taskM == nil {
+		return nil
+	}
+	return t.taskM.QueueStats()
+}
+
+// OnEvent calls hook when a task of this server reaches event: submitted,
+// started, succeeded, failed, retried, cancelled or dead_lettered, or "*"
+// for all of them. config_changed has no task and reports Reload and the
+// periodic reload of jobconfig. Hooks run in the order they were added,
+// on the task's goroutine; a hook that panics is logged and skipped. Add
+// every hook before StartScheduler.
+func (t *TaskScheduler) OnEvent(event string, hook model.LifecycleHook) {
+	t.hooks = append(t.hooks, eventHook{event: event, hook: hook})
+}
+
+// Use wraps every handler of this server in middleware. The first one
+// added runs outermost: it sees the task first and the result last. A
+// middleware that panics fails the attempt like a handler that panics.
+// Add every middleware before StartScheduler.
+func (t *TaskScheduler) Use(middleware model.Middleware) {
+	t.middleware = append(t.middleware, middleware)
+}
+
+// RegisterCodec makes codec usable as TaskMeta.Codec for typed payloads.
+func (t *TaskScheduler) RegisterCodec(codec util.Codec) {
+	t.codecs[codec.Name()] = codec
+}
+
+// StartScheduler connects to storage and the broker and starts running
+// tasks. It returns an error only when it cannot connect to Postgres;
+// other problems are logged and the scheduler runs without what failed.
+func (t *TaskScheduler) StartScheduler() error {
+	if t.Logger == nil {
+		t.Logger = slog.Default()
+	}
 	ta := manager.NewTaskActor(t.maxTaskWorker, t.done, t.taskQueueSize)
-	if error != nil {
-		fmt.Printf("postgres cient failed %v\n", error)
+	usePostgres := t.Storage == nil
+	if usePostgres {
+		postgClient, error := storage.NewPostgresClient(t.PostgUrl, t.PoolLimit, storage.WithLogger(t.Logger))
+		if error != nil {
+			t.Logger.Error("failed to connect to postgres", "error", error)
+			return error
+		}
+		if err := postgClient.Migrate(); err != nil {
+			t.Logger.Error("postgres migration failed", "error", err)
+		}
+		t.Storage = postgClient
+	}
+	storageClient := t.Storage
+	if t.Metrics != nil {
+		storageClient = metrics.InstrumentStorage(t.Storage, t.Metrics)
+	}
+	taskM := manager.InitManager(storageClient, ta, t.done, t.Logger)
+	if t.Metrics != nil {
+		taskM.UseMetrics(t.Metrics)
+	}
+	if t.Tracer != nil {
+		taskM.UseTracer(t.Tracer)
+	}
+	if t.ServerId == "" {
+		t.ServerId = uuid.New().String()
+	}
+	taskM.SetServerId(t.ServerId)
+	if usePostgres {
+		listener, err := storage.NewPostgresListener(t.done, t.PostgUrl, storage.WithLogger(t.Logger))
+		if err != nil {
+			t.Logger.Warn("postgres listener failed, polling for tasks", "error", err)
+		} else {
+			taskM.UseListener(listener)
+		}
+	}
+	for taskType, taskFn := range t.handlers {
+		taskM.RegisterHandler(taskType, taskFn)
+	}
+	for _, hook := range t.hooks {
+		taskM.OnEvent(hook.event, hook.hook)
+	}
+	for _, middleware := range t.middleware {
+		taskM.Use(middleware)
+	}
+	for taskType, limit := range t.rateLimits {
+		taskM.SetRateLimit(taskType, limit)
+	}
+	taskM.SetRetryDefaults(t.retry)
+	taskM.SetMaxPayloadSize(t.MaxPayloadSize)
+	for _, queue := range t.queues {
+		if err := taskM.AddQueue(queue); err != nil {
+			t.Logger.Error("failed to add queue", "queue", queue.Name, "error", err)
+		}
+	}
+	if t.Broker == nil && t.RabbitmqUrl != "" {
+		consumerConfig := util.ConsumerConfig{
+			Prefetch:           taskM.Capacity(),
+			DeadLetterExchange: util.RABBITMQ_DEAD_LETTER_EXCHANGE,
+		}
+		broker, err := storage.NewRabbitBroker(t.done, t.RabbitmqUrl, consumerConfig, storage.WithLogger(t.Logger))
+		if err != nil {
+			t.Logger.Error("failed to connect to rabbitmq", "error", err)
+		} else {
+			t.Broker = broker
+		}
+	}
+	if t.Broker != nil {
+		taskM.UseBroker(t.Broker)
 	}
-	taskM := manager.InitManager(postgClient, ta, t.done)
 	t.taskM = taskM
 	taskM.StartManager()
+	return nil
 }
 
-func (t *TaskScheduler) AddNewTask(task model.Task) error {
-	t.taskM.AddNewTask(task)
-	return nil
+// Stop closes the done channel of the scheduler, which stops it. Do not
+// call it when you close a channel given to WithDone yourself.
+func (t *TaskScheduler) Stop() {
+	t.stopOnce.Do(func() { close(t.done) })
+}
+
+// started returns the manager, or ErrNotStarted before StartScheduler.
+func (t *TaskScheduler) started() (*manager.TaskManager, error) {
+	if t.taskM == nil {
+		return nil, ErrNotStarted
+	}
+	return t.taskM, nil
+}
+
+func (t *TaskScheduler) AddNewTask(task model.Task) (string, error) {
+	return t.AddNewTaskContext(context.Background(), task)
+}
+
+// AddNewTaskContext is AddNewTask where ctx bounds how long a full queue
+// with the "block" backpressure policy may hold the caller.
+func (t *TaskScheduler) AddNewTaskContext(ctx context.Context, task model.Task) (string, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return "", err
+	}
+	return taskM.AddNewTaskContext(ctx, task)
+}
+
+// Wait blocks until the task with id finishes, on any server of the cluster.
+func (t *TaskScheduler) Wait(ctx context.Context, id string) error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.Wait(ctx, id)
+}
+
+// AddWorkflow validates and saves a DAG of tasks and starts the nodes that
+// have no dependency. Every node type needs a handler on some server.
+func (t *TaskScheduler) AddWorkflow(workflow model.Workflow) (string, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return "", err
+	}
+	return taskM.AddWorkflow(workflow)
+}
+
+func (t *TaskScheduler) GetWorkflow(id string) (*model.Workflow, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return nil, err
+	}
+	return taskM.GetWorkflow(id)
+}
+
+func (t *TaskScheduler) CancelWorkflow(id string) error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.CancelWorkflow(id)
+}
+
+// AddBatch submits the tasks of batch together and returns the batch id
+// and the task ids. GetBatch reports how many of them finished.
+func (t *TaskScheduler) AddBatch(batch model.Batch) (string, []string, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return "", nil, err
+	}
+	return taskM.AddBatch(batch)
+}
+
+func (t *TaskScheduler) GetBatch(id string) (*model.Batch, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return nil, err
+	}
+	return taskM.GetBatch(id)
+}
+
+// CancelTask cancels a task that has not finished, and all its children.
+func (t *TaskScheduler) CancelTask(id string) (bool, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return false, err
+	}
+	return taskM.CancelTask(id)
+}
+
+// PauseScheduler stops every server of the cluster from starting tasks
+// until ResumeScheduler. Running tasks finish.
+func (t *TaskScheduler) PauseScheduler() error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.Pause(util.PAUSE_SCOPE_SCHEDULER, "")
+}
+
+func (t *TaskScheduler) ResumeScheduler() error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.Resume(util.PAUSE_SCOPE_SCHEDULER, "")
+}
+
+// PauseQueue stops the cluster from starting tasks of the named queue.
+func (t *TaskScheduler) PauseQueue(name string) error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.Pause(util.PAUSE_SCOPE_QUEUE, name)
+}
+
+func (t *TaskScheduler) ResumeQueue(name string) error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.Resume(util.PAUSE_SCOPE_QUEUE, name)
+}
+
+// PauseType stops the cluster from starting tasks of taskType.
+func (t *TaskScheduler) PauseType(taskType string) error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.Pause(util.PAUSE_SCOPE_TYPE, taskType)
+}
+
+func (t *TaskScheduler) ResumeType(taskType string) error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.Resume(util.PAUSE_SCOPE_TYPE, taskType)
+}
+
+// Pause pauses a scope ("scheduler", "queue" or "type") by name.
+func (t *TaskScheduler) Pause(scope string, name string) error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.Pause(scope, name)
+}
+
+func (t *TaskScheduler) Resume(scope string, name string) error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.Resume(scope, name)
+}
+
+// Pauses lists what is paused in the cluster.
+func (t *TaskScheduler) Pauses() ([]model.Pause, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return nil, err
+	}
+	return taskM.Pauses()
+}
+
+func (t *TaskScheduler) GetTask(id string) (*model.TaskDetail, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return nil, err
+	}
+	return taskM.GetTask(id)
+}
+
+// ListTasks returns the tasks matching filter, newest first, at most
+// filter.Limit (100 by default, 1000 at most) of them.
+func (t *TaskScheduler) ListTasks(filter model.TaskFilter) ([]model.TaskDetail, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return nil, err
+	}
+	return taskM.ListTasks(filter)
+}
+
+// CountTasks counts the tasks of every type by status.
+func (t *TaskScheduler) CountTasks() ([]model.TaskCount, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return nil, err
+	}
+	return taskM.CountTasks()
+}
+
+// GetTaskHistory returns a task with the logs of each attempt and its
+// children.
+func (t *TaskScheduler) GetTaskHistory(id string) (*model.TaskHistory, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return nil, err
+	}
+	return taskM.GetTaskHistory(id)
+}
+
+// RetryTask runs a failed or cancelled typed task again as a new attempt.
+func (t *TaskScheduler) RetryTask(id string) error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.RetryTask(id)
+}
+
+// RescheduleTask moves a pending typed task to executionTime, in unix
+// seconds.
+func (t *TaskScheduler) RescheduleTask(id string, executionTime int64) error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.RescheduleTask(id, executionTime)
+}
+
+// DeleteTask removes a completed, failed or cancelled task.
+func (t *TaskScheduler) DeleteTask(id string) error {
+	taskM, err := t.started()
+	if err != nil {
+		return err
+	}
+	return taskM.DeleteTask(id)
+}
+
+// Members lists the live servers of the cluster.
+func (t *TaskScheduler) Members() ([]model.Member, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return nil, err
+	}
+	return taskM.Members()
+}
+
+// DelayedCount is how many tasks wait in this server's delay queue.
+func (t *TaskScheduler) DelayedCount() int {
+	if t.taskM == nil {
+		return 0
+	}
+	return t.taskM.DelayedCount()
+}
+
+// GetTaskLogs returns what the handler of a task logged through
+// TaskLogger, one entry per attempt.
+func (t *TaskScheduler) GetTaskLogs(id string) ([]model.TaskLog, error) {
+	taskM, err := t.started()
+	if err != nil {
+		return nil, err
+	}
+	return taskM.GetTaskLogs(id)
+}
+
+// Spawn adds a child task of the task whose handler got ctx.
+func Spawn(ctx context.Context, meta model.TaskMeta) (string, error) {
+	return manager.Spawn(ctx, meta)
+}
+
+// WaitChildren blocks until every child spawned by the task whose handler
+// got ctx finished.
+func WaitChildren(ctx context.Context) error {
+	return manager.WaitChildren(ctx)
+}
+
+// TaskFromContext returns the task whose handler got ctx.
+func TaskFromContext(ctx context.Context) (model.TaskDetail, bool) {
+	return manager.TaskFromContext(ctx)
+}
+
+// TaskLogger returns the logger for the handler that got ctx. Its records
+// carry the task id, type, attempt and server id, and are saved with the
+// attempt for GetTaskLogs.
+func TaskLogger(ctx context.Context) util.Logger {
+	return manager.LoggerFromContext(ctx)
 }
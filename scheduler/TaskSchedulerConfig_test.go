@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+)
+
+func TestMethodsBeforeStartReturnErrNotStarted(t *testing.T) {
+	ts := NewTaskScheduler(make(chan int), "", 1, 1, 1)
+	ctx := context.Background()
+	for name, call := range map[string]func() error{
+		"ResizeQueue": func() error { return ts.ResizeQueue("default", 2) },
+		"AddNewTask": func() error {
+			_, err := ts.AddNewTask(model.Task{Meta: model.TaskMeta{Type: "work"}})
+			return err
+		},
+		"AddTypedTask": func() error {
+			_, err := AddTypedTask(ts, model.TaskMeta{Type: "work"}, struct{}{})
+			return err
+		},
+		"Wait": func() error { return ts.Wait(ctx, "id") },
+		"AddWorkflow": func() error {
+			_, err := ts.AddWorkflow(model.Workflow{Name: "chain"})
+			return err
+		},
+		"GetWorkflow": func() error {
+			_, err := ts.GetWorkflow("id")
+			return err
+		},
+		"CancelWorkflow": func() error { return ts.CancelWorkflow("id") },
+		"AddBatch": func() error {
+			_, _, err := ts.AddBatch(model.Batch{})
+			return err
+		},
+		"GetBatch": func() error {
+			_, err := ts.GetBatch("id")
+			return err
+		},
+		"CancelTask": func() error {
+			_, err := ts.CancelTask("id")
+			return err
+		},
+		"PauseScheduler":  ts.PauseScheduler,
+		"ResumeScheduler": ts.ResumeScheduler,
+		"PauseQueue":      func() error { return ts.PauseQueue("default") },
+		"ResumeQueue":     func() error { return ts.ResumeQueue("default") },
+		"PauseType":       func() error { return ts.PauseType("work") },
+		"ResumeType":      func() error { return ts.ResumeType("work") },
+		"Pause":           func() error { return ts.Pause("type", "work") },
+		"Resume":          func() error { return ts.Resume("type", "work") },
+		"Pauses": func() error {
+			_, err := ts.Pauses()
+			return err
+		},
+		"GetTask": func() error {
+			_, err := ts.GetTask("id")
+			return err
+		},
+		"ListTasks": func() error {
+			_, err := ts.ListTasks(model.TaskFilter{})
+			return err
+		},
+		"CountTasks": func() error {
+			_, err := ts.CountTasks()
+			return err
+		},
+		"GetTaskHistory": func() error {
+			_, err := ts.GetTaskHistory("id")
+			return err
+		},
+		"RetryTask":      func() error { return ts.RetryTask("id") },
+		"RescheduleTask": func() error { return ts.RescheduleTask("id", 0) },
+		"DeleteTask":     func() error { return ts.DeleteTask("id") },
+		"Members": func() error {
+			_, err := ts.Members()
+			return err
+		},
+		"GetTaskLogs": func() error {
+			_, err := ts.GetTaskLogs("id")
+			return err
+		},
+	} {
+		if err := call(); !errors.Is(err, ErrNotStarted) {
+			t.Errorf("%v = %v, want ErrNotStarted", name, err)
+		}
+	}
+	if stats := ts.QueueStats(); stats != nil {
+		t.Errorf("QueueStats = %v, want none", stats)
+	}
+	if delayed := ts.DelayedCount(); delayed != 0 {
+		t.Errorf("DelayedCount = %v, want 0", delayed)
+	}
+}
@@ -0,0 +1,107 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// RegisterTypedHandler registers handler for taskType and decodes each task
+// payload into T, with the codec the task was submitted with, before
+// calling it. Register every handler before StartScheduler.
+func RegisterTypedHandler[T any](t *TaskScheduler, taskType string, handler func(ctx context.Context, payload T) error) {
+	t.payloadTypes[taskType] = reflect.TypeOf((*T)(nil)).Elem()
+	t.handlers[taskType] = func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		payload, err := decodePayload[T](t, task)
+		if err != nil {
+			return nil, err
+		}
+		return nil, handler(ctx, payload)
+	}
+}
+
+// RegisterTypedResultHandler is RegisterTypedHandler for handlers that
+// produce a result. The result is saved with the task, encoded with the
+// task's codec, and becomes the payload of successors with PassResult.
+func RegisterTypedResultHandler[T any, R any](t *TaskScheduler, taskType string, handler func(ctx context.Context, payload T) (R, error)) {
+	t.payloadTypes[taskType] = reflect.TypeOf((*T)(nil)).Elem()
+	t.handlers[taskType] = func(ctx context.Context, task model.TaskDetail) ([]byte, error) {
+		payload, err := decodePayload[T](t, task)
+		if err != nil {
+			return nil, err
+		}
+		result, err := handler(ctx, payload)
+		if err != nil {
+			return nil, err
+		}
+		codec, err := t.codec(task.Meta.Codec)
+		if err != nil {
+			return nil, err
+		}
+		data, err := codec.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("encode result of task %v: %w", task.Id, err)
+		}
+		return data, nil
+	}
+}
+
+// AddTypedTask encodes payload with meta.Codec (JSON when empty) and adds
+// the task. If this server registered a handler for meta.Type, payload must
+// have the type that handler expects.
+func AddTypedTask[T any](t *TaskScheduler, meta model.TaskMeta, payload T) (string, error) {
+	meta, err := TypedMeta(t, meta, payload)
+	if err != nil {
+		return "", err
+	}
+	return t.AddNewTask(model.Task{Meta: meta})
+}
+
+// TypedMeta returns meta with payload encoded into it, which is how the
+// steps of a chain (TaskMeta.Next) get their own payload.
+func TypedMeta[T any](t *TaskScheduler, meta model.TaskMeta, payload T) (model.TaskMeta, error) {
+	if meta.Type == "" {
+		return meta, ErrMissingType
+	}
+	payloadType := reflect.TypeOf((*T)(nil)).Elem()
+	if registered, ok := t.payloadTypes[meta.Type]; ok && registered != payloadType {
+		return meta, fmt.Errorf("%w: %v expects %v, got %v", ErrPayloadType, meta.Type, registered, payloadType)
+	}
+	codec, err := t.codec(meta.Codec)
+	if err != nil {
+		return meta, err
+	}
+	data, err := codec.Marshal(payload)
+	if err != nil {
+		return meta, fmt.Errorf("encode payload: %w", err)
+	}
+	meta.Codec = codec.Name()
+	meta.Payload = data
+	return meta, nil
+}
+
+func decodePayload[T any](t *TaskScheduler, task model.TaskDetail) (T, error) {
+	var payload T
+	codec, err := t.codec(task.Meta.Codec)
+	if err != nil {
+		return payload, err
+	}
+	if err := codec.Unmarshal(task.Meta.Payload, &payload); err != nil {
+		return payload, fmt.Errorf("decode payload of task %v: %w", task.Id, err)
+	}
+	return payload, nil
+}
+
+func (t *TaskScheduler) codec(name string) (util.Codec, error) {
+	if name == "" {
+		name = util.CODEC_JSON
+	}
+	codec, ok := t.codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCodec, name)
+	}
+	return codec, nil
+}
@@ -0,0 +1,145 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+)
+
+type email struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+}
+
+// upperCodec is JSON under another name, so the test can tell it was used.
+type upperCodec struct{}
+
+func (upperCodec) Name() string { return "upper" }
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	return []byte(strings.ToUpper(string(data))), err
+}
+
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal([]byte(strings.ToLower(string(data))), v)
+}
+
+func newTypedScheduler(t *testing.T, opts ...Option) *TaskScheduler {
+	t.Helper()
+	opts = append([]Option{
+		WithStorage(storage.NewMemoryStorage()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithServerId("server-1"),
+	}, opts...)
+	ts, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestTypedTaskRoundTrip(t *testing.T) {
+	ts := newTypedScheduler(t)
+	ts.RegisterCodec(upperCodec{})
+	got := make(chan email, 2)
+	RegisterTypedHandler(ts, "email", func(ctx context.Context, payload email) error {
+		got <- payload
+		return nil
+	})
+	if err := ts.StartScheduler(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ts.Stop)
+
+	want := email{To: "a@example.com", Subject: "hello"}
+	for _, codec := range []string{"", "upper"} {
+		id, err := AddTypedTask(ts, model.TaskMeta{Type: "email", Codec: codec}, want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = ts.Wait(ctx, id)
+		cancel()
+		if err != nil {
+			t.Fatalf("Wait with codec %q = %v", codec, err)
+		}
+		if payload := <-got; payload != want {
+			t.Errorf("handler got %+v with codec %q, want %+v", payload, codec, want)
+		}
+		task, err := ts.GetTask(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codec == "upper" && !strings.Contains(string(task.Meta.Payload), "A@EXAMPLE.COM") {
+			t.Errorf("payload = %s, want it encoded by the upper codec", task.Meta.Payload)
+		}
+	}
+}
+
+func TestAddTypedTaskErrors(t *testing.T) {
+	ts := newTypedScheduler(t, WithMaxPayloadSize(64))
+	RegisterTypedHandler(ts, "email", func(ctx context.Context, payload email) error { return nil })
+	if err := ts.StartScheduler(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ts.Stop)
+
+	for _, tc := range []struct {
+		name string
+		add  func() error
+		want error
+	}{
+		{
+			name: "payload of another type",
+			add: func() error {
+				_, err := AddTypedTask(ts, model.TaskMeta{Type: "email"}, "a@example.com")
+				return err
+			},
+			want: ErrPayloadType,
+		},
+		{
+			name: "unknown codec",
+			add: func() error {
+				_, err := AddTypedTask(ts, model.TaskMeta{Type: "email", Codec: "xml"}, email{To: "a@example.com"})
+				return err
+			},
+			want: ErrUnknownCodec,
+		},
+		{
+			name: "payload over the limit",
+			add: func() error {
+				_, err := AddTypedTask(ts, model.TaskMeta{Type: "email"}, email{To: "a@example.com", Subject: strings.Repeat("x", 64)})
+				return err
+			},
+			want: ErrPayloadTooLarge,
+		},
+		{
+			name: "missing type",
+			add: func() error {
+				_, err := AddTypedTask(ts, model.TaskMeta{}, email{})
+				return err
+			},
+			want: ErrMissingType,
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.add(); !errors.Is(err, tc.want) {
+				t.Errorf("AddTypedTask = %v, want %v", err, tc.want)
+			}
+		})
+	}
+	// A type with no handler on this server takes any payload.
+	if _, err := AddTypedTask(ts, model.TaskMeta{Type: "sms"}, "hello"); err != nil {
+		t.Errorf("AddTypedTask of an unregistered type = %v, want nil", err)
+	}
+}
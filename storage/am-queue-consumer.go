@@ -1,9 +1,10 @@
 package storage
 
 import (
+	"context"
 	"fmt"
-	"log"
 
+	model "github.com/amitiwary999/task-scheduler/model"
 	util "github.com/amitiwary999/task-scheduler/util"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -13,11 +14,18 @@ type Consumer struct {
 	conn    *amqp.Connection
 	channel *amqp.Channel
 	done    chan int
+	config  util.ConsumerConfig
+	publish func(exchange string, key string, msg amqp.Publishing) error
+	logger  util.Logger
 }
 
 var connectionName = "task-scheduler-consumer"
 
-func NewConsumer(done chan int, rabbitmqUrl string) (*Consumer, error) {
+func NewConsumer(done chan int, rabbitmqUrl string, options ...ClientOption) (*Consumer, error) {
+	return NewConsumerWithConfig(done, rabbitmqUrl, util.ConsumerConfig{}, options...)
+}
+
+func NewConsumerWithConfig(done chan int, rabbitmqUrl string, consumerConfig util.ConsumerConfig, options ...ClientOption) (*Consumer, error) {
 	amqpURI := rabbitmqUrl
 	exchange := util.RABBITMQ_EXCHANGE
 	exchangeType := util.RABBITMQ_EXCHANGE_TYPE
@@ -26,29 +34,35 @@ func NewConsumer(done chan int, rabbitmqUrl string) (*Consumer, error) {
 		conn:    nil,
 		channel: nil,
 		done:    done,
+		config:  consumerConfig,
+		logger:  applyOptions(options).logger,
 	}
 
 	var err error
 
 	config := amqp.Config{Properties: amqp.NewConnectionProperties()}
 	config.Properties.SetClientConnectionName(connectionName)
-	log.Printf("dialing %q", amqpURI)
+	c.logger.Debug("dialing AMQP", "connection", connectionName)
 	c.conn, err = amqp.DialConfig(amqpURI, config)
 	if err != nil {
 		return nil, fmt.Errorf("dial: %s", err)
 	}
 
 	go func() {
-		log.Printf("closing: %s", <-c.conn.NotifyClose(make(chan *amqp.Error)))
+		c.logger.Info("AMQP connection closed", "connection", connectionName, "reason", <-c.conn.NotifyClose(make(chan *amqp.Error)))
 	}()
 
-	log.Printf("got Connection, getting Channel")
+	c.logger.Debug("got AMQP connection, getting channel")
 	c.channel, err = c.conn.Channel()
 	if err != nil {
 		return nil, fmt.Errorf("channel: %s", err)
 	}
 
-	log.Printf("got Channel, declaring Exchange (%q)", exchange)
+	c.publish = func(exchange string, key string, msg amqp.Publishing) error {
+		return c.channel.PublishWithContext(context.Background(), exchange, key, false, false, msg)
+	}
+
+	c.logger.Debug("got AMQP channel, declaring exchange", "exchange", exchange)
 	if err = c.channel.ExchangeDeclare(
 		exchange,     // name of the exchange
 		exchangeType, // type
@@ -61,51 +75,71 @@ func NewConsumer(done chan int, rabbitmqUrl string) (*Consumer, error) {
 		return nil, fmt.Errorf("exchange Declare: %s", err)
 	}
 
+	if consumerConfig.Prefetch > 0 {
+		c.logger.Debug("setting prefetch count", "prefetch", consumerConfig.Prefetch)
+		if err = c.channel.Qos(consumerConfig.Prefetch, 0, false); err != nil {
+			return nil, fmt.Errorf("qos: %s", err)
+		}
+	}
+
+	if consumerConfig.DeadLetterExchange != "" {
+		c.logger.Debug("declaring dead letter exchange", "exchange", consumerConfig.DeadLetterExchange)
+		if err = c.channel.ExchangeDeclare(
+			consumerConfig.DeadLetterExchange, // name of the exchange
+			util.RABBITMQ_EXCHANGE_TYPE,       // type
+			true,                              // durable
+			false,                             // delete when complete
+			false,                             // internal
+			false,                             // noWait
+			nil,                               // arguments
+		); err != nil {
+			return nil, fmt.Errorf("dead letter exchange Declare: %s", err)
+		}
+	}
+
 	return c, nil
 }
 
 func (c *Consumer) Shutdown() {
 	if err := c.channel.Cancel(util.TaskConsumerTag, true); err != nil {
-		fmt.Printf("task consumer cancel failed: %s", err)
+		c.logger.Error("failed to cancel task consumer", "error", err)
 	}
 	if err := c.channel.Cancel(util.NewServerJoinTag, true); err != nil {
-		fmt.Printf("server join consumer cancel failed: %s", err)
+		c.logger.Error("failed to cancel server join consumer", "error", err)
+	}
+	if err := c.channel.Cancel(util.CompleteTaskConsumerTag, true); err != nil {
+		c.logger.Error("failed to cancel complete task consumer", "error", err)
 	}
 	if err := c.conn.Close(); err != nil {
-		fmt.Printf("AMQP connection close error: %s", err)
+		c.logger.Error("failed to close AMQP connection", "error", err)
 	}
-	fmt.Printf("AMQP consumer shutdown\n")
+	c.logger.Info("AMQP consumer shutdown")
 }
 
-func (c *Consumer) Handle(data chan []byte, queueName string, key string, consumerTag string) error {
-	exchange := util.RABBITMQ_EXCHANGE
-	queue, err := c.channel.QueueDeclare(
-		queueName, // name of the queue
-		true,      // durable
-		false,     // delete when unused
-		false,     // exclusive
-		false,     // noWait
-		nil,       // arguments
-	)
-	if err != nil {
-		return fmt.Errorf("queue Declare: %s", err)
-	}
+// Consume delivers messages with at-least-once semantics: nothing is acked
+// until the receiver calls Ack. Reject puts a message back on its queue
+// with its attempt header incremented, and dead-letters (or drops, when no
+// dead letter exchange is configured) a message that failed
+// RABBITMQ_MAX_ATTEMPTS times. A redelivery after a crash or a closed
+// channel is not counted as a failure.
+func (c *Consumer) Consume(deliveries chan model.Delivery, queueName string, key string, consumerTag string) error {
+	return c.consume(deliveries, queueName, key, consumerTag, false)
+}
 
-	log.Printf("declared Queue (%q %d messages, %d consumers), binding to Exchange (key %q)",
-		queue.Name, queue.Messages, queue.Consumers, key)
+// ConsumeBroadcast is Consume on a queue owned by this connection, so every
+// node binding the same key gets its own copy of each message.
+func (c *Consumer) ConsumeBroadcast(deliveries chan model.Delivery, queueName string, key string, consumerTag string) error {
+	return c.consume(deliveries, queueName, key, consumerTag, true)
+}
 
-	if err = c.channel.QueueBind(
-		queue.Name, // name of the queue
-		key,        // bindingKey
-		exchange,   // sourceExchange
-		false,      // noWait
-		nil,        // arguments
-	); err != nil {
-		return fmt.Errorf("queue Bind: %s", err)
+func (c *Consumer) consume(deliveries chan model.Delivery, queueName string, key string, consumerTag string, exclusive bool) error {
+	queue, err := c.declareQueue(queueName, key, exclusive)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("Queue bound to Exchange, starting Consume (consumer tag %q)", consumerTag)
-	deliveries, err := c.channel.Consume(
+	c.logger.Debug("queue bound to exchange, starting consume", "queue", queue.Name, "consumerTag", consumerTag)
+	amqpDeliveries, err := c.channel.Consume(
 		queue.Name,  // name
 		consumerTag, // consumerTag,
 		false,       // autoAck
@@ -121,52 +155,125 @@ func (c *Consumer) Handle(data chan []byte, queueName string, key string, consum
 		select {
 		case <-c.done:
 			return nil
-		case d := <-deliveries:
-			if len(d.Body) > 0 {
-				data <- d.Body
+		case d, ok := <-amqpDeliveries:
+			if !ok {
+				return fmt.Errorf("queue %q deliveries closed", queueName)
+			}
+			if len(d.Body) == 0 {
+				d.Ack(false)
+				continue
+			}
+			select {
+			case deliveries <- c.toDelivery(d, queue.Name):
+			case <-c.done:
+				return nil
 			}
-			d.Ack(true)
 		}
 	}
 }
 
-func (c *Consumer) ServerJoinHandle(serverJoin chan []byte, consumerTag string) error {
-	serverJoinQueue := util.SERVER_JOIN_RABBITMQ_QUEUE
-	serverJoinKey := util.RABBITMQ_SERVER_JOIN_EXCHANGE_KEY
-	exchange := util.RABBITMQ_EXCHANGE
+func (c *Consumer) toDelivery(d amqp.Delivery, queueName string) model.Delivery {
+	headers := make(map[string]string, len(d.Headers))
+	for key, value := range d.Headers {
+		if s, ok := value.(string); ok {
+			headers[key] = s
+		}
+	}
+	return model.Delivery{
+		Body:        d.Body,
+		Headers:     headers,
+		Redelivered: d.Redelivered,
+		Ack: func() error {
+			return d.Ack(false)
+		},
+		Reject: func() error {
+			attempt := deliveryAttempt(d.Headers) + 1
+			if attempt < util.RABBITMQ_MAX_ATTEMPTS {
+				return c.retry(d, queueName, attempt)
+			}
+			if c.config.DeadLetterExchange == "" {
+				c.logger.Warn("dropping message after repeated failure", "messageId", d.MessageId, "attempts", attempt)
+			}
+			return d.Nack(false, false)
+		},
+	}
+}
 
-	queue, err := c.channel.QueueDeclare(serverJoinQueue, true, false, false, false, nil)
+// retry publishes d to the back of its queue with attempt failures counted
+// and acks the original. A crash in between delivers it twice, which the
+// receivers already handle.
+func (c *Consumer) retry(d amqp.Delivery, queueName string, attempt int) error {
+	table := make(amqp.Table, len(d.Headers)+1)
+	for key, value := range d.Headers {
+		table[key] = value
+	}
+	table[util.RABBITMQ_ATTEMPT_HEADER] = int32(attempt)
+	err := c.publish("", queueName, amqp.Publishing{
+		ContentType:  d.ContentType,
+		DeliveryMode: d.DeliveryMode,
+		MessageId:    d.MessageId,
+		Headers:      table,
+		Body:         d.Body,
+	})
 	if err != nil {
-		fmt.Printf("queue declare failed %v\n", err)
-		return err
+		return d.Nack(false, true)
 	}
+	return d.Ack(false)
+}
 
-	bindErr := c.channel.QueueBind(queue.Name, serverJoinKey, exchange, false, nil)
-	if bindErr != nil {
-		fmt.Printf("failed to bind queue %v error %v\n", queue.Name, bindErr)
-		return bindErr
+// deliveryAttempt is how many times the message failed before, from the
+// header retry sets.
+func deliveryAttempt(headers amqp.Table) int {
+	switch attempt := headers[util.RABBITMQ_ATTEMPT_HEADER].(type) {
+	case int32:
+		return int(attempt)
+	case int64:
+		return int(attempt)
+	case int:
+		return attempt
 	}
-	deliveries, err := c.channel.Consume(
-		queue.Name,  // name
-		consumerTag, // consumerTag,
-		false,       // autoAck
-		false,       // exclusive
-		false,       // noLocal
-		false,       // noWait
-		nil,         // arguments
+	return 0
+}
+
+func (c *Consumer) declareQueue(queueName string, key string, exclusive bool) (amqp.Queue, error) {
+	exchange := util.RABBITMQ_EXCHANGE
+	var args amqp.Table
+	if c.config.DeadLetterExchange != "" && !exclusive {
+		args = amqp.Table{
+			"x-dead-letter-exchange":    c.config.DeadLetterExchange,
+			"x-dead-letter-routing-key": queueName,
+		}
+		deadQueue, err := c.channel.QueueDeclare(queueName+util.RABBITMQ_DEAD_LETTER_SUFFIX, true, false, false, false, nil)
+		if err != nil {
+			return amqp.Queue{}, fmt.Errorf("dead letter queue Declare: %s", err)
+		}
+		if err = c.channel.QueueBind(deadQueue.Name, queueName, c.config.DeadLetterExchange, false, nil); err != nil {
+			return amqp.Queue{}, fmt.Errorf("dead letter queue Bind: %s", err)
+		}
+	}
+	queue, err := c.channel.QueueDeclare(
+		queueName,  // name of the queue
+		!exclusive, // durable
+		exclusive,  // delete when unused
+		exclusive,  // exclusive
+		false,      // noWait
+		args,       // arguments
 	)
 	if err != nil {
-		return err
+		return queue, fmt.Errorf("queue Declare: %s", err)
 	}
-	for {
-		select {
-		case <-c.done:
-			return nil
-		case d := <-deliveries:
-			if len(d.Body) > 0 {
-				serverJoin <- d.Body
-			}
-			d.Ack(true)
-		}
+
+	c.logger.Debug("declared queue, binding to exchange",
+		"queue", queue.Name, "messages", queue.Messages, "consumers", queue.Consumers, "key", key)
+
+	if err = c.channel.QueueBind(
+		queue.Name, // name of the queue
+		key,        // bindingKey
+		exchange,   // sourceExchange
+		false,      // noWait
+		nil,        // arguments
+	); err != nil {
+		return queue, fmt.Errorf("queue Bind: %s", err)
 	}
+	return queue, nil
 }
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type fakeAcknowledger struct {
+	acked   int
+	nacked  int
+	requeue bool
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked++
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.nacked++
+	a.requeue = requeue
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func TestRejectRequeuesThenDeadLetters(t *testing.T) {
+	var published []amqp.Publishing
+	var publishedTo []string
+	c := &Consumer{
+		config: util.ConsumerConfig{DeadLetterExchange: util.RABBITMQ_DEAD_LETTER_EXCHANGE},
+		publish: func(exchange string, key string, msg amqp.Publishing) error {
+			publishedTo = append(publishedTo, exchange+"/"+key)
+			published = append(published, msg)
+			return nil
+		},
+	}
+
+	first := &fakeAcknowledger{}
+	// A redelivery after a crash has not failed yet and must not be
+	// dead-lettered on its first failure.
+	d := amqp.Delivery{
+		Acknowledger: first,
+		Redelivered:  true,
+		Body:         []byte(`{"task":"1"}`),
+		Headers:      amqp.Table{util.TRACE_PARENT_HEADER: "00-abc-def-01"},
+	}
+	if err := c.toDelivery(d, "tasks.a").Reject(); err != nil {
+		t.Fatal(err)
+	}
+	if first.acked != 1 || first.nacked != 0 {
+		t.Fatalf("first failure: acked %v nacked %v, want the original acked", first.acked, first.nacked)
+	}
+	if len(published) != 1 || publishedTo[0] != "/tasks.a" {
+		t.Fatalf("first failure published %v to %v, want one message to the queue", len(published), publishedTo)
+	}
+	retried := published[0]
+	if got := deliveryAttempt(retried.Headers); got != 1 {
+		t.Fatalf("attempt header = %v, want 1", got)
+	}
+	if retried.Headers[util.TRACE_PARENT_HEADER] != "00-abc-def-01" || string(retried.Body) != `{"task":"1"}` {
+		t.Fatalf("retried message lost its headers or body: %+v", retried)
+	}
+
+	second := &fakeAcknowledger{}
+	d = amqp.Delivery{Acknowledger: second, Body: retried.Body, Headers: retried.Headers}
+	if err := c.toDelivery(d, "tasks.a").Reject(); err != nil {
+		t.Fatal(err)
+	}
+	if second.nacked != 1 || second.requeue || second.acked != 0 {
+		t.Fatalf("second failure: acked %v nacked %v requeue %v, want a nack without requeue", second.acked, second.nacked, second.requeue)
+	}
+	if len(published) != 1 {
+		t.Fatalf("second failure published again")
+	}
+}
+
+func TestDeliveryAttempt(t *testing.T) {
+	for _, test := range []struct {
+		headers amqp.Table
+		want    int
+	}{
+		{nil, 0},
+		{amqp.Table{util.RABBITMQ_ATTEMPT_HEADER: int32(1)}, 1},
+		{amqp.Table{util.RABBITMQ_ATTEMPT_HEADER: int64(3)}, 3},
+		{amqp.Table{util.RABBITMQ_ATTEMPT_HEADER: "x"}, 0},
+	} {
+		if got := deliveryAttempt(test.headers); got != test.want {
+			t.Errorf("deliveryAttempt(%v) = %v, want %v", test.headers, got, test.want)
+		}
+	}
+}
+
+func TestTraceParentHeaderRoundTrip(t *testing.T) {
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	msg := model.TaskMessage{ServerId: "server-2", TaskId: "1", TraceParent: traceParent}
+	d := amqp.Delivery{Headers: headerTable(taskHeaders(msg))}
+	delivery := (&Consumer{}).toDelivery(d, "tasks.server-2")
+	if got := delivery.Headers[util.TRACE_PARENT_HEADER]; got != traceParent {
+		t.Fatalf("traceparent header = %q, want %q", got, traceParent)
+	}
+	if headerTable(taskHeaders(model.TaskMessage{TaskId: "1"})) != nil {
+		t.Error("a task without a trace got headers")
+	}
+}
+
+func TestConsumerLogsThroughItsLogger(t *testing.T) {
+	var logs strings.Builder
+	c := &Consumer{logger: slog.New(slog.NewTextHandler(&logs, nil))}
+	d := amqp.Delivery{
+		Acknowledger: &fakeAcknowledger{},
+		MessageId:    "m1",
+		Headers:      amqp.Table{util.RABBITMQ_ATTEMPT_HEADER: int32(util.RABBITMQ_MAX_ATTEMPTS - 1)},
+	}
+	if err := c.toDelivery(d, "tasks.a").Reject(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "dropping message after repeated failure") || !strings.Contains(logs.String(), "messageId=m1") {
+		t.Fatalf("consumer logged %q, want the dropped message", logs.String())
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 
 	util "github.com/amitiwary999/task-scheduler/util"
 
@@ -17,11 +16,12 @@ type Producer struct {
 	conn    *amqp.Connection
 	channel *amqp.Channel
 	done    chan int
+	logger  util.Logger
 }
 
 var connectionProducer = "task-scheduler-producer"
 
-func NewProducer(done chan int, queueName string, rabbitmqUrl string) (*Producer, error) {
+func NewProducer(done chan int, queueName string, rabbitmqUrl string, options ...ClientOption) (*Producer, error) {
 	amqpURI := rabbitmqUrl
 	exchange := util.RABBITMQ_EXCHANGE
 	exchangeType := util.RABBITMQ_EXCHANGE_TYPE
@@ -30,29 +30,30 @@ func NewProducer(done chan int, queueName string, rabbitmqUrl string) (*Producer
 		conn:    nil,
 		channel: nil,
 		done:    done,
+		logger:  applyOptions(options).logger,
 	}
 
 	var err error
 
 	config := amqp.Config{Properties: amqp.NewConnectionProperties()}
 	config.Properties.SetClientConnectionName(connectionProducer)
-	log.Printf("dialing %q", amqpURI)
+	c.logger.Debug("dialing AMQP", "connection", connectionProducer)
 	c.conn, err = amqp.DialConfig(amqpURI, config)
 	if err != nil {
 		return nil, fmt.Errorf("dial: %s", err)
 	}
 
 	go func() {
-		log.Printf("closing: %s", <-c.conn.NotifyClose(make(chan *amqp.Error)))
+		c.logger.Info("AMQP connection closed", "connection", connectionProducer, "reason", <-c.conn.NotifyClose(make(chan *amqp.Error)))
 	}()
 
-	log.Printf("got Connection, getting Channel")
+	c.logger.Debug("got AMQP connection, getting channel")
 	c.channel, err = c.conn.Channel()
 	if err != nil {
 		return nil, fmt.Errorf("channel: %s", err)
 	}
 
-	log.Printf("got Channel, declaring Exchange (%q)", exchange)
+	c.logger.Debug("got AMQP channel, declaring exchange", "exchange", exchange)
 	if err = c.channel.ExchangeDeclare(
 		exchange,     // name of the exchange
 		exchangeType, // type
@@ -65,34 +66,54 @@ func NewProducer(done chan int, queueName string, rabbitmqUrl string) (*Producer
 		return nil, fmt.Errorf("exchange Declare: %s", err)
 	}
 
-	log.Printf("declared Exchange, declaring Queue %q", queueName)
+	c.logger.Debug("declared exchange", "exchange", exchange, "queue", queueName)
 	return c, nil
 }
 
 func (c *Producer) Shutdown() {
 	if err := c.conn.Close(); err != nil {
-		fmt.Printf("AMQP connection close error: %s", err)
+		c.logger.Error("failed to close AMQP connection", "error", err)
 	}
-	fmt.Printf("AMQP producer shutdown\n")
+	c.logger.Info("AMQP producer shutdown")
 }
 
 func (c *Producer) SendTaskMessage(taskId, routingKey string) {
-	fmt.Printf("send the task %v %v \n", routingKey, taskId)
+	c.logger.Debug("sending task", "taskId", taskId, "serverId", routingKey)
 	bodyModel := &model.TaskMessage{
 		TaskId:   taskId,
 		ServerId: routingKey,
 	}
 	body, err := json.Marshal(bodyModel)
 	if err != nil {
-		fmt.Printf("task maessage body parse error %v\n", err)
+		c.logger.Error("failed to encode task message", "taskId", taskId, "error", err)
+		return
 	}
+	if publishErr := c.Publish(routingKey, body); publishErr != nil {
+		c.logger.Error("failed to send task to server", "taskId", taskId, "serverId", routingKey, "error", publishErr)
+	}
+}
+
+func (c *Producer) Publish(routingKey string, body []byte) error {
+	return c.PublishWithHeaders(routingKey, body, nil)
+}
+
+func (c *Producer) PublishWithHeaders(routingKey string, body []byte, headers map[string]string) error {
 	exchange := util.RABBITMQ_EXCHANGE
-	publishErr := c.channel.PublishWithContext(context.Background(), exchange, routingKey, false, false, amqp.Publishing{
-		ContentType: "text/plain",
-		Body:        body,
+	return c.channel.PublishWithContext(context.Background(), exchange, routingKey, false, false, amqp.Publishing{
+		ContentType:  "text/plain",
+		DeliveryMode: amqp.Persistent,
+		Headers:      headerTable(headers),
+		Body:         body,
 	})
+}
 
-	if publishErr != nil {
-		fmt.Printf("error sendig task to server %v\n", err)
+func headerTable(headers map[string]string) amqp.Table {
+	if len(headers) == 0 {
+		return nil
+	}
+	table := make(amqp.Table, len(headers))
+	for key, value := range headers {
+		table[key] = value
 	}
+	return table
 }
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"log/slog"
+
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// ClientOption configures a storage client, listener or broker.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	logger util.Logger
+}
+
+// WithLogger makes the client log through logger instead of
+// slog.Default().
+func WithLogger(logger util.Logger) ClientOption {
+	return func(o *clientOptions) {
+		o.logger = logger
+	}
+}
+
+func applyOptions(options []ClientOption) clientOptions {
+	o := clientOptions{}
+	for _, option := range options {
+		option(&o)
+	}
+	if o.logger == nil {
+		o.logger = slog.Default()
+	}
+	return o
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"encoding/json"
+	"sync"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+)
+
+// MemoryHub is the in-process stand-in for a RabbitMQ server. Every node
+// of a test cluster creates its own MemoryBroker on the same hub. Like the
+// exclusive queues RabbitBroker uses, a broadcast only reaches the nodes
+// consuming at the time: a node that starts consuming later never sees it.
+type MemoryHub struct {
+	mu         sync.Mutex
+	tasks      map[string]*memoryQueue
+	complete   map[string]*memoryQueue
+	membership map[string]*memoryQueue
+}
+
+type MemoryBroker struct {
+	hub  *MemoryHub
+	done chan int
+}
+
+type memoryMessage struct {
+	body        []byte
+	headers     map[string]string
+	redelivered bool
+}
+
+type memoryQueue struct {
+	mu     sync.Mutex
+	items  []memoryMessage
+	notify chan struct{}
+}
+
+func NewMemoryHub() *MemoryHub {
+	return &MemoryHub{
+		tasks:      make(map[string]*memoryQueue),
+		complete:   make(map[string]*memoryQueue),
+		membership: make(map[string]*memoryQueue),
+	}
+}
+
+func NewMemoryBroker(done chan int, hub *MemoryHub) *MemoryBroker {
+	return &MemoryBroker{
+		hub:  hub,
+		done: done,
+	}
+}
+
+func (m *MemoryBroker) PublishTask(msg model.TaskMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	m.hub.queue(m.hub.tasks, msg.ServerId).push(memoryMessage{body: body, headers: taskHeaders(msg)})
+	return nil
+}
+
+func (m *MemoryBroker) ConsumeTasks(serverId string, deliveries chan model.Delivery) error {
+	return m.consume(m.hub.queue(m.hub.tasks, serverId), deliveries)
+}
+
+func (m *MemoryBroker) PublishTaskComplete(msg model.TaskMessage) error {
+	return m.broadcast(m.hub.complete, msg)
+}
+
+func (m *MemoryBroker) ConsumeTaskComplete(serverId string, deliveries chan model.Delivery) error {
+	queue := m.hub.queue(m.hub.complete, serverId)
+	defer m.hub.remove(m.hub.complete, serverId)
+	return m.consume(queue, deliveries)
+}
+
+func (m *MemoryBroker) PublishMembership(joinData model.JoinData) error {
+	return m.broadcast(m.hub.membership, joinData)
+}
+
+func (m *MemoryBroker) ConsumeMembership(serverId string, deliveries chan model.Delivery) error {
+	queue := m.hub.queue(m.hub.membership, serverId)
+	defer m.hub.remove(m.hub.membership, serverId)
+	return m.consume(queue, deliveries)
+}
+
+func (m *MemoryBroker) Shutdown() {}
+
+func (m *MemoryBroker) broadcast(queues map[string]*memoryQueue, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	m.hub.mu.Lock()
+	defer m.hub.mu.Unlock()
+	for _, queue := range queues {
+		queue.push(memoryMessage{body: body})
+	}
+	return nil
+}
+
+func (m *MemoryBroker) consume(queue *memoryQueue, deliveries chan model.Delivery) error {
+	for {
+		msg, ok := queue.pop()
+		if !ok {
+			select {
+			case <-queue.notify:
+				continue
+			case <-m.done:
+				return nil
+			}
+		}
+		delivery := model.Delivery{
+			Body:        msg.body,
+			Headers:     msg.headers,
+			Redelivered: msg.redelivered,
+			Ack: func() error {
+				return nil
+			},
+			Reject: func() error {
+				if !msg.redelivered {
+					queue.push(memoryMessage{body: msg.body, headers: msg.headers, redelivered: true})
+				}
+				return nil
+			},
+		}
+		select {
+		case deliveries <- delivery:
+		case <-m.done:
+			return nil
+		}
+	}
+}
+
+func (h *MemoryHub) queue(queues map[string]*memoryQueue, name string) *memoryQueue {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	queue, ok := queues[name]
+	if !ok {
+		queue = &memoryQueue{notify: make(chan struct{}, 1)}
+		queues[name] = queue
+	}
+	return queue
+}
+
+func (h *MemoryHub) remove(queues map[string]*memoryQueue, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(queues, name)
+}
+
+func (q *memoryQueue) push(msg memoryMessage) {
+	q.mu.Lock()
+	q.items = append(q.items, msg)
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *memoryQueue) pop() (memoryMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		return memoryMessage{}, false
+	}
+	msg := q.items[0]
+	q.items = q.items[1:]
+	return msg, true
+}
@@ -0,0 +1,602 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+	"github.com/google/uuid"
+)
+
+// MemoryStorage is an in-process StorageClient with the semantics of the
+// Postgres one. Like MemoryHub it is for tests: every node of a test
+// cluster shares one MemoryStorage, and nothing survives the process.
+type MemoryStorage struct {
+	mu         sync.Mutex
+	tasks      map[string]*memoryTask
+	created    int64
+	taskConfig []model.TaskWeight
+	rateStates map[string]*util.RateState
+	servers    map[string]model.JoinData
+	pauses     map[model.Pause]int64
+	logs       map[string]map[int]model.TaskLog
+	workflows  map[string]*model.Workflow
+	batches    map[string]*model.Batch
+}
+
+type memoryTask struct {
+	detail    model.TaskDetail
+	claimedBy string
+	seq       int64
+}
+
+var _ util.StorageClient = (*MemoryStorage)(nil)
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		tasks:      make(map[string]*memoryTask),
+		rateStates: make(map[string]*util.RateState),
+		servers:    make(map[string]model.JoinData),
+		pauses:     make(map[model.Pause]int64),
+		logs:       make(map[string]map[int]model.TaskLog),
+		workflows:  make(map[string]*model.Workflow),
+		batches:    make(map[string]*model.Batch),
+	}
+}
+
+// SetTaskConfig replaces the rows of jobconfig.
+func (m *MemoryStorage) SetTaskConfig(taskWeights []model.TaskWeight) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.taskConfig = append([]model.TaskWeight(nil), taskWeights...)
+}
+
+func (m *MemoryStorage) GetTaskConfig() ([]model.TaskWeight, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]model.TaskWeight(nil), m.taskConfig...), nil
+}
+
+func (m *MemoryStorage) TakeRateToken(taskType string, limit model.RateLimit) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.rateStates[taskType]
+	if !ok {
+		state = &util.RateState{}
+		m.rateStates[taskType] = state
+	}
+	return state.Take(limit, time.Now()), nil
+}
+
+func (m *MemoryStorage) SaveTask(meta *model.TaskMeta) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := uuid.New().String()
+	m.insert(id, *meta)
+	return id, nil
+}
+
+// insert adds a pending task unless id exists. The caller holds mu.
+func (m *MemoryStorage) insert(id string, meta model.TaskMeta) {
+	if _, ok := m.tasks[id]; ok {
+		return
+	}
+	m.created++
+	m.tasks[id] = &memoryTask{
+		detail: model.TaskDetail{
+			Id:        id,
+			Meta:      meta,
+			Status:    util.TASK_STATUS_PENDING,
+			CreatedAt: time.Now().Unix(),
+		},
+		seq: m.created,
+	}
+}
+
+func (m *MemoryStorage) GetTask(id string) (*model.TaskDetail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task, ok := m.tasks[id]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	detail := task.detail
+	return &detail, nil
+}
+
+func (m *MemoryStorage) ClaimTask(id string, serverId string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task, ok := m.tasks[id]
+	if !ok || task.detail.Status != util.TASK_STATUS_PENDING || task.detail.Meta.ExecutionTime > time.Now().Unix()+util.CLAIM_CLOCK_SKEW {
+		return false, nil
+	}
+	task.detail.Status = util.TASK_STATUS_RUNNING
+	task.claimedBy = serverId
+	return true, nil
+}
+
+func (m *MemoryStorage) ClaimPendingTasks(serverId string, queue string, known []string, types []string, limit int) ([]model.TaskDetail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wanted := make(map[string]bool, len(types))
+	for _, taskType := range types {
+		wanted[taskType] = true
+	}
+	isKnown := make(map[string]bool, len(known))
+	for _, name := range known {
+		isKnown[name] = true
+	}
+	now := time.Now().Unix()
+	var claimed []model.TaskDetail
+	for _, task := range m.ordered(false) {
+		if len(claimed) >= limit {
+			break
+		}
+		meta := task.detail.Meta
+		taskQueue := meta.Queue
+		if !isKnown[taskQueue] {
+			taskQueue = util.DEFAULT_QUEUE
+		}
+		if task.detail.Status != util.TASK_STATUS_PENDING || !wanted[meta.Type] || taskQueue != queue || meta.ExecutionTime > now {
+			continue
+		}
+		task.detail.Status = util.TASK_STATUS_RUNNING
+		task.claimedBy = serverId
+		claimed = append(claimed, task.detail)
+	}
+	return claimed, nil
+}
+
+func (m *MemoryStorage) UpdateTaskComplete(id string, result []byte, next []model.TaskMeta) ([]string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task, ok := m.tasks[id]
+	if !ok || (task.detail.Status != util.TASK_STATUS_PENDING && task.detail.Status != util.TASK_STATUS_RUNNING) {
+		return nil, false, nil
+	}
+	task.detail.Status = util.TASK_STATUS_COMPLETED
+	task.detail.Result = result
+	nextIds := make([]string, 0, len(next))
+	for i := range next {
+		nextId := SuccessorId(id, i)
+		m.insert(nextId, next[i])
+		nextIds = append(nextIds, nextId)
+	}
+	return nextIds, true, nil
+}
+
+func (m *MemoryStorage) UpdateTaskFailed(id string, reason string) (bool, error) {
+	return m.transition(id, []string{util.TASK_STATUS_PENDING, util.TASK_STATUS_RUNNING}, func(task *memoryTask) {
+		task.detail.Status = util.TASK_STATUS_FAILED
+		task.detail.Error = reason
+	})
+}
+
+func (m *MemoryStorage) RetryTask(id string, reason string, executionTime int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task, ok := m.tasks[id]
+	if !ok || (task.detail.Status != util.TASK_STATUS_PENDING && task.detail.Status != util.TASK_STATUS_RUNNING) {
+		return false, nil
+	}
+	task.detail.Status = util.TASK_STATUS_PENDING
+	task.detail.Error = reason
+	task.detail.Attempt++
+	task.detail.Meta.ExecutionTime = executionTime
+	task.claimedBy = ""
+	return true, nil
+}
+
+func (m *MemoryStorage) CancelTask(id string) (bool, error) {
+	return m.transition(id, []string{util.TASK_STATUS_PENDING, util.TASK_STATUS_RUNNING}, func(task *memoryTask) {
+		task.detail.Status = util.TASK_STATUS_CANCELLED
+	})
+}
+
+func (m *MemoryStorage) DeferTask(id string, executionTime int64) (bool, error) {
+	return m.transition(id, []string{util.TASK_STATUS_RUNNING}, func(task *memoryTask) {
+		task.detail.Status = util.TASK_STATUS_PENDING
+		task.detail.Meta.ExecutionTime = executionTime
+		task.claimedBy = ""
+	})
+}
+
+func (m *MemoryStorage) ReplayTask(id string, executionTime int64) (bool, error) {
+	return m.transition(id, []string{util.TASK_STATUS_FAILED, util.TASK_STATUS_CANCELLED}, func(task *memoryTask) {
+		task.detail.Status = util.TASK_STATUS_PENDING
+		task.detail.Error = ""
+		task.detail.Attempt++
+		task.detail.Meta.ExecutionTime = executionTime
+		task.claimedBy = ""
+	})
+}
+
+func (m *MemoryStorage) RescheduleTask(id string, executionTime int64) (bool, error) {
+	return m.transition(id, []string{util.TASK_STATUS_PENDING}, func(task *memoryTask) {
+		task.detail.Meta.ExecutionTime = executionTime
+	})
+}
+
+func (m *MemoryStorage) DeleteTask(id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task, ok := m.tasks[id]
+	if !ok || !memoryTerminal(task.detail.Status) {
+		return false, nil
+	}
+	delete(m.tasks, id)
+	delete(m.logs, id)
+	return true, nil
+}
+
+// transition applies update to task id if its status is one of from.
+func (m *MemoryStorage) transition(id string, from []string, update func(task *memoryTask)) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	task, ok := m.tasks[id]
+	if !ok {
+		return false, nil
+	}
+	for _, status := range from {
+		if task.detail.Status == status {
+			update(task)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStorage) GetChildTasks(parentId string) ([]model.TaskDetail, error) {
+	return m.filter(func(task *memoryTask) bool { return task.detail.Meta.ParentId == parentId }), nil
+}
+
+func (m *MemoryStorage) GetPendingTask() ([]model.PendingTask, error) {
+	var pendingTasks []model.PendingTask
+	for _, task := range m.filter(func(task *memoryTask) bool { return task.detail.Status == util.TASK_STATUS_PENDING }) {
+		pendingTasks = append(pendingTasks, model.PendingTask{Id: task.Id, Meta: task.Meta})
+	}
+	return pendingTasks, nil
+}
+
+func (m *MemoryStorage) UpdateServerStatus(serverId string, status int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.servers[serverId] = model.JoinData{ServerId: serverId, Status: status, Heartbeat: time.Now().Unix()}
+	return nil
+}
+
+func (m *MemoryStorage) GetAllUsedServer() ([]model.JoinData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var joinDatas []model.JoinData
+	for _, joinData := range m.servers {
+		if joinData.Status == util.SERVER_STATUS_ACTIVE && joinData.Heartbeat >= staleHeartbeat() {
+			joinDatas = append(joinDatas, joinData)
+		}
+	}
+	return joinDatas, nil
+}
+
+func (m *MemoryStorage) RequeueStaleTasks() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, task := range m.tasks {
+		if task.detail.Status != util.TASK_STATUS_RUNNING {
+			continue
+		}
+		server, ok := m.servers[task.claimedBy]
+		if ok && server.Status == util.SERVER_STATUS_ACTIVE && server.Heartbeat >= staleHeartbeat() {
+			continue
+		}
+		task.detail.Status = util.TASK_STATUS_PENDING
+		task.claimedBy = ""
+		count++
+	}
+	return count, nil
+}
+
+func (m *MemoryStorage) SetPause(pause model.Pause, paused bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := model.Pause{Scope: pause.Scope, Name: pause.Name}
+	if !paused {
+		delete(m.pauses, key)
+	} else if _, ok := m.pauses[key]; !ok {
+		m.pauses[key] = time.Now().Unix()
+	}
+	return nil
+}
+
+func (m *MemoryStorage) GetPauses() ([]model.Pause, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pauses := make([]model.Pause, 0, len(m.pauses))
+	for pause, pausedAt := range m.pauses {
+		pause.PausedAt = pausedAt
+		pauses = append(pauses, pause)
+	}
+	sort.Slice(pauses, func(i, j int) bool {
+		if pauses[i].Scope != pauses[j].Scope {
+			return pauses[i].Scope < pauses[j].Scope
+		}
+		return pauses[i].Name < pauses[j].Name
+	})
+	return pauses, nil
+}
+
+func (m *MemoryStorage) SaveTaskLog(taskLog model.TaskLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.logs[taskLog.TaskId] == nil {
+		m.logs[taskLog.TaskId] = make(map[int]model.TaskLog)
+	}
+	m.logs[taskLog.TaskId][taskLog.Attempt] = taskLog
+	return nil
+}
+
+func (m *MemoryStorage) GetTaskLogs(taskId string) ([]model.TaskLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var taskLogs []model.TaskLog
+	for _, taskLog := range m.logs[taskId] {
+		taskLogs = append(taskLogs, taskLog)
+	}
+	sort.Slice(taskLogs, func(i, j int) bool { return taskLogs[i].Attempt < taskLogs[j].Attempt })
+	return taskLogs, nil
+}
+
+// ListTasks returns the tasks matching filter, newest first.
+func (m *MemoryStorage) ListTasks(filter model.TaskFilter) ([]model.TaskDetail, error) {
+	m.mu.Lock()
+	var tasks []model.TaskDetail
+	for _, task := range m.ordered(true) {
+		detail := task.detail
+		queue := detail.Meta.Queue
+		if queue == "" {
+			queue = util.DEFAULT_QUEUE
+		}
+		if (filter.Status != "" && detail.Status != filter.Status) ||
+			(filter.Type != "" && detail.Meta.Type != filter.Type) ||
+			(filter.Queue != "" && queue != filter.Queue) ||
+			(filter.From > 0 && detail.CreatedAt < filter.From) ||
+			(filter.To > 0 && detail.CreatedAt >= filter.To) {
+			continue
+		}
+		tasks = append(tasks, detail)
+	}
+	m.mu.Unlock()
+	limit, offset := listPage(filter)
+	if offset >= len(tasks) {
+		return nil, nil
+	}
+	tasks = tasks[offset:]
+	if len(tasks) > limit {
+		tasks = tasks[:limit]
+	}
+	return tasks, nil
+}
+
+func (m *MemoryStorage) CountTasks() ([]model.TaskCount, error) {
+	m.mu.Lock()
+	counts := make(map[[2]string]int)
+	for _, task := range m.tasks {
+		counts[[2]string{task.detail.Meta.Type, task.detail.Status}]++
+	}
+	m.mu.Unlock()
+	taskCounts := make([]model.TaskCount, 0, len(counts))
+	for key, count := range counts {
+		taskCounts = append(taskCounts, model.TaskCount{Type: key[0], Status: key[1], Count: count})
+	}
+	sort.Slice(taskCounts, func(i, j int) bool {
+		if taskCounts[i].Type != taskCounts[j].Type {
+			return taskCounts[i].Type < taskCounts[j].Type
+		}
+		return taskCounts[i].Status < taskCounts[j].Status
+	})
+	return taskCounts, nil
+}
+
+func (m *MemoryStorage) SaveWorkflow(workflow *model.Workflow) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := uuid.New().String()
+	saved := model.Workflow{Id: id, Name: workflow.Name, Status: util.TASK_STATUS_RUNNING}
+	for _, node := range workflow.Nodes {
+		node.Status = util.WORKFLOW_NODE_WAITING
+		node.TaskId = ""
+		saved.Nodes = append(saved.Nodes, node)
+	}
+	sort.Slice(saved.Nodes, func(i, j int) bool { return saved.Nodes[i].Name < saved.Nodes[j].Name })
+	m.workflows[id] = &saved
+	return id, nil
+}
+
+func (m *MemoryStorage) GetWorkflow(id string) (*model.Workflow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	workflow, ok := m.workflows[id]
+	if !ok {
+		return nil, ErrWorkflowNotFound
+	}
+	copied := *workflow
+	copied.Nodes = append([]model.WorkflowNode(nil), workflow.Nodes...)
+	return &copied, nil
+}
+
+func (m *MemoryStorage) ScheduleWorkflowNode(workflowId string, name string, meta model.TaskMeta) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	workflow, node := m.workflowNode(workflowId, name)
+	if node == nil || workflow.Status != util.TASK_STATUS_RUNNING || node.Status != util.WORKFLOW_NODE_WAITING {
+		return "", false, nil
+	}
+	taskId := WorkflowTaskId(workflowId, name)
+	node.Status = util.WORKFLOW_NODE_SCHEDULED
+	node.TaskId = taskId
+	m.insert(taskId, meta)
+	return taskId, true, nil
+}
+
+func (m *MemoryStorage) ScheduleWorkflowCompensation(workflowId string, name string, meta model.TaskMeta) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	workflow, node := m.workflowNode(workflowId, name)
+	if node == nil || workflow.Status != util.WORKFLOW_COMPENSATING || node.Status != util.TASK_STATUS_COMPLETED {
+		return "", false, nil
+	}
+	taskId := WorkflowCompensationId(workflowId, name)
+	node.Status = util.WORKFLOW_COMPENSATING
+	m.insert(taskId, meta)
+	return taskId, true, nil
+}
+
+func (m *MemoryStorage) UpdateWorkflowNodeStatus(workflowId string, name string, fromStatus []string, status string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, node := m.workflowNode(workflowId, name)
+	if node == nil {
+		return false, nil
+	}
+	for _, from := range fromStatus {
+		if node.Status == from {
+			node.Status = status
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStorage) UpdateWorkflowStatus(id string, fromStatus string, status string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	workflow, ok := m.workflows[id]
+	if !ok || workflow.Status != fromStatus {
+		return false, nil
+	}
+	workflow.Status = status
+	return true, nil
+}
+
+func (m *MemoryStorage) GetActiveWorkflows() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for id, workflow := range m.workflows {
+		if workflow.Status == util.TASK_STATUS_RUNNING || workflow.Status == util.WORKFLOW_COMPENSATING {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// workflowNode finds node name of a workflow. The caller holds mu.
+func (m *MemoryStorage) workflowNode(workflowId string, name string) (*model.Workflow, *model.WorkflowNode) {
+	workflow, ok := m.workflows[workflowId]
+	if !ok {
+		return nil, nil
+	}
+	for i := range workflow.Nodes {
+		if workflow.Nodes[i].Name == name {
+			return workflow, &workflow.Nodes[i]
+		}
+	}
+	return workflow, nil
+}
+
+func (m *MemoryStorage) SaveBatch(batch *model.Batch) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	batch.Id = uuid.New().String()
+	saved := model.Batch{Id: batch.Id, OnComplete: batch.OnComplete, Status: util.TASK_STATUS_RUNNING, Total: len(batch.Tasks)}
+	m.batches[batch.Id] = &saved
+	ids := make([]string, len(batch.Tasks))
+	for i := range batch.Tasks {
+		batch.Tasks[i].BatchId = batch.Id
+		ids[i] = uuid.New().String()
+		m.insert(ids[i], batch.Tasks[i])
+	}
+	return ids, nil
+}
+
+func (m *MemoryStorage) GetBatch(id string) (*model.Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved, ok := m.batches[id]
+	if !ok {
+		return nil, ErrBatchNotFound
+	}
+	batch := model.Batch{Id: id, OnComplete: saved.OnComplete, Status: saved.Status, CallbackId: saved.CallbackId, Total: saved.Total}
+	for _, task := range m.tasks {
+		if task.detail.Meta.BatchId == id {
+			countBatchTasks(&batch, task.detail.Status, 1)
+		}
+	}
+	return &batch, nil
+}
+
+func (m *MemoryStorage) FinishBatch(id string, callback *model.TaskMeta) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	batch, ok := m.batches[id]
+	if !ok || batch.Status != util.TASK_STATUS_RUNNING {
+		return "", false, nil
+	}
+	batch.Status = util.TASK_STATUS_COMPLETED
+	if callback == nil {
+		return "", true, nil
+	}
+	batch.CallbackId = BatchCallbackId(id)
+	m.insert(batch.CallbackId, *callback)
+	return batch.CallbackId, true, nil
+}
+
+func (m *MemoryStorage) GetRunningBatches() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for id, batch := range m.batches {
+		if batch.Status == util.TASK_STATUS_RUNNING {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// filter returns the tasks match keeps, oldest first.
+func (m *MemoryStorage) filter(match func(task *memoryTask) bool) []model.TaskDetail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tasks []model.TaskDetail
+	for _, task := range m.ordered(false) {
+		if match(task) {
+			tasks = append(tasks, task.detail)
+		}
+	}
+	return tasks
+}
+
+// ordered returns the tasks in the order they were added, or the reverse.
+// The caller holds mu.
+func (m *MemoryStorage) ordered(newestFirst bool) []*memoryTask {
+	tasks := make([]*memoryTask, 0, len(m.tasks))
+	for _, task := range m.tasks {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if newestFirst {
+			return tasks[i].seq > tasks[j].seq
+		}
+		return tasks[i].seq < tasks[j].seq
+	})
+	return tasks
+}
+
+func memoryTerminal(status string) bool {
+	return status == util.TASK_STATUS_COMPLETED || status == util.TASK_STATUS_FAILED || status == util.TASK_STATUS_CANCELLED
+}
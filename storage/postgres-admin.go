@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// ListTasks returns the tasks matching filter, newest first.
+func (db *PostgresDbClient) ListTasks(filter model.TaskFilter) ([]model.TaskDetail, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Status != "" {
+		where("status = $%v", filter.Status)
+	}
+	if filter.Type != "" {
+		where("meta->>'type' = $%v", filter.Type)
+	}
+	if filter.Queue != "" {
+		where("COALESCE(meta->>'queue', '"+util.DEFAULT_QUEUE+"') = $%v", filter.Queue)
+	}
+	if filter.From > 0 {
+		where("created_at >= $%v", filter.From)
+	}
+	if filter.To > 0 {
+		where("created_at < $%v", filter.To)
+	}
+	query := "SELECT " + taskDetailColumns + " FROM jobdetail"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	limit, offset := listPage(filter)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id LIMIT %v OFFSET %v", limit, offset)
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tasks []model.TaskDetail
+	for rows.Next() {
+		task, err := scanTaskDetail(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+func (db *PostgresDbClient) CountTasks() ([]model.TaskCount, error) {
+	query := "SELECT COALESCE(meta->>'type', ''), status, COUNT(*) FROM jobdetail GROUP BY 1, 2 ORDER BY 1, 2"
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	rows, err := db.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var counts []model.TaskCount
+	for rows.Next() {
+		var count model.TaskCount
+		if err = rows.Scan(&count.Type, &count.Status, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// ReplayTask puts a failed or cancelled task back to pending as a new
+// attempt due at executionTime.
+func (db *PostgresDbClient) ReplayTask(id string, executionTime int64) (bool, error) {
+	query := `UPDATE jobdetail SET status = $1, error = NULL, claimed_by = NULL, attempt = attempt + 1,
+		meta = jsonb_set(meta, '{executionTime}', to_jsonb($2::BIGINT))
+		WHERE id = $3 AND status IN ($4, $5)`
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	return execAffected(ctx, db.DB, query, util.TASK_STATUS_PENDING, executionTime, id, util.TASK_STATUS_FAILED, util.TASK_STATUS_CANCELLED)
+}
+
+// RescheduleTask moves a pending task to executionTime.
+func (db *PostgresDbClient) RescheduleTask(id string, executionTime int64) (bool, error) {
+	query := `UPDATE jobdetail SET meta = jsonb_set(meta, '{executionTime}', to_jsonb($1::BIGINT))
+		WHERE id = $2 AND status = $3`
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	return execAffected(ctx, db.DB, query, executionTime, id, util.TASK_STATUS_PENDING)
+}
+
+// DeleteTask removes a finished task and its logs.
+func (db *PostgresDbClient) DeleteTask(id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "DELETE FROM jobdetail WHERE id = $1 AND status IN ($2, $3, $4)",
+		id, util.TASK_STATUS_COMPLETED, util.TASK_STATUS_FAILED, util.TASK_STATUS_CANCELLED)
+	if err != nil {
+		return false, err
+	}
+	if count, err := res.RowsAffected(); err != nil || count == 0 {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, "DELETE FROM joblog WHERE task_id = $1", id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func listPage(filter model.TaskFilter) (int, int) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = util.DEFAULT_LIST_LIMIT
+	}
+	if limit > util.MAX_LIST_LIMIT {
+		limit = util.MAX_LIST_LIMIT
+	}
+	offset := filter.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
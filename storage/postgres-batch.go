@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+	"github.com/google/uuid"
+)
+
+// SaveBatch inserts the batch and all its tasks in one transaction. It sets
+// batch.Id and the BatchId of every task, and returns the task ids in the
+// order of batch.Tasks.
+func (db *PostgresDbClient) SaveBatch(batch *model.Batch) ([]string, error) {
+	batch.Id = uuid.New().String()
+	var onCompleteB []byte
+	if batch.OnComplete != nil {
+		var err error
+		if onCompleteB, err = json.Marshal(batch.OnComplete); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	query := "INSERT INTO batch(id, total, on_complete, status) VALUES($1, $2, $3, $4)"
+	if _, err = tx.ExecContext(ctx, query, batch.Id, len(batch.Tasks), onCompleteB, util.TASK_STATUS_RUNNING); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(batch.Tasks))
+	for i := range batch.Tasks {
+		batch.Tasks[i].BatchId = batch.Id
+		metaB, err := json.Marshal(&batch.Tasks[i])
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = uuid.New().String()
+		if _, err = tx.ExecContext(ctx, "INSERT INTO jobdetail(id, meta) VALUES($1, $2)", ids[i], metaB); err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit()
+}
+
+func (db *PostgresDbClient) GetBatch(id string) (*model.Batch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	batch := model.Batch{Id: id}
+	var onComplete []byte
+	query := "SELECT total, on_complete, status, COALESCE(callback_id, '') FROM batch WHERE id = $1"
+	err := db.DB.QueryRowContext(ctx, query, id).Scan(&batch.Total, &onComplete, &batch.Status, &batch.CallbackId)
+	if err == sql.ErrNoRows {
+		return nil, ErrBatchNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if onComplete != nil {
+		batch.OnComplete = &model.TaskMeta{}
+		if err = json.Unmarshal(onComplete, batch.OnComplete); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := db.DB.QueryContext(ctx, "SELECT status, COUNT(*) FROM jobdetail WHERE meta->>'batchId' = $1 GROUP BY status", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var tasks int
+		if err = rows.Scan(&status, &tasks); err != nil {
+			return nil, err
+		}
+		countBatchTasks(&batch, status, tasks)
+	}
+	return &batch, rows.Err()
+}
+
+// FinishBatch marks a running batch completed and adds its callback task
+// in the same transaction. Only one caller gets true back.
+func (db *PostgresDbClient) FinishBatch(id string, callback *model.TaskMeta) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", false, err
+	}
+	defer tx.Rollback()
+	var callbackId sql.NullString
+	if callback != nil {
+		callbackId = sql.NullString{String: BatchCallbackId(id), Valid: true}
+	}
+	query := "UPDATE batch SET status = $1, callback_id = $2 WHERE id = $3 AND status = $4"
+	res, err := tx.ExecContext(ctx, query, util.TASK_STATUS_COMPLETED, callbackId, id, util.TASK_STATUS_RUNNING)
+	if err != nil {
+		return "", false, err
+	}
+	if count, err := res.RowsAffected(); err != nil || count == 0 {
+		return "", false, err
+	}
+	if callback != nil {
+		metaB, err := json.Marshal(callback)
+		if err != nil {
+			return "", false, err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO jobdetail(id, meta) VALUES($1, $2) ON CONFLICT (id) DO NOTHING", callbackId.String, metaB)
+		if err != nil {
+			return "", false, err
+		}
+	}
+	return callbackId.String, true, tx.Commit()
+}
+
+// GetRunningBatches returns the ids of the batches whose callback has not
+// been added yet.
+func (db *PostgresDbClient) GetRunningBatches() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	rows, err := db.DB.QueryContext(ctx, "SELECT id FROM batch WHERE status = $1 ORDER BY id", util.TASK_STATUS_RUNNING)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
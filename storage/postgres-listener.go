@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+	"github.com/lib/pq"
+)
+
+// notifier is the part of a pq.Listener PostgresListener reads.
+type notifier interface {
+	NotificationChannel() <-chan *pq.Notification
+	Close() error
+}
+
+type PostgresListener struct {
+	listener  notifier
+	done      chan int
+	connected atomic.Bool
+	logger    util.Logger
+}
+
+func NewPostgresListener(done chan int, connectionUrl string, options ...ClientOption) (*PostgresListener, error) {
+	pl := &PostgresListener{
+		done:   done,
+		logger: applyOptions(options).logger,
+	}
+	listener := pq.NewListener(connectionUrl, time.Second, time.Minute, pl.onEvent)
+	if err := listener.Listen(util.POSTGRES_TASK_CHANNEL); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	pl.listener = listener
+	pl.connected.Store(true)
+	return pl, nil
+}
+
+func (pl *PostgresListener) onEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+		pl.connected.Store(true)
+	case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+		pl.connected.Store(false)
+		pl.logger.Warn("task notification connection lost", "error", err)
+	}
+}
+
+func (pl *PostgresListener) Connected() bool {
+	return pl.connected.Load()
+}
+
+// Listen forwards every jobdetail notification to events. After a reconnect
+// notifications sent in the meantime are lost, so an event with an empty Id
+// is sent to make the receiver look at the table again.
+func (pl *PostgresListener) Listen(events chan model.TaskEvent) error {
+	defer pl.listener.Close()
+	for {
+		select {
+		case <-pl.done:
+			return nil
+		case notification, ok := <-pl.listener.NotificationChannel():
+			if !ok {
+				return fmt.Errorf("task notification channel closed")
+			}
+			var event model.TaskEvent
+			if notification != nil {
+				if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+					pl.logger.Error("invalid task notification", "error", err)
+					continue
+				}
+			}
+			select {
+			case events <- event:
+			case <-pl.done:
+				return nil
+			}
+		}
+	}
+}
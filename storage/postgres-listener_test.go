@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	"github.com/lib/pq"
+)
+
+// fakeNotifier hands out the notifications a test sends, like pq.Listener.
+type fakeNotifier struct {
+	notifications chan *pq.Notification
+	closed        chan struct{}
+}
+
+func newFakeNotifier() *fakeNotifier {
+	return &fakeNotifier{notifications: make(chan *pq.Notification), closed: make(chan struct{})}
+}
+
+func (n *fakeNotifier) NotificationChannel() <-chan *pq.Notification {
+	return n.notifications
+}
+
+func (n *fakeNotifier) Close() error {
+	close(n.closed)
+	return nil
+}
+
+func TestListenForwardsTaskNotifications(t *testing.T) {
+	notifier := newFakeNotifier()
+	done := make(chan int)
+	pl := &PostgresListener{listener: notifier, done: done, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	events := make(chan model.TaskEvent)
+	listened := make(chan error, 1)
+	go func() { listened <- pl.Listen(events) }()
+
+	receive := func() model.TaskEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+			return model.TaskEvent{}
+		}
+	}
+
+	notifier.notifications <- &pq.Notification{Extra: `{"id": "a", "status": "pending", "type": "email"}`}
+	if event := receive(); event != (model.TaskEvent{Id: "a", Status: "pending", Type: "email"}) {
+		t.Errorf("event = %+v, want a pending email", event)
+	}
+	// A notification that is not JSON is dropped, not forwarded.
+	notifier.notifications <- &pq.Notification{Extra: `not json`}
+	notifier.notifications <- &pq.Notification{Extra: `{"id": "b", "status": "completed"}`}
+	if event := receive(); event.Id != "b" || event.Status != "completed" {
+		t.Errorf("event = %+v, want b completed", event)
+	}
+	// pq sends nil after a reconnect: look at the table again.
+	notifier.notifications <- nil
+	if event := receive(); event != (model.TaskEvent{}) {
+		t.Errorf("event after a reconnect = %+v, want an empty one", event)
+	}
+
+	close(done)
+	select {
+	case err := <-listened:
+		if err != nil {
+			t.Errorf("Listen = %v, want nil once done", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Listen did not stop")
+	}
+	select {
+	case <-notifier.closed:
+	default:
+		t.Error("Listen did not close the connection")
+	}
+}
+
+func TestListenFailsWhenTheChannelCloses(t *testing.T) {
+	notifier := newFakeNotifier()
+	pl := &PostgresListener{listener: notifier, done: make(chan int), logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	close(notifier.notifications)
+	if err := pl.Listen(make(chan model.TaskEvent)); err == nil {
+		t.Error("Listen = nil, want an error when notifications stop")
+	}
+}
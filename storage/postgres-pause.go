@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+func (db *PostgresDbClient) SetPause(pause model.Pause, paused bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	if !paused {
+		_, err := db.DB.ExecContext(ctx, "DELETE FROM jobpause WHERE scope = $1 AND name = $2", pause.Scope, pause.Name)
+		return err
+	}
+	query := "INSERT INTO jobpause(scope, name, paused_at) VALUES($1, $2, $3) ON CONFLICT (scope, name) DO NOTHING"
+	_, err := db.DB.ExecContext(ctx, query, pause.Scope, pause.Name, time.Now().Unix())
+	return err
+}
+
+func (db *PostgresDbClient) GetPauses() ([]model.Pause, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	rows, err := db.DB.QueryContext(ctx, "SELECT scope, name, paused_at FROM jobpause ORDER BY scope, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pauses []model.Pause
+	for rows.Next() {
+		var pause model.Pause
+		if err = rows.Scan(&pause.Scope, &pause.Name, &pause.PausedAt); err != nil {
+			return nil, err
+		}
+		pauses = append(pauses, pause)
+	}
+	return pauses, rows.Err()
+}
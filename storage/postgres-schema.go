@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+var postgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS jobdetail (
+		id TEXT PRIMARY KEY,
+		meta JSONB NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending'
+	)`,
+	`ALTER TABLE jobdetail ADD COLUMN IF NOT EXISTS claimed_by TEXT`,
+	`ALTER TABLE jobdetail ADD COLUMN IF NOT EXISTS error TEXT`,
+	`ALTER TABLE jobdetail ADD COLUMN IF NOT EXISTS result TEXT`,
+	`ALTER TABLE jobdetail ADD COLUMN IF NOT EXISTS attempt INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE jobdetail ADD COLUMN IF NOT EXISTS created_at BIGINT NOT NULL DEFAULT EXTRACT(EPOCH FROM now())::BIGINT`,
+	`CREATE INDEX IF NOT EXISTS jobdetail_status_idx ON jobdetail (status)`,
+	`CREATE INDEX IF NOT EXISTS jobdetail_created_idx ON jobdetail (created_at)`,
+	`CREATE INDEX IF NOT EXISTS jobdetail_queue_idx ON jobdetail ((meta->>'queue')) WHERE status = 'pending'`,
+	`CREATE TABLE IF NOT EXISTS jobconfig (
+		type TEXT PRIMARY KEY,
+		weight INTEGER NOT NULL DEFAULT 1
+	)`,
+	`ALTER TABLE jobconfig ADD COLUMN IF NOT EXISTS rate_limit JSONB`,
+	`CREATE TABLE IF NOT EXISTS jobratelimit (
+		type TEXT PRIMARY KEY,
+		state JSONB NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS jobpause (
+		scope TEXT NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		paused_at BIGINT NOT NULL,
+		PRIMARY KEY (scope, name)
+	)`,
+	`CREATE TABLE IF NOT EXISTS joblog (
+		task_id TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		logs TEXT NOT NULL,
+		created_at BIGINT NOT NULL,
+		PRIMARY KEY (task_id, attempt)
+	)`,
+	`ALTER TABLE joblog ADD COLUMN IF NOT EXISTS error TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS jobservers (
+		serverId TEXT PRIMARY KEY,
+		status INTEGER NOT NULL DEFAULT 1
+	)`,
+	`ALTER TABLE jobservers ADD COLUMN IF NOT EXISTS heartbeat BIGINT NOT NULL DEFAULT 0`,
+	`CREATE TABLE IF NOT EXISTS workflow (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS workflow_node (
+		workflow_id TEXT NOT NULL REFERENCES workflow(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		meta JSONB NOT NULL,
+		depends_on JSONB NOT NULL DEFAULT '[]',
+		min_parents INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL,
+		task_id TEXT,
+		PRIMARY KEY (workflow_id, name)
+	)`,
+	`ALTER TABLE workflow_node ADD COLUMN IF NOT EXISTS compensate JSONB`,
+	`CREATE INDEX IF NOT EXISTS workflow_status_idx ON workflow (status)`,
+	`CREATE TABLE IF NOT EXISTS batch (
+		id TEXT PRIMARY KEY,
+		total INTEGER NOT NULL,
+		on_complete JSONB,
+		status TEXT NOT NULL,
+		callback_id TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS batch_status_idx ON batch (status)`,
+	`CREATE INDEX IF NOT EXISTS jobdetail_batch_idx ON jobdetail ((meta->>'batchId'))`,
+	`CREATE INDEX IF NOT EXISTS jobdetail_parent_idx ON jobdetail ((meta->>'parentId'))`,
+	`CREATE OR REPLACE FUNCTION jobdetail_notify() RETURNS trigger AS $$
+	BEGIN
+		PERFORM pg_notify('` + util.POSTGRES_TASK_CHANNEL + `', json_build_object(
+			'id', NEW.id,
+			'status', NEW.status,
+			'type', NEW.meta->>'type'
+		)::text);
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS jobdetail_notify_trigger ON jobdetail`,
+	`CREATE TRIGGER jobdetail_notify_trigger
+		AFTER INSERT OR UPDATE OF status ON jobdetail
+		FOR EACH ROW EXECUTE FUNCTION jobdetail_notify()`,
+}
+
+// Migrate creates the tables the scheduler uses and the trigger that sends a
+// NOTIFY on every new task and status change. It is safe to run repeatedly.
+func (db *PostgresDbClient) Migrate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, statement := range postgresSchema {
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	db.logger.Debug("postgres schema up to date", "statements", len(postgresSchema))
+	return nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// SaveTaskLog keeps the logs and error of an attempt, replacing those of an
+// earlier run of the same attempt on a server that stopped.
+func (db *PostgresDbClient) SaveTaskLog(taskLog model.TaskLog) error {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	query := `INSERT INTO joblog(task_id, attempt, logs, error, created_at) VALUES($1, $2, $3, $4, $5)
+		ON CONFLICT (task_id, attempt) DO UPDATE SET logs = EXCLUDED.logs, error = EXCLUDED.error, created_at = EXCLUDED.created_at`
+	_, err := db.DB.ExecContext(ctx, query, taskLog.TaskId, taskLog.Attempt, taskLog.Logs, taskLog.Error, taskLog.CreatedAt)
+	return err
+}
+
+func (db *PostgresDbClient) GetTaskLogs(taskId string) ([]model.TaskLog, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	rows, err := db.DB.QueryContext(ctx, "SELECT task_id, attempt, logs, error, created_at FROM joblog WHERE task_id = $1 ORDER BY attempt", taskId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var taskLogs []model.TaskLog
+	for rows.Next() {
+		var taskLog model.TaskLog
+		if err = rows.Scan(&taskLog.TaskId, &taskLog.Attempt, &taskLog.Logs, &taskLog.Error, &taskLog.CreatedAt); err != nil {
+			return nil, err
+		}
+		taskLogs = append(taskLogs, taskLog)
+	}
+	return taskLogs, rows.Err()
+}
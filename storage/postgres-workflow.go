@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func (db *PostgresDbClient) SaveWorkflow(workflow *model.Workflow) (string, error) {
+	id := uuid.New().String()
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "INSERT INTO workflow(id, name, status) VALUES($1, $2, $3)", id, workflow.Name, util.TASK_STATUS_RUNNING)
+	if err != nil {
+		return "", err
+	}
+	query := "INSERT INTO workflow_node(workflow_id, name, meta, depends_on, min_parents, compensate, status) VALUES($1, $2, $3, $4, $5, $6, $7)"
+	for _, node := range workflow.Nodes {
+		metaB, err := json.Marshal(node.Meta)
+		if err != nil {
+			return "", err
+		}
+		dependsOn := node.DependsOn
+		if dependsOn == nil {
+			dependsOn = []string{}
+		}
+		dependsOnB, err := json.Marshal(dependsOn)
+		if err != nil {
+			return "", err
+		}
+		var compensateB []byte
+		if node.Compensate != nil {
+			if compensateB, err = json.Marshal(node.Compensate); err != nil {
+				return "", err
+			}
+		}
+		_, err = tx.ExecContext(ctx, query, id, node.Name, metaB, dependsOnB, node.MinParents, compensateB, util.WORKFLOW_NODE_WAITING)
+		if err != nil {
+			return "", err
+		}
+	}
+	return id, tx.Commit()
+}
+
+func (db *PostgresDbClient) GetWorkflow(id string) (*model.Workflow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	var workflow model.Workflow
+	err := db.DB.QueryRowContext(ctx, "SELECT id, name, status FROM workflow WHERE id = $1", id).Scan(&workflow.Id, &workflow.Name, &workflow.Status)
+	if err == sql.ErrNoRows {
+		return nil, ErrWorkflowNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	query := "SELECT name, meta, depends_on, min_parents, compensate, status, COALESCE(task_id, '') FROM workflow_node WHERE workflow_id = $1 ORDER BY name"
+	rows, err := db.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var node model.WorkflowNode
+		var dependsOn, compensate []byte
+		if err = rows.Scan(&node.Name, &node.Meta, &dependsOn, &node.MinParents, &compensate, &node.Status, &node.TaskId); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(dependsOn, &node.DependsOn); err != nil {
+			return nil, err
+		}
+		if compensate != nil {
+			node.Compensate = &model.TaskMeta{}
+			if err = json.Unmarshal(compensate, node.Compensate); err != nil {
+				return nil, err
+			}
+		}
+		workflow.Nodes = append(workflow.Nodes, node)
+	}
+	return &workflow, rows.Err()
+}
+
+// ScheduleWorkflowNode moves a waiting node of a running workflow to
+// scheduled and inserts its task. Only one caller gets true back, however
+// many servers see the node become ready at the same time.
+func (db *PostgresDbClient) ScheduleWorkflowNode(workflowId string, name string, meta model.TaskMeta) (string, bool, error) {
+	taskId := WorkflowTaskId(workflowId, name)
+	metaB, err := json.Marshal(meta)
+	if err != nil {
+		return "", false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	query := `UPDATE workflow_node SET status = $1, task_id = $2
+		WHERE workflow_id = $3 AND name = $4 AND status = $5
+		AND EXISTS (SELECT 1 FROM workflow WHERE id = $3 AND status = $6)`
+	scheduled, err := scheduleNodeTask(ctx, db.DB, query, taskId, metaB, util.WORKFLOW_NODE_SCHEDULED, taskId, workflowId, name, util.WORKFLOW_NODE_WAITING, util.TASK_STATUS_RUNNING)
+	if err != nil || !scheduled {
+		return "", false, err
+	}
+	return taskId, true, nil
+}
+
+// ScheduleWorkflowCompensation moves a completed node of a compensating
+// workflow to compensating and inserts the task that undoes it.
+func (db *PostgresDbClient) ScheduleWorkflowCompensation(workflowId string, name string, meta model.TaskMeta) (string, bool, error) {
+	taskId := WorkflowCompensationId(workflowId, name)
+	metaB, err := json.Marshal(meta)
+	if err != nil {
+		return "", false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	query := `UPDATE workflow_node SET status = $1
+		WHERE workflow_id = $2 AND name = $3 AND status = $4
+		AND EXISTS (SELECT 1 FROM workflow WHERE id = $2 AND status = $1)`
+	scheduled, err := scheduleNodeTask(ctx, db.DB, query, taskId, metaB, util.WORKFLOW_COMPENSATING, workflowId, name, util.TASK_STATUS_COMPLETED)
+	if err != nil || !scheduled {
+		return "", false, err
+	}
+	return taskId, true, nil
+}
+
+// scheduleNodeTask runs the conditional node update and, when it applied,
+// inserts the node's task in the same transaction.
+func scheduleNodeTask(ctx context.Context, db *sql.DB, query string, taskId string, metaB []byte, args ...interface{}) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	if count, err := res.RowsAffected(); err != nil || count == 0 {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO jobdetail(id, meta) VALUES($1, $2) ON CONFLICT (id) DO NOTHING", taskId, metaB)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (db *PostgresDbClient) UpdateWorkflowNodeStatus(workflowId string, name string, fromStatus []string, status string) (bool, error) {
+	query := "UPDATE workflow_node SET status = $1 WHERE workflow_id = $2 AND name = $3 AND status = ANY($4)"
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	return execAffected(ctx, db.DB, query, status, workflowId, name, pq.Array(fromStatus))
+}
+
+func (db *PostgresDbClient) UpdateWorkflowStatus(id string, fromStatus string, status string) (bool, error) {
+	query := "UPDATE workflow SET status = $1 WHERE id = $2 AND status = $3"
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	return execAffected(ctx, db.DB, query, status, id, fromStatus)
+}
+
+// GetActiveWorkflows returns the ids of the workflows still running or
+// compensating.
+func (db *PostgresDbClient) GetActiveWorkflows() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	rows, err := db.DB.QueryContext(ctx, "SELECT id FROM workflow WHERE status IN ($1, $2) ORDER BY id", util.TASK_STATUS_RUNNING, util.WORKFLOW_COMPENSATING)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func execAffected(ctx context.Context, db *sql.DB, query string, args ...interface{}) (bool, error) {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -3,20 +3,22 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"time"
 
 	"github.com/amitiwary999/task-scheduler/model"
 	util "github.com/amitiwary999/task-scheduler/util"
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type PostgresDbClient struct {
-	DB *sql.DB
+	DB     *sql.DB
+	logger util.Logger
 }
 
-func NewPostgresClient(connectionUrl string, poolLimit int16) (*PostgresDbClient, error) {
+func NewPostgresClient(connectionUrl string, poolLimit int16, options ...ClientOption) (*PostgresDbClient, error) {
 	db, err := sql.Open("postgres", connectionUrl)
 	if err != nil {
 		return nil, err
@@ -31,25 +33,79 @@ func NewPostgresClient(connectionUrl string, poolLimit int16) (*PostgresDbClient
 	}
 
 	return &PostgresDbClient{
-		DB: db,
+		DB:     db,
+		logger: applyOptions(options).logger,
 	}, nil
 }
 
 func (db *PostgresDbClient) GetTaskConfig() ([]model.TaskWeight, error) {
-	query := `SELECT type, weight FROM jobconfig`
+	query := `SELECT type, weight, rate_limit FROM jobconfig`
 	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
 	defer cancel()
 	rows, err := db.DB.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	var taskWeights []model.TaskWeight
 	for rows.Next() {
 		var taskWeight model.TaskWeight
-		rows.Scan(&taskWeight.Type, &taskWeight.Weight)
+		var rateLimit []byte
+		if err = rows.Scan(&taskWeight.Type, &taskWeight.Weight, &rateLimit); err != nil {
+			return nil, err
+		}
+		if rateLimit != nil {
+			taskWeight.RateLimit = &model.RateLimit{}
+			if err = json.Unmarshal(rateLimit, taskWeight.RateLimit); err != nil {
+				return nil, err
+			}
+		}
 		taskWeights = append(taskWeights, taskWeight)
 	}
-	return taskWeights, nil
+	return taskWeights, rows.Err()
+}
+
+// TakeRateToken spends one start of the shared limit of taskType. The row
+// lock serialises servers taking from the same limit.
+func (db *PostgresDbClient) TakeRateToken(taskType string, limit model.RateLimit) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "INSERT INTO jobratelimit(type, state) VALUES($1, '{}') ON CONFLICT (type) DO NOTHING", taskType)
+	if err != nil {
+		return 0, err
+	}
+	var stateB []byte
+	if err = tx.QueryRowContext(ctx, "SELECT state FROM jobratelimit WHERE type = $1 FOR UPDATE", taskType).Scan(&stateB); err != nil {
+		return 0, err
+	}
+	var state util.RateState
+	if err = json.Unmarshal(stateB, &state); err != nil {
+		return 0, err
+	}
+	wait := state.Take(limit, time.Now())
+	if stateB, err = json.Marshal(state); err != nil {
+		return 0, err
+	}
+	if _, err = tx.ExecContext(ctx, "UPDATE jobratelimit SET state = $1 WHERE type = $2", stateB, taskType); err != nil {
+		return 0, err
+	}
+	return wait, tx.Commit()
+}
+
+// DeferTask hands a claimed task back as pending, to be claimed again at
+// executionTime. Unlike RetryTask it does not count an attempt.
+func (db *PostgresDbClient) DeferTask(id string, executionTime int64) (bool, error) {
+	query := `UPDATE jobdetail SET status = $1, claimed_by = NULL,
+		meta = jsonb_set(meta, '{executionTime}', to_jsonb($2::BIGINT))
+		WHERE id = $3 AND status = $4`
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	return execAffected(ctx, db.DB, query, util.TASK_STATUS_PENDING, executionTime, id, util.TASK_STATUS_RUNNING)
 }
 
 func (db *PostgresDbClient) SaveTask(meta *model.TaskMeta) (string, error) {
@@ -68,44 +124,239 @@ func (db *PostgresDbClient) SaveTask(meta *model.TaskMeta) (string, error) {
 	return id, nil
 }
 
-func (db *PostgresDbClient) UpdateTaskComplete(id string) error {
-	query := "UPDATE jobdetail SET status = $1 WHERE id = $2"
+func (db *PostgresDbClient) GetTask(id string) (*model.TaskDetail, error) {
+	query := "SELECT " + taskDetailColumns + " FROM jobdetail WHERE id = $1"
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	task, err := scanTaskDetail(db.DB.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// ClaimTask takes a pending task that is due. A task rescheduled later is
+// not due for a server whose delay queue still holds its old time.
+func (db *PostgresDbClient) ClaimTask(id string, serverId string) (bool, error) {
+	query := `UPDATE jobdetail SET status = $1, claimed_by = $2 WHERE id = $3 AND status = $4
+		AND COALESCE((meta->>'executionTime')::BIGINT, 0) <= $5`
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	return execAffected(ctx, db.DB, query, util.TASK_STATUS_RUNNING, serverId, id, util.TASK_STATUS_PENDING, time.Now().Unix()+util.CLAIM_CLOCK_SKEW)
+}
+
+// CancelTask cancels a task that has not finished yet. A running task keeps
+// running until its server sees the change; its outcome is then dropped.
+func (db *PostgresDbClient) CancelTask(id string) (bool, error) {
+	query := "UPDATE jobdetail SET status = $1 WHERE id = $2 AND status IN ($3, $4)"
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	return execAffected(ctx, db.DB, query, util.TASK_STATUS_CANCELLED, id, util.TASK_STATUS_PENDING, util.TASK_STATUS_RUNNING)
+}
+
+func (db *PostgresDbClient) GetChildTasks(parentId string) ([]model.TaskDetail, error) {
+	query := "SELECT " + taskDetailColumns + " FROM jobdetail WHERE meta->>'parentId' = $1"
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	rows, err := db.DB.QueryContext(ctx, query, parentId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tasks []model.TaskDetail
+	for rows.Next() {
+		task, err := scanTaskDetail(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// ClaimPendingTasks claims up to limit due tasks of queue whose type is in
+// types. Tasks without a queue, or with a queue not in known, belong to
+// the default queue.
+func (db *PostgresDbClient) ClaimPendingTasks(serverId string, queue string, known []string, types []string, limit int) ([]model.TaskDetail, error) {
+	query := `UPDATE jobdetail SET status = $1, claimed_by = $2
+		WHERE id IN (
+			SELECT id FROM jobdetail
+			WHERE status = $3 AND meta->>'type' = ANY($4)
+			AND (CASE WHEN meta->>'queue' = ANY($9) THEN meta->>'queue' ELSE $7 END) = $8
+			AND COALESCE((meta->>'executionTime')::BIGINT, 0) <= $5
+			LIMIT $6
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + taskDetailColumns
 	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
 	defer cancel()
-	_, err := db.DB.ExecContext(ctx, query, "completed", id)
+	rows, err := db.DB.QueryContext(ctx, query, util.TASK_STATUS_RUNNING, serverId, util.TASK_STATUS_PENDING, pq.Array(types), time.Now().Unix(), limit, util.DEFAULT_QUEUE, queue, pq.Array(known))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tasks []model.TaskDetail
+	for rows.Next() {
+		task, err := scanTaskDetail(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// UpdateTaskComplete stores the result and inserts the successor tasks in
+// one transaction, so a chain never loses a step to a crash. Successor ids
+// come from the parent id, so completing the same task twice adds nothing.
+// It returns false when the task was no longer pending or running, having
+// been cancelled or finished elsewhere.
+func (db *PostgresDbClient) UpdateTaskComplete(id string, result []byte, next []model.TaskMeta) ([]string, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+	query := "UPDATE jobdetail SET status = $1, result = $2 WHERE id = $3 AND status IN ($4, $5)"
+	res, err := tx.ExecContext(ctx, query, util.TASK_STATUS_COMPLETED, encodeResult(result), id, util.TASK_STATUS_PENDING, util.TASK_STATUS_RUNNING)
+	if err != nil {
+		return nil, false, err
+	}
+	if count, err := res.RowsAffected(); err != nil || count == 0 {
+		return nil, false, err
+	}
+	nextIds := make([]string, 0, len(next))
+	for i := range next {
+		nextId := SuccessorId(id, i)
+		metaB, err := json.Marshal(&next[i])
+		if err != nil {
+			return nil, false, err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO jobdetail(id, meta) VALUES($1, $2) ON CONFLICT (id) DO NOTHING", nextId, metaB)
+		if err != nil {
+			return nil, false, err
+		}
+		nextIds = append(nextIds, nextId)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return nextIds, true, nil
+}
+
+// UpdateTaskFailed returns false when the task was no longer pending or
+// running.
+func (db *PostgresDbClient) UpdateTaskFailed(id string, reason string) (bool, error) {
+	query := "UPDATE jobdetail SET status = $1, error = $2 WHERE id = $3 AND status IN ($4, $5)"
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	return execAffected(ctx, db.DB, query, util.TASK_STATUS_FAILED, reason, id, util.TASK_STATUS_PENDING, util.TASK_STATUS_RUNNING)
+}
+
+// RetryTask puts a failed task back to pending with one more attempt, to
+// run again at executionTime.
+func (db *PostgresDbClient) RetryTask(id string, reason string, executionTime int64) (bool, error) {
+	query := `UPDATE jobdetail SET status = $1, error = $2, claimed_by = NULL, attempt = attempt + 1,
+		meta = jsonb_set(meta, '{executionTime}', to_jsonb($3::BIGINT))
+		WHERE id = $4 AND status IN ($1, $5)`
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	return execAffected(ctx, db.DB, query, util.TASK_STATUS_PENDING, reason, executionTime, id, util.TASK_STATUS_RUNNING)
+}
+
+func (db *PostgresDbClient) UpdateServerStatus(serverId string, status int) error {
+	query := `INSERT INTO jobservers(serverId, status, heartbeat) VALUES($1, $2, $3)
+		ON CONFLICT (serverId) DO UPDATE SET status = EXCLUDED.status, heartbeat = EXCLUDED.heartbeat`
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	_, err := db.DB.ExecContext(ctx, query, serverId, status, time.Now().Unix())
 	return err
 }
 
+// RequeueStaleTasks puts tasks claimed by servers that stopped sending
+// heartbeats back to pending, so another server picks them up.
+func (db *PostgresDbClient) RequeueStaleTasks() (int, error) {
+	query := `UPDATE jobdetail SET status = $1, claimed_by = NULL
+		WHERE status = $2 AND (claimed_by IS NULL OR claimed_by NOT IN (
+			SELECT serverId FROM jobservers WHERE status = $3 AND heartbeat >= $4
+		))`
+	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
+	defer cancel()
+	res, err := db.DB.ExecContext(ctx, query, util.TASK_STATUS_PENDING, util.TASK_STATUS_RUNNING, util.SERVER_STATUS_ACTIVE, staleHeartbeat())
+	if err != nil {
+		return 0, err
+	}
+	count, err := res.RowsAffected()
+	return int(count), err
+}
+
 func (db *PostgresDbClient) GetPendingTask() ([]model.PendingTask, error) {
 	query := "SELECT id, meta FROM jobdetail WHERE status = $1"
 	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
 	defer cancel()
-	rows, err := db.DB.QueryContext(ctx, query, "pending")
+	rows, err := db.DB.QueryContext(ctx, query, util.TASK_STATUS_PENDING)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	var pendingTasks []model.PendingTask
 	for rows.Next() {
 		var pendingTask model.PendingTask
-		rows.Scan(&pendingTask.Id, &pendingTask.Meta)
+		if err = rows.Scan(&pendingTask.Id, &pendingTask.Meta); err != nil {
+			return nil, err
+		}
 		pendingTasks = append(pendingTasks, pendingTask)
 	}
-	return pendingTasks, nil
+	return pendingTasks, rows.Err()
 }
 
 func (db *PostgresDbClient) GetAllUsedServer() ([]model.JoinData, error) {
-	query := "SELECT serverId, status FROM jobservers WHERE status = 1"
+	query := "SELECT serverId, status, heartbeat FROM jobservers WHERE status = $1 AND heartbeat >= $2"
 	ctx, cancel := context.WithTimeout(context.Background(), util.POSTGRES_QUERY_TIMEOUT*time.Second)
 	defer cancel()
-	rows, err := db.DB.QueryContext(ctx, query)
+	rows, err := db.DB.QueryContext(ctx, query, util.SERVER_STATUS_ACTIVE, staleHeartbeat())
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	var joinDatas []model.JoinData
 	for rows.Next() {
 		var joinData model.JoinData
-		rows.Scan(&joinData.ServerId, &joinData.Status)
+		if err = rows.Scan(&joinData.ServerId, &joinData.Status, &joinData.Heartbeat); err != nil {
+			return nil, err
+		}
 		joinDatas = append(joinDatas, joinData)
 	}
-	return joinDatas, nil
+	return joinDatas, rows.Err()
+}
+
+const taskDetailColumns = "id, meta, status, COALESCE(error, ''), COALESCE(result, ''), attempt, created_at"
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTaskDetail(row rowScanner) (model.TaskDetail, error) {
+	var task model.TaskDetail
+	var result string
+	err := row.Scan(&task.Id, &task.Meta, &task.Status, &task.Error, &result, &task.Attempt, &task.CreatedAt)
+	if err != nil {
+		return task, err
+	}
+	if result != "" {
+		task.Result, err = base64.StdEncoding.DecodeString(result)
+	}
+	return task, err
+}
+
+func encodeResult(result []byte) sql.NullString {
+	if result == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: base64.StdEncoding.EncodeToString(result), Valid: true}
 }
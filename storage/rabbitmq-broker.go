@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+type RabbitBroker struct {
+	producer *Producer
+	consumer *Consumer
+}
+
+func NewRabbitBroker(done chan int, rabbitmqUrl string, consumerConfig util.ConsumerConfig, options ...ClientOption) (*RabbitBroker, error) {
+	producer, err := NewProducer(done, util.RABBITMQ_TASK_QUEUE, rabbitmqUrl, options...)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := NewConsumerWithConfig(done, rabbitmqUrl, consumerConfig, options...)
+	if err != nil {
+		producer.Shutdown()
+		return nil, err
+	}
+	return &RabbitBroker{
+		producer: producer,
+		consumer: consumer,
+	}, nil
+}
+
+func (r *RabbitBroker) PublishTask(msg model.TaskMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return r.producer.PublishWithHeaders(msg.ServerId, body, taskHeaders(msg))
+}
+
+func (r *RabbitBroker) ConsumeTasks(serverId string, deliveries chan model.Delivery) error {
+	queueName := fmt.Sprintf("%v.%v", util.RABBITMQ_TASK_QUEUE, serverId)
+	return r.consumer.Consume(deliveries, queueName, serverId, util.TaskConsumerTag)
+}
+
+func (r *RabbitBroker) PublishTaskComplete(msg model.TaskMessage) error {
+	return r.publishJson(util.RABBITMQ_COMPLETE_TASK_EXCHANGE_KEY, msg)
+}
+
+func (r *RabbitBroker) ConsumeTaskComplete(serverId string, deliveries chan model.Delivery) error {
+	queueName := fmt.Sprintf("%v.%v", util.RABBITMQ_TASK_COMPLETE_QUEUE, serverId)
+	return r.consumer.ConsumeBroadcast(deliveries, queueName, util.RABBITMQ_COMPLETE_TASK_EXCHANGE_KEY, util.CompleteTaskConsumerTag)
+}
+
+func (r *RabbitBroker) PublishMembership(joinData model.JoinData) error {
+	return r.publishJson(util.RABBITMQ_SERVER_JOIN_EXCHANGE_KEY, joinData)
+}
+
+func (r *RabbitBroker) ConsumeMembership(serverId string, deliveries chan model.Delivery) error {
+	queueName := fmt.Sprintf("%v.%v", util.SERVER_JOIN_RABBITMQ_QUEUE, serverId)
+	return r.consumer.ConsumeBroadcast(deliveries, queueName, util.RABBITMQ_SERVER_JOIN_EXCHANGE_KEY, util.NewServerJoinTag)
+}
+
+func (r *RabbitBroker) Shutdown() {
+	r.consumer.Shutdown()
+	r.producer.Shutdown()
+}
+
+func (r *RabbitBroker) publishJson(routingKey string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.producer.Publish(routingKey, body)
+}
+
+func taskHeaders(msg model.TaskMessage) map[string]string {
+	if msg.TraceParent == "" {
+		return nil
+	}
+	return map[string]string{util.TRACE_PARENT_HEADER: msg.TraceParent}
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+func (s *SupabaseClient) ListTasks(filter model.TaskFilter) ([]model.TaskDetail, error) {
+	limit, offset := listPage(filter)
+	params := []string{fmt.Sprintf("select=%v", supabaseTaskColumns)}
+	if filter.Status != "" {
+		params = append(params, "status=eq."+url.QueryEscape(filter.Status))
+	}
+	if filter.Type != "" {
+		params = append(params, "meta->>type=eq."+url.QueryEscape(filter.Type))
+	}
+	if filter.Queue == util.DEFAULT_QUEUE {
+		params = append(params, "or="+url.QueryEscape(fmt.Sprintf("(meta->>queue.is.null,meta->>queue.eq.%q)", filter.Queue)))
+	} else if filter.Queue != "" {
+		params = append(params, "meta->>queue=eq."+url.QueryEscape(filter.Queue))
+	}
+	if filter.From > 0 {
+		params = append(params, fmt.Sprintf("created_at=gte.%v", filter.From))
+	}
+	if filter.To > 0 {
+		params = append(params, fmt.Sprintf("created_at=lt.%v", filter.To))
+	}
+	params = append(params, "order=created_at.desc,id", fmt.Sprintf("limit=%v", limit), fmt.Sprintf("offset=%v", offset))
+	var tasks []model.TaskDetail
+	err := s.request(http.MethodGet, util.SUPABASE_JOBDETAIL, strings.Join(params, "&"), nil, "", &tasks)
+	return tasks, err
+}
+
+// CountTasks pages through the type and status of every task, since
+// PostgREST has no GROUP BY.
+func (s *SupabaseClient) CountTasks() ([]model.TaskCount, error) {
+	counts := make(map[model.TaskCount]int)
+	for offset := 0; ; offset += util.SUPABASE_PAGE_SIZE {
+		var page []model.TaskCount
+		query := fmt.Sprintf("select=type:meta->>type,status&order=id&limit=%v&offset=%v", util.SUPABASE_PAGE_SIZE, offset)
+		if err := s.request(http.MethodGet, util.SUPABASE_JOBDETAIL, query, nil, "", &page); err != nil {
+			return nil, err
+		}
+		for _, row := range page {
+			counts[model.TaskCount{Type: row.Type, Status: row.Status}]++
+		}
+		if len(page) < util.SUPABASE_PAGE_SIZE {
+			break
+		}
+	}
+	result := make([]model.TaskCount, 0, len(counts))
+	for key, count := range counts {
+		key.Count = count
+		result = append(result, key)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Type != result[j].Type {
+			return result[i].Type < result[j].Type
+		}
+		return result[i].Status < result[j].Status
+	})
+	return result, nil
+}
+
+func (s *SupabaseClient) ReplayTask(id string, executionTime int64) (bool, error) {
+	task, err := s.GetTask(id)
+	if err != nil {
+		return false, err
+	}
+	meta := task.Meta
+	meta.ExecutionTime = executionTime
+	update := map[string]interface{}{
+		"status":     util.TASK_STATUS_PENDING,
+		"error":      nil,
+		"claimed_by": nil,
+		"attempt":    task.Attempt + 1,
+		"meta":       meta,
+	}
+	var replayed []model.TaskDetail
+	query := fmt.Sprintf("id=eq.%v&attempt=eq.%v&status=in.(%v,%v)&select=id", url.QueryEscape(id), task.Attempt, util.TASK_STATUS_FAILED, util.TASK_STATUS_CANCELLED)
+	err = s.request(http.MethodPatch, util.SUPABASE_JOBDETAIL, query, update, "return=representation", &replayed)
+	return len(replayed) > 0, err
+}
+
+func (s *SupabaseClient) RescheduleTask(id string, executionTime int64) (bool, error) {
+	task, err := s.GetTask(id)
+	if err != nil {
+		return false, err
+	}
+	meta := task.Meta
+	meta.ExecutionTime = executionTime
+	update := map[string]interface{}{
+		"meta": meta,
+	}
+	var rescheduled []model.TaskDetail
+	query := fmt.Sprintf("id=eq.%v&status=eq.%v&select=id", url.QueryEscape(id), util.TASK_STATUS_PENDING)
+	err = s.request(http.MethodPatch, util.SUPABASE_JOBDETAIL, query, update, "return=representation", &rescheduled)
+	return len(rescheduled) > 0, err
+}
+
+func (s *SupabaseClient) DeleteTask(id string) (bool, error) {
+	var deleted []model.TaskDetail
+	query := fmt.Sprintf("id=eq.%v&status=in.(%v,%v,%v)&select=id", url.QueryEscape(id), util.TASK_STATUS_COMPLETED, util.TASK_STATUS_FAILED, util.TASK_STATUS_CANCELLED)
+	if err := s.request(http.MethodDelete, util.SUPABASE_JOBDETAIL, query, nil, "return=representation", &deleted); err != nil {
+		return false, err
+	}
+	if len(deleted) == 0 {
+		return false, nil
+	}
+	query = fmt.Sprintf("taskId=eq.%v", url.QueryEscape(id))
+	return true, s.request(http.MethodDelete, util.SUPABASE_TASK_LOG, query, nil, "return=minimal", nil)
+}
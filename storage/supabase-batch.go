@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+	"github.com/google/uuid"
+)
+
+type supabaseBatch struct {
+	Id         string          `json:"id"`
+	Total      int             `json:"total"`
+	OnComplete *model.TaskMeta `json:"on_complete,omitempty"`
+	Status     string          `json:"status"`
+	CallbackId *string         `json:"callback_id,omitempty"`
+}
+
+// SaveBatch inserts the tasks before the batch row, so a batch is never
+// seen with fewer tasks than its total.
+func (s *SupabaseClient) SaveBatch(batch *model.Batch) ([]string, error) {
+	batch.Id = uuid.New().String()
+	ids := make([]string, len(batch.Tasks))
+	rows := make([]model.CompleteTask, len(batch.Tasks))
+	for i := range batch.Tasks {
+		batch.Tasks[i].BatchId = batch.Id
+		ids[i] = uuid.New().String()
+		rows[i] = model.CompleteTask{Id: ids[i], Meta: batch.Tasks[i]}
+	}
+	if err := s.request(http.MethodPost, util.SUPABASE_JOBDETAIL, "", rows, "return=minimal", nil); err != nil {
+		return nil, err
+	}
+	row := supabaseBatch{
+		Id:         batch.Id,
+		Total:      len(batch.Tasks),
+		OnComplete: batch.OnComplete,
+		Status:     util.TASK_STATUS_RUNNING,
+	}
+	if err := s.request(http.MethodPost, util.SUPABASE_BATCH, "", row, "return=minimal", nil); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (s *SupabaseClient) GetBatch(id string) (*model.Batch, error) {
+	var batches []supabaseBatch
+	query := fmt.Sprintf("id=eq.%v", url.QueryEscape(id))
+	if err := s.request(http.MethodGet, util.SUPABASE_BATCH, query, nil, "", &batches); err != nil {
+		return nil, err
+	}
+	if len(batches) == 0 {
+		return nil, ErrBatchNotFound
+	}
+	batch := &model.Batch{
+		Id:         batches[0].Id,
+		Total:      batches[0].Total,
+		OnComplete: batches[0].OnComplete,
+		Status:     batches[0].Status,
+	}
+	if batches[0].CallbackId != nil {
+		batch.CallbackId = *batches[0].CallbackId
+	}
+	for offset := 0; ; offset += util.SUPABASE_PAGE_SIZE {
+		var page []model.TaskStatus
+		query := fmt.Sprintf("meta->>batchId=eq.%v&select=status&order=id&limit=%v&offset=%v", url.QueryEscape(id), util.SUPABASE_PAGE_SIZE, offset)
+		if err := s.request(http.MethodGet, util.SUPABASE_JOBDETAIL, query, nil, "", &page); err != nil {
+			return nil, err
+		}
+		for _, task := range page {
+			countBatchTasks(batch, task.Status, 1)
+		}
+		if len(page) < util.SUPABASE_PAGE_SIZE {
+			return batch, nil
+		}
+	}
+}
+
+// FinishBatch inserts the callback task before flipping the batch; the
+// callback id comes from the batch id, so a second insert is ignored and
+// only the caller whose conditional update applied dispatches it.
+func (s *SupabaseClient) FinishBatch(id string, callback *model.TaskMeta) (string, bool, error) {
+	update := map[string]interface{}{
+		"status": util.TASK_STATUS_COMPLETED,
+	}
+	callbackId := ""
+	if callback != nil {
+		callbackId = BatchCallbackId(id)
+		row := model.CompleteTask{Id: callbackId, Meta: *callback}
+		if err := s.request(http.MethodPost, util.SUPABASE_JOBDETAIL, "", row, "resolution=ignore-duplicates,return=minimal", nil); err != nil {
+			return "", false, err
+		}
+		update["callback_id"] = callbackId
+	}
+	var finished []supabaseBatch
+	query := fmt.Sprintf("id=eq.%v&status=eq.%v", url.QueryEscape(id), util.TASK_STATUS_RUNNING)
+	if err := s.request(http.MethodPatch, util.SUPABASE_BATCH, query, update, "return=representation", &finished); err != nil {
+		return "", false, err
+	}
+	return callbackId, len(finished) > 0, nil
+}
+
+// GetRunningBatches returns the ids of the batches whose callback has not
+// been added yet.
+func (s *SupabaseClient) GetRunningBatches() ([]string, error) {
+	var ids []string
+	for offset := 0; ; offset += util.SUPABASE_PAGE_SIZE {
+		var page []supabaseBatch
+		query := fmt.Sprintf("status=eq.%v&select=id&order=id&limit=%v&offset=%v", util.TASK_STATUS_RUNNING, util.SUPABASE_PAGE_SIZE, offset)
+		if err := s.request(http.MethodGet, util.SUPABASE_BATCH, query, nil, "", &page); err != nil {
+			return nil, err
+		}
+		for _, batch := range page {
+			ids = append(ids, batch.Id)
+		}
+		if len(page) < util.SUPABASE_PAGE_SIZE {
+			return ids, nil
+		}
+	}
+}
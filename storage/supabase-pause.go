@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+func (s *SupabaseClient) SetPause(pause model.Pause, paused bool) error {
+	if !paused {
+		query := fmt.Sprintf("scope=eq.%v&name=eq.%v", url.QueryEscape(pause.Scope), url.QueryEscape(pause.Name))
+		return s.request(http.MethodDelete, util.SUPABASE_PAUSE, query, nil, "return=minimal", nil)
+	}
+	pause.PausedAt = time.Now().Unix()
+	return s.request(http.MethodPost, util.SUPABASE_PAUSE, "", pause, "resolution=ignore-duplicates,return=minimal", nil)
+}
+
+func (s *SupabaseClient) GetPauses() ([]model.Pause, error) {
+	var pauses []model.Pause
+	err := s.request(http.MethodGet, util.SUPABASE_PAUSE, "select=scope,name,pausedAt&order=scope,name", nil, "", &pauses)
+	return pauses, err
+}
@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+func (s *SupabaseClient) SaveTaskLog(taskLog model.TaskLog) error {
+	return s.request(http.MethodPost, util.SUPABASE_TASK_LOG, "on_conflict=taskId,attempt", taskLog, "resolution=merge-duplicates,return=minimal", nil)
+}
+
+func (s *SupabaseClient) GetTaskLogs(taskId string) ([]model.TaskLog, error) {
+	var taskLogs []model.TaskLog
+	query := fmt.Sprintf("taskId=eq.%v&select=taskId,attempt,logs,error,createdAt&order=attempt", url.QueryEscape(taskId))
+	err := s.request(http.MethodGet, util.SUPABASE_TASK_LOG, query, nil, "", &taskLogs)
+	return taskLogs, err
+}
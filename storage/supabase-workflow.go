@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+	"github.com/google/uuid"
+)
+
+type supabaseWorkflow struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+type supabaseWorkflowNode struct {
+	WorkflowId string          `json:"workflow_id"`
+	Name       string          `json:"name"`
+	Meta       model.TaskMeta  `json:"meta"`
+	DependsOn  []string        `json:"depends_on"`
+	MinParents int             `json:"min_parents"`
+	Compensate *model.TaskMeta `json:"compensate,omitempty"`
+	Status     string          `json:"status"`
+	TaskId     *string         `json:"task_id,omitempty"`
+}
+
+// SaveWorkflow inserts the nodes before the workflow row is visible as
+// running, so no server can schedule a node of a half written workflow.
+func (s *SupabaseClient) SaveWorkflow(workflow *model.Workflow) (string, error) {
+	id := uuid.New().String()
+	row := supabaseWorkflow{
+		Id:     id,
+		Name:   workflow.Name,
+		Status: util.WORKFLOW_NODE_WAITING,
+	}
+	if err := s.request(http.MethodPost, util.SUPABASE_WORKFLOW, "", row, "return=minimal", nil); err != nil {
+		return "", err
+	}
+	nodes := make([]supabaseWorkflowNode, 0, len(workflow.Nodes))
+	for _, node := range workflow.Nodes {
+		dependsOn := node.DependsOn
+		if dependsOn == nil {
+			dependsOn = []string{}
+		}
+		nodes = append(nodes, supabaseWorkflowNode{
+			WorkflowId: id,
+			Name:       node.Name,
+			Meta:       node.Meta,
+			DependsOn:  dependsOn,
+			MinParents: node.MinParents,
+			Compensate: node.Compensate,
+			Status:     util.WORKFLOW_NODE_WAITING,
+		})
+	}
+	if err := s.request(http.MethodPost, util.SUPABASE_WORKFLOW_NODE, "", nodes, "return=minimal", nil); err != nil {
+		return "", err
+	}
+	if _, err := s.UpdateWorkflowStatus(id, util.WORKFLOW_NODE_WAITING, util.TASK_STATUS_RUNNING); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (s *SupabaseClient) GetWorkflow(id string) (*model.Workflow, error) {
+	var workflows []supabaseWorkflow
+	query := fmt.Sprintf("id=eq.%v&select=id,name,status", url.QueryEscape(id))
+	if err := s.request(http.MethodGet, util.SUPABASE_WORKFLOW, query, nil, "", &workflows); err != nil {
+		return nil, err
+	}
+	if len(workflows) == 0 {
+		return nil, ErrWorkflowNotFound
+	}
+	var nodes []supabaseWorkflowNode
+	query = fmt.Sprintf("workflow_id=eq.%v&order=name", url.QueryEscape(id))
+	if err := s.request(http.MethodGet, util.SUPABASE_WORKFLOW_NODE, query, nil, "", &nodes); err != nil {
+		return nil, err
+	}
+	workflow := &model.Workflow{
+		Id:     workflows[0].Id,
+		Name:   workflows[0].Name,
+		Status: workflows[0].Status,
+	}
+	for _, node := range nodes {
+		workflowNode := model.WorkflowNode{
+			Name:       node.Name,
+			Meta:       node.Meta,
+			DependsOn:  node.DependsOn,
+			MinParents: node.MinParents,
+			Compensate: node.Compensate,
+			Status:     node.Status,
+		}
+		if node.TaskId != nil {
+			workflowNode.TaskId = *node.TaskId
+		}
+		workflow.Nodes = append(workflow.Nodes, workflowNode)
+	}
+	return workflow, nil
+}
+
+// ScheduleWorkflowNode inserts the node task first; its id is derived from
+// the node, so servers racing for the node insert it once and only the one
+// whose conditional update of the node succeeds dispatches it.
+func (s *SupabaseClient) ScheduleWorkflowNode(workflowId string, name string, meta model.TaskMeta) (string, bool, error) {
+	workflow, err := s.GetWorkflow(workflowId)
+	if err != nil {
+		return "", false, err
+	}
+	if workflow.Status != util.TASK_STATUS_RUNNING {
+		return "", false, nil
+	}
+	taskId := WorkflowTaskId(workflowId, name)
+	row := model.CompleteTask{
+		Id:   taskId,
+		Meta: meta,
+	}
+	if err := s.request(http.MethodPost, util.SUPABASE_JOBDETAIL, "", row, "resolution=ignore-duplicates,return=minimal", nil); err != nil {
+		return "", false, err
+	}
+	update := map[string]string{
+		"status":  util.WORKFLOW_NODE_SCHEDULED,
+		"task_id": taskId,
+	}
+	var scheduled []supabaseWorkflowNode
+	query := fmt.Sprintf("workflow_id=eq.%v&name=eq.%v&status=eq.%v", url.QueryEscape(workflowId), url.QueryEscape(name), util.WORKFLOW_NODE_WAITING)
+	if err := s.request(http.MethodPatch, util.SUPABASE_WORKFLOW_NODE, query, update, "return=representation", &scheduled); err != nil {
+		return "", false, err
+	}
+	return taskId, len(scheduled) > 0, nil
+}
+
+func (s *SupabaseClient) ScheduleWorkflowCompensation(workflowId string, name string, meta model.TaskMeta) (string, bool, error) {
+	workflow, err := s.GetWorkflow(workflowId)
+	if err != nil {
+		return "", false, err
+	}
+	if workflow.Status != util.WORKFLOW_COMPENSATING {
+		return "", false, nil
+	}
+	taskId := WorkflowCompensationId(workflowId, name)
+	row := model.CompleteTask{
+		Id:   taskId,
+		Meta: meta,
+	}
+	if err := s.request(http.MethodPost, util.SUPABASE_JOBDETAIL, "", row, "resolution=ignore-duplicates,return=minimal", nil); err != nil {
+		return "", false, err
+	}
+	fromStatus := []string{util.TASK_STATUS_COMPLETED}
+	scheduled, err := s.UpdateWorkflowNodeStatus(workflowId, name, fromStatus, util.WORKFLOW_COMPENSATING)
+	if err != nil || !scheduled {
+		return "", false, err
+	}
+	return taskId, true, nil
+}
+
+func (s *SupabaseClient) UpdateWorkflowNodeStatus(workflowId string, name string, fromStatus []string, status string) (bool, error) {
+	var updated []supabaseWorkflowNode
+	update := map[string]string{"status": status}
+	query := fmt.Sprintf("workflow_id=eq.%v&name=eq.%v&status=in.(%v)", url.QueryEscape(workflowId), url.QueryEscape(name), strings.Join(fromStatus, ","))
+	err := s.request(http.MethodPatch, util.SUPABASE_WORKFLOW_NODE, query, update, "return=representation", &updated)
+	return len(updated) > 0, err
+}
+
+func (s *SupabaseClient) UpdateWorkflowStatus(id string, fromStatus string, status string) (bool, error) {
+	var updated []supabaseWorkflow
+	update := map[string]string{"status": status}
+	query := fmt.Sprintf("id=eq.%v&status=eq.%v", url.QueryEscape(id), fromStatus)
+	err := s.request(http.MethodPatch, util.SUPABASE_WORKFLOW, query, update, "return=representation", &updated)
+	return len(updated) > 0, err
+}
+
+// GetActiveWorkflows returns the ids of the workflows still running or
+// compensating.
+func (s *SupabaseClient) GetActiveWorkflows() ([]string, error) {
+	var ids []string
+	for offset := 0; ; offset += util.SUPABASE_PAGE_SIZE {
+		var page []supabaseWorkflow
+		query := fmt.Sprintf("status=in.(%v,%v)&select=id&order=id&limit=%v&offset=%v", util.TASK_STATUS_RUNNING, util.WORKFLOW_COMPENSATING, util.SUPABASE_PAGE_SIZE, offset)
+		if err := s.request(http.MethodGet, util.SUPABASE_WORKFLOW, query, nil, "", &page); err != nil {
+			return nil, err
+		}
+		for _, workflow := range page {
+			ids = append(ids, workflow.Id)
+		}
+		if len(page) < util.SUPABASE_PAGE_SIZE {
+			return ids, nil
+		}
+	}
+}
@@ -6,8 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/amitiwary999/task-scheduler/model"
@@ -21,9 +22,14 @@ type SupabaseClient struct {
 	baseUrl           string
 	supabaseAuth      string
 	supabaseKeyString string
+	logger            util.Logger
 }
 
-func NewSupabaseClient(supabaseApiBaseUrl, supabaseAuth, supabaseKeyString string) (*SupabaseClient, error) {
+var _ util.StorageClient = (*SupabaseClient)(nil)
+
+const supabaseTaskColumns = "id,meta,status,error,result,attempt,createdAt:created_at"
+
+func NewSupabaseClient(supabaseApiBaseUrl, supabaseAuth, supabaseKeyString string, options ...ClientOption) (*SupabaseClient, error) {
 	t := http.DefaultTransport.(*http.Transport).Clone()
 	t.MaxIdleConns = 100
 	t.MaxConnsPerHost = 100
@@ -37,163 +43,345 @@ func NewSupabaseClient(supabaseApiBaseUrl, supabaseAuth, supabaseKeyString strin
 		baseUrl:           supabaseApiBaseUrl,
 		supabaseAuth:      supabaseAuth,
 		supabaseKeyString: supabaseKeyString,
+		logger:            applyOptions(options).logger,
 	}, nil
 }
-func (s *SupabaseClient) GetTaskConfig() ([]byte, error) {
-	jobConfigTable := util.SUPABASE_JOBCONFIG
-	url := fmt.Sprintf("%v%v", s.baseUrl, jobConfigTable)
-	req, reqErr := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
-	if reqErr != nil {
-		fmt.Printf("failed to create get task by id req %v\n", reqErr)
-		return nil, reqErr
+
+// GetTaskConfig renames the rate_limit column to the rateLimit key of
+// TaskWeight.
+func (s *SupabaseClient) GetTaskConfig() ([]model.TaskWeight, error) {
+	var taskWeights []model.TaskWeight
+	err := s.request(http.MethodGet, util.SUPABASE_JOBCONFIG, "select=type,weight,rateLimit:rate_limit", nil, "", &taskWeights)
+	return taskWeights, err
+}
+
+type supabaseRateLimit struct {
+	Type  string         `json:"type"`
+	State util.RateState `json:"state"`
+}
+
+// TakeRateToken has no row lock through PostgREST, so it writes the new
+// state only if the version it read is still current and starts over when
+// another server got there first.
+func (s *SupabaseClient) TakeRateToken(taskType string, limit model.RateLimit) (time.Duration, error) {
+	row := supabaseRateLimit{Type: taskType}
+	err := s.request(http.MethodPost, util.SUPABASE_RATE_LIMIT, "", row, "resolution=ignore-duplicates,return=minimal", nil)
+	if err != nil {
+		return 0, err
 	}
-	authToken := fmt.Sprintf("Bearer %v", s.supabaseAuth)
-	req.Header.Set("Authorization", authToken)
-	req.Header.Set("apiKey", s.supabaseKeyString)
-	resp, respErr := s.httpClinet.Do(req)
-	if respErr != nil {
-		return nil, respErr
+	query := fmt.Sprintf("type=eq.%v", url.QueryEscape(taskType))
+	for i := 0; i < util.RATE_LIMIT_MAX_CONFLICTS; i++ {
+		var rows []supabaseRateLimit
+		if err := s.request(http.MethodGet, util.SUPABASE_RATE_LIMIT, query, nil, "", &rows); err != nil {
+			return 0, err
+		}
+		if len(rows) == 0 {
+			return 0, fmt.Errorf("rate limit of %v not found", taskType)
+		}
+		state := rows[0].State
+		version := state.Version
+		wait := state.Take(limit, time.Now())
+		var updated []supabaseRateLimit
+		update := map[string]interface{}{"state": state}
+		conditional := fmt.Sprintf("%v&state->>version=eq.%v", query, version)
+		if err := s.request(http.MethodPatch, util.SUPABASE_RATE_LIMIT, conditional, update, "return=representation", &updated); err != nil {
+			return 0, err
+		}
+		if len(updated) > 0 {
+			return wait, nil
+		}
+		s.logger.Debug("rate limit state changed by another server, retrying", "type", taskType, "attempt", i+1)
 	}
-	defer resp.Body.Close()
-	body, bodyErr := io.ReadAll(resp.Body)
-	if bodyErr != nil {
-		return nil, bodyErr
+	return 0, fmt.Errorf("rate limit of %v kept changing", taskType)
+}
+
+func (s *SupabaseClient) DeferTask(id string, executionTime int64) (bool, error) {
+	task, err := s.GetTask(id)
+	if err != nil {
+		return false, err
 	}
-	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-		log.Printf("successfully fetch task config \n")
-		return body, nil
-	} else {
-		log.Printf("error in fetch with status %v\n", resp.StatusCode)
-		return nil, fmt.Errorf("failed to get the unused server")
+	meta := task.Meta
+	meta.ExecutionTime = executionTime
+	update := map[string]interface{}{
+		"status":     util.TASK_STATUS_PENDING,
+		"claimed_by": nil,
+		"meta":       meta,
 	}
+	var deferred []model.TaskDetail
+	query := fmt.Sprintf("id=eq.%v&status=eq.%v&select=id", url.QueryEscape(id), util.TASK_STATUS_RUNNING)
+	err = s.request(http.MethodPatch, util.SUPABASE_JOBDETAIL, query, update, "return=representation", &deferred)
+	return len(deferred) > 0, err
 }
 
 func (s *SupabaseClient) SaveTask(meta *model.TaskMeta) (string, error) {
-	jobDetailTable := util.SUPABASE_JOBDETAIL
-	url := fmt.Sprintf("%v%v", s.baseUrl, jobDetailTable)
 	id := uuid.New().String()
 	row := model.CompleteTask{
 		Id:   id,
 		Meta: *meta,
 	}
-	data, marshalErr := json.Marshal(row)
-	if marshalErr != nil {
-		return "", marshalErr
+	err := s.request(http.MethodPost, util.SUPABASE_JOBDETAIL, "", row, "return=minimal", nil)
+	if err != nil {
+		return "", err
 	}
-	req, reqErr := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewBuffer(data))
-	if reqErr != nil {
-		return "", reqErr
+	return id, nil
+}
+
+func (s *SupabaseClient) GetTask(id string) (*model.TaskDetail, error) {
+	var tasks []model.TaskDetail
+	query := fmt.Sprintf("id=eq.%v&select=%v", url.QueryEscape(id), supabaseTaskColumns)
+	if err := s.request(http.MethodGet, util.SUPABASE_JOBDETAIL, query, nil, "", &tasks); err != nil {
+		return nil, err
 	}
-	authToken := fmt.Sprintf("Bearer %v", s.supabaseAuth)
-	req.Header.Set("Authorization", authToken)
-	req.Header.Set("apiKey", s.supabaseKeyString)
-	resp, respErr := s.httpClinet.Do(req)
-	if respErr != nil {
-		return "", respErr
+	if len(tasks) == 0 {
+		return nil, ErrTaskNotFound
 	}
-	defer resp.Body.Close()
-	body, bodyErr := io.ReadAll(resp.Body)
-	if bodyErr != nil {
-		return "", bodyErr
+	return &tasks[0], nil
+}
+
+// ClaimTask only updates the row while it is still pending and due, so
+// exactly one of the servers racing for a task gets it back in the
+// representation.
+func (s *SupabaseClient) ClaimTask(id string, serverId string) (bool, error) {
+	update := map[string]string{
+		"status":     util.TASK_STATUS_RUNNING,
+		"claimed_by": serverId,
 	}
-	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-		log.Printf("successfully insert %v\n", body)
-	} else {
-		log.Printf("error in insert with status %v\n", resp.StatusCode)
+	var claimed []model.TaskDetail
+	due := url.QueryEscape(fmt.Sprintf("(meta->executionTime.is.null,meta->executionTime.lte.%v)", time.Now().Unix()+util.CLAIM_CLOCK_SKEW))
+	query := fmt.Sprintf("id=eq.%v&status=eq.%v&or=%v&select=id", url.QueryEscape(id), util.TASK_STATUS_PENDING, due)
+	err := s.request(http.MethodPatch, util.SUPABASE_JOBDETAIL, query, update, "return=representation", &claimed)
+	if err != nil {
+		return false, err
 	}
-	return id, nil
+	return len(claimed) > 0, nil
 }
 
-func (s *SupabaseClient) UpdateTaskComplete(id string) error {
-	jobDetailTable := util.SUPABASE_JOBDETAIL
-	updateS := model.TaskStatus{
-		Status: "completed",
+func (s *SupabaseClient) ClaimPendingTasks(serverId string, queue string, known []string, types []string, limit int) ([]model.TaskDetail, error) {
+	escapedTypes := make([]string, len(types))
+	for i, taskType := range types {
+		escapedTypes[i] = url.QueryEscape(fmt.Sprintf("%q", taskType))
 	}
-	updateD, marshalErr := json.Marshal(updateS)
-	if marshalErr != nil {
-		fmt.Printf("marshal json for update task error %v\n", marshalErr)
-		return marshalErr
+	queueFilter := fmt.Sprintf("meta->>queue.eq.%q", queue)
+	if queue == util.DEFAULT_QUEUE {
+		quoted := make([]string, len(known))
+		for i, name := range known {
+			quoted[i] = fmt.Sprintf("%q", name)
+		}
+		queueFilter = fmt.Sprintf("or(meta->>queue.is.null,%v,meta->>queue.not.in.(%v))", queueFilter, strings.Join(quoted, ","))
 	}
-	url := fmt.Sprintf("%v%v?id=eq.%v", s.baseUrl, jobDetailTable, id)
-	req, reqErr := http.NewRequestWithContext(context.Background(), http.MethodPatch, url, bytes.NewBuffer(updateD))
-	if reqErr != nil {
-		fmt.Printf("req err creation err %v\n", reqErr)
+	query := fmt.Sprintf("status=eq.%v&meta->>type=in.(%v)&and=(%v,or(meta->executionTime.is.null,meta->executionTime.lte.%v))&select=%v&limit=%v",
+		util.TASK_STATUS_PENDING, strings.Join(escapedTypes, ","), url.QueryEscape(queueFilter), time.Now().Unix(), supabaseTaskColumns, limit)
+	var pendingTasks []model.TaskDetail
+	if err := s.request(http.MethodGet, util.SUPABASE_JOBDETAIL, query, nil, "", &pendingTasks); err != nil {
+		return nil, err
 	}
-	authToken := fmt.Sprintf("Bearer %v", s.supabaseAuth)
-	req.Header.Set("Authorization", authToken)
-	req.Header.Set("apiKey", s.supabaseKeyString)
-	resp, respErr := s.httpClinet.Do(req)
-	if respErr != nil {
-		return respErr
+	var tasks []model.TaskDetail
+	for _, task := range pendingTasks {
+		claimed, err := s.ClaimTask(task.Id, serverId)
+		if err != nil {
+			return tasks, err
+		}
+		if claimed {
+			task.Status = util.TASK_STATUS_RUNNING
+			tasks = append(tasks, task)
+		}
 	}
-	defer resp.Body.Close()
-	_, bodyErr := io.ReadAll(resp.Body)
-	if bodyErr != nil {
-		return bodyErr
+	return tasks, nil
+}
+
+// UpdateTaskComplete cannot use a transaction through PostgREST, so the
+// successors are inserted before the task is marked complete. A crash in
+// between leaves the task running; it is requeued, runs again and the
+// second insert of the same successor ids is ignored. It returns false
+// when the task was no longer pending or running.
+func (s *SupabaseClient) UpdateTaskComplete(id string, result []byte, next []model.TaskMeta) ([]string, bool, error) {
+	task, err := s.GetTask(id)
+	if err != nil {
+		return nil, false, err
 	}
-	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-		log.Printf("successfully update \n")
-		return nil
-	} else {
-		log.Printf("error in task status update %v\n", resp.StatusCode)
-		return fmt.Errorf("error in task status update %v", resp.StatusCode)
+	if task.Status != util.TASK_STATUS_PENDING && task.Status != util.TASK_STATUS_RUNNING {
+		return nil, false, nil
+	}
+	nextIds := make([]string, 0, len(next))
+	if len(next) > 0 {
+		rows := make([]model.CompleteTask, 0, len(next))
+		for i, meta := range next {
+			nextId := SuccessorId(id, i)
+			rows = append(rows, model.CompleteTask{Id: nextId, Meta: meta})
+			nextIds = append(nextIds, nextId)
+		}
+		err = s.request(http.MethodPost, util.SUPABASE_JOBDETAIL, "", rows, "resolution=ignore-duplicates,return=minimal", nil)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	update := map[string]interface{}{
+		"status": util.TASK_STATUS_COMPLETED,
+		"result": result,
+	}
+	var completed []model.TaskDetail
+	query := fmt.Sprintf("id=eq.%v&status=in.(%v,%v)&select=id", url.QueryEscape(id), util.TASK_STATUS_PENDING, util.TASK_STATUS_RUNNING)
+	err = s.request(http.MethodPatch, util.SUPABASE_JOBDETAIL, query, update, "return=representation", &completed)
+	if err != nil || len(completed) == 0 {
+		return nil, false, err
 	}
+	return nextIds, true, nil
 }
 
-func (s *SupabaseClient) GetPendingTask() ([]byte, error) {
-	jobDetailTable := util.SUPABASE_JOBDETAIL
-	url := fmt.Sprintf("%v%v?status=eq.%v&select=id,meta", s.baseUrl, jobDetailTable, "pending")
-	req, reqErr := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
-	if reqErr != nil {
-		fmt.Printf("failed to create get task by id req %v\n", reqErr)
-		return nil, reqErr
+func (s *SupabaseClient) UpdateTaskFailed(id string, reason string) (bool, error) {
+	update := map[string]string{
+		"status": util.TASK_STATUS_FAILED,
+		"error":  reason,
 	}
-	authToken := fmt.Sprintf("Bearer %v", s.supabaseAuth)
-	req.Header.Set("Authorization", authToken)
-	req.Header.Set("apiKey", s.supabaseKeyString)
-	resp, respErr := s.httpClinet.Do(req)
-	if respErr != nil {
-		return nil, respErr
+	var failed []model.TaskDetail
+	query := fmt.Sprintf("id=eq.%v&status=in.(%v,%v)&select=id", url.QueryEscape(id), util.TASK_STATUS_PENDING, util.TASK_STATUS_RUNNING)
+	err := s.request(http.MethodPatch, util.SUPABASE_JOBDETAIL, query, update, "return=representation", &failed)
+	return len(failed) > 0, err
+}
+
+// RetryTask only applies while the attempt read back is still current, so
+// two servers retrying the same failure add a single attempt.
+func (s *SupabaseClient) RetryTask(id string, reason string, executionTime int64) (bool, error) {
+	task, err := s.GetTask(id)
+	if err != nil {
+		return false, err
 	}
-	defer resp.Body.Close()
-	body, bodyErr := io.ReadAll(resp.Body)
-	if bodyErr != nil {
-		return nil, bodyErr
+	meta := task.Meta
+	meta.ExecutionTime = executionTime
+	update := map[string]interface{}{
+		"status":     util.TASK_STATUS_PENDING,
+		"error":      reason,
+		"claimed_by": nil,
+		"attempt":    task.Attempt + 1,
+		"meta":       meta,
 	}
-	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-		log.Printf("successfully fetch all used server \n")
-		return body, nil
-	} else {
-		log.Printf("error in fetch with status %v\n", resp.StatusCode)
-		return nil, fmt.Errorf("failed to get the unused server")
+	var retried []model.TaskDetail
+	query := fmt.Sprintf("id=eq.%v&attempt=eq.%v&status=in.(%v,%v)&select=id", url.QueryEscape(id), task.Attempt, util.TASK_STATUS_PENDING, util.TASK_STATUS_RUNNING)
+	err = s.request(http.MethodPatch, util.SUPABASE_JOBDETAIL, query, update, "return=representation", &retried)
+	return len(retried) > 0, err
+}
+
+func (s *SupabaseClient) CancelTask(id string) (bool, error) {
+	update := model.TaskStatus{
+		Status: util.TASK_STATUS_CANCELLED,
+	}
+	var cancelled []model.TaskDetail
+	query := fmt.Sprintf("id=eq.%v&status=in.(%v,%v)&select=id", url.QueryEscape(id), util.TASK_STATUS_PENDING, util.TASK_STATUS_RUNNING)
+	err := s.request(http.MethodPatch, util.SUPABASE_JOBDETAIL, query, update, "return=representation", &cancelled)
+	return len(cancelled) > 0, err
+}
+
+func (s *SupabaseClient) GetChildTasks(parentId string) ([]model.TaskDetail, error) {
+	var tasks []model.TaskDetail
+	for offset := 0; ; offset += util.SUPABASE_PAGE_SIZE {
+		var page []model.TaskDetail
+		query := fmt.Sprintf("meta->>parentId=eq.%v&select=%v&order=id&limit=%v&offset=%v", url.QueryEscape(parentId), supabaseTaskColumns, util.SUPABASE_PAGE_SIZE, offset)
+		if err := s.request(http.MethodGet, util.SUPABASE_JOBDETAIL, query, nil, "", &page); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, page...)
+		if len(page) < util.SUPABASE_PAGE_SIZE {
+			return tasks, nil
+		}
 	}
 }
 
-func (s *SupabaseClient) GetAllUsedServer() ([]byte, error) {
-	jobServersTable := util.SUPABASE_JOBSERVERS
-	url := fmt.Sprintf("%v%v?status=eq.1&select=serverId,status", s.baseUrl, jobServersTable)
-	req, reqErr := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+func (s *SupabaseClient) UpdateServerStatus(serverId string, status int) error {
+	joinData := model.JoinData{
+		ServerId:  serverId,
+		Status:    status,
+		Heartbeat: time.Now().Unix(),
+	}
+	return s.request(http.MethodPost, util.SUPABASE_JOBSERVERS, "", joinData, "resolution=merge-duplicates,return=minimal", nil)
+}
+
+func (s *SupabaseClient) RequeueStaleTasks() (int, error) {
+	servers, err := s.GetAllUsedServer()
+	if err != nil {
+		return 0, err
+	}
+	filter := "claimed_by.is.null"
+	if len(servers) > 0 {
+		serverIds := make([]string, len(servers))
+		for i, server := range servers {
+			serverIds[i] = url.QueryEscape(fmt.Sprintf("%q", server.ServerId))
+		}
+		filter = fmt.Sprintf("%v,claimed_by.not.in.(%v)", filter, strings.Join(serverIds, ","))
+	}
+	update := map[string]interface{}{
+		"status":     util.TASK_STATUS_PENDING,
+		"claimed_by": nil,
+	}
+	var requeued []model.TaskDetail
+	query := fmt.Sprintf("status=eq.%v&or=(%v)&select=id", util.TASK_STATUS_RUNNING, filter)
+	err = s.request(http.MethodPatch, util.SUPABASE_JOBDETAIL, query, update, "return=representation", &requeued)
+	return len(requeued), err
+}
+
+// GetPendingTask reads the pending tasks a page at a time, so a large
+// backlog never has to come back in one response.
+func (s *SupabaseClient) GetPendingTask() ([]model.PendingTask, error) {
+	var pendingTasks []model.PendingTask
+	for offset := 0; ; offset += util.SUPABASE_PAGE_SIZE {
+		var page []model.PendingTask
+		query := fmt.Sprintf("status=eq.%v&select=id,meta&order=id&limit=%v&offset=%v", util.TASK_STATUS_PENDING, util.SUPABASE_PAGE_SIZE, offset)
+		if err := s.request(http.MethodGet, util.SUPABASE_JOBDETAIL, query, nil, "", &page); err != nil {
+			return nil, err
+		}
+		pendingTasks = append(pendingTasks, page...)
+		if len(page) < util.SUPABASE_PAGE_SIZE {
+			return pendingTasks, nil
+		}
+	}
+}
+
+func (s *SupabaseClient) GetAllUsedServer() ([]model.JoinData, error) {
+	var joinDatas []model.JoinData
+	query := fmt.Sprintf("status=eq.%v&heartbeat=gte.%v&select=serverId,status,heartbeat", util.SERVER_STATUS_ACTIVE, staleHeartbeat())
+	err := s.request(http.MethodGet, util.SUPABASE_JOBSERVERS, query, nil, "", &joinDatas)
+	return joinDatas, err
+}
+
+func (s *SupabaseClient) request(method string, table string, query string, in interface{}, prefer string, out interface{}) error {
+	reqUrl := fmt.Sprintf("%v%v", s.baseUrl, table)
+	if query != "" {
+		reqUrl = fmt.Sprintf("%v?%v", reqUrl, query)
+	}
+	var reqBody io.Reader
+	if in != nil {
+		data, marshalErr := json.Marshal(in)
+		if marshalErr != nil {
+			return marshalErr
+		}
+		reqBody = bytes.NewBuffer(data)
+	}
+	req, reqErr := http.NewRequestWithContext(context.Background(), method, reqUrl, reqBody)
 	if reqErr != nil {
-		fmt.Printf("failed to create get task by id req %v\n", reqErr)
-		return nil, reqErr
+		return reqErr
 	}
 	authToken := fmt.Sprintf("Bearer %v", s.supabaseAuth)
 	req.Header.Set("Authorization", authToken)
 	req.Header.Set("apiKey", s.supabaseKeyString)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if prefer != "" {
+		req.Header.Set("Prefer", prefer)
+	}
 	resp, respErr := s.httpClinet.Do(req)
 	if respErr != nil {
-		return nil, respErr
+		return respErr
 	}
 	defer resp.Body.Close()
 	body, bodyErr := io.ReadAll(resp.Body)
 	if bodyErr != nil {
-		return nil, bodyErr
+		return bodyErr
 	}
-	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
-		log.Printf("successfully fetch all pending task \n")
-		return body, nil
-	} else {
-		log.Printf("error in fetch pending task with status %v\n", resp.StatusCode)
-		return nil, fmt.Errorf("failed to get the pending task")
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("supabase %v %v failed with status %v: %s", method, table, resp.StatusCode, body)
+	}
+	if out == nil || len(body) == 0 {
+		return nil
 	}
+	return json.Unmarshal(body, out)
 }
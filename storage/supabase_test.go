@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// postgrestRequest is one request the fake PostgREST got.
+type postgrestRequest struct {
+	method string
+	table  string
+	query  url.Values
+	prefer string
+	body   string
+}
+
+// postgrestFake answers every request with respond and records it.
+type postgrestFake struct {
+	t        *testing.T
+	mu       sync.Mutex
+	requests []postgrestRequest
+	respond  func(req postgrestRequest) (int, interface{})
+}
+
+func newPostgrestFake(t *testing.T, respond func(req postgrestRequest) (int, interface{})) (*postgrestFake, *SupabaseClient) {
+	fake := &postgrestFake{t: t, respond: respond}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client, err := NewSupabaseClient(server.URL+"/rest/v1/", "auth-token", "api-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, client
+}
+
+func (f *postgrestFake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer auth-token" || r.Header.Get("apiKey") != "api-key" {
+		f.t.Errorf("%v %v: missing credentials", r.Method, r.URL)
+	}
+	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		f.t.Errorf("%v %v: %v", r.Method, r.URL, err)
+	}
+	body, _ := io.ReadAll(r.Body)
+	req := postgrestRequest{
+		method: r.Method,
+		table:  strings.TrimPrefix(r.URL.Path, "/rest/v1/"),
+		query:  query,
+		prefer: r.Header.Get("Prefer"),
+		body:   string(body),
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+	status, out := f.respond(req)
+	w.WriteHeader(status)
+	if out != nil {
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+func (f *postgrestFake) recorded() []postgrestRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]postgrestRequest(nil), f.requests...)
+}
+
+func TestSupabaseGetTaskEncodesFilter(t *testing.T) {
+	fake, client := newPostgrestFake(t, func(req postgrestRequest) (int, interface{}) {
+		if req.query.Get("id") == "eq.a&b=c" {
+			return http.StatusOK, []model.TaskDetail{{Id: "a&b=c", Status: util.TASK_STATUS_PENDING, Meta: model.TaskMeta{Type: "email"}}}
+		}
+		return http.StatusOK, []model.TaskDetail{}
+	})
+	task, err := client.GetTask("a&b=c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Id != "a&b=c" || task.Meta.Type != "email" {
+		t.Fatalf("GetTask = %+v", task)
+	}
+	req := fake.recorded()[0]
+	if req.method != http.MethodGet || req.table != util.SUPABASE_JOBDETAIL || req.query.Get("select") != supabaseTaskColumns {
+		t.Fatalf("GetTask sent %+v", req)
+	}
+	if _, err := client.GetTask("missing"); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("GetTask of a missing task = %v, want ErrTaskNotFound", err)
+	}
+}
+
+func TestSupabaseClaimTask(t *testing.T) {
+	claimable := map[string]bool{"free": true}
+	fake, client := newPostgrestFake(t, func(req postgrestRequest) (int, interface{}) {
+		id := strings.TrimPrefix(req.query.Get("id"), "eq.")
+		if claimable[id] {
+			return http.StatusOK, []map[string]string{{"id": id}}
+		}
+		return http.StatusOK, []map[string]string{}
+	})
+	claimed, err := client.ClaimTask("free", "server-1")
+	if err != nil || !claimed {
+		t.Fatalf("ClaimTask(free) = %v, %v, want true", claimed, err)
+	}
+	claimed, err = client.ClaimTask("taken", "server-1")
+	if err != nil || claimed {
+		t.Fatalf("ClaimTask with no row updated = %v, %v, want false", claimed, err)
+	}
+	req := fake.recorded()[0]
+	if req.method != http.MethodPatch || req.query.Get("status") != "eq."+util.TASK_STATUS_PENDING {
+		t.Fatalf("ClaimTask sent %+v", req)
+	}
+	if due := req.query.Get("or"); !strings.HasPrefix(due, "(meta->executionTime.is.null,meta->executionTime.lte.") {
+		t.Fatalf("ClaimTask due filter = %q", due)
+	}
+	if req.prefer != "return=representation" {
+		t.Fatalf("ClaimTask Prefer = %q", req.prefer)
+	}
+	var update map[string]string
+	json.Unmarshal([]byte(req.body), &update)
+	if update["status"] != util.TASK_STATUS_RUNNING || update["claimed_by"] != "server-1" {
+		t.Fatalf("ClaimTask update = %v", update)
+	}
+}
+
+func TestSupabaseClaimPendingTasksQuery(t *testing.T) {
+	fake, client := newPostgrestFake(t, func(req postgrestRequest) (int, interface{}) {
+		if req.method == http.MethodGet {
+			return http.StatusOK, []model.TaskDetail{{Id: "1", Status: util.TASK_STATUS_PENDING}, {Id: "2", Status: util.TASK_STATUS_PENDING}}
+		}
+		// Another server claimed task 2 first.
+		if req.query.Get("id") == "eq.1" {
+			return http.StatusOK, []map[string]string{{"id": "1"}}
+		}
+		return http.StatusOK, []map[string]string{}
+	})
+	tasks, err := client.ClaimPendingTasks("server-1", util.DEFAULT_QUEUE, []string{util.DEFAULT_QUEUE, "slow"}, []string{"email", "a,b"}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Id != "1" || tasks[0].Status != util.TASK_STATUS_RUNNING {
+		t.Fatalf("ClaimPendingTasks = %+v, want only task 1, running", tasks)
+	}
+	req := fake.recorded()[0]
+	if got := req.query.Get("meta->>type"); got != `in.("email","a,b")` {
+		t.Fatalf("type filter = %q", got)
+	}
+	if got := req.query.Get("and"); !strings.HasPrefix(got, `(or(meta->>queue.is.null,meta->>queue.eq."default",meta->>queue.not.in.("default","slow")),or(meta->executionTime.is.null,`) {
+		t.Fatalf("queue and due filter = %q", got)
+	}
+	if req.query.Get("limit") != "10" {
+		t.Fatalf("limit = %q", req.query.Get("limit"))
+	}
+}
+
+// pagedRows serves rows of count tasks a page at a time, by limit and
+// offset like PostgREST.
+func pagedRows(req postgrestRequest, count int) []model.TaskDetail {
+	limit, _ := strconv.Atoi(req.query.Get("limit"))
+	offset, _ := strconv.Atoi(req.query.Get("offset"))
+	var rows []model.TaskDetail
+	for i := offset; i < count && i < offset+limit; i++ {
+		rows = append(rows, model.TaskDetail{Id: fmt.Sprint(i)})
+	}
+	return rows
+}
+
+func TestSupabasePagination(t *testing.T) {
+	total := 2*util.SUPABASE_PAGE_SIZE + 3
+	fake, client := newPostgrestFake(t, func(req postgrestRequest) (int, interface{}) {
+		return http.StatusOK, pagedRows(req, total)
+	})
+
+	pending, err := client.GetPendingTask()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != total {
+		t.Fatalf("GetPendingTask returned %v tasks, want %v", len(pending), total)
+	}
+	requests := fake.recorded()
+	if len(requests) != 3 {
+		t.Fatalf("GetPendingTask made %v requests, want 3", len(requests))
+	}
+	for i, req := range requests {
+		if req.query.Get("offset") != fmt.Sprint(i*util.SUPABASE_PAGE_SIZE) || req.query.Get("order") != "id" {
+			t.Fatalf("page %v query = %v", i, req.query)
+		}
+	}
+
+	children, err := client.GetChildTasks("parent/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != total {
+		t.Fatalf("GetChildTasks returned %v tasks, want %v", len(children), total)
+	}
+	if req := fake.recorded()[3]; req.query.Get("meta->>parentId") != "eq.parent/1" {
+		t.Fatalf("GetChildTasks filter = %v", req.query)
+	}
+}
+
+func TestSupabaseErrorStatus(t *testing.T) {
+	_, client := newPostgrestFake(t, func(req postgrestRequest) (int, interface{}) {
+		return http.StatusInternalServerError, map[string]string{"message": "boom"}
+	})
+	if _, err := client.GetTask("1"); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("GetTask = %v, want the status in the error", err)
+	}
+	if _, err := client.SaveTask(&model.TaskMeta{Type: "email"}); err == nil {
+		t.Error("SaveTask did not fail")
+	}
+	if _, err := client.UpdateTaskFailed("1", "reason"); err == nil {
+		t.Error("UpdateTaskFailed did not fail")
+	}
+	if _, err := client.ClaimTask("1", "server-1"); err == nil {
+		t.Error("ClaimTask did not fail")
+	}
+	if _, err := client.GetPendingTask(); err == nil {
+		t.Error("GetPendingTask did not fail")
+	}
+}
+
+func TestSupabaseGetTaskConfigRenamesRateLimit(t *testing.T) {
+	fake, client := newPostgrestFake(t, func(req postgrestRequest) (int, interface{}) {
+		return http.StatusOK, []map[string]interface{}{
+			{"type": "email", "weight": 2, "rateLimit": map[string]interface{}{"limit": 10, "window": 60}},
+		}
+	})
+	taskWeights, err := client.GetTaskConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req := fake.recorded()[0]; req.table != util.SUPABASE_JOBCONFIG || req.query.Get("select") != "type,weight,rateLimit:rate_limit" {
+		t.Fatalf("GetTaskConfig sent %+v", req)
+	}
+	if len(taskWeights) != 1 || taskWeights[0].RateLimit == nil || taskWeights[0].RateLimit.Limit != 10 {
+		t.Fatalf("GetTaskConfig = %+v", taskWeights)
+	}
+}
@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"github.com/amitiwary999/task-scheduler/model"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// countBatchTasks adds tasks members with status to the batch counts.
+func countBatchTasks(batch *model.Batch, status string, tasks int) {
+	switch status {
+	case util.TASK_STATUS_PENDING:
+		batch.Pending += tasks
+	case util.TASK_STATUS_RUNNING:
+		batch.Running += tasks
+	case util.TASK_STATUS_COMPLETED:
+		batch.Succeeded += tasks
+	case util.TASK_STATUS_FAILED:
+		batch.Failed += tasks
+	case util.TASK_STATUS_CANCELLED:
+		batch.Cancelled += tasks
+	}
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	util "github.com/amitiwary999/task-scheduler/util"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTaskNotFound     = errors.New("task not found")
+	ErrWorkflowNotFound = errors.New("workflow not found")
+	ErrBatchNotFound    = errors.New("batch not found")
+)
+
+// SuccessorId is the id of the index-th task to run after parentId
+// completes. It is derived rather than random so inserting the successors
+// again after a crash is a no-op.
+func SuccessorId(parentId string, index int) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%v/next/%v", parentId, index))).String()
+}
+
+func staleHeartbeat() int64 {
+	return time.Now().Unix() - util.SERVER_STALE_AFTER
+}
+
+// BatchCallbackId is the id of the task added when batch batchId is done.
+func BatchCallbackId(batchId string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%v/batch", batchId))).String()
+}
+
+// WorkflowCompensationId is the id of the task that undoes node name.
+func WorkflowCompensationId(workflowId string, name string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%v/compensate/%v", workflowId, name))).String()
+}
+
+// WorkflowTaskId is the id of the task that runs node name of a workflow.
+func WorkflowTaskId(workflowId string, name string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("%v/node/%v", workflowId, name))).String()
+}
@@ -0,0 +1,166 @@
+package submission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// Client calls SubmissionService at baseUrl, the server's url with the
+// prefix the Handler is mounted under. Failed calls return an *Error.
+type Client struct {
+	httpClient *http.Client
+	baseUrl    string
+	token      string
+}
+
+// NewClient uses http.DefaultClient when httpClient is nil. Give WatchStatus
+// a client without a Timeout, which would cut long streams short.
+func NewClient(baseUrl string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{httpClient: httpClient, baseUrl: strings.TrimSuffix(baseUrl, "/")}
+}
+
+// SetToken sends token as a bearer token with every call.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+func (c *Client) Submit(ctx context.Context, req *SubmitRequest) (*SubmitResponse, error) {
+	var resp SubmitResponse
+	if err := c.call(ctx, "Submit", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) SubmitBatch(ctx context.Context, req *SubmitBatchRequest) (*SubmitBatchResponse, error) {
+	var resp SubmitBatchResponse
+	if err := c.call(ctx, "SubmitBatch", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetStatus(ctx context.Context, req *GetStatusRequest) (*TaskStatus, error) {
+	var resp TaskStatus
+	if err := c.call(ctx, "GetStatus", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Cancel(ctx context.Context, req *CancelRequest) (*CancelResponse, error) {
+	var resp CancelResponse
+	if err := c.call(ctx, "Cancel", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// WatchStatus opens a stream of the statuses of the tasks of req. Close it
+// when done, or cancel ctx.
+func (c *Client) WatchStatus(ctx context.Context, req *WatchStatusRequest) (*StatusStream, error) {
+	var body bytes.Buffer
+	if err := writeEnvelope(&body, 0, req); err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseUrl+ServicePath+"WatchStatus", &body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", contentTypeStream)
+	httpReq.Header.Set(headerVersion, protocolVersion)
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, &Error{Code: codeForStatus(resp.StatusCode), Message: resp.Status}
+	}
+	return &StatusStream{body: resp.Body}, nil
+}
+
+func (c *Client) call(ctx context.Context, method string, req interface{}, resp interface{}) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseUrl+ServicePath+method, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", contentTypeJson)
+	httpReq.Header.Set(headerVersion, protocolVersion)
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxMessageSize))
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		var connectErr Error
+		if json.Unmarshal(body, &connectErr) != nil || connectErr.Code == "" {
+			return &Error{Code: codeForStatus(httpResp.StatusCode), Message: httpResp.Status}
+		}
+		return &connectErr
+	}
+	return json.Unmarshal(body, resp)
+}
+
+// StatusStream is the answer of WatchStatus.
+type StatusStream struct {
+	body io.ReadCloser
+	err  error
+}
+
+// Receive returns the next status, or io.EOF once every task finished.
+func (s *StatusStream) Receive() (*TaskStatus, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	flags, data, err := readEnvelope(s.body)
+	if err == io.EOF {
+		err = &Error{Code: util.CONNECT_CODE_INTERNAL, Message: "stream ended without an end-stream message"}
+	}
+	if err == nil && flags&flagEndStream != 0 {
+		var end endStream
+		if err = json.Unmarshal(data, &end); err == nil {
+			err = io.EOF
+			if end.Error != nil {
+				err = end.Error
+			}
+		}
+	}
+	if err != nil {
+		s.err = err
+		return nil, err
+	}
+	var status TaskStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		s.err = err
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (s *StatusStream) Close() error {
+	return s.body.Close()
+}
@@ -0,0 +1,98 @@
+// Package submission serves the SubmissionService of
+// proto/taskscheduler/v1/submission.proto over the Connect protocol with
+// JSON, so services in other languages can add and follow tasks, and has a
+// Go client for it. Nothing here is generated from the proto: the messages
+// and the client are written by hand against its JSON mapping, so a change
+// to the proto needs the same change here; the tests fail until it has one.
+package submission
+
+import (
+	"time"
+
+	model "github.com/amitiwary999/task-scheduler/model"
+)
+
+// The messages below follow the proto3 JSON mapping of submission.proto.
+
+type SubmitRequest struct {
+	Type              string     `json:"type,omitempty"`
+	Payload           []byte     `json:"payload,omitempty"`
+	Codec             string     `json:"codec,omitempty"`
+	Queue             string     `json:"queue,omitempty"`
+	MetaId            string     `json:"metaId,omitempty"`
+	DelaySeconds      int32      `json:"delaySeconds,omitempty"`
+	ExecutionTime     *time.Time `json:"executionTime,omitempty"`
+	MaxRetry          int32      `json:"maxRetry,omitempty"`
+	RetryDelaySeconds int32      `json:"retryDelaySeconds,omitempty"`
+}
+
+type SubmitResponse struct {
+	Id string `json:"id,omitempty"`
+}
+
+type SubmitBatchRequest struct {
+	Tasks      []*SubmitRequest `json:"tasks,omitempty"`
+	OnComplete *SubmitRequest   `json:"onComplete,omitempty"`
+}
+
+type SubmitBatchResponse struct {
+	BatchId string   `json:"batchId,omitempty"`
+	Ids     []string `json:"ids,omitempty"`
+}
+
+type GetStatusRequest struct {
+	Id string `json:"id,omitempty"`
+}
+
+type TaskStatus struct {
+	Id      string `json:"id,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Result  []byte `json:"result,omitempty"`
+	Attempt int32  `json:"attempt,omitempty"`
+}
+
+type CancelRequest struct {
+	Id string `json:"id,omitempty"`
+}
+
+type CancelResponse struct {
+	Cancelled bool `json:"cancelled,omitempty"`
+}
+
+type WatchStatusRequest struct {
+	Ids []string `json:"ids,omitempty"`
+}
+
+// meta is the task r asks for. Delays are in seconds here, where
+// TaskMeta.Delay counts minutes, so they become an execution time.
+func (r *SubmitRequest) meta() model.TaskMeta {
+	meta := model.TaskMeta{
+		MetaId:     r.MetaId,
+		Type:       r.Type,
+		Codec:      r.Codec,
+		Payload:    r.Payload,
+		Queue:      r.Queue,
+		MaxRetry:   int(r.MaxRetry),
+		RetryDelay: int(r.RetryDelaySeconds),
+	}
+	switch {
+	case r.ExecutionTime != nil:
+		meta.ExecutionTime = r.ExecutionTime.Unix()
+	case r.DelaySeconds > 0:
+		meta.ExecutionTime = time.Now().Unix() + int64(r.DelaySeconds)
+	}
+	return meta
+}
+
+func taskStatus(task *model.TaskDetail) *TaskStatus {
+	return &TaskStatus{
+		Id:      task.Id,
+		Type:    task.Meta.Type,
+		Status:  task.Status,
+		Error:   task.Error,
+		Result:  task.Result,
+		Attempt: int32(task.Attempt),
+	}
+}
@@ -0,0 +1,151 @@
+package submission
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+)
+
+var (
+	protoMessage = regexp.MustCompile(`(?s)\nmessage (\w+) \{(.*?)\n\}`)
+	protoField   = regexp.MustCompile(`^\s*(repeated )?([\w.]+) (\w+) = \d+;`)
+	protoRpc     = regexp.MustCompile(`rpc (\w+)\((\w+)\) returns \((stream )?(\w+)\)`)
+)
+
+// messages are the Go types of the messages of submission.proto.
+var messages = map[string]reflect.Type{
+	"SubmitRequest":       reflect.TypeOf(SubmitRequest{}),
+	"SubmitResponse":      reflect.TypeOf(SubmitResponse{}),
+	"SubmitBatchRequest":  reflect.TypeOf(SubmitBatchRequest{}),
+	"SubmitBatchResponse": reflect.TypeOf(SubmitBatchResponse{}),
+	"GetStatusRequest":    reflect.TypeOf(GetStatusRequest{}),
+	"TaskStatus":          reflect.TypeOf(TaskStatus{}),
+	"CancelRequest":       reflect.TypeOf(CancelRequest{}),
+	"CancelResponse":      reflect.TypeOf(CancelResponse{}),
+	"WatchStatusRequest":  reflect.TypeOf(WatchStatusRequest{}),
+}
+
+func readProto(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile("../proto/taskscheduler/v1/submission.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// goType is the Go type the proto3 JSON mapping of a field of protoType
+// decodes into here.
+func goType(t *testing.T, protoType string) reflect.Type {
+	switch protoType {
+	case "string":
+		return reflect.TypeOf("")
+	case "bytes":
+		return reflect.TypeOf([]byte(nil))
+	case "int32":
+		return reflect.TypeOf(int32(0))
+	case "int64":
+		return reflect.TypeOf(int64(0))
+	case "bool":
+		return reflect.TypeOf(false)
+	case "google.protobuf.Timestamp":
+		return reflect.TypeOf(&time.Time{})
+	}
+	message, ok := messages[protoType]
+	if !ok {
+		t.Fatalf("no Go type for proto type %v", protoType)
+	}
+	return reflect.PointerTo(message)
+}
+
+// jsonName is the proto3 JSON name of a field: lowerCamelCase.
+func jsonName(field string) string {
+	var name strings.Builder
+	upper := false
+	for _, r := range field {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			name.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			name.WriteRune(r)
+		}
+	}
+	return name.String()
+}
+
+// TestMessagesMatchTheProto fails when submission.proto and the messages
+// written by hand here drift apart.
+func TestMessagesMatchTheProto(t *testing.T) {
+	found := protoMessage.FindAllStringSubmatch(readProto(t), -1)
+	if len(found) != len(messages) {
+		t.Errorf("the proto has %v messages, the Go code %v", len(found), len(messages))
+	}
+	for _, message := range found {
+		name, body := message[1], message[2]
+		typ, ok := messages[name]
+		if !ok {
+			t.Errorf("message %v has no Go type", name)
+			continue
+		}
+		goFields := make(map[string]reflect.StructField)
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			goFields[strings.Split(field.Tag.Get("json"), ",")[0]] = field
+		}
+		for _, line := range strings.Split(body, "\n") {
+			field := protoField.FindStringSubmatch(line)
+			if field == nil {
+				continue
+			}
+			want := goType(t, field[2])
+			if field[1] != "" {
+				want = reflect.SliceOf(want)
+			}
+			json := jsonName(field[3])
+			goField, ok := goFields[json]
+			if !ok {
+				t.Errorf("%v.%v has no Go field with the json name %q", name, field[3], json)
+				continue
+			}
+			delete(goFields, json)
+			if goField.Type != want {
+				t.Errorf("%v.%v is %v in Go, want %v", name, field[3], goField.Type, want)
+			}
+		}
+		for json := range goFields {
+			t.Errorf("%v.%v is not in the proto", name, json)
+		}
+	}
+}
+
+// TestClientHasEveryRpc fails when the service of the proto gains a method
+// the client does not have.
+func TestClientHasEveryRpc(t *testing.T) {
+	client := reflect.TypeOf(&Client{})
+	for _, rpc := range protoRpc.FindAllStringSubmatch(readProto(t), -1) {
+		method, ok := client.MethodByName(rpc[1])
+		if !ok {
+			t.Errorf("Client has no method %v", rpc[1])
+			continue
+		}
+		// Methods take a context and the request and return the response,
+		// or a stream of them, and an error.
+		if method.Type.NumIn() != 3 || method.Type.In(2) != reflect.PointerTo(messages[rpc[2]]) {
+			t.Errorf("Client.%v takes %v, want *%v", rpc[1], method.Type, rpc[2])
+		}
+		want := reflect.PointerTo(messages[rpc[4]])
+		if rpc[3] != "" {
+			want = reflect.TypeOf(&StatusStream{})
+		}
+		if method.Type.NumOut() != 2 || method.Type.Out(0) != want {
+			t.Errorf("Client.%v returns %v, want %v", rpc[1], method.Type, want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package submission
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	manager "github.com/amitiwary999/task-scheduler/manager"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// The parts of the Connect protocol the service uses: unary calls are a
+// JSON POST, and a server stream is a series of envelopes, each a flags
+// byte and a big-endian length before a JSON message, ending with an
+// end-stream envelope that carries the error, if any.
+const (
+	ServicePath          = "/taskscheduler.v1.SubmissionService/"
+	contentTypeJson      = "application/json"
+	contentTypeStream    = "application/connect+json"
+	protocolVersion      = "1"
+	headerVersion        = "Connect-Protocol-Version"
+	headerTimeout        = "Connect-Timeout-Ms"
+	flagEndStream        = 0x02
+	maxMessageSize       = 4 * 1024 * 1024
+	envelopeHeaderLength = 5
+)
+
+// Error is an error as the Connect protocol sends it. Not found and
+// resource exhausted errors unwrap to storage.ErrTaskNotFound and
+// manager.ErrQueueFull.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	switch e.Code {
+	case util.CONNECT_CODE_NOT_FOUND:
+		return storage.ErrTaskNotFound
+	case util.CONNECT_CODE_RESOURCE_EXHAUSTED:
+		return manager.ErrQueueFull
+	}
+	return nil
+}
+
+func errorf(code string, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// httpStatus is the status a unary call fails with, per the Connect
+// protocol.
+func httpStatus(code string) int {
+	switch code {
+	case util.CONNECT_CODE_CANCELED:
+		return 499
+	case util.CONNECT_CODE_INVALID_ARGUMENT, util.CONNECT_CODE_FAILED_PRECONDITION:
+		return http.StatusBadRequest
+	case util.CONNECT_CODE_DEADLINE_EXCEEDED:
+		return http.StatusGatewayTimeout
+	case util.CONNECT_CODE_NOT_FOUND:
+		return http.StatusNotFound
+	case util.CONNECT_CODE_RESOURCE_EXHAUSTED:
+		return http.StatusTooManyRequests
+	case util.CONNECT_CODE_UNIMPLEMENTED:
+		return http.StatusNotImplemented
+	case util.CONNECT_CODE_UNAVAILABLE:
+		return http.StatusServiceUnavailable
+	case util.CONNECT_CODE_UNAUTHENTICATED:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// codeForStatus is the code of a failed unary call whose body is not a
+// Connect error, like one a proxy answered.
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return util.CONNECT_CODE_INVALID_ARGUMENT
+	case http.StatusUnauthorized:
+		return util.CONNECT_CODE_UNAUTHENTICATED
+	case http.StatusNotFound:
+		return util.CONNECT_CODE_UNIMPLEMENTED
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return util.CONNECT_CODE_UNAVAILABLE
+	default:
+		return util.CONNECT_CODE_UNKNOWN
+	}
+}
+
+func writeEnvelope(w io.Writer, flags byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, envelopeHeaderLength)
+	header[0] = flags
+	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readEnvelope reads the next envelope of r. It returns io.EOF only when r
+// ends before one starts.
+func readEnvelope(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, envelopeHeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, errorf(util.CONNECT_CODE_INVALID_ARGUMENT, "truncated envelope")
+		}
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return 0, nil, errorf(util.CONNECT_CODE_INVALID_ARGUMENT, "message of %v bytes is over the limit of %v", size, maxMessageSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, errorf(util.CONNECT_CODE_INVALID_ARGUMENT, "truncated envelope")
+	}
+	return header[0], data, nil
+}
+
+// endStream is the message of the last envelope of a stream.
+type endStream struct {
+	Error *Error `json:"error,omitempty"`
+}
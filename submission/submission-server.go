@@ -0,0 +1,329 @@
+package submission
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	manager "github.com/amitiwary999/task-scheduler/manager"
+	model "github.com/amitiwary999/task-scheduler/model"
+	scheduler "github.com/amitiwary999/task-scheduler/scheduler"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// Scheduler is what the service needs of a scheduler.TaskScheduler.
+type Scheduler interface {
+	AddNewTaskContext(ctx context.Context, task model.Task) (string, error)
+	AddBatch(batch model.Batch) (string, []string, error)
+	GetTask(id string) (*model.TaskDetail, error)
+	CancelTask(id string) (bool, error)
+	Wait(ctx context.Context, id string) error
+}
+
+// Handler serves SubmissionService. Submitted tasks need a type with a
+// handler on some server of the cluster. Without WithAuth anyone who can
+// reach the handler may submit and cancel tasks.
+type Handler struct {
+	scheduler Scheduler
+	allowed   func(r *http.Request) bool
+}
+
+// Option configures a Handler.
+type Option func(h *Handler)
+
+// WithAuth fails the calls allowed rejects with unauthenticated, like ones
+// without the right bearer token; admin.BearerToken is such a check.
+func WithAuth(allowed func(r *http.Request) bool) Option {
+	return func(h *Handler) {
+		h.allowed = allowed
+	}
+}
+
+func NewHandler(scheduler Scheduler, opts ...Option) *Handler {
+	h := &Handler{scheduler: scheduler}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Mount serves the service on mux under prefix, which may be empty.
+// Clients then use the server's url with prefix as their base url.
+func (h *Handler) Mount(mux *http.ServeMux, prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	mux.Handle(prefix+ServicePath, http.StripPrefix(prefix, h))
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if h.allowed != nil && !h.allowed(r) {
+		h.writeError(w, errorf(util.CONNECT_CODE_UNAUTHENTICATED, "unauthorized"))
+		return
+	}
+	ctx := r.Context()
+	if timeout := r.Header.Get(headerTimeout); timeout != "" {
+		ms, err := strconv.ParseInt(timeout, 10, 64)
+		if err != nil {
+			h.writeError(w, errorf(util.CONNECT_CODE_INVALID_ARGUMENT, "bad %v %q", headerTimeout, timeout))
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+		defer cancel()
+	}
+	switch strings.TrimPrefix(r.URL.Path, ServicePath) {
+	case "Submit":
+		var req SubmitRequest
+		unary(h, w, r, &req, func() (interface{}, error) { return h.submit(ctx, &req) })
+	case "SubmitBatch":
+		var req SubmitBatchRequest
+		unary(h, w, r, &req, func() (interface{}, error) { return h.submitBatch(&req) })
+	case "GetStatus":
+		var req GetStatusRequest
+		unary(h, w, r, &req, func() (interface{}, error) { return h.getStatus(&req) })
+	case "Cancel":
+		var req CancelRequest
+		unary(h, w, r, &req, func() (interface{}, error) { return h.cancel(&req) })
+	case "WatchStatus":
+		h.serveWatch(ctx, w, r)
+	default:
+		h.writeError(w, errorf(util.CONNECT_CODE_UNIMPLEMENTED, "no method %v", r.URL.Path))
+	}
+}
+
+func unary(h *Handler, w http.ResponseWriter, r *http.Request, req interface{}, call func() (interface{}, error)) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != contentTypeJson {
+		w.Header().Set("Accept-Post", contentTypeJson)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		h.writeError(w, errorf(util.CONNECT_CODE_UNIMPLEMENTED, "unsupported content encoding %q", encoding))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+	if err != nil {
+		h.writeError(w, errorf(util.CONNECT_CODE_INVALID_ARGUMENT, "read request: %v", err))
+		return
+	}
+	if len(body) > maxMessageSize {
+		h.writeError(w, errorf(util.CONNECT_CODE_INVALID_ARGUMENT, "request is over the limit of %v bytes", maxMessageSize))
+		return
+	}
+	if err := json.Unmarshal(body, req); err != nil {
+		h.writeError(w, errorf(util.CONNECT_CODE_INVALID_ARGUMENT, "decode request: %v", err))
+		return
+	}
+	resp, err := call()
+	if err != nil {
+		h.writeError(w, toError(err))
+		return
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		h.writeError(w, toError(err))
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJson)
+	w.Write(data)
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, err *Error) {
+	w.Header().Set("Content-Type", contentTypeJson)
+	w.WriteHeader(httpStatus(err.Code))
+	json.NewEncoder(w).Encode(err)
+}
+
+func (h *Handler) submit(ctx context.Context, req *SubmitRequest) (*SubmitResponse, error) {
+	if req.Type == "" {
+		return nil, errorf(util.CONNECT_CODE_INVALID_ARGUMENT, "task needs a type")
+	}
+	id, err := h.scheduler.AddNewTaskContext(ctx, model.Task{Meta: req.meta()})
+	if err != nil {
+		return nil, err
+	}
+	return &SubmitResponse{Id: id}, nil
+}
+
+func (h *Handler) submitBatch(req *SubmitBatchRequest) (*SubmitBatchResponse, error) {
+	var batch model.Batch
+	for i, task := range req.Tasks {
+		if task == nil || task.Type == "" {
+			return nil, errorf(util.CONNECT_CODE_INVALID_ARGUMENT, "task %v needs a type", i)
+		}
+		batch.Tasks = append(batch.Tasks, task.meta())
+	}
+	if req.OnComplete != nil {
+		if req.OnComplete.Type == "" {
+			return nil, errorf(util.CONNECT_CODE_INVALID_ARGUMENT, "onComplete task needs a type")
+		}
+		onComplete := req.OnComplete.meta()
+		batch.OnComplete = &onComplete
+	}
+	batchId, ids, err := h.scheduler.AddBatch(batch)
+	if err != nil {
+		return nil, err
+	}
+	return &SubmitBatchResponse{BatchId: batchId, Ids: ids}, nil
+}
+
+func (h *Handler) getStatus(req *GetStatusRequest) (*TaskStatus, error) {
+	task, err := h.scheduler.GetTask(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return taskStatus(task), nil
+}
+
+func (h *Handler) cancel(req *CancelRequest) (*CancelResponse, error) {
+	if _, err := h.scheduler.GetTask(req.Id); err != nil {
+		return nil, err
+	}
+	cancelled, err := h.scheduler.CancelTask(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &CancelResponse{Cancelled: cancelled}, nil
+}
+
+func (h *Handler) serveWatch(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != contentTypeStream {
+		w.Header().Set("Accept-Post", contentTypeStream)
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeStream)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	var mu sync.Mutex
+	send := func(status *TaskStatus) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := writeEnvelope(w, 0, status); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	var end endStream
+	var req WatchStatusRequest
+	_, data, err := readEnvelope(r.Body)
+	if err == nil {
+		err = json.Unmarshal(data, &req)
+	}
+	if err != nil {
+		end.Error = errorf(util.CONNECT_CODE_INVALID_ARGUMENT, "decode request: %v", err)
+	} else if err := h.watchStatus(ctx, &req, send); err != nil {
+		end.Error = toError(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	writeEnvelope(w, flagEndStream, end)
+}
+
+// watchStatus sends the status of every task of req, then each change it
+// sees until all of them finished. It looks again whenever Wait says a
+// task finished and every WATCH_POLL_INTERVAL, which is what catches tasks
+// starting.
+func (h *Handler) watchStatus(ctx context.Context, req *WatchStatusRequest, send func(*TaskStatus) error) error {
+	if len(req.Ids) == 0 {
+		return errorf(util.CONNECT_CODE_INVALID_ARGUMENT, "no task ids to watch")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watching := make(map[string]*TaskStatus)
+	for _, id := range req.Ids {
+		task, err := h.scheduler.GetTask(id)
+		if err != nil {
+			return err
+		}
+		status := taskStatus(task)
+		if err := send(status); err != nil {
+			return err
+		}
+		if !isTerminal(status.Status) {
+			watching[id] = status
+		}
+	}
+	finished := make(chan struct{}, 1)
+	for id := range watching {
+		go func(id string) {
+			if h.scheduler.Wait(ctx, id) != nil && ctx.Err() != nil {
+				return
+			}
+			select {
+			case finished <- struct{}{}:
+			default:
+			}
+		}(id)
+	}
+	ticker := time.NewTicker(util.WATCH_POLL_INTERVAL * time.Second)
+	defer ticker.Stop()
+	for len(watching) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-finished:
+		}
+		for id, last := range watching {
+			task, err := h.scheduler.GetTask(id)
+			if err != nil {
+				return err
+			}
+			status := taskStatus(task)
+			if status.Status != last.Status || status.Attempt != last.Attempt {
+				if err := send(status); err != nil {
+					return err
+				}
+				watching[id] = status
+			}
+			if isTerminal(status.Status) {
+				delete(watching, id)
+			}
+		}
+	}
+	return nil
+}
+
+func isTerminal(status string) bool {
+	return status == util.TASK_STATUS_COMPLETED || status == util.TASK_STATUS_FAILED || status == util.TASK_STATUS_CANCELLED
+}
+
+// toError turns an error of the scheduler into the Connect error a client
+// can act on.
+func toError(err error) *Error {
+	var connectErr *Error
+	switch {
+	case errors.As(err, &connectErr):
+		return connectErr
+	case errors.Is(err, storage.ErrTaskNotFound):
+		return &Error{Code: util.CONNECT_CODE_NOT_FOUND, Message: err.Error()}
+	case errors.Is(err, manager.ErrQueueFull):
+		return &Error{Code: util.CONNECT_CODE_RESOURCE_EXHAUSTED, Message: err.Error()}
+	case errors.Is(err, scheduler.ErrPayloadTooLarge), errors.Is(err, scheduler.ErrInvalidBatch):
+		return &Error{Code: util.CONNECT_CODE_INVALID_ARGUMENT, Message: err.Error()}
+	case errors.Is(err, manager.ErrTaskState):
+		return &Error{Code: util.CONNECT_CODE_FAILED_PRECONDITION, Message: err.Error()}
+	case errors.Is(err, context.Canceled):
+		return &Error{Code: util.CONNECT_CODE_CANCELED, Message: err.Error()}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Code: util.CONNECT_CODE_DEADLINE_EXCEEDED, Message: err.Error()}
+	default:
+		return &Error{Code: util.CONNECT_CODE_INTERNAL, Message: err.Error()}
+	}
+}
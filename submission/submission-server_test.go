@@ -0,0 +1,362 @@
+package submission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	manager "github.com/amitiwary999/task-scheduler/manager"
+	model "github.com/amitiwary999/task-scheduler/model"
+	scheduler "github.com/amitiwary999/task-scheduler/scheduler"
+	storage "github.com/amitiwary999/task-scheduler/storage"
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// fakeScheduler keeps tasks in memory. Submitting a task of type "full"
+// fails as a full queue would, and "large" as a payload over the limit.
+type fakeScheduler struct {
+	mu      sync.Mutex
+	tasks   map[string]*model.TaskDetail
+	batches []model.Batch
+	next    int
+}
+
+func newFakeScheduler() *fakeScheduler {
+	return &fakeScheduler{tasks: make(map[string]*model.TaskDetail)}
+}
+
+func (f *fakeScheduler) add(meta model.TaskMeta) string {
+	f.next++
+	id := fmt.Sprintf("task-%v", f.next)
+	f.tasks[id] = &model.TaskDetail{Id: id, Meta: meta, Status: util.TASK_STATUS_PENDING}
+	return id
+}
+
+func (f *fakeScheduler) AddNewTaskContext(ctx context.Context, task model.Task) (string, error) {
+	switch task.Meta.Type {
+	case "full":
+		return "", manager.ErrQueueFull
+	case "large":
+		return "", scheduler.ErrPayloadTooLarge
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.add(task.Meta), nil
+}
+
+func (f *fakeScheduler) AddBatch(batch model.Batch) (string, []string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, batch)
+	var ids []string
+	for _, meta := range batch.Tasks {
+		ids = append(ids, f.add(meta))
+	}
+	return fmt.Sprintf("batch-%v", len(f.batches)), ids, nil
+}
+
+func (f *fakeScheduler) GetTask(id string) (*model.TaskDetail, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	task, ok := f.tasks[id]
+	if !ok {
+		return nil, storage.ErrTaskNotFound
+	}
+	detail := *task
+	return &detail, nil
+}
+
+func (f *fakeScheduler) CancelTask(id string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	task := f.tasks[id]
+	if task == nil || isTerminal(task.Status) {
+		return false, nil
+	}
+	task.Status = util.TASK_STATUS_CANCELLED
+	return true, nil
+}
+
+func (f *fakeScheduler) Wait(ctx context.Context, id string) error {
+	for {
+		task, err := f.GetTask(id)
+		if err != nil {
+			return err
+		}
+		if isTerminal(task.Status) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (f *fakeScheduler) setStatus(id string, status string, result []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tasks[id].Status = status
+	f.tasks[id].Result = result
+}
+
+// serve starts the service on an httptest server under /submit and returns
+// a client of it.
+func serve(t *testing.T, s Scheduler, opts ...Option) (*httptest.Server, *Client) {
+	t.Helper()
+	mux := http.NewServeMux()
+	NewHandler(s, opts...).Mount(mux, "/submit")
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, NewClient(server.URL+"/submit", server.Client())
+}
+
+func TestSubmitGetStatusAndCancel(t *testing.T) {
+	fake := newFakeScheduler()
+	_, client := serve(t, fake)
+	ctx := context.Background()
+
+	submitted, err := client.Submit(ctx, &SubmitRequest{Type: "report", Payload: []byte{0, 1, 2}, Queue: "slow", MaxRetry: 2, DelaySeconds: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err := fake.GetTask(submitted.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Meta.Type != "report" || string(task.Meta.Payload) != "\x00\x01\x02" || task.Meta.Queue != "slow" || task.Meta.MaxRetry != 2 {
+		t.Errorf("submitted %+v, want the request's type, payload, queue and retries", task.Meta)
+	}
+	if delay := task.Meta.ExecutionTime - time.Now().Unix(); delay < 58 || delay > 60 {
+		t.Errorf("task runs in %v seconds, want 60", delay)
+	}
+
+	fake.setStatus(submitted.Id, util.TASK_STATUS_COMPLETED, []byte("done"))
+	status, err := client.GetStatus(ctx, &GetStatusRequest{Id: submitted.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Id != submitted.Id || status.Type != "report" || status.Status != util.TASK_STATUS_COMPLETED || string(status.Result) != "done" {
+		t.Errorf("status = %+v, want report completed with its result", status)
+	}
+
+	cancelled, err := client.Cancel(ctx, &CancelRequest{Id: submitted.Id})
+	if err != nil || cancelled.Cancelled {
+		t.Errorf("Cancel of a completed task = %+v, %v, want not cancelled", cancelled, err)
+	}
+	pending, err := client.Submit(ctx, &SubmitRequest{Type: "report"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err = client.Cancel(ctx, &CancelRequest{Id: pending.Id})
+	if err != nil || !cancelled.Cancelled {
+		t.Errorf("Cancel of a pending task = %+v, %v, want cancelled", cancelled, err)
+	}
+}
+
+func TestSubmitBatch(t *testing.T) {
+	fake := newFakeScheduler()
+	_, client := serve(t, fake)
+
+	resp, err := client.SubmitBatch(context.Background(), &SubmitBatchRequest{
+		Tasks:      []*SubmitRequest{{Type: "resize"}, {Type: "resize"}},
+		OnComplete: &SubmitRequest{Type: "notify"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.BatchId != "batch-1" || len(resp.Ids) != 2 {
+		t.Fatalf("SubmitBatch = %+v, want batch-1 with two tasks", resp)
+	}
+	batch := fake.batches[0]
+	if len(batch.Tasks) != 2 || batch.OnComplete == nil || batch.OnComplete.Type != "notify" {
+		t.Errorf("batch = %+v, want two tasks and a notify callback", batch)
+	}
+}
+
+func TestWatchStatusEndsOnceEveryTaskFinished(t *testing.T) {
+	fake := newFakeScheduler()
+	_, client := serve(t, fake)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	first, _ := client.Submit(ctx, &SubmitRequest{Type: "work"})
+	second, _ := client.Submit(ctx, &SubmitRequest{Type: "work"})
+	stream, err := client.WatchStatus(ctx, &WatchStatusRequest{Ids: []string{first.Id, second.Id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	last := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		status, err := stream.Receive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Status != util.TASK_STATUS_PENDING {
+			t.Errorf("first status of %v = %v, want pending", status.Id, status.Status)
+		}
+		last[status.Id] = status.Status
+	}
+	fake.setStatus(first.Id, util.TASK_STATUS_COMPLETED, nil)
+	fake.setStatus(second.Id, util.TASK_STATUS_FAILED, nil)
+	for {
+		status, err := stream.Receive()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		last[status.Id] = status.Status
+	}
+	if last[first.Id] != util.TASK_STATUS_COMPLETED || last[second.Id] != util.TASK_STATUS_FAILED {
+		t.Errorf("last statuses = %v, want completed and failed", last)
+	}
+	if _, err := stream.Receive(); err != io.EOF {
+		t.Errorf("Receive after the end = %v, want io.EOF", err)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	fake := newFakeScheduler()
+	_, client := serve(t, fake)
+	ctx := context.Background()
+
+	receive := func(req *WatchStatusRequest) error {
+		stream, err := client.WatchStatus(ctx, req)
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+		for {
+			if _, err := stream.Receive(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		call func() error
+		code string
+		is   error
+	}{
+		{name: "submit without type", code: util.CONNECT_CODE_INVALID_ARGUMENT, call: func() error {
+			_, err := client.Submit(ctx, &SubmitRequest{})
+			return err
+		}},
+		{name: "submit to a full queue", code: util.CONNECT_CODE_RESOURCE_EXHAUSTED, is: manager.ErrQueueFull, call: func() error {
+			_, err := client.Submit(ctx, &SubmitRequest{Type: "full"})
+			return err
+		}},
+		{name: "submit a large payload", code: util.CONNECT_CODE_INVALID_ARGUMENT, call: func() error {
+			_, err := client.Submit(ctx, &SubmitRequest{Type: "large"})
+			return err
+		}},
+		{name: "batch task without type", code: util.CONNECT_CODE_INVALID_ARGUMENT, call: func() error {
+			_, err := client.SubmitBatch(ctx, &SubmitBatchRequest{Tasks: []*SubmitRequest{{Type: "a"}, {}}})
+			return err
+		}},
+		{name: "status of a missing task", code: util.CONNECT_CODE_NOT_FOUND, is: storage.ErrTaskNotFound, call: func() error {
+			_, err := client.GetStatus(ctx, &GetStatusRequest{Id: "missing"})
+			return err
+		}},
+		{name: "cancel a missing task", code: util.CONNECT_CODE_NOT_FOUND, is: storage.ErrTaskNotFound, call: func() error {
+			_, err := client.Cancel(ctx, &CancelRequest{Id: "missing"})
+			return err
+		}},
+		{name: "watch nothing", code: util.CONNECT_CODE_INVALID_ARGUMENT, call: func() error {
+			return receive(&WatchStatusRequest{})
+		}},
+		{name: "watch a missing task", code: util.CONNECT_CODE_NOT_FOUND, is: storage.ErrTaskNotFound, call: func() error {
+			return receive(&WatchStatusRequest{Ids: []string{"missing"}})
+		}},
+		{name: "unknown method", code: util.CONNECT_CODE_UNIMPLEMENTED, call: func() error {
+			return client.call(ctx, "Resubmit", &SubmitRequest{}, &SubmitResponse{})
+		}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.call()
+			var connectErr *Error
+			if !errors.As(err, &connectErr) || connectErr.Code != tc.code {
+				t.Fatalf("err = %v, want code %v", err, tc.code)
+			}
+			if tc.is != nil && !errors.Is(err, tc.is) {
+				t.Errorf("err = %v, want it to wrap %v", err, tc.is)
+			}
+		})
+	}
+}
+
+func TestPlainJsonPost(t *testing.T) {
+	fake := newFakeScheduler()
+	server, _ := serve(t, fake)
+	url := server.URL + "/submit" + ServicePath
+
+	resp, err := http.Post(url+"Submit", "application/json", strings.NewReader(`{"type": "report", "payload": "AAEC"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"id":"task-1"`) {
+		t.Fatalf("Submit = %v %s, want 200 with the id", resp.StatusCode, body)
+	}
+	if task, _ := fake.GetTask("task-1"); string(task.Meta.Payload) != "\x00\x01\x02" {
+		t.Errorf("payload = %q, want it decoded from base64", task.Meta.Payload)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		timeout     string
+		want        int
+	}{
+		{name: "wrong content type", contentType: "text/plain", want: http.StatusUnsupportedMediaType},
+		{name: "bad timeout", contentType: "application/json", timeout: "soon", want: http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, url+"GetStatus", strings.NewReader(`{"id": "task-1"}`))
+		req.Header.Set("Content-Type", tc.contentType)
+		if tc.timeout != "" {
+			req.Header.Set(headerTimeout, tc.timeout)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%v: status = %v, want %v", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+func TestWithAuth(t *testing.T) {
+	fake := newFakeScheduler()
+	_, client := serve(t, fake, WithAuth(func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer secret"
+	}))
+	ctx := context.Background()
+
+	var connectErr *Error
+	if _, err := client.Submit(ctx, &SubmitRequest{Type: "report"}); !errors.As(err, &connectErr) || connectErr.Code != util.CONNECT_CODE_UNAUTHENTICATED {
+		t.Fatalf("Submit without a token = %v, want unauthenticated", err)
+	}
+	if _, err := client.WatchStatus(ctx, &WatchStatusRequest{Ids: []string{"a"}}); !errors.As(err, &connectErr) || connectErr.Code != util.CONNECT_CODE_UNAUTHENTICATED {
+		t.Fatalf("WatchStatus without a token = %v, want unauthenticated", err)
+	}
+	client.SetToken("secret")
+	if _, err := client.Submit(ctx, &SubmitRequest{Type: "report"}); err != nil {
+		t.Errorf("Submit with the token = %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+// StdoutExporter writes every span as a line of JSON.
+type StdoutExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	logger util.Logger
+}
+
+// NewStdoutExporter writes to w, or to os.Stdout when w is nil, and logs
+// spans it cannot encode to logger, or slog.Default() when logger is nil.
+func NewStdoutExporter(w io.Writer, logger util.Logger) *StdoutExporter {
+	if w == nil {
+		w = os.Stdout
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &StdoutExporter{w: w, logger: logger}
+}
+
+func (e *StdoutExporter) Export(span SpanData) {
+	line, err := json.Marshal(span)
+	if err != nil {
+		e.logger.Error("failed to encode span", "span", span.Name, "error", err)
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(append(line, '\n'))
+}
+
+// InMemoryExporter keeps the spans, for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the spans exported so far, oldest first.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,71 @@
+// Package oteltracing runs the scheduler's spans on OpenTelemetry, so they
+// go to whatever exporter the application set up for the rest of its
+// traces.
+package oteltracing
+
+import (
+	"context"
+
+	util "github.com/amitiwary999/task-scheduler/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer is a util.Tracer over an OpenTelemetry tracer. Trace context
+// crosses servers as a W3C traceparent, whatever propagator the
+// application uses for its own requests.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TraceContext
+}
+
+var _ util.Tracer = (*Tracer)(nil)
+
+// NewTracer starts spans with tracer, for example
+// otel.Tracer("github.com/amitiwary999/task-scheduler").
+func NewTracer(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, util.Span) {
+	ctx, otelSpan := t.tracer.Start(ctx, name)
+	return ctx, &span{span: otelSpan, propagator: t.propagator}
+}
+
+// Extract makes the span of traceParent the parent of spans started from
+// the returned context. An invalid traceParent leaves ctx as it is.
+func (t *Tracer) Extract(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return t.propagator.Extract(ctx, propagation.MapCarrier{util.TRACE_PARENT_HEADER: traceParent})
+}
+
+type span struct {
+	span       trace.Span
+	propagator propagation.TraceContext
+}
+
+func (s *span) SetAttribute(key string, value string) {
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+func (s *span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *span) TraceParent() string {
+	carrier := propagation.MapCarrier{}
+	s.propagator.Inject(trace.ContextWithSpan(context.Background(), s.span), carrier)
+	return carrier[util.TRACE_PARENT_HEADER]
+}
+
+func (s *span) End() {
+	s.span.End()
+}
@@ -0,0 +1,72 @@
+package oteltracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracer() (*Tracer, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return NewTracer(provider.Tracer("test")), recorder
+}
+
+func TestSpansAreParented(t *testing.T) {
+	tracer, recorder := newTestTracer()
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttribute("task.type", "email")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended %v spans, want 2", len(spans))
+	}
+	childSpan, parentSpan := spans[0], spans[1]
+	if childSpan.Parent().SpanID() != parentSpan.SpanContext().SpanID() || childSpan.SpanContext().TraceID() != parentSpan.SpanContext().TraceID() {
+		t.Errorf("child %v is not a child of %v", childSpan.Parent(), parentSpan.SpanContext())
+	}
+	if childSpan.Status().Code != codes.Error || len(childSpan.Events()) != 1 {
+		t.Errorf("child status %v events %v, want the error recorded", childSpan.Status(), childSpan.Events())
+	}
+	if attrs := childSpan.Attributes(); len(attrs) != 1 || attrs[0].Value.AsString() != "email" {
+		t.Errorf("child attributes = %v", attrs)
+	}
+}
+
+func TestTraceParentRoundTrip(t *testing.T) {
+	tracer, recorder := newTestTracer()
+	_, submit := tracer.Start(context.Background(), "task.submit")
+	traceParent := submit.TraceParent()
+	submit.End()
+	if traceParent == "" {
+		t.Fatal("no traceparent for a sampled span")
+	}
+
+	// Another server continues the trace from the traceparent alone.
+	_, execute := tracer.Start(tracer.Extract(context.Background(), traceParent), "task.execute")
+	execute.End()
+
+	spans := recorder.Ended()
+	submitSpan, executeSpan := spans[0], spans[1]
+	if !executeSpan.Parent().IsRemote() || executeSpan.Parent().SpanID() != submitSpan.SpanContext().SpanID() {
+		t.Errorf("execute parent = %v, want the submit span %v", executeSpan.Parent(), submitSpan.SpanContext())
+	}
+	if executeSpan.SpanContext().TraceID() != submitSpan.SpanContext().TraceID() {
+		t.Error("execute span is in another trace")
+	}
+
+	ctx := tracer.Extract(context.Background(), "not-a-traceparent")
+	_, root := tracer.Start(ctx, "root")
+	root.End()
+	if parent := recorder.Ended()[2].Parent(); parent.IsValid() {
+		t.Errorf("invalid traceparent gave parent %v", parent)
+	}
+}
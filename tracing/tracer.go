@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	util "github.com/amitiwary999/task-scheduler/util"
+)
+
+type spanContextKey struct{}
+
+// SpanData is a finished span as exporters get it.
+type SpanData struct {
+	Name       string            `json:"name"`
+	TraceId    string            `json:"traceId"`
+	SpanId     string            `json:"spanId"`
+	ParentId   string            `json:"parentId,omitempty"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+func (sd SpanData) Duration() time.Duration {
+	return sd.End.Sub(sd.Start)
+}
+
+// Exporter receives every span when it ends.
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// Tracer is a util.Tracer that hands finished spans to an exporter.
+type Tracer struct {
+	exporter Exporter
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, util.Span) {
+	parent, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	sc := SpanContext{TraceId: parent.TraceId, SpanId: newSpanId(), Sampled: true}
+	data := SpanData{Name: name, Start: time.Now()}
+	if parent.IsValid() {
+		sc.Sampled = parent.Sampled
+		data.ParentId = hex.EncodeToString(parent.SpanId[:])
+	} else {
+		sc.TraceId = newTraceId()
+	}
+	data.TraceId = hex.EncodeToString(sc.TraceId[:])
+	data.SpanId = hex.EncodeToString(sc.SpanId[:])
+	s := &span{tracer: t, context: sc, data: data}
+	return context.WithValue(ctx, spanContextKey{}, sc), s
+}
+
+// Extract makes the span of traceParent the parent of spans started from
+// the returned context. An invalid traceParent leaves ctx as it is.
+func (t *Tracer) Extract(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	sc, err := ParseTraceParent(traceParent)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// TraceParent returns the traceparent of the span in ctx, for passing the
+// trace on to other services. It is empty when ctx has no span.
+func TraceParent(ctx context.Context) string {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	if !ok || !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceParent()
+}
+
+type span struct {
+	tracer  *Tracer
+	context SpanContext
+	mu      sync.Mutex
+	data    SpanData
+	ended   bool
+}
+
+func (s *span) SetAttribute(key string, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]string)
+	}
+	s.data.Attributes[key] = value
+}
+
+func (s *span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+func (s *span) TraceParent() string {
+	return s.context.TraceParent()
+}
+
+// End exports the span once; later calls do nothing.
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	if s.context.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.Export(data)
+	}
+}
@@ -0,0 +1,17 @@
+package util
+
+import "encoding/json"
+
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return CODEC_JSON
+}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
@@ -13,8 +13,106 @@ const RABBITMQ_CONSUMER_TAG = "task-consumer"
 const SUPABASE_JOBDETAIL = "JobDetail"
 const SUPABASE_JOBSERVERS = "JobServers"
 const SUPABASE_JOBCONFIG = "JobConfig"
+const SUPABASE_WORKFLOW = "Workflow"
+const SUPABASE_WORKFLOW_NODE = "WorkflowNode"
+const SUPABASE_BATCH = "Batch"
 const SERVER_JOIN_RABBITMQ_QUEUE = "serverjoin"
 const RABBITMQ_SERVER_JOIN_EXCHANGE_KEY = "joinserversondesh"
 const RABBITMQ_COMPLETE_TASK_EXCHANGE_KEY = "complete-task-sondesh"
 const RABBITMQ_TASK_COMPLETE_QUEUE = "complete-tasks"
 const POSTGRES_QUERY_TIMEOUT = 10
+const RABBITMQ_DEAD_LETTER_SUFFIX = ".dead"
+const RABBITMQ_ATTEMPT_HEADER = "x-task-attempt"
+const RABBITMQ_MAX_ATTEMPTS = 2
+const SERVER_STATUS_ACTIVE = 1
+const SERVER_STATUS_LEFT = 0
+const SERVER_STATUS_JOINING = 2
+const JOIN_ANNOUNCE_INTERVAL = 100
+const JOIN_ANNOUNCE_ATTEMPTS = 50
+const TASK_STATUS_PENDING = "pending"
+const TASK_STATUS_RUNNING = "running"
+const TASK_STATUS_COMPLETED = "completed"
+const TASK_STATUS_FAILED = "failed"
+const TASK_STATUS_CANCELLED = "cancelled"
+const WORKFLOW_NODE_WAITING = "waiting"
+const WORKFLOW_NODE_SCHEDULED = "scheduled"
+const WORKFLOW_NODE_SKIPPED = "skipped"
+const WORKFLOW_COMPENSATING = "compensating"
+const WORKFLOW_COMPENSATED = "compensated"
+const WORKFLOW_COMPENSATION_FAILED = "compensation_failed"
+const POSTGRES_TASK_CHANNEL = "jobdetail_events"
+const RABBITMQ_DEAD_LETTER_EXCHANGE = "sondesh-dead"
+const CLAIM_POLL_INTERVAL = 1
+const CLAIM_SAFETY_INTERVAL = 30
+const SUPABASE_PAGE_SIZE = 1000
+const CODEC_JSON = "json"
+const DEFAULT_MAX_PAYLOAD_SIZE = 256 * 1024
+const SERVER_HEARTBEAT_INTERVAL = 10
+const SERVER_STALE_AFTER = 60
+const DEFAULT_RETRY_DELAY = 5
+const MAX_RETRY_DELAY = 3600
+const RATE_LIMIT_TOKEN_BUCKET = "token_bucket"
+const RATE_LIMIT_SLIDING_WINDOW = "sliding_window"
+const SUPABASE_RATE_LIMIT = "JobRateLimit"
+const RATE_LIMIT_MAX_CONFLICTS = 5
+const DEFAULT_QUEUE = "default"
+const AUTOSCALE_INTERVAL = 10
+const BACKPRESSURE_BLOCK = "block"
+const BACKPRESSURE_REJECT = "reject"
+const BACKPRESSURE_SPILL = "spill"
+const PAUSE_SCOPE_SCHEDULER = "scheduler"
+const PAUSE_SCOPE_QUEUE = "queue"
+const PAUSE_SCOPE_TYPE = "type"
+const PAUSE_REFRESH_INTERVAL = 5
+const SUPABASE_PAUSE = "JobPause"
+const AUTOSCALE_TARGET_WAIT = 1000
+const METRICS_INTERVAL = 5
+const METRIC_TASKS_SUBMITTED = "taskscheduler_tasks_submitted_total"
+const METRIC_TASKS_SUCCEEDED = "taskscheduler_tasks_succeeded_total"
+const METRIC_TASKS_FAILED = "taskscheduler_tasks_failed_total"
+const METRIC_TASKS_RETRIED = "taskscheduler_tasks_retried_total"
+const METRIC_TASKS_REJECTED = "taskscheduler_tasks_rejected_total"
+const METRIC_TASKS_SPILLED = "taskscheduler_tasks_spilled_total"
+const METRIC_QUEUE_DEPTH = "taskscheduler_queue_depth"
+const METRIC_QUEUE_WORKERS = "taskscheduler_queue_workers"
+const METRIC_QUEUE_BUSY_WORKERS = "taskscheduler_queue_busy_workers"
+const METRIC_DELAYED_TASKS = "taskscheduler_delayed_tasks"
+const METRIC_QUEUE_WAIT = "taskscheduler_queue_wait_seconds"
+const METRIC_EXECUTION_TIME = "taskscheduler_execution_seconds"
+const METRIC_STORAGE_LATENCY = "taskscheduler_storage_seconds"
+const TRACE_PARENT_HEADER = "traceparent"
+const SUPABASE_TASK_LOG = "JobLog"
+const MAX_TASK_LOG_SIZE = 64 * 1024
+const TASK_EVENT_ANY = "*"
+const TASK_EVENT_SUBMITTED = "submitted"
+const TASK_EVENT_STARTED = "started"
+const TASK_EVENT_SUCCEEDED = "succeeded"
+const TASK_EVENT_FAILED = "failed"
+const TASK_EVENT_RETRIED = "retried"
+const TASK_EVENT_CANCELLED = "cancelled"
+const TASK_EVENT_DEAD_LETTERED = "dead_lettered"
+const DEFAULT_LIST_LIMIT = 100
+const MAX_LIST_LIMIT = 1000
+const CLAIM_CLOCK_SKEW = 5
+const WATCH_POLL_INTERVAL = 1
+const CONNECT_CODE_CANCELED = "canceled"
+const CONNECT_CODE_UNKNOWN = "unknown"
+const CONNECT_CODE_INVALID_ARGUMENT = "invalid_argument"
+const CONNECT_CODE_DEADLINE_EXCEEDED = "deadline_exceeded"
+const CONNECT_CODE_NOT_FOUND = "not_found"
+const CONNECT_CODE_RESOURCE_EXHAUSTED = "resource_exhausted"
+const CONNECT_CODE_FAILED_PRECONDITION = "failed_precondition"
+const CONNECT_CODE_UNIMPLEMENTED = "unimplemented"
+const CONNECT_CODE_INTERNAL = "internal"
+const CONNECT_CODE_UNAVAILABLE = "unavailable"
+const CONNECT_CODE_UNAUTHENTICATED = "unauthenticated"
+const STORAGE_POSTGRES = "postgres"
+const STORAGE_SUPABASE = "supabase"
+const DEFAULT_POOL_LIMIT = 5
+const DEFAULT_WORKERS = 10
+const DEFAULT_QUEUE_SIZE = 10000
+const DEFAULT_ADMIN_LISTEN = "127.0.0.1:8081"
+const TASK_EVENT_CONFIG_CHANGED = "config_changed"
+const TASK_CONFIG_RELOAD_INTERVAL = 60
+const CONFIG_WATCH_INTERVAL = 5
+const RECONCILE_INTERVAL = 30
@@ -0,0 +1,27 @@
+package util
+
+// LoggerWith returns a logger that adds args, alternating keys and values,
+// to every record of logger.
+func LoggerWith(logger Logger, args ...any) Logger {
+	if len(args) == 0 {
+		return logger
+	}
+	if fl, ok := logger.(*fieldLogger); ok {
+		return &fieldLogger{logger: fl.logger, fields: append(fl.fields[:len(fl.fields):len(fl.fields)], args...)}
+	}
+	return &fieldLogger{logger: logger, fields: args}
+}
+
+type fieldLogger struct {
+	logger Logger
+	fields []any
+}
+
+func (l *fieldLogger) with(args []any) []any {
+	return append(l.fields[:len(l.fields):len(l.fields)], args...)
+}
+
+func (l *fieldLogger) Debug(msg string, args ...any) { l.logger.Debug(msg, l.with(args)...) }
+func (l *fieldLogger) Info(msg string, args ...any)  { l.logger.Info(msg, l.with(args)...) }
+func (l *fieldLogger) Warn(msg string, args ...any)  { l.logger.Warn(msg, l.with(args)...) }
+func (l *fieldLogger) Error(msg string, args ...any) { l.logger.Error(msg, l.with(args)...) }
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"math"
+	"time"
+
+	"github.com/amitiwary999/task-scheduler/model"
+)
+
+// RateState is the state of one rate limit. Storage backends keep it as
+// JSON for shared limits, so both algorithms live in one struct.
+type RateState struct {
+	Tokens    float64 `json:"tokens"`
+	UpdatedAt int64   `json:"updatedAt"`
+	Hits      []int64 `json:"hits,omitempty"`
+	Version   int64   `json:"version"`
+}
+
+// Take spends one start of limit at now. It returns zero when the task may
+// start, and otherwise how long to wait before trying again.
+func (s *RateState) Take(limit model.RateLimit, now time.Time) time.Duration {
+	if limit.Limit <= 0 || limit.Window <= 0 {
+		return 0
+	}
+	window := time.Duration(limit.Window) * time.Second
+	nowMs := now.UnixMilli()
+	s.Version++
+	if limit.Algorithm == RATE_LIMIT_SLIDING_WINDOW {
+		start := nowMs - window.Milliseconds()
+		hits := s.Hits[:0]
+		for _, hit := range s.Hits {
+			if hit > start {
+				hits = append(hits, hit)
+			}
+		}
+		s.Hits = hits
+		s.UpdatedAt = nowMs
+		if len(s.Hits) >= limit.Limit {
+			return time.Duration(s.Hits[0]-start) * time.Millisecond
+		}
+		s.Hits = append(s.Hits, nowMs)
+		return 0
+	}
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = float64(limit.Limit)
+	}
+	perMs := float64(limit.Limit) / float64(window.Milliseconds())
+	if s.UpdatedAt == 0 {
+		s.Tokens = burst
+	} else if elapsed := nowMs - s.UpdatedAt; elapsed > 0 {
+		s.Tokens += float64(elapsed) * perMs
+	}
+	if s.Tokens > burst {
+		s.Tokens = burst
+	}
+	s.UpdatedAt = nowMs
+	if s.Tokens < 1 {
+		return time.Duration(math.Ceil((1-s.Tokens)/perMs)) * time.Millisecond
+	}
+	s.Tokens--
+	return 0
+}
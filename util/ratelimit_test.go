@@ -0,0 +1,67 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/amitiwary999/task-scheduler/model"
+)
+
+func TestRateStateTake(t *testing.T) {
+	type take struct {
+		at   time.Duration
+		wait time.Duration
+	}
+	for _, tc := range []struct {
+		name  string
+		limit model.RateLimit
+		takes []take
+	}{
+		{
+			name:  "token bucket starts full",
+			limit: model.RateLimit{Limit: 2, Window: 10},
+			takes: []take{{0, 0}, {0, 0}, {0, 5 * time.Second}},
+		},
+		{
+			name:  "token bucket refills over the window",
+			limit: model.RateLimit{Limit: 2, Window: 10},
+			takes: []take{{0, 0}, {0, 0}, {4 * time.Second, time.Second}, {5 * time.Second, 0}, {5 * time.Second, 5 * time.Second}},
+		},
+		{
+			name:  "token bucket burst",
+			limit: model.RateLimit{Limit: 1, Window: 1, Burst: 3},
+			takes: []take{{0, 0}, {0, 0}, {0, 0}, {0, time.Second}},
+		},
+		{
+			name:  "token bucket refills up to the burst",
+			limit: model.RateLimit{Limit: 1, Window: 1, Burst: 2},
+			takes: []take{{0, 0}, {0, 0}, {time.Minute, 0}, {time.Minute, 0}, {time.Minute, time.Second}},
+		},
+		{
+			name:  "sliding window",
+			limit: model.RateLimit{Algorithm: RATE_LIMIT_SLIDING_WINDOW, Limit: 2, Window: 10},
+			takes: []take{{0, 0}, {3 * time.Second, 0}, {4 * time.Second, 6 * time.Second}, {9 * time.Second, time.Second}},
+		},
+		{
+			name:  "sliding window drops expired hits",
+			limit: model.RateLimit{Algorithm: RATE_LIMIT_SLIDING_WINDOW, Limit: 2, Window: 10},
+			takes: []take{{0, 0}, {3 * time.Second, 0}, {10 * time.Second, 0}, {11 * time.Second, 2 * time.Second}, {13 * time.Second, 0}},
+		},
+		{
+			name:  "no limit",
+			limit: model.RateLimit{},
+			takes: []take{{0, 0}, {0, 0}, {0, 0}},
+		},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			start := time.Unix(1700000000, 0)
+			var state RateState
+			for i, take := range tc.takes {
+				if wait := state.Take(tc.limit, start.Add(take.at)); wait != take.wait {
+					t.Errorf("take %v at %v waits %v, want %v", i, take.at, wait, take.wait)
+				}
+			}
+		})
+	}
+}
@@ -1,13 +1,15 @@
 package util
 
 import (
+	"context"
+	"time"
+
 	"github.com/amitiwary999/task-scheduler/model"
 )
 
 type AMQPConsumer interface {
 	Shutdown()
-	Handle(data chan []byte, queueName string, key string, consumerTag string) error
-	ServerJoinHandle(serverJoin chan []byte, consumerTag string) error
+	Consume(deliveries chan model.Delivery, queueName string, key string, consumerTag string) error
 }
 
 type AMQPProducer interface {
@@ -15,20 +17,111 @@ type AMQPProducer interface {
 	SendTaskMessage(taskId, routingKey string)
 }
 
-type SupabaseClient interface {
-	SaveTask(meta *model.TaskMeta) (string, error)
-	UpdateTaskComplete(id string) error
-	GetAllUsedServer() ([]byte, error)
-	GetTaskConfig() ([]byte, error)
-	GetPendingTask() ([]byte, error)
+type Broker interface {
+	PublishTask(msg model.TaskMessage) error
+	ConsumeTasks(serverId string, deliveries chan model.Delivery) error
+	PublishTaskComplete(msg model.TaskMessage) error
+	ConsumeTaskComplete(serverId string, deliveries chan model.Delivery) error
+	PublishMembership(joinData model.JoinData) error
+	ConsumeMembership(serverId string, deliveries chan model.Delivery) error
+	Shutdown()
+}
+
+// MetricsSink receives the scheduler's metrics. Counters only grow by
+// delta, gauges are set to value and histograms observe value, in seconds
+// for durations.
+type MetricsSink interface {
+	AddCounter(name string, labels map[string]string, delta float64)
+	SetGauge(name string, labels map[string]string, value float64)
+	Observe(name string, labels map[string]string, value float64)
+}
+
+// Tracer starts the spans of a task. Start makes the span a child of the
+// span in ctx; Extract puts the span of a W3C traceparent into ctx, so a
+// task continues the trace it was submitted in, on whichever server it
+// runs.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+	Extract(ctx context.Context, traceParent string) context.Context
+}
+
+type Span interface {
+	SetAttribute(key string, value string)
+	RecordError(err error)
+	// TraceParent is the W3C traceparent of the span.
+	TraceParent() string
+	End()
 }
 
-type PostgClient interface {
+// Logger is the part of *slog.Logger the scheduler logs through, so a
+// *slog.Logger fits as it is. Args are alternating keys and values.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+type TaskListener interface {
+	Listen(events chan model.TaskEvent) error
+	Connected() bool
+}
+
+// StorageClient is implemented by every task store (PostgresDbClient and
+// SupabaseClient), so the manager never knows which backend it is using.
+type StorageClient interface {
 	SaveTask(meta *model.TaskMeta) (string, error)
-	UpdateTaskComplete(id string) error
+	GetTask(id string) (*model.TaskDetail, error)
+	ClaimTask(id string, serverId string) (bool, error)
+	ClaimPendingTasks(serverId string, queue string, known []string, types []string, limit int) ([]model.TaskDetail, error)
+	UpdateTaskComplete(id string, result []byte, next []model.TaskMeta) ([]string, bool, error)
+	UpdateTaskFailed(id string, reason string) (bool, error)
+	RetryTask(id string, reason string, executionTime int64) (bool, error)
+	CancelTask(id string) (bool, error)
+	GetChildTasks(parentId string) ([]model.TaskDetail, error)
+	UpdateServerStatus(serverId string, status int) error
+	RequeueStaleTasks() (int, error)
 	GetAllUsedServer() ([]model.JoinData, error)
 	GetTaskConfig() ([]model.TaskWeight, error)
+	TakeRateToken(taskType string, limit model.RateLimit) (time.Duration, error)
+	DeferTask(id string, executionTime int64) (bool, error)
 	GetPendingTask() ([]model.PendingTask, error)
+	SaveWorkflow(workflow *model.Workflow) (string, error)
+	GetWorkflow(id string) (*model.Workflow, error)
+	ScheduleWorkflowNode(workflowId string, name string, meta model.TaskMeta) (string, bool, error)
+	ScheduleWorkflowCompensation(workflowId string, name string, meta model.TaskMeta) (string, bool, error)
+	UpdateWorkflowNodeStatus(workflowId string, name string, fromStatus []string, status string) (bool, error)
+	UpdateWorkflowStatus(id string, fromStatus string, status string) (bool, error)
+	GetActiveWorkflows() ([]string, error)
+	SetPause(pause model.Pause, paused bool) error
+	GetPauses() ([]model.Pause, error)
+	SaveTaskLog(taskLog model.TaskLog) error
+	GetTaskLogs(taskId string) ([]model.TaskLog, error)
+	ListTasks(filter model.TaskFilter) ([]model.TaskDetail, error)
+	CountTasks() ([]model.TaskCount, error)
+	ReplayTask(id string, executionTime int64) (bool, error)
+	RescheduleTask(id string, executionTime int64) (bool, error)
+	DeleteTask(id string) (bool, error)
+	SaveBatch(batch *model.Batch) ([]string, error)
+	GetBatch(id string) (*model.Batch, error)
+	FinishBatch(id string, callback *model.TaskMeta) (string, bool, error)
+	GetRunningBatches() ([]string, error)
+}
+
+// Codec turns task payloads into the bytes stored in jobdetail. The codec
+// name is saved with the task, so it must stay the same across releases.
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// ConsumerConfig controls how many unacked messages the broker hands to a
+// consumer. Prefetch is normally set to TaskActor.Capacity() so a node never
+// holds more deliveries than it can run or buffer.
+type ConsumerConfig struct {
+	Prefetch           int
+	DeadLetterExchange string
 }
 
 type InitConfig struct {